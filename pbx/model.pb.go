@@ -26,20 +26,26 @@ const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 type InfoNote int32
 
 const (
-	InfoNote_READ InfoNote = 0
-	InfoNote_RECV InfoNote = 1
-	InfoNote_KP   InfoNote = 2
+	InfoNote_READ    InfoNote = 0
+	InfoNote_RECV    InfoNote = 1
+	InfoNote_KP      InfoNote = 2
+	InfoNote_REACT   InfoNote = 3
+	InfoNote_UNREACT InfoNote = 4
 )
 
 var InfoNote_name = map[int32]string{
 	0: "READ",
 	1: "RECV",
 	2: "KP",
+	3: "REACT",
+	4: "UNREACT",
 }
 var InfoNote_value = map[string]int32{
-	"READ": 0,
-	"RECV": 1,
-	"KP":   2,
+	"READ":    0,
+	"RECV":    1,
+	"KP":      2,
+	"REACT":   3,
+	"UNREACT": 4,
 }
 
 func (x InfoNote) String() string {
@@ -111,24 +117,27 @@ func (Crud) EnumDescriptor() ([]byte, []int) {
 }
 
 // What to delete, either "msg" to delete messages (default) or "topic" to delete the topic or "sub"
-// to delete a subscription to topic.
+// to delete a subscription to topic or "sess" to terminate user's sessions.
 type ClientDel_What int32
 
 const (
 	ClientDel_MSG   ClientDel_What = 0
 	ClientDel_TOPIC ClientDel_What = 1
 	ClientDel_SUB   ClientDel_What = 2
+	ClientDel_SESS  ClientDel_What = 3
 )
 
 var ClientDel_What_name = map[int32]string{
 	0: "MSG",
 	1: "TOPIC",
 	2: "SUB",
+	3: "SESS",
 }
 var ClientDel_What_value = map[string]int32{
 	"MSG":   0,
 	"TOPIC": 1,
 	"SUB":   2,
+	"SESS":  3,
 }
 
 func (x ClientDel_What) String() string {
@@ -460,7 +469,11 @@ type GetOpts struct {
 	// Load messages with seq id lower than this
 	BeforeId int32 `protobuf:"varint,5,opt,name=before_id,json=beforeId" json:"before_id,omitempty"`
 	// Maximum number of results to return
-	Limit                int32    `protobuf:"varint,6,opt,name=limit" json:"limit,omitempty"`
+	Limit int32 `protobuf:"varint,6,opt,name=limit" json:"limit,omitempty"`
+	// Load only replies to the message with this seq id
+	Thread int32 `protobuf:"varint,7,opt,name=thread" json:"thread,omitempty"`
+	// Full-text search query
+	Query                string   `protobuf:"bytes,8,opt,name=query" json:"query,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -531,6 +544,18 @@ func (m *GetOpts) GetLimit() int32 {
 	}
 	return 0
 }
+func (m *GetOpts) GetThread() int32 {
+	if m != nil {
+		return m.Thread
+	}
+	return 0
+}
+func (m *GetOpts) GetQuery() string {
+	if m != nil {
+		return m.Query
+	}
+	return ""
+}
 
 type GetQuery struct {
 	What string `protobuf:"bytes,1,opt,name=what" json:"what,omitempty"`
@@ -539,7 +564,9 @@ type GetQuery struct {
 	// Parameters of "sub" request
 	Sub *GetOpts `protobuf:"bytes,3,opt,name=sub" json:"sub,omitempty"`
 	// Parameters of "data" request
-	Data                 *GetOpts `protobuf:"bytes,4,opt,name=data" json:"data,omitempty"`
+	Data *GetOpts `protobuf:"bytes,4,opt,name=data" json:"data,omitempty"`
+	// Parameters of "search" request
+	Search               *GetOpts `protobuf:"bytes,5,opt,name=search" json:"search,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -596,6 +623,12 @@ func (m *GetQuery) GetData() *GetOpts {
 	}
 	return nil
 }
+func (m *GetQuery) GetSearch() *GetOpts {
+	if m != nil {
+		return m.Search
+	}
+	return nil
+}
 
 type SetQuery struct {
 	// Topic metadata, new topic & new subscriptions only
@@ -603,10 +636,12 @@ type SetQuery struct {
 	// Subscription parameters
 	Sub *SetSub `protobuf:"bytes,2,opt,name=sub" json:"sub,omitempty"`
 	// Indexable tags
-	Tags                 []string `protobuf:"bytes,3,rep,name=tags" json:"tags,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	Tags []string `protobuf:"bytes,3,rep,name=tags" json:"tags,omitempty"`
+	// Preferences of push notifications
+	Notify               *NotifyPrefs `protobuf:"bytes,4,opt,name=notify" json:"notify,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
 }
 
 func (m *SetQuery) Reset()         { *m = SetQuery{} }
@@ -653,6 +688,12 @@ func (m *SetQuery) GetTags() []string {
 	}
 	return nil
 }
+func (m *SetQuery) GetNotify() *NotifyPrefs {
+	if m != nil {
+		return m.Notify
+	}
+	return nil
+}
 
 type SeqRange struct {
 	Low                  int32    `protobuf:"varint,1,opt,name=low" json:"low,omitempty"`
@@ -1127,14 +1168,16 @@ func (m *ClientLeave) GetUnsub() bool {
 
 // ClientPub is client's request to publish data to topic subscribers {pub}
 type ClientPub struct {
-	Id                   string            `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
-	Topic                string            `protobuf:"bytes,2,opt,name=topic" json:"topic,omitempty"`
-	NoEcho               bool              `protobuf:"varint,3,opt,name=no_echo,json=noEcho" json:"no_echo,omitempty"`
-	Head                 map[string][]byte `protobuf:"bytes,4,rep,name=head" json:"head,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value,proto3"`
-	Content              []byte            `protobuf:"bytes,5,opt,name=content,proto3" json:"content,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
-	XXX_unrecognized     []byte            `json:"-"`
-	XXX_sizecache        int32             `json:"-"`
+	Id      string            `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Topic   string            `protobuf:"bytes,2,opt,name=topic" json:"topic,omitempty"`
+	NoEcho  bool              `protobuf:"varint,3,opt,name=no_echo,json=noEcho" json:"no_echo,omitempty"`
+	Head    map[string][]byte `protobuf:"bytes,4,rep,name=head" json:"head,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Content []byte            `protobuf:"bytes,5,opt,name=content,proto3" json:"content,omitempty"`
+	// Seq id of the message being replied to
+	ReplyTo              int32    `protobuf:"varint,6,opt,name=reply_to,json=replyTo" json:"reply_to,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *ClientPub) Reset()         { *m = ClientPub{} }
@@ -1195,6 +1238,12 @@ func (m *ClientPub) GetContent() []byte {
 	}
 	return nil
 }
+func (m *ClientPub) GetReplyTo() int32 {
+	if m != nil {
+		return m.ReplyTo
+	}
+	return 0
+}
 
 // Query topic state {get}
 type ClientGet struct {
@@ -1316,7 +1365,9 @@ type ClientDel struct {
 	// User ID of the subscription to delete
 	UserId string `protobuf:"bytes,5,opt,name=user_id,json=userId" json:"user_id,omitempty"`
 	// Request to hard-delete messages for all users, if such option is available.
-	Hard                 bool     `protobuf:"varint,6,opt,name=hard" json:"hard,omitempty"`
+	Hard bool `protobuf:"varint,6,opt,name=hard" json:"hard,omitempty"`
+	// ID of the session to terminate; all other sessions of the user if missing.
+	Sess                 string   `protobuf:"bytes,7,opt,name=sess" json:"sess,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -1387,6 +1438,12 @@ func (m *ClientDel) GetHard() bool {
 	}
 	return false
 }
+func (m *ClientDel) GetSess() string {
+	if m != nil {
+		return m.Sess
+	}
+	return ""
+}
 
 // ClientNote is a client-generated notification for topic subscribers
 type ClientNote struct {
@@ -1394,7 +1451,9 @@ type ClientNote struct {
 	// what is being reported: "recv" - message received, "read" - message read, "kp" - typing notification
 	What InfoNote `protobuf:"varint,2,opt,name=what,enum=pbx.InfoNote" json:"what,omitempty"`
 	// Server-issued message ID being reported
-	SeqId                int32    `protobuf:"varint,3,opt,name=seq_id,json=seqId" json:"seq_id,omitempty"`
+	SeqId int32 `protobuf:"varint,3,opt,name=seq_id,json=seqId" json:"seq_id,omitempty"`
+	// Reaction being added or removed, "react" and "unreact" only
+	React                string   `protobuf:"bytes,4,opt,name=react" json:"react,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -1445,6 +1504,13 @@ func (m *ClientNote) GetSeqId() int32 {
 	return 0
 }
 
+func (m *ClientNote) GetReact() string {
+	if m != nil {
+		return m.React
+	}
+	return ""
+}
+
 type ClientMsg struct {
 	// Types that are valid to be assigned to Message:
 	//	*ClientMsg_Hi
@@ -1849,6 +1915,7 @@ type TopicDesc struct {
 	DelId                int32           `protobuf:"varint,9,opt,name=del_id,json=delId" json:"del_id,omitempty"`
 	Public               []byte          `protobuf:"bytes,10,opt,name=public,proto3" json:"public,omitempty"`
 	Private              []byte          `protobuf:"bytes,11,opt,name=private,proto3" json:"private,omitempty"`
+	Notify               *NotifyPrefs    `protobuf:"bytes,12,opt,name=notify" json:"notify,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
 	XXX_unrecognized     []byte          `json:"-"`
 	XXX_sizecache        int32           `json:"-"`
@@ -1954,6 +2021,12 @@ func (m *TopicDesc) GetPrivate() []byte {
 	}
 	return nil
 }
+func (m *TopicDesc) GetNotify() *NotifyPrefs {
+	if m != nil {
+		return m.Notify
+	}
+	return nil
+}
 
 // MsgTopicSub: topic subscription details, sent in Meta message
 type TopicSub struct {
@@ -1975,8 +2048,10 @@ type TopicSub struct {
 	// Messages are deleted up to this ID
 	DelId int32 `protobuf:"varint,13,opt,name=del_id,json=delId" json:"del_id,omitempty"`
 	// Other user's last online timestamp & user agent
-	LastSeenTime         int64    `protobuf:"varint,14,opt,name=last_seen_time,json=lastSeenTime" json:"last_seen_time,omitempty"`
-	LastSeenUserAgent    string   `protobuf:"bytes,15,opt,name=last_seen_user_agent,json=lastSeenUserAgent" json:"last_seen_user_agent,omitempty"`
+	LastSeenTime      int64  `protobuf:"varint,14,opt,name=last_seen_time,json=lastSeenTime" json:"last_seen_time,omitempty"`
+	LastSeenUserAgent string `protobuf:"bytes,15,opt,name=last_seen_user_agent,json=lastSeenUserAgent" json:"last_seen_user_agent,omitempty"`
+	// Count of unread messages which mention the user, own subscriptions only
+	Mentions             int32    `protobuf:"varint,16,opt,name=mentions" json:"mentions,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -2110,6 +2185,12 @@ func (m *TopicSub) GetLastSeenUserAgent() string {
 	}
 	return ""
 }
+func (m *TopicSub) GetMentions() int32 {
+	if m != nil {
+		return m.Mentions
+	}
+	return 0
+}
 
 type DelValues struct {
 	DelId                int32       `protobuf:"varint,1,opt,name=del_id,json=delId" json:"del_id,omitempty"`
@@ -2234,13 +2315,19 @@ type ServerData struct {
 	// ID of the user who originated the message as {pub}, could be empty if sent by the system
 	FromUserId string `protobuf:"bytes,2,opt,name=from_user_id,json=fromUserId" json:"from_user_id,omitempty"`
 	// Timestamp when the message was deleted or 0. Milliseconds since the epoch 01/01/1970
-	DeletedAt            int64             `protobuf:"varint,3,opt,name=deleted_at,json=deletedAt" json:"deleted_at,omitempty"`
-	SeqId                int32             `protobuf:"varint,4,opt,name=seq_id,json=seqId" json:"seq_id,omitempty"`
-	Head                 map[string][]byte `protobuf:"bytes,5,rep,name=head" json:"head,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value,proto3"`
-	Content              []byte            `protobuf:"bytes,6,opt,name=content,proto3" json:"content,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
-	XXX_unrecognized     []byte            `json:"-"`
-	XXX_sizecache        int32             `json:"-"`
+	DeletedAt int64             `protobuf:"varint,3,opt,name=deleted_at,json=deletedAt" json:"deleted_at,omitempty"`
+	SeqId     int32             `protobuf:"varint,4,opt,name=seq_id,json=seqId" json:"seq_id,omitempty"`
+	Head      map[string][]byte `protobuf:"bytes,5,rep,name=head" json:"head,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Content   []byte            `protobuf:"bytes,6,opt,name=content,proto3" json:"content,omitempty"`
+	// Seq id of the thread root if the message is a reply
+	ReplyTo int32 `protobuf:"varint,7,opt,name=reply_to,json=replyTo" json:"reply_to,omitempty"`
+	// Number of replies to the message
+	ReplyCount int32 `protobuf:"varint,8,opt,name=reply_count,json=replyCount" json:"reply_count,omitempty"`
+	// Timestamp of the latest reply. Milliseconds since the epoch 01/01/1970
+	LastReplyAt          int64    `protobuf:"varint,9,opt,name=last_reply_at,json=lastReplyAt" json:"last_reply_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *ServerData) Reset()         { *m = ServerData{} }
@@ -2308,6 +2395,24 @@ func (m *ServerData) GetContent() []byte {
 	}
 	return nil
 }
+func (m *ServerData) GetReplyTo() int32 {
+	if m != nil {
+		return m.ReplyTo
+	}
+	return 0
+}
+func (m *ServerData) GetReplyCount() int32 {
+	if m != nil {
+		return m.ReplyCount
+	}
+	return 0
+}
+func (m *ServerData) GetLastReplyAt() int64 {
+	if m != nil {
+		return m.LastReplyAt
+	}
+	return 0
+}
 
 // {pres} message
 type ServerPres struct {
@@ -2422,14 +2527,18 @@ func (m *ServerPres) GetAcs() *AccessMode {
 
 // {meta} message
 type ServerMeta struct {
-	Id                   string      `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
-	Topic                string      `protobuf:"bytes,2,opt,name=topic" json:"topic,omitempty"`
-	Desc                 *TopicDesc  `protobuf:"bytes,3,opt,name=desc" json:"desc,omitempty"`
-	Sub                  []*TopicSub `protobuf:"bytes,4,rep,name=sub" json:"sub,omitempty"`
-	Del                  *DelValues  `protobuf:"bytes,5,opt,name=del" json:"del,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
-	XXX_unrecognized     []byte      `json:"-"`
-	XXX_sizecache        int32       `json:"-"`
+	Id    string      `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Topic string      `protobuf:"bytes,2,opt,name=topic" json:"topic,omitempty"`
+	Desc  *TopicDesc  `protobuf:"bytes,3,opt,name=desc" json:"desc,omitempty"`
+	Sub   []*TopicSub `protobuf:"bytes,4,rep,name=sub" json:"sub,omitempty"`
+	Del   *DelValues  `protobuf:"bytes,5,opt,name=del" json:"del,omitempty"`
+	// Messages found by full-text search
+	Search []*ServerData `protobuf:"bytes,6,rep,name=search" json:"search,omitempty"`
+	// Live sessions of the user
+	Sess                 []*SessionInfo `protobuf:"bytes,7,rep,name=sess" json:"sess,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
 }
 
 func (m *ServerMeta) Reset()         { *m = ServerMeta{} }
@@ -2490,6 +2599,18 @@ func (m *ServerMeta) GetDel() *DelValues {
 	}
 	return nil
 }
+func (m *ServerMeta) GetSearch() []*ServerData {
+	if m != nil {
+		return m.Search
+	}
+	return nil
+}
+func (m *ServerMeta) GetSess() []*SessionInfo {
+	if m != nil {
+		return m.Sess
+	}
+	return nil
+}
 
 // {info} message: server-side copy of ClientNote with From added
 type ServerInfo struct {
@@ -2497,6 +2618,7 @@ type ServerInfo struct {
 	FromUserId           string   `protobuf:"bytes,2,opt,name=from_user_id,json=fromUserId" json:"from_user_id,omitempty"`
 	What                 InfoNote `protobuf:"varint,3,opt,name=what,enum=pbx.InfoNote" json:"what,omitempty"`
 	SeqId                int32    `protobuf:"varint,4,opt,name=seq_id,json=seqId" json:"seq_id,omitempty"`
+	React                string   `protobuf:"bytes,5,opt,name=react" json:"react,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -2554,6 +2676,13 @@ func (m *ServerInfo) GetSeqId() int32 {
 	return 0
 }
 
+func (m *ServerInfo) GetReact() string {
+	if m != nil {
+		return m.React
+	}
+	return ""
+}
+
 // Cumulative message
 type ServerMsg struct {
 	// Types that are valid to be assigned to Message:
@@ -3345,6 +3474,209 @@ func (m *MessageEvent) GetMsg() *ServerData {
 	return nil
 }
 
+// Live session of the user, an element of ServerMeta.sess
+type SessionInfo struct {
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	// This is the session which requested the list
+	Current    bool   `protobuf:"varint,2,opt,name=current" json:"current,omitempty"`
+	DeviceId   string `protobuf:"bytes,3,opt,name=device_id,json=deviceId" json:"device_id,omitempty"`
+	Lang       string `protobuf:"bytes,4,opt,name=lang" json:"lang,omitempty"`
+	UserAgent  string `protobuf:"bytes,5,opt,name=user_agent,json=userAgent" json:"user_agent,omitempty"`
+	RemoteAddr string `protobuf:"bytes,6,opt,name=remote_addr,json=remoteAddr" json:"remote_addr,omitempty"`
+	// Time of the last message from the client
+	LastSeen             int64    `protobuf:"varint,7,opt,name=last_seen,json=lastSeen" json:"last_seen,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SessionInfo) Reset()         { *m = SessionInfo{} }
+func (m *SessionInfo) String() string { return proto.CompactTextString(m) }
+func (*SessionInfo) ProtoMessage()    {}
+func (*SessionInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_model_be39e3c871441b6d, []int{39}
+}
+func (m *SessionInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SessionInfo.Unmarshal(m, b)
+}
+func (m *SessionInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SessionInfo.Marshal(b, m, deterministic)
+}
+func (dst *SessionInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SessionInfo.Merge(dst, src)
+}
+func (m *SessionInfo) XXX_Size() int {
+	return xxx_messageInfo_SessionInfo.Size(m)
+}
+func (m *SessionInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_SessionInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SessionInfo proto.InternalMessageInfo
+
+func (m *SessionInfo) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *SessionInfo) GetCurrent() bool {
+	if m != nil {
+		return m.Current
+	}
+	return false
+}
+
+func (m *SessionInfo) GetDeviceId() string {
+	if m != nil {
+		return m.DeviceId
+	}
+	return ""
+}
+
+func (m *SessionInfo) GetLang() string {
+	if m != nil {
+		return m.Lang
+	}
+	return ""
+}
+
+func (m *SessionInfo) GetUserAgent() string {
+	if m != nil {
+		return m.UserAgent
+	}
+	return ""
+}
+
+func (m *SessionInfo) GetRemoteAddr() string {
+	if m != nil {
+		return m.RemoteAddr
+	}
+	return ""
+}
+
+func (m *SessionInfo) GetLastSeen() int64 {
+	if m != nil {
+		return m.LastSeen
+	}
+	return 0
+}
+
+// Daily period without push notifications, an element of NotifyPrefs
+type QuietHours struct {
+	// Start and end of the period as HH:MM
+	From string `protobuf:"bytes,1,opt,name=from" json:"from,omitempty"`
+	To   string `protobuf:"bytes,2,opt,name=to" json:"to,omitempty"`
+	// IANA time zone name
+	Tz                   string   `protobuf:"bytes,3,opt,name=tz" json:"tz,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *QuietHours) Reset()         { *m = QuietHours{} }
+func (m *QuietHours) String() string { return proto.CompactTextString(m) }
+func (*QuietHours) ProtoMessage()    {}
+func (*QuietHours) Descriptor() ([]byte, []int) {
+	return fileDescriptor_model_be39e3c871441b6d, []int{40}
+}
+func (m *QuietHours) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_QuietHours.Unmarshal(m, b)
+}
+func (m *QuietHours) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_QuietHours.Marshal(b, m, deterministic)
+}
+func (dst *QuietHours) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_QuietHours.Merge(dst, src)
+}
+func (m *QuietHours) XXX_Size() int {
+	return xxx_messageInfo_QuietHours.Size(m)
+}
+func (m *QuietHours) XXX_DiscardUnknown() {
+	xxx_messageInfo_QuietHours.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_QuietHours proto.InternalMessageInfo
+
+func (m *QuietHours) GetFrom() string {
+	if m != nil {
+		return m.From
+	}
+	return ""
+}
+
+func (m *QuietHours) GetTo() string {
+	if m != nil {
+		return m.To
+	}
+	return ""
+}
+
+func (m *QuietHours) GetTz() string {
+	if m != nil {
+		return m.Tz
+	}
+	return ""
+}
+
+// Preferences of push notifications
+type NotifyPrefs struct {
+	// Mute notifications until this time, milliseconds since epoch. Time in the past unmutes.
+	Mute int64 `protobuf:"varint,1,opt,name=mute" json:"mute,omitempty"`
+	// Notify only of mentions
+	Mentions             bool        `protobuf:"varint,2,opt,name=mentions" json:"mentions,omitempty"`
+	Quiet                *QuietHours `protobuf:"bytes,3,opt,name=quiet" json:"quiet,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *NotifyPrefs) Reset()         { *m = NotifyPrefs{} }
+func (m *NotifyPrefs) String() string { return proto.CompactTextString(m) }
+func (*NotifyPrefs) ProtoMessage()    {}
+func (*NotifyPrefs) Descriptor() ([]byte, []int) {
+	return fileDescriptor_model_be39e3c871441b6d, []int{41}
+}
+func (m *NotifyPrefs) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_NotifyPrefs.Unmarshal(m, b)
+}
+func (m *NotifyPrefs) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_NotifyPrefs.Marshal(b, m, deterministic)
+}
+func (dst *NotifyPrefs) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_NotifyPrefs.Merge(dst, src)
+}
+func (m *NotifyPrefs) XXX_Size() int {
+	return xxx_messageInfo_NotifyPrefs.Size(m)
+}
+func (m *NotifyPrefs) XXX_DiscardUnknown() {
+	xxx_messageInfo_NotifyPrefs.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_NotifyPrefs proto.InternalMessageInfo
+
+func (m *NotifyPrefs) GetMute() int64 {
+	if m != nil {
+		return m.Mute
+	}
+	return 0
+}
+
+func (m *NotifyPrefs) GetMentions() bool {
+	if m != nil {
+		return m.Mentions
+	}
+	return false
+}
+
+func (m *NotifyPrefs) GetQuiet() *QuietHours {
+	if m != nil {
+		return m.Quiet
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Unused)(nil), "pbx.Unused")
 	proto.RegisterType((*DefaultAcsMode)(nil), "pbx.DefaultAcsMode")
@@ -3388,6 +3720,9 @@ func init() {
 	proto.RegisterType((*AccountEvent)(nil), "pbx.AccountEvent")
 	proto.RegisterType((*SubscriptionEvent)(nil), "pbx.SubscriptionEvent")
 	proto.RegisterType((*MessageEvent)(nil), "pbx.MessageEvent")
+	proto.RegisterType((*SessionInfo)(nil), "pbx.SessionInfo")
+	proto.RegisterType((*QuietHours)(nil), "pbx.QuietHours")
+	proto.RegisterType((*NotifyPrefs)(nil), "pbx.NotifyPrefs")
 	proto.RegisterEnum("pbx.InfoNote", InfoNote_name, InfoNote_value)
 	proto.RegisterEnum("pbx.RespCode", RespCode_name, RespCode_value)
 	proto.RegisterEnum("pbx.Crud", Crud_name, Crud_value)
@@ -3756,157 +4091,177 @@ var _Plugin_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("model.proto", fileDescriptor_model_be39e3c871441b6d) }
 
 var fileDescriptor_model_be39e3c871441b6d = []byte{
-	// 2432 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x39, 0xcd, 0x72, 0xe3, 0x58,
-	0xd5, 0xb6, 0x65, 0xcb, 0xd2, 0x71, 0x26, 0x51, 0xdf, 0x2f, 0xdf, 0x8c, 0x27, 0x53, 0x33, 0x93,
-	0x56, 0xcf, 0x4f, 0x2a, 0xdd, 0x13, 0xa8, 0x6e, 0x1a, 0x06, 0x98, 0x8d, 0x27, 0x76, 0x27, 0x81,
-	0x24, 0x36, 0x72, 0xd2, 0x6c, 0xa8, 0x72, 0xc9, 0xd2, 0x8d, 0xad, 0x1a, 0x59, 0x72, 0xa4, 0x2b,
-	0x4f, 0x77, 0x15, 0x45, 0x15, 0xec, 0xe0, 0x0d, 0x58, 0xb1, 0x63, 0xc5, 0xbc, 0x00, 0x8f, 0x30,
-	0x6c, 0x61, 0xc1, 0x43, 0xf0, 0x06, 0x2c, 0xa8, 0x73, 0x7f, 0x64, 0xc9, 0x89, 0x43, 0x1a, 0xd8,
-	0xdd, 0x7b, 0xce, 0xf1, 0xf9, 0xff, 0xd3, 0x35, 0xb4, 0x66, 0xb1, 0x4f, 0xc3, 0x83, 0x79, 0x12,
-	0xb3, 0x98, 0x68, 0xf3, 0xf1, 0x2b, 0xdb, 0x00, 0xfd, 0x32, 0xca, 0x52, 0xea, 0xdb, 0x9f, 0xc3,
-	0x66, 0x97, 0x5e, 0xb9, 0x59, 0xc8, 0x3a, 0x5e, 0x7a, 0x16, 0xfb, 0x94, 0x10, 0xa8, 0xbb, 0x19,
-	0x9b, 0xb6, 0xab, 0xbb, 0xd5, 0x3d, 0xd3, 0xe1, 0x67, 0x0e, 0x8b, 0xe2, 0xa8, 0x5d, 0x93, 0xb0,
-	0x28, 0x8e, 0xec, 0xef, 0x03, 0x74, 0x3c, 0x8f, 0xa6, 0xf9, 0xaf, 0xbe, 0x76, 0x23, 0xa6, 0x7e,
-	0x85, 0x67, 0xb2, 0x0d, 0x8d, 0x49, 0xb0, 0xa0, 0xea, 0x67, 0xe2, 0x62, 0x3f, 0x07, 0x7d, 0x48,
-	0xd9, 0x30, 0x1b, 0x93, 0x77, 0xa0, 0x99, 0xa5, 0x34, 0x19, 0x05, 0xbe, 0xfc, 0x99, 0x8e, 0xd7,
-	0x13, 0x1f, 0x99, 0xa1, 0xca, 0x4a, 0x1c, 0x9e, 0xed, 0x6b, 0x68, 0x0e, 0x29, 0xeb, 0xd2, 0xd4,
-	0x23, 0xdf, 0x83, 0x96, 0x2f, 0x74, 0x1e, 0xb9, 0x5e, 0xca, 0x7f, 0xdb, 0x7a, 0xfa, 0x7f, 0x07,
-	0xf3, 0xf1, 0xab, 0x83, 0xb2, 0x2d, 0x0e, 0xf8, 0xf9, 0x9d, 0xbc, 0x0d, 0xfa, 0x3c, 0x1b, 0x87,
-	0x81, 0xc7, 0xd9, 0x6e, 0x38, 0xf2, 0x46, 0xda, 0xd0, 0x9c, 0x27, 0xc1, 0xc2, 0x65, 0xb4, 0xad,
-	0x71, 0x84, 0xba, 0xda, 0xdf, 0x54, 0xa1, 0x79, 0x44, 0x59, 0x7f, 0xce, 0x52, 0xb2, 0x0f, 0x0f,
-	0x82, 0xab, 0xd1, 0x2c, 0xf6, 0x83, 0xab, 0x80, 0xfa, 0xa3, 0x34, 0x88, 0x3c, 0xca, 0x25, 0x6b,
-	0xce, 0x56, 0x70, 0x75, 0x26, 0xe1, 0x43, 0x04, 0xa3, 0xfa, 0x68, 0x88, 0x52, 0x1f, 0xcf, 0xe8,
-	0x0b, 0x16, 0xcf, 0x03, 0x8f, 0xcb, 0x30, 0x1d, 0x71, 0x21, 0xef, 0x82, 0xc1, 0x39, 0xa1, 0x0b,
-	0xea, 0xbb, 0xd5, 0xbd, 0x86, 0xd3, 0xe4, 0xf7, 0x13, 0x9f, 0xbc, 0x07, 0xe6, 0x98, 0x5e, 0xc5,
-	0x09, 0xc7, 0x35, 0x38, 0xce, 0x10, 0x80, 0x13, 0x1f, 0xb9, 0x85, 0xc1, 0x2c, 0x60, 0x6d, 0x9d,
-	0x23, 0xc4, 0xc5, 0xfe, 0x4d, 0x15, 0x8c, 0x23, 0xca, 0x7e, 0x96, 0xd1, 0xe4, 0x35, 0x0f, 0xc8,
-	0xd4, 0x5d, 0x06, 0x64, 0xea, 0x32, 0xb2, 0x0b, 0x75, 0x9f, 0xa6, 0xc2, 0x01, 0xad, 0xa7, 0x1b,
-	0xdc, 0x63, 0xd2, 0x40, 0x87, 0x63, 0xc8, 0x07, 0xa0, 0xa5, 0xd9, 0x98, 0x2b, 0xb9, 0x4a, 0x80,
-	0x08, 0xce, 0xc1, 0x65, 0x2e, 0x57, 0xf6, 0x26, 0x07, 0x97, 0xb9, 0xf6, 0x08, 0x8c, 0xa1, 0xd2,
-	0x41, 0xc9, 0xab, 0x16, 0xa8, 0x65, 0x10, 0xa5, 0xbc, 0xf7, 0x85, 0x3c, 0xa1, 0x50, 0x4b, 0x11,
-	0x0c, 0xb3, 0xb1, 0x10, 0x47, 0xa0, 0xce, 0xdc, 0x49, 0xda, 0xd6, 0x76, 0x35, 0x34, 0x02, 0xcf,
-	0xf6, 0x13, 0x14, 0x70, 0xed, 0xb8, 0xd1, 0x84, 0x12, 0x0b, 0xb4, 0x30, 0xfe, 0x9a, 0xf3, 0x6f,
-	0x38, 0x78, 0x24, 0x9b, 0x50, 0x9b, 0x06, 0x9c, 0x5f, 0xc3, 0xa9, 0x4d, 0x03, 0x3b, 0x02, 0x38,
-	0x4c, 0xa8, 0x4f, 0x23, 0x16, 0xb8, 0x21, 0xe6, 0xc0, 0x8c, 0xb2, 0x69, 0x9c, 0x27, 0x9c, 0xb8,
-	0xa1, 0x3f, 0x17, 0x6e, 0x98, 0xa9, 0x8c, 0x13, 0x17, 0xb2, 0x03, 0x46, 0x42, 0xd3, 0x79, 0x1c,
-	0xa5, 0x54, 0x86, 0x2d, 0xbf, 0xf3, 0x6c, 0x72, 0x13, 0x77, 0x96, 0x72, 0x57, 0x60, 0x36, 0xf1,
-	0x9b, 0xfd, 0x4b, 0x30, 0x0e, 0xc3, 0x80, 0x46, 0xec, 0x38, 0x40, 0x5d, 0xf2, 0xd4, 0xae, 0x05,
-	0x3e, 0x79, 0x1f, 0x80, 0xe7, 0xbb, 0x3b, 0xa1, 0x11, 0x93, 0xa2, 0x4c, 0x84, 0x74, 0x10, 0x80,
-	0xc6, 0x2c, 0x68, 0x22, 0x25, 0xe1, 0x11, 0x73, 0xc0, 0xa7, 0x8b, 0x60, 0x99, 0x1f, 0xa6, 0x63,
-	0x08, 0x80, 0x28, 0x92, 0xd0, 0x8d, 0x26, 0x3c, 0x37, 0x4c, 0x87, 0x9f, 0xed, 0xbf, 0x55, 0xc1,
-	0x14, 0xe2, 0x3b, 0x9e, 0x77, 0x43, 0x7e, 0xa1, 0xde, 0x6a, 0xa5, 0x7a, 0x7b, 0x1b, 0xf4, 0xd4,
-	0x9b, 0xd2, 0x99, 0x32, 0x53, 0xde, 0x38, 0x9c, 0x7a, 0x09, 0x65, 0xca, 0x48, 0x71, 0xe3, 0xe9,
-	0x17, 0x4f, 0x82, 0x88, 0xcb, 0x36, 0x1c, 0x71, 0xc9, 0x83, 0xa5, 0x2f, 0x83, 0x95, 0x67, 0x40,
-	0x73, 0x6d, 0x06, 0x3c, 0x82, 0xba, 0x97, 0x50, 0xbf, 0x6d, 0xec, 0x6a, 0x7b, 0xad, 0xa7, 0x5b,
-	0x9c, 0x62, 0x19, 0x31, 0x87, 0x23, 0xed, 0x04, 0x5a, 0xc2, 0xac, 0x53, 0x2e, 0x69, 0xd5, 0xb0,
-	0xa5, 0xfe, 0xb5, 0x35, 0xfa, 0x6b, 0x25, 0xfd, 0x95, 0xcc, 0xfa, 0x5d, 0x32, 0x7f, 0x9b, 0xfb,
-	0x12, 0x7b, 0xd5, 0xaa, 0xc8, 0xbc, 0x9e, 0x6b, 0xc5, 0x7a, 0xde, 0x07, 0x33, 0xa5, 0x6c, 0x74,
-	0x8d, 0xd9, 0x2f, 0x8b, 0xe8, 0x2d, 0x65, 0x33, 0x2f, 0x09, 0xc7, 0x48, 0x55, 0x71, 0xec, 0x83,
-	0x39, 0xc9, 0x69, 0xeb, 0x05, 0xda, 0xa3, 0x9c, 0x76, 0x22, 0x4f, 0xf6, 0x49, 0x6e, 0x3f, 0x75,
-	0x17, 0xf4, 0x9e, 0xca, 0x6c, 0x43, 0x23, 0x8b, 0x54, 0x35, 0x1b, 0x8e, 0xb8, 0xd8, 0x7f, 0xc9,
-	0xcd, 0x1a, 0xdc, 0xdb, 0xac, 0x77, 0xa0, 0x19, 0xc5, 0x23, 0xea, 0x4d, 0x63, 0xc9, 0x4b, 0x8f,
-	0xe2, 0x9e, 0x37, 0x8d, 0xc9, 0x13, 0xa8, 0x4f, 0xa9, 0xab, 0x1c, 0xd9, 0x16, 0x8e, 0x54, 0xcc,
-	0x0f, 0x8e, 0xa9, 0xeb, 0xf7, 0x22, 0x96, 0xbc, 0x76, 0x38, 0x15, 0x76, 0x5a, 0x2f, 0x8e, 0x18,
-	0x26, 0x7f, 0x43, 0x74, 0x5a, 0x79, 0xdd, 0xf9, 0x01, 0x98, 0x39, 0x31, 0xd6, 0xc1, 0x57, 0xf4,
-	0xb5, 0x54, 0x0a, 0x8f, 0xe5, 0xf2, 0xdc, 0x90, 0xe5, 0xf9, 0xa3, 0xda, 0xe7, 0x55, 0xfb, 0xa5,
-	0x32, 0xe6, 0x88, 0xb2, 0x7b, 0x1a, 0xf3, 0x08, 0x1a, 0x37, 0xe3, 0x93, 0xfb, 0x5c, 0xe0, 0x96,
-	0x7c, 0x87, 0xff, 0x1d, 0xdf, 0xe1, 0x0a, 0xdf, 0xbf, 0xe6, 0xde, 0xef, 0xd2, 0xf0, 0x9e, 0x8c,
-	0x3f, 0x95, 0x9d, 0x1c, 0xf9, 0x6e, 0xca, 0x39, 0x97, 0xf3, 0x38, 0xf8, 0xf9, 0xd4, 0x65, 0xb2,
-	0xbd, 0x7f, 0x02, 0x4d, 0x9f, 0x86, 0xa3, 0x94, 0x5e, 0xcb, 0x80, 0x28, 0x1d, 0x44, 0xb7, 0x74,
-	0x74, 0x9f, 0x86, 0x43, 0x7a, 0x5d, 0xec, 0x03, 0x8d, 0xd5, 0xb9, 0x3b, 0x75, 0x13, 0x9f, 0x4f,
-	0x15, 0xc3, 0xe1, 0x67, 0xfb, 0x11, 0xd4, 0x51, 0x04, 0x69, 0x82, 0x76, 0x36, 0x3c, 0xb2, 0x2a,
-	0xc4, 0x84, 0xc6, 0x45, 0x7f, 0x70, 0x72, 0x68, 0x55, 0x11, 0x36, 0xbc, 0xfc, 0xd2, 0xaa, 0xd9,
-	0xbf, 0x00, 0x10, 0x1a, 0x9d, 0xc7, 0x8c, 0x2e, 0xcd, 0xa8, 0x16, 0xcd, 0x78, 0x28, 0xcd, 0xa8,
-	0x71, 0x33, 0x84, 0x6a, 0x27, 0xd1, 0x55, 0x8c, 0x3f, 0x91, 0x06, 0xfc, 0x3f, 0xd6, 0xeb, 0x35,
-	0xea, 0xa5, 0x89, 0xb9, 0x96, 0xd2, 0xeb, 0x13, 0xdf, 0xfe, 0x9d, 0xa6, 0x9c, 0x76, 0x96, 0x4e,
-	0xc8, 0x87, 0xbc, 0xc3, 0x57, 0x0b, 0x4e, 0x56, 0x0d, 0xf7, 0xb8, 0x82, 0x2d, 0x9f, 0xd8, 0xa0,
-	0xb9, 0x9e, 0x1a, 0x72, 0x9b, 0x05, 0x8a, 0x8e, 0xe7, 0x1d, 0x57, 0x1c, 0x44, 0x92, 0x3d, 0xd5,
-	0xc1, 0x44, 0xb0, 0xac, 0x02, 0x15, 0x6f, 0x31, 0xc7, 0x15, 0xd5, 0xd5, 0x6c, 0x31, 0xa1, 0xea,
-	0x37, 0xb8, 0x0d, 0xb3, 0x31, 0x72, 0xc3, 0x31, 0x85, 0xdc, 0xb0, 0x30, 0xb9, 0x3b, 0x57, 0xb8,
-	0x21, 0x9c, 0x73, 0xe3, 0x95, 0x6b, 0x83, 0x36, 0xcf, 0xc6, 0xdc, 0xc1, 0x65, 0x6e, 0x03, 0xc1,
-	0x6d, 0x9e, 0x8d, 0x91, 0x66, 0x42, 0x99, 0x6c, 0x99, 0x45, 0x9a, 0x23, 0xca, 0x90, 0x66, 0x42,
-	0x19, 0xd7, 0x8a, 0xb2, 0xb6, 0x71, 0x53, 0x2b, 0x41, 0x93, 0x0a, 0x1a, 0x9f, 0x86, 0x6d, 0xf3,
-	0x06, 0x4d, 0x97, 0x86, 0x48, 0xe3, 0xd3, 0x90, 0x7c, 0x0c, 0xf5, 0x28, 0x66, 0xb4, 0x0d, 0x9c,
-	0x68, 0xab, 0x40, 0x84, 0x61, 0x39, 0xae, 0x38, 0x1c, 0xfd, 0xa5, 0x09, 0xcd, 0x33, 0x9a, 0xa6,
-	0xee, 0x84, 0xda, 0xdf, 0xd6, 0xc0, 0xbc, 0xc0, 0x80, 0x76, 0xc5, 0xfc, 0x06, 0x2f, 0xa1, 0x2e,
-	0xa3, 0xfe, 0x48, 0xee, 0x1a, 0x9a, 0x63, 0x4a, 0x48, 0x87, 0xf1, 0x89, 0x37, 0xf7, 0x15, 0xba,
-	0x26, 0xd0, 0x12, 0x22, 0xd0, 0x2c, 0xce, 0xbc, 0xa9, 0x40, 0x6b, 0x02, 0x2d, 0x21, 0x1d, 0x46,
-	0x1e, 0x83, 0x8e, 0xfb, 0x9b, 0x97, 0x4a, 0xef, 0xdf, 0xba, 0xe2, 0x49, 0x12, 0xf2, 0x10, 0xa3,
-	0x9e, 0xca, 0x08, 0x08, 0x43, 0x96, 0xeb, 0x29, 0x06, 0x3d, 0x2d, 0xa4, 0x97, 0x5e, 0x48, 0x2f,
-	0x2c, 0x87, 0x84, 0xba, 0x3e, 0xc2, 0x9b, 0x1c, 0xae, 0xe3, 0x55, 0x21, 0xbc, 0x05, 0x22, 0x0c,
-	0x85, 0xf0, 0x16, 0x27, 0x3e, 0x32, 0xc2, 0x42, 0x0b, 0x7c, 0xee, 0xdc, 0x86, 0xd3, 0xf0, 0x69,
-	0x28, 0xc6, 0xa8, 0xdc, 0x30, 0x61, 0xdd, 0x86, 0xd9, 0x2a, 0x6f, 0x98, 0x7f, 0xd6, 0xc0, 0xe0,
-	0xce, 0xc4, 0x11, 0x53, 0x76, 0x56, 0xf5, 0x16, 0x67, 0xf9, 0x34, 0xa4, 0x65, 0x5f, 0x4a, 0x48,
-	0x87, 0xa1, 0xf0, 0x38, 0x0a, 0x83, 0x88, 0xaa, 0x16, 0x2d, 0x6e, 0xca, 0x2f, 0xf5, 0x3b, 0xfc,
-	0x52, 0x70, 0x40, 0x63, 0x9d, 0x03, 0xf4, 0x92, 0x03, 0x96, 0x96, 0x36, 0xd7, 0x59, 0x6a, 0x94,
-	0x2c, 0x2d, 0xf6, 0x1c, 0xb3, 0xd4, 0x73, 0xf2, 0x66, 0x01, 0xc5, 0x66, 0x51, 0xce, 0x8c, 0xd6,
-	0x6a, 0x66, 0x2c, 0x23, 0xb9, 0x51, 0x8c, 0xe4, 0x32, 0x2e, 0x6f, 0x15, 0xe3, 0xf2, 0x11, 0x6c,
-	0x86, 0x6e, 0xca, 0x46, 0x29, 0xa5, 0xd1, 0x88, 0x05, 0x33, 0xda, 0xde, 0xe4, 0x0c, 0x37, 0x10,
-	0x3a, 0xa4, 0x34, 0xba, 0x08, 0x66, 0x94, 0x7c, 0x07, 0xb6, 0x97, 0x54, 0x85, 0x3d, 0x6d, 0x8b,
-	0xeb, 0xf5, 0x40, 0xd1, 0x5e, 0xaa, 0x7d, 0xcd, 0xfe, 0x09, 0x98, 0x5d, 0x1a, 0xbe, 0xc4, 0x59,
-	0x94, 0x16, 0x44, 0x57, 0x8b, 0xa2, 0x0b, 0x2d, 0xb9, 0x76, 0x47, 0x4b, 0xb6, 0xbf, 0xad, 0x02,
-	0x0c, 0x69, 0xb2, 0xa0, 0xc9, 0x21, 0x4b, 0xee, 0x3b, 0x18, 0x08, 0xd4, 0x3d, 0xfc, 0x4c, 0x12,
-	0xcd, 0x92, 0x9f, 0xf9, 0x12, 0x46, 0x5f, 0x31, 0xb9, 0x2d, 0xf2, 0x33, 0x79, 0x96, 0xef, 0xaa,
-	0x0d, 0xae, 0xc3, 0x7b, 0x52, 0x07, 0x25, 0xee, 0x60, 0xc0, 0xb1, 0x62, 0x54, 0x4b, 0xd2, 0x9d,
-	0x1f, 0x42, 0xab, 0x00, 0x7e, 0xa3, 0xa1, 0xfc, 0xcf, 0xdc, 0x98, 0xae, 0xcb, 0xdc, 0x35, 0xe3,
-	0x60, 0x17, 0x36, 0xae, 0x92, 0x78, 0x36, 0x2a, 0x6f, 0xa4, 0x80, 0xb0, 0x4b, 0x91, 0x19, 0xe5,
-	0x84, 0xd7, 0x56, 0x13, 0x7e, 0x99, 0x03, 0xf5, 0x62, 0x0e, 0x7c, 0x26, 0x57, 0x12, 0x61, 0xea,
-	0xbb, 0x05, 0x53, 0x51, 0x99, 0xbb, 0x76, 0x12, 0xfd, 0x7f, 0xb4, 0x93, 0x7c, 0xa3, 0x29, 0xf3,
-	0x07, 0x09, 0x4d, 0xd7, 0x98, 0x6f, 0x81, 0x96, 0x26, 0x2a, 0x9e, 0x78, 0x24, 0x7b, 0xa5, 0x31,
-	0xbf, 0x5d, 0x50, 0x1c, 0xd9, 0x14, 0xe7, 0x7c, 0xf9, 0x3b, 0xa2, 0xbe, 0xfa, 0x1d, 0xb1, 0x74,
-	0x4c, 0xe3, 0xf6, 0xe2, 0xd0, 0xd7, 0x64, 0x68, 0xf3, 0xae, 0xa5, 0xe1, 0x23, 0xd8, 0x64, 0x6e,
-	0x82, 0x1b, 0xab, 0x8a, 0x98, 0xc1, 0x05, 0x6f, 0x08, 0xa8, 0x8c, 0x99, 0x0d, 0x6f, 0xb9, 0x1e,
-	0x8b, 0x93, 0x51, 0xb9, 0xd8, 0x5b, 0x1c, 0x28, 0x69, 0x64, 0x47, 0x82, 0xf5, 0x1d, 0xc9, 0xfe,
-	0x4a, 0x2e, 0x1d, 0x3a, 0xd4, 0xfa, 0xe7, 0x56, 0x05, 0x17, 0x8d, 0xfe, 0x8b, 0x17, 0x56, 0x15,
-	0x01, 0x97, 0x1d, 0x4b, 0x43, 0xc0, 0xe5, 0xa0, 0x6b, 0xd5, 0x89, 0x01, 0xf5, 0xa3, 0xfe, 0x79,
-	0xcf, 0x6a, 0x20, 0xa8, 0x73, 0x38, 0xb4, 0x74, 0x04, 0x5d, 0xf4, 0x9c, 0x33, 0xab, 0xa9, 0x76,
-	0x16, 0x03, 0x41, 0x4e, 0xaf, 0xd3, 0xb5, 0x4c, 0x71, 0x3a, 0x7c, 0x69, 0x01, 0x22, 0xbb, 0xbd,
-	0x53, 0xab, 0x65, 0xff, 0x3e, 0x4f, 0xd7, 0x33, 0xca, 0xdc, 0x7b, 0xd6, 0x9e, 0x2d, 0x3f, 0x6c,
-	0xb4, 0xc2, 0x74, 0xcd, 0xc7, 0xa2, 0xfc, 0xb4, 0xf9, 0x50, 0xad, 0x0e, 0x4b, 0xb7, 0xaa, 0x66,
-	0xaf, 0xbe, 0xa6, 0xf9, 0x84, 0x6e, 0x14, 0x78, 0xe4, 0x1d, 0x85, 0xcf, 0x67, 0xfb, 0x57, 0x4a,
-	0x35, 0xdc, 0x94, 0xfe, 0xe3, 0x4a, 0x7a, 0x58, 0x4a, 0xad, 0x7f, 0xb3, 0x7a, 0x15, 0xab, 0xc9,
-	0xfe, 0x7b, 0x15, 0x4c, 0xe9, 0x9b, 0x74, 0x82, 0xdb, 0x82, 0xc7, 0x92, 0x50, 0x2e, 0x5f, 0x5b,
-	0x2b, 0x6d, 0x04, 0xb7, 0x05, 0x44, 0x23, 0x19, 0x7f, 0x24, 0xa8, 0xdd, 0x20, 0xc3, 0x12, 0x44,
-	0x32, 0x44, 0x23, 0xd9, 0x3c, 0xa1, 0xa9, 0x74, 0xe1, 0xd6, 0x4a, 0xc2, 0x23, 0x19, 0xa2, 0x91,
-	0x6c, 0x46, 0xf3, 0x27, 0x87, 0x22, 0x19, 0x86, 0x0b, 0xc9, 0x10, 0x8d, 0x64, 0x41, 0x74, 0x15,
-	0x97, 0x16, 0x80, 0xa5, 0xeb, 0x90, 0x0c, 0xd1, 0xc5, 0x4d, 0xe6, 0xd7, 0x79, 0xdc, 0x1d, 0x9a,
-	0xce, 0xc9, 0xc7, 0xa0, 0xa7, 0xcc, 0x65, 0x99, 0x78, 0x50, 0x52, 0x6e, 0x42, 0xd4, 0x21, 0xdf,
-	0x33, 0x04, 0x92, 0x7c, 0x02, 0x7a, 0x9a, 0x2c, 0x66, 0xe9, 0xa4, 0xb4, 0x60, 0xe6, 0x3e, 0x72,
-	0x24, 0x96, 0x7c, 0x04, 0x0d, 0x2f, 0x44, 0x32, 0xed, 0xc6, 0xfe, 0x85, 0x64, 0x02, 0x69, 0xff,
-	0xb1, 0x06, 0xcd, 0x21, 0x4d, 0xd3, 0x20, 0x8e, 0xb0, 0xac, 0x53, 0x71, 0x5c, 0xbe, 0x88, 0x99,
-	0x12, 0x72, 0x72, 0xc7, 0xd7, 0xfb, 0x73, 0x00, 0x37, 0x63, 0xd3, 0x51, 0x48, 0x17, 0x34, 0x94,
-	0x31, 0x7e, 0x5b, 0x6a, 0xc5, 0x7f, 0x7c, 0xd0, 0xc9, 0xd8, 0xf4, 0x14, 0xb1, 0x8e, 0xe9, 0xaa,
-	0x23, 0xf9, 0x10, 0x5a, 0x09, 0x9d, 0xc5, 0x8c, 0x8e, 0x5c, 0xdf, 0x4f, 0x64, 0x1b, 0x01, 0x01,
-	0xea, 0xf8, 0x7e, 0xb2, 0xd2, 0x66, 0x1a, 0xab, 0x6d, 0xa6, 0xf4, 0x38, 0xa1, 0xaf, 0x3c, 0x4e,
-	0xec, 0x80, 0x11, 0xba, 0xd1, 0x24, 0x73, 0x27, 0x94, 0xaf, 0x08, 0xa6, 0x93, 0xdf, 0xed, 0x67,
-	0x60, 0xe6, 0x0a, 0x61, 0x3d, 0x9e, 0x63, 0xfd, 0x56, 0xf0, 0xd4, 0x39, 0xef, 0x9f, 0x5b, 0xc0,
-	0x4f, 0x97, 0x17, 0xc7, 0xd6, 0x36, 0xaf, 0xd6, 0x7e, 0xff, 0xc2, 0xfa, 0xc0, 0xee, 0xab, 0x4f,
-	0x00, 0x87, 0x5e, 0x63, 0xdd, 0xa0, 0x67, 0xab, 0xb7, 0x7a, 0x16, 0x51, 0x64, 0x17, 0xea, 0xe8,
-	0xb9, 0xd2, 0x4b, 0x97, 0xf4, 0x86, 0xc3, 0x31, 0xf6, 0x17, 0xd0, 0x1a, 0x52, 0x37, 0xf1, 0xa6,
-	0xe2, 0x6b, 0x7c, 0xed, 0x5b, 0xe4, 0xb6, 0xfa, 0xac, 0x93, 0xe5, 0x2f, 0xbe, 0xe3, 0xae, 0xd5,
-	0xaf, 0x5f, 0xc4, 0x59, 0xe4, 0xdf, 0x37, 0x77, 0x6e, 0xe5, 0x85, 0x3f, 0x4e, 0x68, 0x9a, 0x85,
-	0x8c, 0x3f, 0x73, 0xdd, 0xe8, 0x14, 0x12, 0x69, 0x4f, 0x00, 0x38, 0xac, 0xb7, 0x40, 0xef, 0x3f,
-	0x04, 0xdd, 0xf5, 0x58, 0x10, 0x47, 0x52, 0xa2, 0x29, 0x1f, 0x31, 0x32, 0xdf, 0x91, 0x08, 0x5c,
-	0x05, 0x22, 0x37, 0x7f, 0x13, 0xe1, 0xe7, 0xfb, 0xb4, 0x2d, 0xfb, 0x4f, 0x55, 0xd8, 0xe8, 0x78,
-	0x5e, 0x9c, 0x45, 0xec, 0xde, 0xb2, 0xd6, 0x26, 0xe7, 0xca, 0x5b, 0xad, 0xf6, 0xa6, 0x6f, 0xb5,
-	0xf5, 0xd2, 0x7e, 0xa9, 0x9e, 0x98, 0x8c, 0xc2, 0x7b, 0xe0, 0x3f, 0xaa, 0xf0, 0x60, 0x98, 0x8d,
-	0x53, 0x2f, 0x09, 0xe6, 0xa8, 0xcb, 0xbd, 0x75, 0x5e, 0xfb, 0xd6, 0xa1, 0x2c, 0xd1, 0x4a, 0x96,
-	0x2c, 0xe7, 0x67, 0xbd, 0x38, 0x3f, 0xdf, 0x7c, 0x79, 0x7e, 0x24, 0x5f, 0xb7, 0x9b, 0xb7, 0x0f,
-	0x40, 0x8e, 0x5c, 0xbf, 0x49, 0xdb, 0x17, 0xb0, 0x21, 0x3b, 0xd8, 0xbd, 0x2d, 0x7d, 0x28, 0xea,
-	0xe5, 0xf6, 0x7e, 0xcc, 0x0b, 0x66, 0xff, 0x13, 0x30, 0xd4, 0x44, 0xc8, 0xa7, 0x65, 0x25, 0x9f,
-	0x96, 0x7c, 0xf0, 0xfe, 0x74, 0x60, 0xd5, 0xf6, 0xbf, 0x00, 0x43, 0xa5, 0x35, 0xd9, 0x00, 0xe3,
-	0xb0, 0x7f, 0x7e, 0x71, 0x72, 0x7e, 0x29, 0xeb, 0xb7, 0xeb, 0xf4, 0x07, 0x56, 0x95, 0xb4, 0xa0,
-	0xe9, 0xf4, 0x86, 0x83, 0xfe, 0x79, 0xd7, 0xaa, 0x89, 0xcb, 0xe0, 0xb4, 0x73, 0xd8, 0xb3, 0xb4,
-	0xfd, 0x7d, 0xa8, 0xa3, 0x62, 0x04, 0x40, 0x3f, 0x74, 0x7a, 0x9d, 0x0b, 0xfc, 0x1d, 0x80, 0x7e,
-	0x39, 0xe8, 0xe2, 0xb9, 0x8a, 0xe7, 0x6e, 0xef, 0xb4, 0x77, 0xd1, 0xb3, 0x6a, 0x4f, 0x7f, 0x0c,
-	0xf5, 0x73, 0x94, 0xf2, 0x0c, 0x5a, 0xd2, 0xde, 0xd3, 0x38, 0x9e, 0x93, 0x95, 0x72, 0xdf, 0x59,
-	0xe9, 0xbf, 0x76, 0x65, 0xaf, 0xfa, 0xdd, 0xea, 0xd3, 0x3f, 0xd4, 0x40, 0x1f, 0x84, 0x19, 0x7e,
-	0xc0, 0x7f, 0x06, 0xc6, 0x8b, 0x20, 0xa1, 0xc7, 0x71, 0x4a, 0x4b, 0x3f, 0x76, 0xe8, 0xf5, 0x4e,
-	0xd1, 0x17, 0x68, 0x96, 0x5d, 0x21, 0x4f, 0xa0, 0xfe, 0x22, 0x88, 0x7c, 0x62, 0x49, 0x54, 0xde,
-	0x22, 0x76, 0x8a, 0x10, 0x5e, 0xf6, 0x76, 0x85, 0x3c, 0x86, 0xa6, 0x2c, 0x15, 0xf2, 0x40, 0x05,
-	0x32, 0x2f, 0x9c, 0x1d, 0xf1, 0xa0, 0x2d, 0xff, 0x69, 0xa9, 0x90, 0x4f, 0xa1, 0xc1, 0x6b, 0x8d,
-	0x6c, 0x2d, 0xeb, 0xee, 0x56, 0xc2, 0xe7, 0xb0, 0x51, 0xcc, 0x68, 0x22, 0xbb, 0xf9, 0x6a, 0x92,
-	0xaf, 0xfe, 0xec, 0x71, 0x3e, 0xdb, 0xa4, 0x32, 0xc5, 0x3c, 0x59, 0x21, 0x1e, 0xeb, 0xfc, 0xef,
-	0xa0, 0x67, 0xff, 0x0a, 0x00, 0x00, 0xff, 0xff, 0x37, 0x00, 0xe9, 0xd7, 0x1d, 0x1a, 0x00, 0x00,
+	// 2737 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x19, 0x4d, 0x73, 0xe4, 0x46,
+	0x75, 0x34, 0xd2, 0x68, 0x34, 0x6f, 0xbc, 0x5e, 0x6d, 0xb3, 0x24, 0x8a, 0x53, 0x49, 0xbc, 0xca,
+	0x26, 0x71, 0x6d, 0x12, 0x43, 0xed, 0x12, 0x08, 0x90, 0xa2, 0x98, 0x78, 0x66, 0x6d, 0xc3, 0xda,
+	0x9e, 0x68, 0xec, 0x70, 0x9c, 0x92, 0xa5, 0xf6, 0x8c, 0x2a, 0x1a, 0x69, 0x2c, 0xb5, 0x9c, 0x6c,
+	0x8a, 0x0b, 0xc7, 0x70, 0xe6, 0xce, 0x8d, 0xe2, 0x00, 0x3f, 0x83, 0x0b, 0x77, 0xa8, 0xa2, 0xe0,
+	0x4c, 0x71, 0xe1, 0x42, 0xf1, 0x03, 0xa8, 0xd7, 0x1f, 0x1a, 0x69, 0x3c, 0xe3, 0x78, 0xc3, 0xad,
+	0xdf, 0x87, 0xba, 0xdf, 0x7b, 0xfd, 0xbe, 0xfa, 0x09, 0xba, 0xb3, 0x34, 0xa4, 0xf1, 0xee, 0x3c,
+	0x4b, 0x59, 0x4a, 0xf4, 0xf9, 0xf9, 0x17, 0xae, 0x05, 0xe6, 0x59, 0x52, 0xe4, 0x34, 0x74, 0x3f,
+	0x84, 0xcd, 0x3e, 0xbd, 0xf0, 0x8b, 0x98, 0xf5, 0x82, 0xfc, 0x28, 0x0d, 0x29, 0x21, 0x60, 0xf8,
+	0x05, 0x9b, 0x3a, 0xda, 0xb6, 0xb6, 0xd3, 0xf1, 0xf8, 0x9a, 0xe3, 0x92, 0x34, 0x71, 0x9a, 0x12,
+	0x97, 0xa4, 0x89, 0xfb, 0x7d, 0x80, 0x5e, 0x10, 0xd0, 0xbc, 0xfc, 0xea, 0x73, 0x3f, 0x61, 0xea,
+	0x2b, 0x5c, 0x93, 0xfb, 0xd0, 0x9a, 0x44, 0x57, 0x54, 0x7d, 0x26, 0x00, 0xf7, 0x03, 0x30, 0x47,
+	0x94, 0x8d, 0x8a, 0x73, 0xf2, 0x32, 0xb4, 0x8b, 0x9c, 0x66, 0xe3, 0x28, 0x94, 0x9f, 0x99, 0x08,
+	0x1e, 0x86, 0xb8, 0x19, 0x8a, 0xac, 0x8e, 0xc3, 0xb5, 0x7b, 0x09, 0xed, 0x11, 0x65, 0x7d, 0x9a,
+	0x07, 0xe4, 0x7b, 0xd0, 0x0d, 0x85, 0xcc, 0x63, 0x3f, 0xc8, 0xf9, 0xb7, 0xdd, 0xc7, 0xdf, 0xda,
+	0x9d, 0x9f, 0x7f, 0xb1, 0x5b, 0xd7, 0xc5, 0x83, 0xb0, 0x84, 0xc9, 0x4b, 0x60, 0xce, 0x8b, 0xf3,
+	0x38, 0x0a, 0xf8, 0xb6, 0x1b, 0x9e, 0x84, 0x88, 0x03, 0xed, 0x79, 0x16, 0x5d, 0xf9, 0x8c, 0x3a,
+	0x3a, 0x27, 0x28, 0xd0, 0xfd, 0xbb, 0x06, 0xed, 0x7d, 0xca, 0x4e, 0xe6, 0x2c, 0x27, 0x8f, 0xe0,
+	0x5e, 0x74, 0x31, 0x9e, 0xa5, 0x61, 0x74, 0x11, 0xd1, 0x70, 0x9c, 0x47, 0x49, 0x40, 0xf9, 0xc9,
+	0xba, 0x77, 0x37, 0xba, 0x38, 0x92, 0xf8, 0x11, 0xa2, 0x51, 0x7c, 0x54, 0x44, 0x89, 0x8f, 0x6b,
+	0xb4, 0x05, 0x4b, 0xe7, 0x51, 0xc0, 0xcf, 0xe8, 0x78, 0x02, 0x20, 0xaf, 0x80, 0xc5, 0x77, 0x42,
+	0x13, 0x18, 0xdb, 0xda, 0x4e, 0xcb, 0x6b, 0x73, 0xf8, 0x30, 0x24, 0xaf, 0x42, 0xe7, 0x9c, 0x5e,
+	0xa4, 0x19, 0xa7, 0xb5, 0x38, 0xcd, 0x12, 0x88, 0xc3, 0x10, 0x77, 0x8b, 0xa3, 0x59, 0xc4, 0x1c,
+	0x93, 0x13, 0x04, 0x80, 0x1a, 0xb2, 0x69, 0x46, 0xfd, 0xd0, 0x69, 0x73, 0xb4, 0x84, 0x90, 0xfb,
+	0xb2, 0xa0, 0xd9, 0x73, 0xc7, 0x12, 0x67, 0x73, 0xc0, 0xfd, 0xbd, 0x06, 0xd6, 0x3e, 0x65, 0x9f,
+	0x20, 0xc0, 0xaf, 0x6f, 0xea, 0x2f, 0xae, 0x6f, 0xea, 0x33, 0xb2, 0x0d, 0x46, 0x48, 0x73, 0x61,
+	0xae, 0xee, 0xe3, 0x0d, 0x6e, 0x5f, 0x69, 0x0e, 0x8f, 0x53, 0xc8, 0xeb, 0xa0, 0xe7, 0xc5, 0xb9,
+	0xa3, 0xaf, 0x60, 0x40, 0x02, 0xdf, 0xc1, 0x67, 0xbe, 0x63, 0xac, 0x60, 0xe0, 0x14, 0xf2, 0x10,
+	0xcc, 0x9c, 0xfa, 0x59, 0x30, 0x75, 0x5a, 0x2b, 0x78, 0x24, 0xcd, 0xfd, 0x4a, 0x03, 0x6b, 0xa4,
+	0x44, 0x55, 0x62, 0x69, 0x95, 0x0f, 0xa4, 0x67, 0x48, 0xb1, 0x5e, 0x13, 0x62, 0x09, 0xb9, 0xbb,
+	0x8a, 0x61, 0x54, 0x9c, 0x0b, 0xa9, 0x08, 0x18, 0xcc, 0x9f, 0xe4, 0x8e, 0xbe, 0xad, 0xa3, 0xae,
+	0xb8, 0x26, 0x3b, 0x60, 0x26, 0x29, 0x8b, 0x2e, 0x9e, 0x4b, 0x59, 0x6d, 0xfe, 0xd5, 0x31, 0x47,
+	0x0d, 0x33, 0x7a, 0x91, 0x7b, 0x92, 0xee, 0xbe, 0x87, 0xa2, 0x5c, 0x7a, 0x7e, 0x32, 0xa1, 0xc4,
+	0x06, 0x3d, 0x4e, 0x3f, 0xe7, 0x92, 0xb4, 0x3c, 0x5c, 0x92, 0x4d, 0x68, 0x4e, 0x23, 0x7e, 0x72,
+	0xcb, 0x6b, 0x4e, 0x23, 0x37, 0x01, 0xd8, 0xcb, 0x68, 0x48, 0x13, 0x16, 0xf9, 0x31, 0x5e, 0xd0,
+	0x8c, 0xb2, 0x69, 0x5a, 0xfa, 0xbb, 0x80, 0xf0, 0x82, 0xae, 0xfc, 0xb8, 0x50, 0x0e, 0x2f, 0x00,
+	0xb2, 0x05, 0x56, 0x46, 0xf3, 0x79, 0x9a, 0xe4, 0x54, 0x7a, 0x4d, 0x09, 0x73, 0x67, 0xf6, 0x33,
+	0x7f, 0x96, 0x3b, 0x86, 0x74, 0x66, 0x0e, 0xb9, 0xbf, 0x04, 0x6b, 0x2f, 0x8e, 0x68, 0xc2, 0x0e,
+	0x22, 0x94, 0xa5, 0x8c, 0xac, 0x66, 0x14, 0x92, 0xd7, 0x00, 0x78, 0xb8, 0xf9, 0x13, 0x9a, 0x30,
+	0x79, 0x54, 0x07, 0x31, 0x3d, 0x44, 0xa0, 0x32, 0x57, 0x34, 0x93, 0x27, 0xe1, 0x12, 0x5d, 0x30,
+	0xa4, 0x57, 0xd1, 0xc2, 0x3d, 0x3b, 0x9e, 0x25, 0x10, 0x22, 0x46, 0x63, 0x3f, 0x99, 0xf0, 0x7b,
+	0xeb, 0x78, 0x7c, 0xed, 0xfe, 0x45, 0x83, 0x8e, 0x38, 0xbe, 0x17, 0x04, 0xd7, 0xce, 0xaf, 0x84,
+	0x7b, 0xb3, 0x16, 0xee, 0x2f, 0x81, 0x99, 0x07, 0x53, 0x3a, 0x53, 0x6a, 0x4a, 0x88, 0xe3, 0x69,
+	0x90, 0x51, 0xa6, 0x94, 0x14, 0x10, 0xf7, 0xfe, 0x74, 0x12, 0x25, 0xfc, 0x6c, 0xcb, 0x13, 0x40,
+	0x79, 0xad, 0x66, 0xe5, 0x5a, 0x95, 0xaf, 0xb4, 0xd7, 0xfa, 0xca, 0x9b, 0x60, 0x04, 0x19, 0x0d,
+	0x1d, 0x6b, 0x5b, 0xdf, 0xe9, 0x3e, 0xbe, 0xcb, 0x39, 0x16, 0x37, 0xe6, 0x71, 0xa2, 0x9b, 0x41,
+	0x57, 0xa8, 0xf5, 0x8c, 0x9f, 0xb4, 0xac, 0xd8, 0x42, 0xfe, 0xe6, 0x1a, 0xf9, 0xf5, 0x9a, 0xfc,
+	0xea, 0x4c, 0xe3, 0xa6, 0x33, 0xbf, 0x2a, 0x6d, 0x89, 0xa9, 0x72, 0xf9, 0xc8, 0x32, 0x9d, 0x34,
+	0xab, 0xe9, 0xe4, 0x11, 0x74, 0x72, 0xca, 0xc6, 0x22, 0xd8, 0x45, 0x54, 0xde, 0x51, 0x3a, 0xf3,
+	0xe0, 0xf1, 0xac, 0x5c, 0xae, 0x90, 0x77, 0x52, 0xf2, 0x1a, 0x15, 0xde, 0xfd, 0x92, 0x77, 0x22,
+	0x57, 0xee, 0x61, 0xa9, 0x3f, 0xf5, 0xaf, 0xe8, 0x2d, 0x85, 0xb9, 0x0f, 0xad, 0x22, 0x51, 0xe9,
+	0xc1, 0xf2, 0x04, 0xe0, 0xfe, 0xb3, 0x54, 0x6b, 0x78, 0x6b, 0xb5, 0x5e, 0x86, 0x76, 0x92, 0x8e,
+	0x69, 0x30, 0x4d, 0xe5, 0x5e, 0x66, 0x92, 0x0e, 0x82, 0x69, 0x4a, 0xde, 0x03, 0x63, 0x4a, 0x7d,
+	0x65, 0x48, 0x47, 0x18, 0x52, 0x6d, 0xbe, 0x7b, 0x40, 0xfd, 0x70, 0x90, 0xb0, 0xec, 0xb9, 0xc7,
+	0xb9, 0x30, 0xd1, 0x07, 0x69, 0xc2, 0xd0, 0xf9, 0x5b, 0x22, 0xd1, 0x4b, 0x10, 0xd3, 0x70, 0x46,
+	0xe7, 0xf1, 0xf3, 0x31, 0x4b, 0x65, 0x46, 0x6d, 0x73, 0xf8, 0x34, 0xdd, 0xfa, 0x01, 0x74, 0xca,
+	0x7d, 0x30, 0x44, 0x3e, 0xa3, 0xcf, 0xa5, 0xbc, 0xb8, 0xac, 0x47, 0xee, 0x86, 0x8c, 0xdc, 0x1f,
+	0x35, 0x3f, 0xd4, 0xdc, 0x4f, 0x95, 0x9e, 0xfb, 0x94, 0xdd, 0x52, 0xcf, 0x37, 0x55, 0x9e, 0xd6,
+	0x57, 0x5d, 0x87, 0x4c, 0xdb, 0xe5, 0xbe, 0xa3, 0xff, 0x6f, 0xdf, 0xd1, 0xd2, 0xbe, 0xff, 0x29,
+	0x2f, 0xa6, 0x4f, 0xe3, 0x5b, 0x6e, 0xfc, 0x8e, 0xac, 0x1a, 0xb8, 0xef, 0xa6, 0xac, 0xc0, 0xe5,
+	0x1e, 0xbb, 0xbf, 0x98, 0xfa, 0x4c, 0x96, 0x92, 0xb7, 0xa1, 0x1d, 0xd2, 0x78, 0x9c, 0xd3, 0x4b,
+	0x79, 0x57, 0x4a, 0x06, 0x91, 0x48, 0x3d, 0x33, 0xa4, 0xf1, 0x88, 0x5e, 0x56, 0x53, 0x44, 0x6b,
+	0xb9, 0x23, 0x98, 0xfa, 0x59, 0xc8, 0x6f, 0xc7, 0xf2, 0xf8, 0x1a, 0x71, 0x39, 0xcd, 0x73, 0x1e,
+	0xdc, 0x1d, 0x8f, 0xaf, 0xdd, 0xf7, 0xc1, 0xc0, 0x63, 0x49, 0x1b, 0xf4, 0xa3, 0xd1, 0xbe, 0xdd,
+	0x20, 0x1d, 0x68, 0x9d, 0x9e, 0x0c, 0x0f, 0xf7, 0x6c, 0x0d, 0x71, 0xa3, 0xb3, 0x8f, 0xed, 0x26,
+	0xb1, 0xc0, 0x18, 0x0d, 0x46, 0x23, 0x5b, 0x77, 0x33, 0x00, 0x21, 0xef, 0x71, 0xca, 0xe8, 0x42,
+	0x49, 0xad, 0xaa, 0xe4, 0x03, 0xa9, 0x64, 0x93, 0x2b, 0x29, 0x04, 0x3f, 0x4c, 0x2e, 0x52, 0xfc,
+	0x44, 0xaa, 0xf7, 0x6d, 0x0c, 0xf4, 0x4b, 0x94, 0x5a, 0x17, 0xf5, 0x38, 0xa7, 0x97, 0xa2, 0x4a,
+	0x67, 0xd4, 0x0f, 0x98, 0xcc, 0x9d, 0x02, 0x70, 0x7f, 0xad, 0x2b, 0x43, 0x1f, 0xe5, 0x13, 0xf2,
+	0x06, 0x2f, 0x18, 0x5a, 0xe5, 0x62, 0x54, 0xfe, 0x3e, 0x68, 0x60, 0x05, 0x21, 0x2e, 0xe8, 0x7e,
+	0xa0, 0x8a, 0xf0, 0x66, 0x85, 0xa3, 0x17, 0x04, 0x07, 0x0d, 0x0f, 0x89, 0x64, 0x47, 0x25, 0x44,
+	0xbd, 0x52, 0xbc, 0x2a, 0x19, 0xeb, 0xa0, 0xa1, 0x92, 0xa4, 0x2b, 0x4a, 0xa3, 0x71, 0x6d, 0xb7,
+	0x51, 0x71, 0x7e, 0xd0, 0x10, 0xf5, 0x11, 0x77, 0xc3, 0x38, 0x77, 0x5a, 0xd7, 0x77, 0x43, 0x3c,
+	0xdf, 0x0d, 0x17, 0xb8, 0xdb, 0xbc, 0x38, 0x77, 0xcc, 0x6b, 0xbb, 0x0d, 0xc5, 0x6e, 0xf3, 0xe2,
+	0x1c, 0x79, 0x26, 0x94, 0x39, 0xed, 0x6b, 0x3c, 0xfb, 0x94, 0x21, 0xcf, 0x84, 0x32, 0x2e, 0x15,
+	0x65, 0x8e, 0x75, 0x8d, 0x67, 0x24, 0x78, 0x72, 0xc1, 0x13, 0xd2, 0xd8, 0xe9, 0x5c, 0xe3, 0xe9,
+	0xd3, 0x18, 0x79, 0x42, 0x1a, 0x93, 0xb7, 0xc0, 0x48, 0x52, 0x46, 0x1d, 0xd8, 0xd6, 0x16, 0x89,
+	0xb5, 0xbc, 0xdf, 0x83, 0x86, 0xc7, 0xc9, 0x1f, 0x77, 0xa0, 0x7d, 0x44, 0xf3, 0xdc, 0x9f, 0x50,
+	0xf7, 0xbf, 0x4d, 0xe8, 0x9c, 0xe2, 0x35, 0xf7, 0x45, 0xe3, 0x00, 0x41, 0x46, 0x7d, 0x46, 0xc3,
+	0xb1, 0xec, 0x85, 0x74, 0xaf, 0x23, 0x31, 0x3d, 0x86, 0xe4, 0x62, 0x1e, 0x2a, 0x72, 0x53, 0x90,
+	0x25, 0x46, 0x90, 0x59, 0x5a, 0x04, 0x53, 0x41, 0xd6, 0x05, 0x59, 0x62, 0x7a, 0x8c, 0xbc, 0x0b,
+	0x26, 0x76, 0xa3, 0x41, 0x2e, 0xad, 0xbf, 0xb2, 0x61, 0x95, 0x2c, 0xe4, 0x01, 0xde, 0x7a, 0xee,
+	0xb4, 0x2a, 0x8a, 0x2c, 0x9a, 0x6d, 0xbc, 0xf4, 0xbc, 0xe2, 0x74, 0x66, 0xd5, 0xe9, 0x5e, 0x86,
+	0x36, 0x36, 0x7d, 0x88, 0x97, 0x5d, 0x20, 0x82, 0x8a, 0x10, 0x5c, 0x21, 0xc1, 0x52, 0x84, 0xe0,
+	0xea, 0x30, 0xc4, 0x8d, 0x30, 0x38, 0xa3, 0x90, 0x1b, 0xb7, 0xe5, 0xb5, 0x42, 0x1a, 0x8b, 0xaa,
+	0x2c, 0xfb, 0x65, 0x58, 0xd7, 0x2f, 0x77, 0x6b, 0xfd, 0x72, 0xa5, 0x89, 0xda, 0xf8, 0x9a, 0x26,
+	0xea, 0xaf, 0x3a, 0x58, 0xdc, 0xec, 0x58, 0xdb, 0xea, 0x66, 0xd5, 0x56, 0x98, 0x35, 0xa4, 0x31,
+	0xad, 0x5b, 0x5d, 0x62, 0x7a, 0xbc, 0xe9, 0x4d, 0x93, 0x38, 0x4a, 0xa8, 0xaa, 0x0d, 0x02, 0x52,
+	0x16, 0x34, 0x6e, 0xb0, 0x60, 0xc5, 0x54, 0xad, 0x75, 0xa6, 0x32, 0x6b, 0xa6, 0x5a, 0xd8, 0xa4,
+	0xbd, 0xce, 0x26, 0x56, 0xdd, 0x26, 0x95, 0x8c, 0xd6, 0xa9, 0x65, 0xb4, 0x32, 0xd9, 0x40, 0x35,
+	0xd9, 0xd4, 0x7d, 0xa8, 0xbb, 0xec, 0x43, 0x8b, 0x3b, 0xdf, 0xa8, 0xde, 0xf9, 0xe2, 0x06, 0xef,
+	0x54, 0x6f, 0xf0, 0x21, 0x6c, 0xc6, 0x7e, 0xce, 0xc6, 0x39, 0xa5, 0xc9, 0x98, 0x45, 0x33, 0xea,
+	0x6c, 0xf2, 0x0d, 0x37, 0x10, 0x3b, 0xa2, 0x34, 0x39, 0x8d, 0x66, 0x94, 0x7c, 0x07, 0xee, 0x2f,
+	0xb8, 0x2a, 0x0d, 0xe2, 0x5d, 0x2e, 0xd7, 0x3d, 0xc5, 0x7b, 0x56, 0x36, 0x8a, 0x5b, 0x60, 0xcd,
+	0xb0, 0x55, 0x49, 0x93, 0xdc, 0xb1, 0xc5, 0xc3, 0x44, 0xc1, 0xee, 0xcf, 0xa0, 0xd3, 0xa7, 0xf1,
+	0xa7, 0x58, 0x05, 0xf3, 0x8a, 0x58, 0x5a, 0x55, 0xac, 0x4a, 0x31, 0x68, 0xde, 0x50, 0x0c, 0xdc,
+	0x3f, 0x6b, 0x00, 0x23, 0x9a, 0x5d, 0xd1, 0x6c, 0x8f, 0x65, 0xb7, 0x2d, 0x49, 0x04, 0x8c, 0x20,
+	0x0d, 0x85, 0x33, 0xb4, 0x3c, 0xbe, 0x46, 0x1c, 0xa3, 0x5f, 0xa8, 0x34, 0xcc, 0xd7, 0xe4, 0x49,
+	0xd9, 0x40, 0xb7, 0xb8, 0x0c, 0xaf, 0x4a, 0x19, 0xd4, 0x71, 0xbb, 0x43, 0x4e, 0x15, 0xfd, 0x83,
+	0x64, 0xdd, 0xfa, 0x21, 0x74, 0x2b, 0xe8, 0x17, 0x6a, 0x07, 0xfe, 0xd1, 0x54, 0xca, 0xf4, 0xf1,
+	0xdd, 0xb3, 0xba, 0xd4, 0x6c, 0xc3, 0xc6, 0x45, 0x96, 0xce, 0xc6, 0xf5, 0x36, 0x19, 0x10, 0x77,
+	0x26, 0xbc, 0xa6, 0x1e, 0x0c, 0xfa, 0x72, 0x30, 0x2c, 0xfc, 0xc3, 0xa8, 0xfa, 0xc7, 0xfb, 0xb2,
+	0x4f, 0x12, 0xaa, 0xbe, 0x52, 0x51, 0x15, 0x85, 0xb9, 0xa9, 0x51, 0x32, 0xd7, 0x37, 0x4a, 0xed,
+	0x5a, 0xa3, 0x44, 0xde, 0x80, 0xae, 0x20, 0x05, 0x69, 0x91, 0x30, 0x99, 0x62, 0x80, 0xa3, 0xf6,
+	0x10, 0x43, 0x5c, 0xb8, 0xc3, 0xfd, 0x4c, 0x70, 0xf9, 0x8c, 0xc7, 0x83, 0xee, 0x75, 0x11, 0xe9,
+	0x21, 0xae, 0xc7, 0xbe, 0x79, 0xb7, 0xf5, 0x47, 0x5d, 0x99, 0x77, 0x98, 0xd1, 0x7c, 0x8d, 0x79,
+	0x6d, 0xd0, 0xf3, 0x4c, 0xf9, 0x0b, 0x2e, 0xc9, 0x4e, 0xad, 0x81, 0xb9, 0x5f, 0x31, 0x0c, 0x6e,
+	0x53, 0xed, 0x60, 0xea, 0x8f, 0x27, 0x63, 0xf9, 0xf1, 0xb4, 0x30, 0x7c, 0x6b, 0x75, 0x60, 0x9a,
+	0x6b, 0x22, 0xa0, 0x7d, 0x53, 0x3b, 0xf4, 0x10, 0x36, 0x99, 0x9f, 0x61, 0x9b, 0xae, 0x3c, 0x42,
+	0xbc, 0xe0, 0x37, 0x04, 0x56, 0xfa, 0x84, 0x0b, 0x77, 0xfc, 0x80, 0xa5, 0xd9, 0xb8, 0x9e, 0x68,
+	0xba, 0x1c, 0x29, 0x79, 0x64, 0x36, 0x84, 0xf5, 0xd9, 0xd0, 0xfd, 0x4c, 0xb6, 0x4e, 0x26, 0x34,
+	0x4f, 0x8e, 0xed, 0x06, 0xb6, 0x4b, 0x27, 0x4f, 0x9f, 0xda, 0x1a, 0x22, 0xce, 0x7a, 0xb6, 0x8e,
+	0x88, 0xb3, 0x61, 0xdf, 0x36, 0xb0, 0x7f, 0xda, 0x3f, 0x39, 0x1e, 0xd8, 0x2d, 0x44, 0xf5, 0xf6,
+	0x46, 0xb6, 0x89, 0xa8, 0xd3, 0x81, 0x77, 0x64, 0xb7, 0x55, 0xe7, 0x65, 0x21, 0xca, 0x1b, 0xf4,
+	0xfa, 0x76, 0x47, 0xac, 0xf6, 0x3e, 0xb5, 0x01, 0x89, 0xfd, 0xc1, 0x33, 0xbb, 0xeb, 0xfe, 0xab,
+	0x8c, 0xed, 0x23, 0xca, 0xfc, 0x5b, 0xc6, 0xb6, 0x2b, 0x5f, 0x73, 0x7a, 0xa5, 0x07, 0x28, 0x8b,
+	0xb7, 0x7c, 0xcf, 0xbd, 0xa1, 0x1a, 0x9c, 0x85, 0x59, 0x55, 0xa1, 0x51, 0x33, 0x09, 0xde, 0x47,
+	0xb4, 0x2a, 0x7b, 0x94, 0x19, 0x4b, 0x74, 0x11, 0xef, 0x94, 0x33, 0x09, 0xb3, 0xf2, 0x40, 0x5b,
+	0xc4, 0x8b, 0x1a, 0x4b, 0x90, 0x87, 0x65, 0x03, 0xaa, 0x97, 0xd5, 0x6e, 0x44, 0xf3, 0x3c, 0x4a,
+	0x13, 0x6c, 0x10, 0x65, 0x4b, 0xfa, 0x9b, 0x52, 0x55, 0x44, 0x7e, 0xe3, 0xc8, 0x7f, 0x50, 0x73,
+	0xd5, 0xaf, 0x69, 0x43, 0x8d, 0x95, 0x6d, 0x68, 0xab, 0xda, 0x86, 0xfe, 0x4d, 0x83, 0x8e, 0xbc,
+	0x81, 0x7c, 0x82, 0x9d, 0x53, 0xc0, 0xb2, 0x58, 0x36, 0xa2, 0x77, 0x97, 0x92, 0x21, 0x76, 0x4e,
+	0x48, 0x46, 0x36, 0x3e, 0xd0, 0x69, 0x6e, 0x6b, 0x2b, 0x0c, 0x83, 0x6c, 0x48, 0x46, 0xb6, 0x79,
+	0x46, 0x73, 0x47, 0xbf, 0xc6, 0x86, 0x61, 0x85, 0x6c, 0x48, 0x46, 0xb6, 0x19, 0x2d, 0xc7, 0x43,
+	0x55, 0x36, 0x74, 0x0a, 0x64, 0x43, 0x32, 0xb2, 0x45, 0xc9, 0x45, 0xea, 0xb4, 0xae, 0xb1, 0xa1,
+	0xfe, 0xc8, 0x86, 0xe4, 0x6a, 0x57, 0xf7, 0xab, 0xd2, 0xe4, 0x1e, 0xcd, 0xe7, 0xe4, 0x2d, 0x30,
+	0x73, 0xe6, 0xb3, 0x42, 0x8c, 0x0a, 0x95, 0xf1, 0x90, 0xb4, 0xc7, 0x7b, 0x2e, 0x41, 0x24, 0x6f,
+	0x83, 0x99, 0x67, 0x57, 0xb3, 0x7c, 0x52, 0x6b, 0xb6, 0x4b, 0x1b, 0x79, 0x92, 0x4a, 0x1e, 0x42,
+	0x2b, 0x88, 0x91, 0x4d, 0xbf, 0xd6, 0x8b, 0x22, 0x9b, 0x20, 0xba, 0xbf, 0x6b, 0x42, 0x5b, 0x3a,
+	0x03, 0x26, 0x8f, 0x5c, 0x2c, 0x17, 0xb3, 0xce, 0x8e, 0xc4, 0x1c, 0xde, 0x30, 0x18, 0xf9, 0x00,
+	0x00, 0xc7, 0xaf, 0xe3, 0x98, 0x5e, 0xd1, 0x58, 0xde, 0xfc, 0x4b, 0x55, 0x37, 0xdb, 0xed, 0x15,
+	0x6c, 0xfa, 0x0c, 0xa9, 0x5e, 0xc7, 0x57, 0x4b, 0x91, 0x8a, 0x67, 0x29, 0xa3, 0x63, 0x3f, 0x0c,
+	0x33, 0x99, 0xac, 0x40, 0xa0, 0x7a, 0x61, 0x98, 0x2d, 0x25, 0xb3, 0xd6, 0x72, 0x32, 0xab, 0xcd,
+	0x7d, 0xcc, 0xa5, 0xb9, 0xcf, 0x16, 0x58, 0x38, 0xeb, 0x29, 0xfc, 0x09, 0x95, 0x2f, 0xaf, 0x12,
+	0x76, 0x9f, 0x40, 0xa7, 0x14, 0x08, 0xa3, 0xfe, 0x18, 0xb3, 0x44, 0x03, 0x57, 0xbd, 0xe3, 0x93,
+	0x63, 0x1b, 0xf8, 0xea, 0xec, 0xf4, 0xc0, 0xbe, 0x8f, 0x2b, 0xef, 0xe4, 0xe4, 0xd4, 0x7e, 0xdd,
+	0x3d, 0x51, 0xcf, 0x21, 0x8f, 0x5e, 0x62, 0x74, 0xa2, 0x65, 0xb5, 0x95, 0x96, 0x45, 0x12, 0x8e,
+	0x74, 0x78, 0xd0, 0x35, 0x6b, 0x23, 0x1d, 0x6e, 0x0d, 0x19, 0x70, 0x1f, 0x41, 0x77, 0xc4, 0x03,
+	0x54, 0x0c, 0x3a, 0xd6, 0x4e, 0x99, 0xcb, 0xb1, 0x68, 0xb3, 0x3a, 0x16, 0xbd, 0x54, 0x5f, 0x3f,
+	0x4d, 0x8b, 0x24, 0xbc, 0xad, 0xef, 0xac, 0xdc, 0x0b, 0x3f, 0xce, 0x68, 0x5e, 0xc4, 0xcc, 0xd1,
+	0x57, 0xe5, 0x23, 0x49, 0x74, 0x27, 0x00, 0x1c, 0x37, 0xb8, 0x42, 0xeb, 0x3f, 0x00, 0xd3, 0x0f,
+	0xb0, 0x9b, 0x92, 0x27, 0x76, 0xe4, 0x7c, 0xa8, 0x08, 0x3d, 0x49, 0xc0, 0x86, 0x26, 0xf1, 0xcb,
+	0x71, 0x13, 0x5f, 0xdf, 0x26, 0x39, 0xba, 0x7f, 0xd0, 0x60, 0xa3, 0x17, 0xf0, 0x02, 0x7d, 0xeb,
+	0xb3, 0xd6, 0x3a, 0xe7, 0xd2, 0x14, 0x5e, 0x7f, 0xd1, 0x29, 0xbc, 0x51, 0xeb, 0xa0, 0xd5, 0xf4,
+	0xce, 0x5a, 0x4c, 0xef, 0xdc, 0x7f, 0x6b, 0x70, 0x6f, 0x54, 0x9c, 0xe7, 0x41, 0x16, 0xcd, 0x51,
+	0x96, 0x5b, 0xcb, 0xbc, 0x76, 0x8c, 0xa4, 0x34, 0xd1, 0x6b, 0x9a, 0x2c, 0xaa, 0xb4, 0x51, 0xad,
+	0xd2, 0x2f, 0xfe, 0x3c, 0x78, 0x53, 0xfe, 0xb7, 0x68, 0xaf, 0x2e, 0xb3, 0x9c, 0xb8, 0xfe, 0xad,
+	0xe0, 0x9e, 0xc2, 0x86, 0xcc, 0x60, 0xb7, 0xd6, 0xf4, 0x81, 0x88, 0x97, 0xd5, 0xf9, 0x98, 0x07,
+	0x8c, 0xfb, 0x27, 0x0d, 0xba, 0x32, 0x40, 0x78, 0x01, 0x5a, 0xae, 0xb5, 0xd8, 0xed, 0x15, 0x59,
+	0xa6, 0x66, 0xc2, 0x96, 0xa7, 0xc0, 0x7a, 0x1e, 0xd0, 0xd7, 0xcc, 0x7f, 0x8d, 0xc5, 0xfc, 0xf7,
+	0xeb, 0xf2, 0xca, 0x52, 0x5e, 0x32, 0xaf, 0xe5, 0xa5, 0x57, 0xa1, 0x53, 0x3e, 0x45, 0xb8, 0x11,
+	0x75, 0xcf, 0x52, 0xef, 0x0f, 0xf7, 0xa7, 0x00, 0x9f, 0x14, 0x11, 0x65, 0x07, 0x69, 0x91, 0xe5,
+	0x78, 0x3c, 0x16, 0x47, 0xf5, 0xc3, 0x02, 0xd7, 0xa8, 0x19, 0x4b, 0xe5, 0x9d, 0x37, 0x19, 0xd7,
+	0x94, 0x7d, 0x29, 0x05, 0x6f, 0xb2, 0x2f, 0xdd, 0x10, 0xba, 0x95, 0xc7, 0x28, 0xff, 0xcb, 0x54,
+	0x30, 0xf5, 0x17, 0x87, 0xaf, 0x6b, 0x6f, 0x1b, 0x61, 0x8d, 0x12, 0x26, 0x6f, 0x61, 0x8c, 0x47,
+	0x72, 0x9a, 0xab, 0xac, 0xbd, 0x10, 0xc9, 0x13, 0xd4, 0x47, 0x3f, 0x01, 0x4b, 0xd5, 0xe5, 0xb2,
+	0x07, 0x6a, 0x94, 0x3d, 0x10, 0x6f, 0xa7, 0x7e, 0x3e, 0xb4, 0x9b, 0x38, 0x99, 0xf2, 0x06, 0xbd,
+	0xbd, 0x53, 0x5b, 0x27, 0x5d, 0x68, 0x9f, 0x1d, 0x0b, 0xc0, 0x78, 0xf4, 0x11, 0x58, 0x2a, 0xbd,
+	0x90, 0x0d, 0xb0, 0xf6, 0x4e, 0x8e, 0x4f, 0x0f, 0x8f, 0xcf, 0x64, 0x1e, 0xed, 0x7b, 0x27, 0x43,
+	0x5b, 0xc3, 0x0f, 0xbc, 0xc1, 0x68, 0x78, 0x72, 0xdc, 0xb7, 0x9b, 0x02, 0x18, 0x3e, 0xeb, 0xed,
+	0x0d, 0x6c, 0xfd, 0xd1, 0x23, 0x30, 0xd0, 0x41, 0x08, 0x80, 0xb9, 0xe7, 0x0d, 0x7a, 0xa7, 0xf8,
+	0x1d, 0x80, 0x79, 0x36, 0xec, 0xe3, 0x5a, 0xc3, 0x75, 0x7f, 0xf0, 0x6c, 0x70, 0x3a, 0xb0, 0x9b,
+	0x8f, 0x7f, 0x0c, 0xc6, 0x31, 0x9e, 0xf2, 0x04, 0xba, 0xd2, 0xef, 0x9e, 0xa5, 0xe9, 0x9c, 0x2c,
+	0xa5, 0xdd, 0xad, 0xa5, 0x3a, 0xe8, 0x36, 0x76, 0xb4, 0xef, 0x6a, 0x8f, 0x7f, 0xdb, 0x04, 0x73,
+	0x18, 0x17, 0x38, 0x54, 0x7a, 0x1f, 0xac, 0xa7, 0x51, 0x46, 0x0f, 0xd2, 0x9c, 0xd6, 0x3e, 0xf6,
+	0xe8, 0xe5, 0x56, 0xd5, 0x27, 0x51, 0x2d, 0xb7, 0x81, 0x53, 0xdb, 0xa7, 0x51, 0x12, 0x12, 0xd5,
+	0x30, 0x95, 0xa9, 0x7a, 0xab, 0x8a, 0xe1, 0xe9, 0xd7, 0x6d, 0x90, 0x77, 0xa1, 0x2d, 0x53, 0x16,
+	0xb9, 0xa7, 0x02, 0xaa, 0x4c, 0x60, 0x5b, 0xe2, 0xef, 0x8e, 0xfc, 0x97, 0xd9, 0x20, 0xef, 0x40,
+	0x8b, 0xe7, 0x3c, 0x72, 0x77, 0x91, 0xff, 0x56, 0x32, 0x7e, 0x00, 0x1b, 0xd5, 0xcc, 0x42, 0x64,
+	0x55, 0x5d, 0x4e, 0x36, 0xcb, 0x9f, 0xbd, 0x5b, 0xf6, 0x18, 0x52, 0x98, 0x6a, 0xbc, 0x2e, 0x31,
+	0x9f, 0x9b, 0xfc, 0x87, 0xeb, 0x93, 0xff, 0x0d, 0x00, 0x4b, 0x22, 0x2f, 0xcd, 0x7f, 0x1d, 0x00,
+	0x00,
 }
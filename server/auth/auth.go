@@ -57,6 +57,8 @@ type Feature uint16
 const (
 	// Validated bit is set if user's credentials are already validated.
 	Validated Feature = 1 << iota
+	// TwoFactor bit is set if the user has passed the second step of authentication.
+	TwoFactor
 )
 
 // Rec is an authentication record.
@@ -67,10 +69,12 @@ type Rec struct {
 	AuthLevel Level
 	// Lifetime of this record
 	Lifetime time.Duration
-	// Bitmap of features. Currently 'validated'/'not validated' only.
+	// Bitmap of features: 'validated'/'not validated', 'second factor passed'.
 	Features Feature
 	// Tags generated by this authentication record.
 	Tags []string
+	// Scheme-dependent data to report to the client, e.g. provisioning data of a new second factor.
+	Params map[string]interface{}
 }
 
 // AuthHandler is the interface which auth providers must implement.
@@ -103,3 +107,11 @@ type AuthHandler interface {
 	// DelRecords deletes all authentication records for the given user.
 	DelRecords(uid types.Uid) error
 }
+
+// AddrAuthenticator is implemented by the handlers which take the network address of the client
+// into account, e.g. to slow down password guessing. If the handler implements it, the server calls
+// AuthenticateAddr instead of Authenticate.
+type AddrAuthenticator interface {
+	// AuthenticateAddr is the same as Authenticate with the remote IP address of the client.
+	AuthenticateAddr(secret []byte, remoteAddr string) (*Rec, []byte, error)
+}
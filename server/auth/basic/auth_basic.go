@@ -6,6 +6,7 @@ package basic
 import (
 	"encoding/json"
 	"errors"
+	"log"
 	"strings"
 	"time"
 
@@ -20,11 +21,103 @@ const (
 	// Define constraints on login
 	minLoginLength = 1
 	maxLoginLength = 32
+
+	// Defaults of the protection against password guessing.
+	defaultLoginFailures = 5
+	defaultAddrFailures  = 50
+	defaultBackoff       = time.Second
+	defaultLockout       = 15 * time.Minute
+	defaultReset         = time.Hour
 )
 
 // BasicAuth is the type to map authentication methods to.
 type authenticator struct {
 	addToTags bool
+	// Protection against password guessing, nil if disabled.
+	throttle *throttle
+}
+
+// throttle slows down password guessing. Failed attempts are counted per login and per remote
+// address. Once the count reaches the limit, each next attempt must wait twice as long as the
+// previous one up to the lockout time. The counts are kept in the database so they are shared by
+// all cluster nodes and survive restarts.
+type throttle struct {
+	// Number of failures of a login before the attempts are delayed.
+	loginFailures int
+	// Number of failures from an address before the attempts are delayed.
+	addrFailures int
+	// The first delay.
+	backoff time.Duration
+	// The longest delay.
+	lockout time.Duration
+	// Failures are forgotten after this time without a new failure.
+	reset time.Duration
+}
+
+// delay returns the time to wait after the last failure given the count of failures.
+func (th *throttle) delay(failures, limit int) time.Duration {
+	if failures < limit {
+		return 0
+	}
+	wait := th.backoff
+	for i := limit; i < failures && wait < th.lockout; i++ {
+		wait *= 2
+	}
+	if wait > th.lockout {
+		wait = th.lockout
+	}
+	return wait
+}
+
+// check returns ErrLocked if the next attempt for the key must wait.
+func (th *throttle) check(key string, limit int) error {
+	failures, last, err := store.Users.GetAuthFailures(key)
+	if err != nil {
+		return err
+	}
+	since := time.Since(last)
+	if failures == 0 || since > th.reset {
+		return nil
+	}
+	// The time of the last failure is rounded and may be slightly in the future: check the delay first.
+	if wait := th.delay(failures, limit); wait > 0 && since < wait {
+		return types.ErrLocked
+	}
+	return nil
+}
+
+// attempt counts the next attempt for the key as a failure before it's made and returns ErrLocked if
+// it must wait. The count is incremented atomically, so concurrent attempts cannot all pass: an attempt
+// which finds that another one was counted meanwhile is rejected once the delay applies. The caller
+// clears the count if the attempt succeeds.
+func (th *throttle) attempt(key string, limit int) error {
+	prev, last, err := store.Users.GetAuthFailures(key)
+	if err != nil {
+		return err
+	}
+	if time.Since(last) > th.reset {
+		prev = 0
+	}
+	failures, err := store.Users.AddAuthFailure(key, types.TimeNow().Add(-th.reset))
+	if err != nil {
+		return err
+	}
+	wait := th.delay(failures-1, limit)
+	if wait == 0 {
+		return nil
+	}
+	// The time of the last failure is rounded and may be slightly in the future: check the delay first.
+	if failures != prev+1 || time.Since(last) < wait {
+		return types.ErrLocked
+	}
+	return nil
+}
+
+// fail records a failed attempt for the key.
+func (th *throttle) fail(key string) {
+	if _, err := store.Users.AddAuthFailure(key, types.TimeNow().Add(-th.reset)); err != nil {
+		log.Println("auth_basic: failed to record failed attempt", key, err)
+	}
 }
 
 func parseSecret(bsecret []byte) (uname, password string, err error) {
@@ -43,15 +136,58 @@ func parseSecret(bsecret []byte) (uname, password string, err error) {
 
 // Init initializes the basic authenticator.
 func (a *authenticator) Init(jsonconf string) error {
+	type lockoutConfig struct {
+		Enabled bool `json:"enabled"`
+		// Failed attempts per login before the attempts are delayed.
+		LoginFailures int `json:"login_failures"`
+		// Failed attempts per remote address before the attempts are delayed.
+		AddrFailures int `json:"addr_failures"`
+		// The first delay in seconds. Every next failure doubles it.
+		Backoff int `json:"backoff"`
+		// The longest delay in seconds.
+		Lockout int `json:"lockout"`
+		// Failures are forgotten after this many seconds without a new failure.
+		Reset int `json:"reset"`
+	}
 	type configType struct {
 		//
-		AddToTags bool `json:"add_to_tags"`
+		AddToTags bool          `json:"add_to_tags"`
+		Lockout   lockoutConfig `json:"lockout"`
 	}
 	var config configType
 	if err := json.Unmarshal([]byte(jsonconf), &config); err != nil {
 		return errors.New("auth_basic: failed to parse config: " + err.Error() + "(" + jsonconf + ")")
 	}
 	a.addToTags = config.AddToTags
+
+	if config.Lockout.Enabled {
+		th := &throttle{
+			loginFailures: config.Lockout.LoginFailures,
+			addrFailures:  config.Lockout.AddrFailures,
+			backoff:       time.Duration(config.Lockout.Backoff) * time.Second,
+			lockout:       time.Duration(config.Lockout.Lockout) * time.Second,
+			reset:         time.Duration(config.Lockout.Reset) * time.Second,
+		}
+		if th.loginFailures <= 0 {
+			th.loginFailures = defaultLoginFailures
+		}
+		if th.addrFailures <= 0 {
+			th.addrFailures = defaultAddrFailures
+		}
+		if th.backoff <= 0 {
+			th.backoff = defaultBackoff
+		}
+		if th.lockout <= 0 {
+			th.lockout = defaultLockout
+		}
+		if th.reset <= 0 {
+			th.reset = defaultReset
+		}
+		if th.lockout < th.backoff || th.reset < th.lockout {
+			return errors.New("auth_basic: lockout must be between backoff and reset")
+		}
+		a.throttle = th
+	}
 	return nil
 }
 
@@ -123,7 +259,13 @@ func (authenticator) UpdateRecord(rec *auth.Rec, secret []byte) error {
 }
 
 // Authenticate checks login and password.
-func (authenticator) Authenticate(secret []byte) (*auth.Rec, []byte, error) {
+func (a *authenticator) Authenticate(secret []byte) (*auth.Rec, []byte, error) {
+	return a.AuthenticateAddr(secret, "")
+}
+
+// AuthenticateAddr checks login and password. Failed attempts are counted by login and by the
+// remote address if it's known.
+func (a *authenticator) AuthenticateAddr(secret []byte, remoteAddr string) (*auth.Rec, []byte, error) {
 	uname, password, err := parseSecret(secret)
 	if err != nil {
 		return nil, nil, err
@@ -133,12 +275,32 @@ func (authenticator) Authenticate(secret []byte) (*auth.Rec, []byte, error) {
 		return nil, nil, types.ErrFailed
 	}
 
+	// Failures are counted for missing logins too, otherwise the lockout would reveal which
+	// logins exist.
+	loginKey := "login:" + uname
+	var addrKey string
+	if a.throttle != nil {
+		// The attempt is counted before the password is checked and forgotten if the password is valid.
+		if err = a.throttle.attempt(loginKey, a.throttle.loginFailures); err != nil {
+			return nil, nil, err
+		}
+		if remoteAddr != "" {
+			// Only failures are counted for the address: successful logins must not lock out addresses
+			// shared by many users. Concurrent guesses from one address are still limited per login.
+			addrKey = "ip:" + remoteAddr
+			if err = a.throttle.check(addrKey, a.throttle.addrFailures); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
 	uid, authLvl, passhash, expires, err := store.Users.GetAuthUniqueRecord("basic", uname)
 	if err != nil {
 		return nil, nil, err
 	}
 	if uid.IsZero() {
 		// Invalid login.
+		a.fail(addrKey)
 		return nil, nil, types.ErrFailed
 	}
 	if !expires.IsZero() && expires.Before(time.Now()) {
@@ -149,9 +311,17 @@ func (authenticator) Authenticate(secret []byte) (*auth.Rec, []byte, error) {
 	err = bcrypt.CompareHashAndPassword([]byte(passhash), []byte(password))
 	if err != nil {
 		// Invalid password
+		a.fail(addrKey)
 		return nil, nil, types.ErrFailed
 	}
 
+	if a.throttle != nil {
+		// The address is not cleared: one valid account must not let the attacker keep guessing others.
+		if err = store.Users.ClearAuthFailures(loginKey); err != nil {
+			log.Println("auth_basic: failed to clear failed attempts", loginKey, err)
+		}
+	}
+
 	var lifetime time.Duration
 	if !expires.IsZero() {
 		lifetime = time.Until(expires)
@@ -194,6 +364,22 @@ func (authenticator) DelRecords(uid types.Uid) error {
 	return store.Users.DelAuthRecords(uid, "basic")
 }
 
+// fail records a failed attempt from the address if the protection against password guessing is enabled.
+func (a *authenticator) fail(addrKey string) {
+	if a.throttle != nil && addrKey != "" {
+		a.throttle.fail(addrKey)
+	}
+}
+
+// Unlock forgets failed login attempts so the login can be used without delay. The subject is
+// either a login or "ip:" followed by the IP address of the client.
+func Unlock(subject string) error {
+	if !strings.HasPrefix(subject, "ip:") {
+		subject = "login:" + strings.ToLower(subject)
+	}
+	return store.Users.ClearAuthFailures(subject)
+}
+
 func init() {
 	store.RegisterAuthScheme("basic", &authenticator{})
 }
@@ -0,0 +1,96 @@
+package basic
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nanfengpo/chat/server/auth"
+	"github.com/nanfengpo/chat/server/db/memory"
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+func TestDelay(t *testing.T) {
+	th := &throttle{backoff: time.Second, lockout: 8 * time.Second}
+	for failures, want := range map[int]time.Duration{
+		1: 0, 2: time.Second, 3: 2 * time.Second, 5: 8 * time.Second, 100: 8 * time.Second} {
+		if got := th.delay(failures, 2); got != want {
+			t.Error("delay after", failures, "failures: expected", want, "got", got)
+		}
+	}
+}
+
+func TestLockout(t *testing.T) {
+	if err := memory.OpenTestStore(); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	ba := &authenticator{}
+	if err := ba.Init(`{"lockout":{"enabled":true,"login_failures":2,"addr_failures":3,"backoff":60}}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ba.AddRecord(&auth.Rec{Uid: types.Uid(1001)}, []byte("alice:alice123")); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := ba.AuthenticateAddr([]byte("alice:wrong"), "10.0.0.1"); err != types.ErrFailed {
+			t.Fatal("wrong password: expected ErrFailed, got", err)
+		}
+	}
+	// Even the correct password is rejected until the delay expires.
+	if _, _, err := ba.AuthenticateAddr([]byte("alice:alice123"), "10.0.0.2"); err != types.ErrLocked {
+		t.Fatal("login must be locked, got", err)
+	}
+
+	if err := Unlock("Alice"); err != nil {
+		t.Fatal(err)
+	}
+	if rec, _, err := ba.AuthenticateAddr([]byte("alice:alice123"), "10.0.0.2"); err != nil || rec.Uid != types.Uid(1001) {
+		t.Fatal("unlocked login rejected", err)
+	}
+
+	// Missing logins are locked the same way as the existing ones.
+	for i := 0; i < 2; i++ {
+		ba.AuthenticateAddr([]byte("nobody:wrong"), "10.0.0.3")
+	}
+	if _, _, err := ba.AuthenticateAddr([]byte("nobody:wrong"), "10.0.0.3"); err != types.ErrLocked {
+		t.Error("missing login must be locked, got", err)
+	}
+
+	// The address 10.0.0.1 has failed twice with alice and once with bob: it's locked for all logins.
+	if _, _, err := ba.AuthenticateAddr([]byte("bob:wrong"), "10.0.0.1"); err != types.ErrFailed {
+		t.Fatal("wrong login: expected ErrFailed, got", err)
+	}
+	if _, _, err := ba.AuthenticateAddr([]byte("alice:alice123"), "10.0.0.1"); err != types.ErrLocked {
+		t.Error("address must be locked, got", err)
+	}
+	if err := Unlock("ip:10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ba.AuthenticateAddr([]byte("alice:alice123"), "10.0.0.1"); err != nil {
+		t.Error("unlocked address rejected", err)
+	}
+
+	// Concurrent guesses cannot pass the check together: only the allowed number of passwords is tried.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	tried := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := ba.AuthenticateAddr([]byte("alice:wrong"), ""); err == types.ErrFailed {
+				mu.Lock()
+				tried++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if tried != 2 {
+		t.Error("expected 2 passwords tried, got", tried)
+	}
+}
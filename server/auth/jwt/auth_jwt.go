@@ -0,0 +1,446 @@
+// Package jwt implements authentication by JSON Web Tokens (RFC 7519) signed with HS256 or RS256.
+// Unlike the tokens of the 'token' scheme, JWTs can be issued and verified by other services which
+// share the keys. Several keys can be configured to rotate them without invalidating issued tokens.
+//
+// Claims:
+//
+//	uid: ID of the user, like "usrWkhy5I-ZJA8"; required.
+//	exp: expiration time, Unix seconds; required.
+//	authlvl: authentication level, "anon", "auth" or "root"; default "auth".
+//	features: bitmap of auth.Feature; optional.
+//	gen: user's token generation, default 0. Tokens are revoked together with tokens of the 'token'
+//	     scheme: JWTs of earlier generations are rejected.
+//	iss, aud: checked if configured.
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nanfengpo/chat/server/auth"
+	authtoken "github.com/nanfengpo/chat/server/auth/token"
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+const (
+	// Allowed clock difference with other services.
+	defaultLeeway = 30 * time.Second
+	// Minimum length of HMAC keys.
+	minSecretLength = 32
+)
+
+// key is a signing or verification key.
+type key struct {
+	alg string
+	// HS256
+	secret []byte
+	// RS256
+	public  *rsa.PublicKey
+	private *rsa.PrivateKey
+}
+
+// authenticator is a singleton instance of the authenticator.
+type authenticator struct {
+	// Key ID -> key.
+	keys map[string]*key
+	// ID of the key for issuing tokens. Tokens are not issued if empty.
+	signingKey string
+	lifetime   time.Duration
+	issuer     string
+	audience   string
+	leeway     time.Duration
+}
+
+type claimSet struct {
+	Uid        string      `json:"uid"`
+	Expires    int64       `json:"exp"`
+	IssuedAt   int64       `json:"iat,omitempty"`
+	NotBefore  int64       `json:"nbf,omitempty"`
+	AuthLevel  string      `json:"authlvl,omitempty"`
+	Features   int         `json:"features,omitempty"`
+	Generation uint32      `json:"gen,omitempty"`
+	Issuer     string      `json:"iss,omitempty"`
+	Audience   interface{} `json:"aud,omitempty"`
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// Init initializes the authenticator.
+func (ja *authenticator) Init(jsonconf string) error {
+	if ja.keys != nil {
+		return errors.New("auth_jwt: already initialized")
+	}
+
+	type keyConfig struct {
+		// Key ID, the 'kid' header of tokens.
+		Kid string `json:"kid"`
+		// "HS256" or "RS256".
+		Alg string `json:"alg"`
+		// Shared secret for HS256.
+		Secret []byte `json:"secret"`
+		// Paths to PEM files with RSA keys for RS256. The public key is not needed if
+		// the private key is given.
+		PublicKey  string `json:"public_key"`
+		PrivateKey string `json:"private_key"`
+	}
+	type configType struct {
+		Keys []keyConfig `json:"keys"`
+		// ID of the key for issuing tokens.
+		SigningKey string `json:"signing_key"`
+		// Lifetime of issued tokens in seconds.
+		ExpireIn int `json:"expire_in"`
+		// Expected and issued 'iss' claim, optional.
+		Issuer string `json:"issuer"`
+		// Expected and issued 'aud' claim, optional.
+		Audience string `json:"audience"`
+		// Allowed clock difference in seconds.
+		Leeway *int `json:"leeway"`
+	}
+	var config configType
+	if err := json.Unmarshal([]byte(jsonconf), &config); err != nil {
+		return errors.New("auth_jwt: failed to parse config: " + err.Error() + "(" + jsonconf + ")")
+	}
+
+	if len(config.Keys) == 0 {
+		return errors.New("auth_jwt: no keys")
+	}
+	keys := make(map[string]*key)
+	for _, kc := range config.Keys {
+		if _, dup := keys[kc.Kid]; dup {
+			return errors.New("auth_jwt: duplicate key id '" + kc.Kid + "'")
+		}
+		k := &key{alg: kc.Alg}
+		switch kc.Alg {
+		case "HS256":
+			if len(kc.Secret) < minSecretLength {
+				return errors.New("auth_jwt: secret of key '" + kc.Kid + "' is missing or too short")
+			}
+			k.secret = kc.Secret
+		case "RS256":
+			var err error
+			if kc.PrivateKey != "" {
+				if k.private, err = loadPrivateKey(kc.PrivateKey); err != nil {
+					return errors.New("auth_jwt: key '" + kc.Kid + "': " + err.Error())
+				}
+				k.public = &k.private.PublicKey
+			} else if kc.PublicKey != "" {
+				if k.public, err = loadPublicKey(kc.PublicKey); err != nil {
+					return errors.New("auth_jwt: key '" + kc.Kid + "': " + err.Error())
+				}
+			} else {
+				return errors.New("auth_jwt: key '" + kc.Kid + "' is missing")
+			}
+		default:
+			return errors.New("auth_jwt: unsupported algorithm '" + kc.Alg + "'")
+		}
+		keys[kc.Kid] = k
+	}
+
+	if config.SigningKey != "" {
+		k := keys[config.SigningKey]
+		if k == nil || (k.alg == "RS256" && k.private == nil) {
+			return errors.New("auth_jwt: signing key is missing")
+		}
+		if config.ExpireIn <= 0 {
+			return errors.New("auth_jwt: invalid expiration value")
+		}
+	}
+	if config.Leeway != nil && *config.Leeway < 0 {
+		return errors.New("auth_jwt: invalid leeway")
+	}
+
+	ja.keys = keys
+	ja.signingKey = config.SigningKey
+	ja.lifetime = time.Duration(config.ExpireIn) * time.Second
+	ja.issuer = config.Issuer
+	ja.audience = config.Audience
+	ja.leeway = defaultLeeway
+	if config.Leeway != nil {
+		ja.leeway = time.Duration(*config.Leeway) * time.Second
+	}
+
+	return nil
+}
+
+// AddRecord is not supprted, will produce an error.
+func (authenticator) AddRecord(rec *auth.Rec, secret []byte) (*auth.Rec, error) {
+	return nil, types.ErrUnsupported
+}
+
+// UpdateRecord is not supported, will produce an error.
+func (authenticator) UpdateRecord(rec *auth.Rec, secret []byte) error {
+	return types.ErrUnsupported
+}
+
+// Authenticate checks validity of the JWT.
+func (ja *authenticator) Authenticate(token []byte) (*auth.Rec, []byte, error) {
+	if ja.keys == nil {
+		return nil, nil, types.ErrUnsupported
+	}
+
+	parts := strings.Split(string(token), ".")
+	if len(parts) != 3 {
+		return nil, nil, types.ErrMalformed
+	}
+
+	var hdr header
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return nil, nil, types.ErrMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, types.ErrMalformed
+	}
+
+	if !ja.verify(&hdr, parts[0]+"."+parts[1], sig) {
+		return nil, nil, types.ErrFailed
+	}
+
+	var claims claimSet
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, nil, types.ErrMalformed
+	}
+
+	if ja.issuer != "" && claims.Issuer != ja.issuer {
+		return nil, nil, types.ErrFailed
+	}
+	if ja.audience != "" && !audienceContains(claims.Audience, ja.audience) {
+		return nil, nil, types.ErrFailed
+	}
+
+	now := time.Now()
+	if claims.Expires == 0 {
+		return nil, nil, types.ErrMalformed
+	}
+	expires := time.Unix(claims.Expires, 0).UTC()
+	if expires.Add(ja.leeway).Before(now) {
+		return nil, nil, types.ErrExpired
+	}
+	if claims.NotBefore != 0 && time.Unix(claims.NotBefore, 0).Add(-ja.leeway).After(now) {
+		return nil, nil, types.ErrFailed
+	}
+
+	uid := types.ParseUserId(claims.Uid)
+	if uid.IsZero() {
+		return nil, nil, types.ErrMalformed
+	}
+
+	// Check if the token was revoked.
+	gen, err := authtoken.Generation(uid)
+	if err != nil {
+		return nil, nil, err
+	}
+	if claims.Generation != gen {
+		return nil, nil, types.ErrFailed
+	}
+
+	authLvl := auth.LevelAuth
+	if claims.AuthLevel != "" {
+		if authLvl = auth.ParseAuthLevel(claims.AuthLevel); authLvl == auth.LevelNone {
+			return nil, nil, types.ErrMalformed
+		}
+	}
+
+	lifetime := time.Until(expires)
+	if lifetime <= 0 {
+		// Expired within the leeway.
+		lifetime = time.Second
+	}
+
+	return &auth.Rec{
+		Uid:       uid,
+		AuthLevel: authLvl,
+		Lifetime:  lifetime,
+		Features:  auth.Feature(claims.Features)}, nil, nil
+}
+
+// IsUnique is not supported, will produce an error.
+func (authenticator) IsUnique(token []byte) (bool, error) {
+	return false, types.ErrUnsupported
+}
+
+// GenSecret issues a new JWT signed with the signing key.
+func (ja *authenticator) GenSecret(rec *auth.Rec) ([]byte, time.Time, error) {
+	if ja.signingKey == "" {
+		return nil, time.Time{}, types.ErrUnsupported
+	}
+
+	lifetime := rec.Lifetime
+	if lifetime == 0 {
+		lifetime = ja.lifetime
+	} else if lifetime < 0 {
+		return nil, time.Time{}, types.ErrExpired
+	}
+	now := time.Now()
+	expires := now.Add(lifetime).UTC().Round(time.Second)
+
+	gen, err := authtoken.Generation(rec.Uid)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	claims := claimSet{
+		Uid:        rec.Uid.UserId(),
+		Expires:    expires.Unix(),
+		IssuedAt:   now.Unix(),
+		AuthLevel:  rec.AuthLevel.String(),
+		Features:   int(rec.Features),
+		Issuer:     ja.issuer,
+		Generation: gen,
+	}
+	if ja.audience != "" {
+		claims.Audience = ja.audience
+	}
+
+	k := ja.keys[ja.signingKey]
+	hdr, _ := json.Marshal(&header{Alg: k.alg, Kid: ja.signingKey, Typ: "JWT"})
+	payload, _ := json.Marshal(&claims)
+	signed := base64.RawURLEncoding.EncodeToString(hdr) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	sig, err := k.sign(signed)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return []byte(signed + "." + base64.RawURLEncoding.EncodeToString(sig)), expires, nil
+}
+
+// DelRecords is a noop which always succeeds.
+func (authenticator) DelRecords(uid types.Uid) error {
+	return nil
+}
+
+// verify checks the signature with the key from the header. If the token has no key ID,
+// all keys of the algorithm are tried.
+func (ja *authenticator) verify(hdr *header, signed string, sig []byte) bool {
+	if hdr.Kid != "" {
+		k := ja.keys[hdr.Kid]
+		return k != nil && k.alg == hdr.Alg && k.verify(signed, sig)
+	}
+	for _, k := range ja.keys {
+		if k.alg == hdr.Alg && k.verify(signed, sig) {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *key) sign(signed string) ([]byte, error) {
+	if k.alg == "HS256" {
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write([]byte(signed))
+		return mac.Sum(nil), nil
+	}
+	digest := sha256.Sum256([]byte(signed))
+	return rsa.SignPKCS1v15(rand.Reader, k.private, crypto.SHA256, digest[:])
+}
+
+func (k *key) verify(signed string, sig []byte) bool {
+	if k.alg == "HS256" {
+		expected, _ := k.sign(signed)
+		return hmac.Equal(expected, sig)
+	}
+	digest := sha256.Sum256([]byte(signed))
+	return rsa.VerifyPKCS1v15(k.public, crypto.SHA256, digest[:], sig) == nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// audienceContains checks the 'aud' claim which is either a string or an array of strings.
+func audienceContains(aud interface{}, audience string) bool {
+	switch val := aud.(type) {
+	case string:
+		return val == audience
+	case []interface{}:
+		for _, v := range val {
+			if v == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readPEM reads the first PEM block from the file. A relative path is resolved relative to
+// the executable.
+func readPEM(path string) (*pem.Block, error) {
+	if !filepath.IsAbs(path) {
+		if basepath, err := os.Executable(); err == nil {
+			path = filepath.Join(filepath.Dir(basepath), path)
+		}
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(bytes.TrimSpace(data))
+	if block == nil {
+		return nil, errors.New("no PEM data in " + path)
+	}
+	return block, nil
+}
+
+func loadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+		return rsaKey, nil
+	}
+	return nil, errors.New("not an RSA key")
+}
+
+func loadPublicKey(path string) (*rsa.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if rsaKey, ok := key.(*rsa.PublicKey); ok {
+		return rsaKey, nil
+	}
+	return nil, errors.New("not an RSA key")
+}
+
+func init() {
+	store.RegisterAuthScheme("jwt", &authenticator{})
+}
@@ -0,0 +1,200 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nanfengpo/chat/server/auth"
+	"github.com/nanfengpo/chat/server/db/memory"
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+const (
+	oldSecret = "b2xkLXNlY3JldC1vbGQtc2VjcmV0LW9sZC1zZWNyZXQtb2xk"
+	newSecret = "bmV3LXNlY3JldC1uZXctc2VjcmV0LW5ldy1zZWNyZXQtbmV3"
+)
+
+// The store keeps token generations of users.
+func TestMain(m *testing.M) {
+	if err := memory.OpenTestStore(); err != nil {
+		log.Fatal(err)
+	}
+	code := m.Run()
+	store.Close()
+	os.Exit(code)
+}
+
+func newAuthenticator(t *testing.T, conf string) *authenticator {
+	ja := &authenticator{}
+	if err := ja.Init(conf); err != nil {
+		t.Fatal(err)
+	}
+	return ja
+}
+
+// sign creates a token the way an external service would.
+func sign(t *testing.T, k *key, kid string, claims map[string]interface{}) []byte {
+	hdr, _ := json.Marshal(&header{Alg: k.alg, Kid: kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(hdr) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sig, err := k.sign(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []byte(signed + "." + base64.RawURLEncoding.EncodeToString(sig))
+}
+
+func TestRoundTrip(t *testing.T) {
+	ja := newAuthenticator(t, `{"keys":[{"kid":"k1","alg":"HS256","secret":"`+oldSecret+`"}],
+		"signing_key":"k1","expire_in":3600,"issuer":"chat","audience":"services"}`)
+
+	uid := types.Uid(12345)
+	token, expires, err := ja.GenSecret(&auth.Rec{Uid: uid, AuthLevel: auth.LevelAuth, Features: auth.Validated})
+	if err != nil || time.Until(expires) < 59*time.Minute {
+		t.Fatal("GenSecret:", err, expires)
+	}
+	rec, _, err := ja.Authenticate(token)
+	if err != nil || rec.Uid != uid || rec.AuthLevel != auth.LevelAuth || rec.Features != auth.Validated {
+		t.Fatal("Authenticate:", rec, err)
+	}
+
+	parts := strings.Split(string(token), ".")
+	forged, _ := json.Marshal(map[string]interface{}{"uid": types.Uid(1).UserId(), "exp": expires.Unix(),
+		"iss": "chat", "aud": "services"})
+	if _, _, err = ja.Authenticate([]byte(parts[0] + "." + base64.RawURLEncoding.EncodeToString(forged) + "." +
+		parts[2])); err != types.ErrFailed {
+		t.Error("tampered token: got", err)
+	}
+
+	k := ja.keys["k1"]
+	claims := map[string]interface{}{"uid": uid.UserId(), "exp": time.Now().Add(time.Hour).Unix(),
+		"iss": "chat", "aud": []string{"services"}, "authlvl": "root"}
+	if rec, _, err = ja.Authenticate(sign(t, k, "k1", claims)); err != nil || rec.AuthLevel != auth.LevelRoot {
+		t.Error("external token:", rec, err)
+	}
+
+	tests := map[string]struct {
+		mutate func(map[string]interface{})
+		want   error
+	}{
+		"expired":        {func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, types.ErrExpired},
+		"no expiration":  {func(c map[string]interface{}) { delete(c, "exp") }, types.ErrMalformed},
+		"no uid":         {func(c map[string]interface{}) { delete(c, "uid") }, types.ErrMalformed},
+		"bad auth level": {func(c map[string]interface{}) { c["authlvl"] = "god" }, types.ErrMalformed},
+		"wrong issuer":   {func(c map[string]interface{}) { c["iss"] = "evil" }, types.ErrFailed},
+		"wrong audience": {func(c map[string]interface{}) { c["aud"] = "other" }, types.ErrFailed},
+	}
+	for name, tc := range tests {
+		c := make(map[string]interface{})
+		for k, v := range claims {
+			c[k] = v
+		}
+		tc.mutate(c)
+		if _, _, err = ja.Authenticate(sign(t, k, "k1", c)); err != tc.want {
+			t.Errorf("%s: got %v, want %v", name, err, tc.want)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	before := newAuthenticator(t, `{"keys":[{"kid":"old","alg":"HS256","secret":"`+oldSecret+`"}],
+		"signing_key":"old","expire_in":3600}`)
+	token, _, _ := before.GenSecret(&auth.Rec{Uid: types.Uid(12345), AuthLevel: auth.LevelAuth})
+
+	// New tokens are signed with the new key, the old key still verifies tokens issued before.
+	after := newAuthenticator(t, `{"keys":[{"kid":"new","alg":"HS256","secret":"`+newSecret+`"},
+		{"kid":"old","alg":"HS256","secret":"`+oldSecret+`"}],"signing_key":"new","expire_in":3600}`)
+	if _, _, err := after.Authenticate(token); err != nil {
+		t.Error("token signed with the old key:", err)
+	}
+	fresh, _, _ := after.GenSecret(&auth.Rec{Uid: types.Uid(12345), AuthLevel: auth.LevelAuth})
+	if _, _, err := after.Authenticate(fresh); err != nil {
+		t.Error("token signed with the new key:", err)
+	}
+	if _, _, err := before.Authenticate(fresh); err != types.ErrFailed {
+		t.Error("unknown key must be rejected, got", err)
+	}
+
+	// Tokens without a key ID are checked against all keys.
+	claims := map[string]interface{}{"uid": types.Uid(12345).UserId(), "exp": time.Now().Add(time.Hour).Unix()}
+	if _, _, err := after.Authenticate(sign(t, after.keys["old"], "", claims)); err != nil {
+		t.Error("token without kid:", err)
+	}
+}
+
+func TestRevocation(t *testing.T) {
+	ja := newAuthenticator(t, `{"keys":[{"kid":"k1","alg":"HS256","secret":"`+oldSecret+`"}],
+		"signing_key":"k1","expire_in":3600}`)
+	uid := types.Uid(23456)
+	old, _, _ := ja.GenSecret(&auth.Rec{Uid: uid, AuthLevel: auth.LevelAuth})
+
+	if err := store.GetAuthHandler("token").UpdateRecord(&auth.Rec{Uid: uid}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ja.Authenticate(old); err != types.ErrFailed {
+		t.Error("revoked token accepted", err)
+	}
+	claims := map[string]interface{}{"uid": uid.UserId(), "exp": time.Now().Add(time.Hour).Unix()}
+	if _, _, err := ja.Authenticate(sign(t, ja.keys["k1"], "k1", claims)); err != types.ErrFailed {
+		t.Error("token without generation accepted after revocation", err)
+	}
+	fresh, _, _ := ja.GenSecret(&auth.Rec{Uid: uid, AuthLevel: auth.LevelAuth})
+	if _, _, err := ja.Authenticate(fresh); err != nil {
+		t.Error("token issued after revocation rejected", err)
+	}
+}
+
+func TestRS256(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jwt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPath := filepath.Join(dir, "private.pem")
+	ioutil.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(private)}), 0600)
+	der, _ := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	pubPath := filepath.Join(dir, "public.pem")
+	ioutil.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)
+
+	issuer := newAuthenticator(t, `{"keys":[{"kid":"rsa","alg":"RS256","private_key":"`+privPath+`"}],
+		"signing_key":"rsa","expire_in":600}`)
+	token, _, err := issuer.GenSecret(&auth.Rec{Uid: types.Uid(12345), AuthLevel: auth.LevelAnon})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A service which only verifies tokens needs just the public key.
+	verifier := newAuthenticator(t, `{"keys":[{"kid":"rsa","alg":"RS256","public_key":"`+pubPath+`"}]}`)
+	rec, _, err := verifier.Authenticate(token)
+	if err != nil || rec.Uid != types.Uid(12345) || rec.AuthLevel != auth.LevelAnon {
+		t.Error("RS256:", rec, err)
+	}
+	if _, _, err = verifier.GenSecret(rec); err != types.ErrUnsupported {
+		t.Error("verifier must not issue tokens, got", err)
+	}
+
+	// HS256 token which uses the public key as the HMAC secret is rejected.
+	claims := map[string]interface{}{"uid": types.Uid(12345).UserId(), "exp": time.Now().Add(time.Hour).Unix()}
+	pubPEM, _ := ioutil.ReadFile(pubPath)
+	if _, _, err = verifier.Authenticate(sign(t, &key{alg: "HS256", secret: pubPEM}, "rsa", claims)); err != types.ErrFailed {
+		t.Error("algorithm confusion: got", err)
+	}
+}
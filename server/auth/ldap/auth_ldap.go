@@ -0,0 +1,487 @@
+// Package ldap implements authentication against an LDAP directory. The secret is "login:password" like
+// in the basic scheme. The password is verified by binding to the directory as the user. Accounts are
+// created on the first login if configured. Groups of the user are mapped to tags and re-synced on every
+// login.
+package ldap
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nanfengpo/chat/server/auth"
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+const (
+	// Timeout of requests to the directory.
+	defaultTimeout = 10 * time.Second
+
+	// Logins are stored in auth records as 'ldap:login' which must fit 32 characters.
+	maxLoginLength = 27
+
+	// Default namespace of tags generated from groups.
+	defaultTagNamespace = "group"
+)
+
+// authenticator is a singleton instance of the authenticator.
+type authenticator struct {
+	// URL of the server, ldap://host:port or ldaps://host:port.
+	serverURL string
+	timeout   time.Duration
+	// Config of ldaps:// or StartTLS connections, nil for plaintext ldap://.
+	tlsConfig *tls.Config
+
+	// Template of the user's DN for direct bind, like "uid=%s,ou=people,dc=example,dc=com".
+	userDN string
+	// Service account used to find users by login if userDN is not set.
+	bindDN       string
+	bindPassword string
+	// Subtree where users are searched.
+	baseDN string
+	// Attribute which contains the login, like "uid" or "sAMAccountName".
+	userAttr string
+	// Optional object class of user entries.
+	userClass string
+	// Attribute to use as user's name.
+	nameAttr string
+
+	// Attribute of the user entry which lists DNs of user's groups, like "memberOf".
+	groupAttr string
+	// Subtree where groups are searched for members if set.
+	groupBaseDN string
+	// Attribute of group entries which lists DNs of members, like "member".
+	groupMemberAttr string
+	// Group DN or name -> tag value. If empty, all groups are mapped to tags by name.
+	groups map[string]string
+	// Namespace of group tags.
+	tagNamespace string
+
+	// Add 'ldap:login' tag.
+	addToTags bool
+	// Create accounts for unknown users.
+	autoCreate bool
+}
+
+// Init initializes the authenticator.
+func (a *authenticator) Init(jsonconf string) error {
+	if a.serverURL != "" {
+		return errors.New("auth_ldap: already initialized")
+	}
+
+	type configType struct {
+		// Server URL, like "ldaps://ldap.example.com".
+		URL string `json:"url"`
+		// Timeout of requests in seconds.
+		Timeout int `json:"timeout"`
+		// Upgrade ldap:// connections to TLS with StartTLS.
+		StartTLS bool `json:"start_tls"`
+		// Use ldap:// without StartTLS. Passwords are sent in the clear. Testing only.
+		AllowPlaintext bool `json:"allow_plaintext"`
+		// Skip verification of the server certificate. Testing only.
+		InsecureSkipVerify bool `json:"insecure_skip_verify"`
+		// Template of the user DN with %s for the login. Enables direct bind.
+		UserDN string `json:"user_dn"`
+		// Service account for searching users.
+		BindDN       string `json:"bind_dn"`
+		BindPassword string `json:"bind_password"`
+		// Search base for users.
+		BaseDN string `json:"base_dn"`
+		// Login attribute, "uid" by default.
+		UserAttr string `json:"user_attr"`
+		// Object class of users, like "person".
+		UserClass string `json:"user_class"`
+		// Attribute with user's name, "cn" by default.
+		NameAttr string `json:"name_attr"`
+		// Attribute of the user entry with group DNs, like "memberOf".
+		GroupAttr string `json:"group_attr"`
+		// Search base for groups.
+		GroupBaseDN string `json:"group_base_dn"`
+		// Attribute of groups with member DNs, "member" by default.
+		GroupMemberAttr string `json:"group_member_attr"`
+		// Mapping of groups to tags.
+		Groups map[string]string `json:"groups"`
+		// Namespace of group tags, "group" by default. Empty string "" is not allowed.
+		TagNamespace string `json:"tag_namespace"`
+		// Add 'ldap:login' tag to the user.
+		AddToTags bool `json:"add_to_tags"`
+		// Create an account on the first login.
+		AutoCreate bool `json:"auto_create"`
+	}
+	var config configType
+	if err := json.Unmarshal([]byte(jsonconf), &config); err != nil {
+		return errors.New("auth_ldap: failed to parse config: " + err.Error() + "(" + jsonconf + ")")
+	}
+
+	u, err := url.Parse(config.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "ldap" && u.Scheme != "ldaps") {
+		return errors.New("auth_ldap: invalid url")
+	}
+	if u.Scheme == "ldap" && !config.StartTLS && !config.AllowPlaintext {
+		return errors.New("auth_ldap: ldap:// sends passwords in the clear, use ldaps:// or start_tls")
+	}
+	if config.UserDN != "" {
+		if strings.Count(config.UserDN, "%s") != 1 {
+			return errors.New("auth_ldap: user_dn must contain one %s")
+		}
+	} else if config.BaseDN == "" || config.BindDN == "" {
+		return errors.New("auth_ldap: either user_dn or base_dn with bind_dn must be provided")
+	}
+	if config.GroupBaseDN != "" && config.BindDN == "" && config.UserDN == "" {
+		return errors.New("auth_ldap: group search requires a bind")
+	}
+	if config.Timeout < 0 || strings.Contains(config.TagNamespace, ":") {
+		return errors.New("auth_ldap: invalid config values")
+	}
+
+	a.serverURL = config.URL
+	a.timeout = defaultTimeout
+	if config.Timeout > 0 {
+		a.timeout = time.Duration(config.Timeout) * time.Second
+	}
+	if u.Scheme == "ldaps" || config.StartTLS {
+		a.tlsConfig = &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: config.InsecureSkipVerify}
+	}
+	a.userDN = config.UserDN
+	a.bindDN = config.BindDN
+	a.bindPassword = config.BindPassword
+	a.baseDN = config.BaseDN
+	a.userAttr = config.UserAttr
+	if a.userAttr == "" {
+		a.userAttr = "uid"
+	}
+	a.userClass = config.UserClass
+	a.nameAttr = config.NameAttr
+	if a.nameAttr == "" {
+		a.nameAttr = "cn"
+	}
+	a.groupAttr = config.GroupAttr
+	a.groupBaseDN = config.GroupBaseDN
+	a.groupMemberAttr = config.GroupMemberAttr
+	if a.groupMemberAttr == "" {
+		a.groupMemberAttr = "member"
+	}
+	a.groups = make(map[string]string, len(config.Groups))
+	for group, tag := range config.Groups {
+		a.groups[strings.ToLower(group)] = tag
+	}
+	a.tagNamespace = config.TagNamespace
+	if a.tagNamespace == "" {
+		a.tagNamespace = defaultTagNamespace
+	}
+	a.addToTags = config.AddToTags
+	a.autoCreate = config.AutoCreate
+
+	return nil
+}
+
+func parseSecret(bsecret []byte) (login, password string, err error) {
+	secret := string(bsecret)
+
+	splitAt := strings.Index(secret, ":")
+	if splitAt < 0 {
+		err = types.ErrMalformed
+		return
+	}
+
+	login = strings.ToLower(strings.TrimSpace(secret[:splitAt]))
+	password = secret[splitAt+1:]
+	if login == "" || len(login) > maxLoginLength {
+		err = types.ErrPolicy
+	}
+	return
+}
+
+// directoryUser is the user as found in the directory.
+type directoryUser struct {
+	name   string
+	groups []string
+}
+
+// verify checks user's credentials against the directory and fetches the user's name and groups.
+func (a *authenticator) verify(login, password string) (*directoryUser, error) {
+	if a.serverURL == "" {
+		return nil, types.ErrUnsupported
+	}
+
+	c, err := dial(a.serverURL, a.timeout, a.tlsConfig)
+	if err != nil {
+		log.Println("ldap: failed to connect", err)
+		return nil, types.ErrInternal
+	}
+	defer c.close()
+
+	attrs := []string{a.nameAttr}
+	if a.groupAttr != "" {
+		attrs = append(attrs, a.groupAttr)
+	}
+
+	var user *entry
+	if a.userDN != "" {
+		// Direct bind, then read own entry.
+		dn := strings.Replace(a.userDN, "%s", escapeDN(login), 1)
+		if err = c.bind(dn, password); err != nil {
+			return nil, resultError(err)
+		}
+		entries, err := c.search(dn, scopeBase, nil, attrs)
+		if err != nil || len(entries) != 1 {
+			log.Println("ldap: failed to read user entry", dn, err)
+			return nil, types.ErrInternal
+		}
+		user = entries[0]
+	} else {
+		// Find the user with the service account, then bind as the user.
+		if err = c.bind(a.bindDN, a.bindPassword); err != nil {
+			log.Println("ldap: service account bind failed", err)
+			return nil, types.ErrInternal
+		}
+		match := map[string]string{a.userAttr: login}
+		if a.userClass != "" {
+			match["objectClass"] = a.userClass
+		}
+		entries, err := c.search(a.baseDN, scopeSub, match, attrs)
+		if err != nil {
+			log.Println("ldap: user search failed", err)
+			return nil, types.ErrInternal
+		}
+		if len(entries) != 1 {
+			// Unknown or ambiguous login.
+			return nil, types.ErrFailed
+		}
+		user = entries[0]
+		if err = c.bind(user.dn, password); err != nil {
+			return nil, resultError(err)
+		}
+		// Group search is performed with the service account's permissions.
+		if a.groupBaseDN != "" {
+			if err = c.bind(a.bindDN, a.bindPassword); err != nil {
+				log.Println("ldap: service account bind failed", err)
+				return nil, types.ErrInternal
+			}
+		}
+	}
+
+	groups := user.attrs[strings.ToLower(a.groupAttr)]
+	if a.groupBaseDN != "" {
+		entries, err := c.search(a.groupBaseDN, scopeSub, map[string]string{a.groupMemberAttr: user.dn}, []string{"cn"})
+		if err != nil {
+			log.Println("ldap: group search failed", err)
+			return nil, types.ErrInternal
+		}
+		for _, e := range entries {
+			groups = append(groups, e.dn)
+		}
+	}
+
+	return &directoryUser{name: user.get(a.nameAttr), groups: groups}, nil
+}
+
+// resultError converts the result of a user bind to an error.
+func resultError(err error) error {
+	if lerr, ok := err.(*ldapError); ok && lerr.code == resultInvalidCredentials {
+		return types.ErrFailed
+	}
+	log.Println("ldap: bind failed", err)
+	return types.ErrInternal
+}
+
+// tags generates tags from user's login and groups.
+func (a *authenticator) tags(login string, groups []string) []string {
+	var tags []string
+	if a.addToTags {
+		tags = append(tags, "ldap:"+login)
+	}
+	seen := make(map[string]bool)
+	for _, dn := range groups {
+		name := strings.ToLower(firstRDNValue(dn))
+		tag := name
+		if len(a.groups) > 0 {
+			var ok bool
+			if tag, ok = a.groups[strings.ToLower(dn)]; !ok {
+				if tag, ok = a.groups[name]; !ok {
+					continue
+				}
+			}
+		}
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, a.tagNamespace+":"+tag)
+	}
+	return tags
+}
+
+// syncTags replaces tags managed by the authenticator, keeping all others.
+func (a *authenticator) syncTags(uid types.Uid, tags []string) ([]string, error) {
+	user, err := store.Users.Get(uid)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, types.ErrNotFound
+	}
+
+	var merged []string
+	changed := false
+	for _, tag := range user.Tags {
+		if strings.HasPrefix(tag, a.tagNamespace+":") || strings.HasPrefix(tag, "ldap:") {
+			changed = true
+			continue
+		}
+		merged = append(merged, tag)
+	}
+	merged = append(merged, tags...)
+
+	// Tags are updated on login only if there are any. Clear them here if the user lost all of them.
+	if len(merged) == 0 && changed {
+		if err = store.Users.Update(uid, map[string]interface{}{"Tags": []string{}}); err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
+
+// AddRecord links the directory account to the user.
+func (a *authenticator) AddRecord(rec *auth.Rec, secret []byte) (*auth.Rec, error) {
+	login, password, err := parseSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	duser, err := a.verify(login, password)
+	if err != nil {
+		return nil, err
+	}
+
+	dup, err := store.Users.AddAuthRecord(rec.Uid, auth.LevelAuth, "ldap", login, []byte{}, time.Time{})
+	if dup {
+		return nil, types.ErrDuplicate
+	} else if err != nil {
+		return nil, err
+	}
+
+	rec.AuthLevel = auth.LevelAuth
+	rec.Tags = a.tags(login, duser.groups)
+	return rec, nil
+}
+
+// UpdateRecord links the user to another directory account.
+func (a *authenticator) UpdateRecord(rec *auth.Rec, secret []byte) error {
+	login, password, err := parseSecret(secret)
+	if err != nil {
+		return err
+	}
+	if _, err = a.verify(login, password); err != nil {
+		return err
+	}
+
+	dup, err := store.Users.UpdateAuthRecord(rec.Uid, auth.LevelAuth, "ldap", login, []byte{}, time.Time{})
+	if dup {
+		return types.ErrDuplicate
+	}
+	return err
+}
+
+// Authenticate binds to the directory as the user and finds the local user. The user is created if not
+// found and auto-creation is enabled. Group tags are re-synced.
+func (a *authenticator) Authenticate(secret []byte) (*auth.Rec, []byte, error) {
+	login, password, err := parseSecret(secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	duser, err := a.verify(login, password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	uid, authLvl, _, _, err := store.Users.GetAuthUniqueRecord("ldap", login)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tags := a.tags(login, duser.groups)
+	if uid.IsZero() {
+		if !a.autoCreate {
+			return nil, nil, types.ErrFailed
+		}
+		if uid, err = a.createUser(login, duser.name, tags); err != nil {
+			return nil, nil, err
+		}
+		authLvl = auth.LevelAuth
+	} else if tags, err = a.syncTags(uid, tags); err != nil {
+		return nil, nil, err
+	}
+
+	return &auth.Rec{
+		Uid:       uid,
+		AuthLevel: authLvl,
+		Tags:      tags}, nil, nil
+}
+
+// IsUnique checks if the login is not linked to any user yet. The directory is not queried.
+func (authenticator) IsUnique(secret []byte) (bool, error) {
+	login, _, err := parseSecret(secret)
+	if err != nil {
+		return false, err
+	}
+
+	uid, _, _, _, err := store.Users.GetAuthUniqueRecord("ldap", login)
+	if err != nil {
+		return false, err
+	}
+	if uid.IsZero() {
+		return true, nil
+	}
+	return false, types.ErrDuplicate
+}
+
+// GenSecret is not supported: passwords are managed by the directory.
+func (authenticator) GenSecret(rec *auth.Rec) ([]byte, time.Time, error) {
+	return nil, time.Time{}, types.ErrUnsupported
+}
+
+// DelRecords deletes the link to the directory account. The directory is not modified.
+func (authenticator) DelRecords(uid types.Uid) error {
+	return store.Users.DelAuthRecords(uid, "ldap")
+}
+
+// createUser creates an account for the directory user.
+func (a *authenticator) createUser(login, name string, tags []string) (types.Uid, error) {
+	user := types.User{
+		Access: types.DefaultAccess{
+			Auth: types.ModeCP2P,
+			Anon: types.ModeNone,
+		},
+		Tags: tags,
+	}
+	if name != "" {
+		user.Public = map[string]interface{}{"fn": name}
+	}
+
+	if _, err := store.Users.Create(&user, nil); err != nil {
+		return types.ZeroUid, err
+	}
+
+	dup, err := store.Users.AddAuthRecord(user.Uid(), auth.LevelAuth, "ldap", login, []byte{}, time.Time{})
+	if err != nil {
+		// Delete incomplete user record.
+		store.Users.Delete(user.Uid(), false)
+		if dup {
+			// Created concurrently by another login.
+			return types.ZeroUid, types.ErrDuplicate
+		}
+		return types.ZeroUid, err
+	}
+
+	log.Println("ldap: created user", user.Uid().UserId())
+	return user.Uid(), nil
+}
+
+func init() {
+	store.RegisterAuthScheme("ldap", &authenticator{})
+}
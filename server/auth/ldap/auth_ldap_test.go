@@ -0,0 +1,387 @@
+package ldap
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nanfengpo/chat/server/auth"
+	"github.com/nanfengpo/chat/server/db/memory"
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+// dirEntry is an entry of the stand-in directory.
+type dirEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// directory is a stand-in LDAP server which supports StartTLS, simple bind and search with equality filters.
+type directory struct {
+	ln        net.Listener
+	tlsConfig *tls.Config
+	// Reject binds before StartTLS.
+	requireTLS bool
+	mu         sync.Mutex
+	entries    []*dirEntry
+}
+
+func newDirectory(t *testing.T, entries ...*dirEntry) *directory {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Self-signed certificate for StartTLS.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}, &x509.Certificate{SerialNumber: big.NewInt(1)}, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &directory{ln: ln, entries: entries, tlsConfig: &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{cert}, PrivateKey: key}}}}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(c)
+		}
+	}()
+	return d
+}
+
+func (d *directory) url() string {
+	return "ldap://" + d.ln.Addr().String()
+}
+
+func (d *directory) close() {
+	d.ln.Close()
+}
+
+// setAttr replaces values of the attribute of the entry.
+func (d *directory) setAttr(dn, attr string, vals ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, e := range d.entries {
+		if e.dn == dn {
+			e.attrs[attr] = vals
+		}
+	}
+}
+
+func result(op byte, code int) []byte {
+	return berConstructed(op, berInt(berEnumerated, code), berString(berOctetString, ""),
+		berString(berOctetString, ""))
+}
+
+func (d *directory) serve(c net.Conn) {
+	defer func() { c.Close() }()
+	r := bufio.NewReader(c)
+	bound, secure := false, false
+	for {
+		msg, err := berRead(r)
+		if err != nil {
+			return
+		}
+		parts, err := msg.children()
+		if err != nil || len(parts) < 2 {
+			return
+		}
+		id := berInt(berInteger, parts[0].int())
+		reply := func(op []byte) {
+			c.Write(berConstructed(berSequence, id, op))
+		}
+
+		op := parts[1]
+		switch op.tag {
+		case opExtendedRequest:
+			args, _ := op.children()
+			if len(args) == 0 || string(args[0].content) != oidStartTLS || secure {
+				// protocolError
+				reply(result(opExtendedResponse, 2))
+				continue
+			}
+			reply(result(opExtendedResponse, resultSuccess))
+			tc := tls.Server(c, d.tlsConfig)
+			if tc.Handshake() != nil {
+				return
+			}
+			c, r, secure = tc, bufio.NewReader(tc), true
+		case opBindRequest:
+			if d.requireTLS && !secure {
+				// confidentialityRequired
+				reply(result(opBindResponse, 13))
+				continue
+			}
+			args, _ := op.children()
+			dn, password := string(args[1].content), string(args[2].content)
+			bound = false
+			d.mu.Lock()
+			for _, e := range d.entries {
+				if strings.EqualFold(e.dn, dn) && e.password != "" && e.password == password {
+					bound = true
+				}
+			}
+			d.mu.Unlock()
+			if bound {
+				reply(result(opBindResponse, resultSuccess))
+			} else {
+				reply(result(opBindResponse, resultInvalidCredentials))
+			}
+		case opSearchRequest:
+			args, _ := op.children()
+			if !bound {
+				// insufficientAccessRights
+				reply(result(opSearchResultDone, 50))
+				continue
+			}
+			base, scope, filter := strings.ToLower(string(args[0].content)), args[1].int(), args[6]
+			d.mu.Lock()
+			for _, e := range d.entries {
+				dn := strings.ToLower(e.dn)
+				if (scope == scopeBase && dn != base) || !strings.HasSuffix(dn, base) || !matches(e, filter) {
+					continue
+				}
+				var attrs [][]byte
+				for name, vals := range e.attrs {
+					var vv [][]byte
+					for _, v := range vals {
+						vv = append(vv, berString(berOctetString, v))
+					}
+					attrs = append(attrs, berConstructed(berSequence,
+						berString(berOctetString, name), berConstructed(berSet, vv...)))
+				}
+				reply(berConstructed(opSearchResultEntry,
+					berString(berOctetString, e.dn), berConstructed(berSequence, attrs...)))
+			}
+			d.mu.Unlock()
+			reply(result(opSearchResultDone, resultSuccess))
+		case opUnbindRequest:
+			return
+		}
+	}
+}
+
+func matches(e *dirEntry, filter *tlv) bool {
+	switch filter.tag {
+	case filterPresent:
+		return true
+	case filterAnd:
+		subs, _ := filter.children()
+		for _, sub := range subs {
+			if !matches(e, sub) {
+				return false
+			}
+		}
+		return true
+	case filterEquality:
+		kv, _ := filter.children()
+		for name, vals := range e.attrs {
+			if strings.EqualFold(name, string(kv[0].content)) {
+				for _, v := range vals {
+					if strings.EqualFold(v, string(kv[1].content)) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+func initStore(t *testing.T) {
+	if err := memory.OpenTestStore(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sorted(tags []string) []string {
+	out := append([]string(nil), tags...)
+	sort.Strings(out)
+	return out
+}
+
+func TestBER(t *testing.T) {
+	for _, val := range []int{0, 1, 127, 128, 255, 256, 65535, -1, -129} {
+		r := bufio.NewReader(strings.NewReader(string(berInt(berInteger, val))))
+		el, err := berRead(r)
+		if err != nil || el.int() != val {
+			t.Error("integer round trip failed", val, err)
+		}
+	}
+
+	long := strings.Repeat("x", 300)
+	r := bufio.NewReader(strings.NewReader(string(berString(berOctetString, long))))
+	if el, err := berRead(r); err != nil || string(el.content) != long {
+		t.Error("long form length round trip failed", err)
+	}
+
+	if got := escapeDN(" a,b=c#"); got != `\ a\,b\=c#` {
+		t.Error("escapeDN:", got)
+	}
+	if got := firstRDNValue(`cn=R\,D,ou=groups,dc=example`); got != "R,D" {
+		t.Error("firstRDNValue:", got)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	initStore(t)
+	defer store.Close()
+
+	dir := newDirectory(t,
+		&dirEntry{dn: "cn=svc,dc=example", password: "svc-secret", attrs: map[string][]string{}},
+		&dirEntry{dn: "uid=alice,ou=people,dc=example", password: "alice-secret", attrs: map[string][]string{
+			"objectClass": {"person"}, "uid": {"alice"}, "cn": {"Alice Johnson"}}},
+		&dirEntry{dn: "cn=eng,ou=groups,dc=example", attrs: map[string][]string{
+			"cn": {"eng"}, "member": {"uid=alice,ou=people,dc=example"}}},
+		&dirEntry{dn: "cn=ops,ou=groups,dc=example", attrs: map[string][]string{
+			"cn": {"ops"}, "member": {"uid=bob,ou=people,dc=example"}}},
+	)
+	defer dir.close()
+
+	dir.requireTLS = true
+
+	a := &authenticator{}
+	if _, _, err := a.Authenticate([]byte("alice:alice-secret")); err != types.ErrUnsupported {
+		t.Fatal("unconfigured authenticator must be unsupported", err)
+	}
+	if err := a.Init(`{"url":"` + dir.url() + `", "user_dn":"uid=%s,ou=people,dc=example"}`); err == nil {
+		t.Fatal("plaintext ldap:// must be refused")
+	}
+	if err := a.Init(`{"url":"` + dir.url() + `", "start_tls":true, "insecure_skip_verify":true, "bind_dn":"cn=svc,dc=example", "bind_password":"svc-secret",
+		"base_dn":"ou=people,dc=example", "user_class":"person", "group_base_dn":"ou=groups,dc=example",
+		"add_to_tags":true, "auto_create":true}`); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{"alice:wrong", "alice:", "bob:alice-secret"} {
+		if _, _, err := a.Authenticate([]byte(secret)); err != types.ErrFailed {
+			t.Error("invalid credentials accepted", secret, err)
+		}
+	}
+	if _, _, err := a.Authenticate([]byte("alice")); err != types.ErrMalformed {
+		t.Error("malformed secret accepted", err)
+	}
+
+	rec, _, err := a.Authenticate([]byte("Alice:alice-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Uid.IsZero() || rec.AuthLevel != auth.LevelAuth {
+		t.Fatal("user not created", rec)
+	}
+	if want := []string{"group:eng", "ldap:alice"}; !reflect.DeepEqual(sorted(rec.Tags), want) {
+		t.Error("tags mismatch", rec.Tags, want)
+	}
+	user, err := store.Users.Get(rec.Uid)
+	if err != nil || user == nil {
+		t.Fatal("created user not found", err)
+	}
+	if public, _ := user.Public.(map[string]interface{}); public["fn"] != "Alice Johnson" {
+		t.Error("name not set", user.Public)
+	}
+
+	// Group membership changes: group tags are re-synced, other tags are kept.
+	dir.setAttr("cn=eng,ou=groups,dc=example", "member")
+	dir.setAttr("cn=ops,ou=groups,dc=example", "member", "uid=alice,ou=people,dc=example")
+	store.Users.Update(rec.Uid, map[string]interface{}{"Tags": []string{"group:eng", "ldap:alice", "hobby"}})
+	rec2, _, err := a.Authenticate([]byte("alice:alice-secret"))
+	if err != nil || rec2.Uid != rec.Uid {
+		t.Fatal("second login failed", err)
+	}
+	if want := []string{"group:ops", "hobby", "ldap:alice"}; !reflect.DeepEqual(sorted(rec2.Tags), want) {
+		t.Error("tags not re-synced", rec2.Tags, want)
+	}
+
+	if ok, err := a.IsUnique([]byte("alice:anything")); ok || err != types.ErrDuplicate {
+		t.Error("linked login reported unique", ok, err)
+	}
+	if ok, err := a.IsUnique([]byte("carol:")); !ok || err != nil {
+		t.Error("unknown login reported taken", ok, err)
+	}
+
+	if err := a.DelRecords(rec.Uid); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := a.IsUnique([]byte("alice:")); !ok || err != nil {
+		t.Error("login still linked after DelRecords", ok, err)
+	}
+}
+
+func TestDirectBind(t *testing.T) {
+	initStore(t)
+	defer store.Close()
+
+	dir := newDirectory(t,
+		&dirEntry{dn: "uid=dave,ou=people,dc=example", password: "dave-secret", attrs: map[string][]string{
+			"uid": {"dave"}, "displayName": {"Dave"},
+			"memberOf": {"cn=Admins,ou=groups,dc=example", "cn=staff,ou=groups,dc=example"}}},
+	)
+	defer dir.close()
+
+	a := &authenticator{}
+	if err := a.Init(`{"url":"` + dir.url() + `", "allow_plaintext":true, "user_dn":"uid=%s,ou=people,dc=example",
+		"name_attr":"displayName", "group_attr":"memberOf", "tag_namespace":"org",
+		"groups":{"cn=admins,ou=groups,dc=example":"admin"}}`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unknown users are not created.
+	if _, _, err := a.Authenticate([]byte("dave:dave-secret")); err != types.ErrFailed {
+		t.Fatal("user created without auto_create", err)
+	}
+
+	// Link an existing user.
+	user := types.User{}
+	if _, err := store.Users.Create(&user, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.AddRecord(&auth.Rec{Uid: user.Uid()}, []byte("dave:wrong")); err != types.ErrFailed {
+		t.Error("linked with invalid password", err)
+	}
+	rec, err := a.AddRecord(&auth.Rec{Uid: user.Uid()}, []byte("dave:dave-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only mapped groups become tags.
+	if want := []string{"org:admin"}; !reflect.DeepEqual(rec.Tags, want) {
+		t.Error("tags mismatch", rec.Tags, want)
+	}
+
+	rec, _, err = a.Authenticate([]byte("dave:dave-secret"))
+	if err != nil || rec.Uid != user.Uid() {
+		t.Fatal("login failed", err)
+	}
+
+	// The last group tag is removed from the user.
+	store.Users.Update(user.Uid(), map[string]interface{}{"Tags": []string{"org:admin"}})
+	dir.setAttr("uid=dave,ou=people,dc=example", "memberOf", "cn=staff,ou=groups,dc=example")
+	if rec, _, err = a.Authenticate([]byte("dave:dave-secret")); err != nil || len(rec.Tags) != 0 {
+		t.Fatal("group tags not removed", rec, err)
+	}
+	if u, _ := store.Users.Get(user.Uid()); len(u.Tags) != 0 {
+		t.Error("stale tags kept", u.Tags)
+	}
+}
@@ -0,0 +1,468 @@
+package ldap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Minimal LDAPv3 client (RFC 4511): StartTLS, simple bind and search with equality filters. Messages are
+// encoded with the subset of BER used by LDAP.
+
+// BER identifiers.
+const (
+	berBoolean     = 0x01
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berEnumerated  = 0x0a
+	berSequence    = 0x30
+	berSet         = 0x31
+
+	// LDAP protocol operations, [APPLICATION n].
+	opBindRequest       = 0x60
+	opBindResponse      = 0x61
+	opUnbindRequest     = 0x42
+	opSearchRequest     = 0x63
+	opSearchResultEntry = 0x64
+	opSearchResultDone  = 0x65
+	opSearchResultRef   = 0x73
+	opExtendedRequest   = 0x77
+	opExtendedResponse  = 0x78
+
+	// Name of the extended request in ExtendedRequest, [0] primitive.
+	extendedRequestName = 0x80
+
+	// Simple authentication in BindRequest, [0] primitive.
+	authSimple = 0x80
+	// Filters.
+	filterAnd      = 0xa0
+	filterEquality = 0xa3
+	filterPresent  = 0x87
+)
+
+// Name of the StartTLS extended operation (RFC 4511, section 4.14).
+const oidStartTLS = "1.3.6.1.4.1.1466.20037"
+
+// Search scopes.
+const (
+	scopeBase = 0
+	scopeSub  = 2
+)
+
+// Result codes.
+const (
+	resultSuccess            = 0
+	resultInvalidCredentials = 49
+)
+
+// Maximum size of a message from the server.
+const maxMessageSize = 1 << 20
+
+// ldapError is an unsuccessful result of an operation.
+type ldapError struct {
+	code    int
+	message string
+}
+
+func (e *ldapError) Error() string {
+	return "ldap: result " + strconv.Itoa(e.code) + ": " + e.message
+}
+
+// tlv is a decoded BER element.
+type tlv struct {
+	tag     byte
+	content []byte
+}
+
+// berEncode encodes one element.
+func berEncode(tag byte, content []byte) []byte {
+	out := []byte{tag}
+	if n := len(content); n < 0x80 {
+		out = append(out, byte(n))
+	} else {
+		var size []byte
+		for ; n > 0; n >>= 8 {
+			size = append([]byte{byte(n)}, size...)
+		}
+		out = append(out, 0x80|byte(len(size)))
+		out = append(out, size...)
+	}
+	return append(out, content...)
+}
+
+func berInt(tag byte, val int) []byte {
+	// Minimal two's complement encoding.
+	var content []byte
+	for {
+		content = append([]byte{byte(val)}, content...)
+		if (val < 0x80 && val >= -0x80) || len(content) >= 4 {
+			break
+		}
+		val >>= 8
+	}
+	return berEncode(tag, content)
+}
+
+func berString(tag byte, val string) []byte {
+	return berEncode(tag, []byte(val))
+}
+
+func berBool(val bool) []byte {
+	if val {
+		return berEncode(berBoolean, []byte{0xff})
+	}
+	return berEncode(berBoolean, []byte{0})
+}
+
+func berConstructed(tag byte, parts ...[]byte) []byte {
+	var content []byte
+	for _, p := range parts {
+		content = append(content, p...)
+	}
+	return berEncode(tag, content)
+}
+
+// berRead reads one element from the stream.
+func berRead(r *bufio.Reader) (*tlv, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	size := int(first)
+	if first&0x80 != 0 {
+		n := int(first & 0x7f)
+		if n == 0 || n > 4 {
+			return nil, errors.New("ldap: unsupported length")
+		}
+		size = 0
+		for i := 0; i < n; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			size = size<<8 | int(b)
+		}
+	}
+	if size > maxMessageSize {
+		return nil, errors.New("ldap: message too large")
+	}
+	content := make([]byte, size)
+	if _, err = io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return &tlv{tag: tag, content: content}, nil
+}
+
+// children decodes the content of a constructed element.
+func (t *tlv) children() ([]*tlv, error) {
+	var out []*tlv
+	r := bufio.NewReader(strings.NewReader(string(t.content)))
+	for {
+		child, err := berRead(r)
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, child)
+	}
+}
+
+func (t *tlv) int() int {
+	val := 0
+	for i, b := range t.content {
+		if i == 0 && b&0x80 != 0 {
+			val = -1
+		}
+		val = val<<8 | int(b)
+	}
+	return val
+}
+
+// ldapResult parses the LDAPResult of a response.
+func ldapResult(op *tlv) error {
+	parts, err := op.children()
+	if err != nil || len(parts) < 3 {
+		return errors.New("ldap: malformed result")
+	}
+	if code := parts[0].int(); code != resultSuccess {
+		return &ldapError{code: code, message: string(parts[2].content)}
+	}
+	return nil
+}
+
+// entry is a search result.
+type entry struct {
+	dn    string
+	attrs map[string][]string
+}
+
+// get returns the first value of the attribute.
+func (e *entry) get(attr string) string {
+	if vals := e.attrs[strings.ToLower(attr)]; len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+// conn is a connection to an LDAP server.
+type conn struct {
+	nc      net.Conn
+	r       *bufio.Reader
+	msgID   int
+	timeout time.Duration
+}
+
+// dial connects to the server given as ldap://host:port or ldaps://host:port. Plain ldap:// connections
+// are upgraded with StartTLS if tlsConfig is not nil.
+func dial(addr string, timeout time.Duration, tlsConfig *tls.Config) (*conn, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	var nc net.Conn
+	dialer := &net.Dialer{Timeout: timeout}
+	switch u.Scheme {
+	case "ldap":
+		if u.Port() == "" {
+			host += ":389"
+		}
+		nc, err = dialer.Dial("tcp", host)
+	case "ldaps":
+		if u.Port() == "" {
+			host += ":636"
+		}
+		nc, err = tls.DialWithDialer(dialer, "tcp", host, tlsConfig)
+	default:
+		return nil, errors.New("ldap: unsupported URL scheme '" + u.Scheme + "'")
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{nc: nc, r: bufio.NewReader(nc), timeout: timeout}
+	if u.Scheme == "ldap" && tlsConfig != nil {
+		if err = c.startTLS(tlsConfig); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// startTLS upgrades the connection to TLS.
+func (c *conn) startTLS(tlsConfig *tls.Config) error {
+	id, err := c.send(berConstructed(opExtendedRequest, berString(extendedRequestName, oidStartTLS)))
+	if err != nil {
+		return err
+	}
+	resp, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if resp.tag != opExtendedResponse {
+		return errors.New("ldap: unexpected response to StartTLS")
+	}
+	if err = ldapResult(resp); err != nil {
+		return err
+	}
+
+	tc := tls.Client(c.nc, tlsConfig)
+	tc.SetDeadline(time.Now().Add(c.timeout))
+	if err = tc.Handshake(); err != nil {
+		return err
+	}
+	c.nc = tc
+	c.r = bufio.NewReader(tc)
+	return nil
+}
+
+// send sends a request and returns its message ID.
+func (c *conn) send(op []byte) (int, error) {
+	c.msgID++
+	c.nc.SetDeadline(time.Now().Add(c.timeout))
+	_, err := c.nc.Write(berConstructed(berSequence, berInt(berInteger, c.msgID), op))
+	return c.msgID, err
+}
+
+// receive reads the next response to the given request and returns its protocol operation.
+func (c *conn) receive(msgID int) (*tlv, error) {
+	for {
+		msg, err := berRead(c.r)
+		if err != nil {
+			return nil, err
+		}
+		parts, err := msg.children()
+		if err != nil || msg.tag != berSequence || len(parts) < 2 {
+			return nil, errors.New("ldap: malformed message")
+		}
+		// Skip unsolicited notifications and responses to other requests.
+		if parts[0].int() == msgID {
+			return parts[1], nil
+		}
+	}
+}
+
+// bind authenticates the connection. An empty password is rejected: the server would treat it as
+// an unauthenticated bind which always succeeds.
+func (c *conn) bind(dn, password string) error {
+	if password == "" {
+		return &ldapError{code: resultInvalidCredentials, message: "empty password"}
+	}
+	id, err := c.send(berConstructed(opBindRequest,
+		berInt(berInteger, 3),
+		berString(berOctetString, dn),
+		berString(authSimple, password)))
+	if err != nil {
+		return err
+	}
+	resp, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if resp.tag != opBindResponse {
+		return errors.New("ldap: unexpected response to bind")
+	}
+	return ldapResult(resp)
+}
+
+// search finds entries which match all the given attribute values.
+func (c *conn) search(base string, scope int, match map[string]string, attrs []string) ([]*entry, error) {
+	var filters [][]byte
+	for attr, val := range match {
+		filters = append(filters, berConstructed(filterEquality,
+			berString(berOctetString, attr), berString(berOctetString, val)))
+	}
+	var filter []byte
+	switch len(filters) {
+	case 0:
+		filter = berString(filterPresent, "objectClass")
+	case 1:
+		filter = filters[0]
+	default:
+		filter = berConstructed(filterAnd, filters...)
+	}
+
+	var attrList [][]byte
+	for _, a := range attrs {
+		attrList = append(attrList, berString(berOctetString, a))
+	}
+
+	id, err := c.send(berConstructed(opSearchRequest,
+		berString(berOctetString, base),
+		berInt(berEnumerated, scope),
+		// Never dereference aliases.
+		berInt(berEnumerated, 0),
+		// No size limit, time limit in seconds.
+		berInt(berInteger, 0),
+		berInt(berInteger, int(c.timeout/time.Second)),
+		berBool(false),
+		filter,
+		berConstructed(berSequence, attrList...)))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*entry
+	for {
+		resp, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch resp.tag {
+		case opSearchResultEntry:
+			e, err := parseEntry(resp)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+		case opSearchResultRef:
+			// Referrals are not followed.
+		case opSearchResultDone:
+			return entries, ldapResult(resp)
+		default:
+			return nil, errors.New("ldap: unexpected response to search")
+		}
+	}
+}
+
+func parseEntry(op *tlv) (*entry, error) {
+	parts, err := op.children()
+	if err != nil || len(parts) < 2 {
+		return nil, errors.New("ldap: malformed entry")
+	}
+	e := &entry{dn: string(parts[0].content), attrs: make(map[string][]string)}
+	attrs, err := parts[1].children()
+	if err != nil {
+		return nil, err
+	}
+	for _, attr := range attrs {
+		kv, err := attr.children()
+		if err != nil || len(kv) < 2 {
+			return nil, errors.New("ldap: malformed attribute")
+		}
+		vals, err := kv[1].children()
+		if err != nil {
+			return nil, err
+		}
+		name := strings.ToLower(string(kv[0].content))
+		for _, v := range vals {
+			e.attrs[name] = append(e.attrs[name], string(v.content))
+		}
+	}
+	return e, nil
+}
+
+// close unbinds and closes the connection.
+func (c *conn) close() {
+	c.send(berEncode(opUnbindRequest, nil))
+	c.nc.Close()
+}
+
+// escapeDN escapes special characters of an attribute value in a DN, RFC 4514.
+func escapeDN(val string) string {
+	var b strings.Builder
+	for i := 0; i < len(val); i++ {
+		ch := val[i]
+		switch {
+		case strings.IndexByte(",+\"\\<>;=", ch) >= 0,
+			i == 0 && (ch == ' ' || ch == '#'),
+			i == len(val)-1 && ch == ' ':
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case ch == 0:
+			b.WriteString("\\00")
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+// firstRDNValue returns the value of the first RDN of the DN, e.g. "eng" of "cn=eng,ou=groups,dc=example".
+func firstRDNValue(dn string) string {
+	rdn := dn
+	for i := 0; i < len(dn); i++ {
+		if dn[i] == '\\' {
+			i++
+		} else if dn[i] == ',' || dn[i] == '+' {
+			rdn = dn[:i]
+			break
+		}
+	}
+	if eq := strings.IndexByte(rdn, '='); eq >= 0 {
+		rdn = rdn[eq+1:]
+	}
+	return strings.Replace(strings.TrimSpace(rdn), "\\", "", -1)
+}
@@ -0,0 +1,474 @@
+// Package oidc implements authentication by OpenID Connect ID tokens. The token is obtained by the client
+// from the identity provider and sent to the server as the secret. The server verifies the signature
+// of the token with the provider's public keys (JWKS) and maps the 'sub' claim to the user. Accounts are
+// created on the first login if configured.
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"hash"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nanfengpo/chat/server/auth"
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+const (
+	// Allowed clock difference between the server and the identity provider.
+	defaultLeeway = time.Minute
+	// Timeout of requests to the identity provider.
+	defaultTimeout = 10 * time.Second
+
+	// Length of the hash of the subject used as the unique value of auth records. 20 bytes base64-encoded are
+	// 27 characters, which with the 'oidc:' prefix fits the 32 characters limit of auth records.
+	subjectHashLength = 20
+)
+
+// authenticator is a singleton instance of the authenticator.
+type authenticator struct {
+	// Expected value of the 'iss' claim.
+	issuer string
+	// Expected value of the 'aud' claim.
+	clientID string
+	keys     *keySet
+	leeway   time.Duration
+
+	// Create accounts for unknown users.
+	autoCreate bool
+	// The identity provider has verified the user: skip validation of credentials.
+	validated bool
+	// Claim to use as user's name.
+	nameClaim string
+	// Claim name -> tag namespace.
+	tagClaims map[string]string
+}
+
+// Init initializes the authenticator.
+func (a *authenticator) Init(jsonconf string) error {
+	if a.keys != nil {
+		return errors.New("auth_oidc: already initialized")
+	}
+
+	type configType struct {
+		// URL of the identity provider, the value of the 'iss' claim.
+		Issuer string `json:"issuer"`
+		// Client ID of the application registered with the provider, the value of the 'aud' claim.
+		ClientID string `json:"client_id"`
+		// URL of the provider's keys. Discovered from the issuer URL if missing.
+		JwksURL string `json:"jwks_url"`
+		// Allowed clock difference in seconds.
+		Leeway *int `json:"leeway"`
+		// Timeout of requests to the provider in seconds.
+		Timeout int `json:"timeout"`
+		// Create an account on the first login.
+		AutoCreate bool `json:"auto_create"`
+		// The provider is trusted to have verified user's credentials.
+		Validated bool `json:"validated"`
+		// Claim to use as user's name, like "name".
+		NameClaim string `json:"name_claim"`
+		// Claims which become tags, like {"email": "email"} for tag 'email:alice@example.com'.
+		TagClaims map[string]string `json:"tag_claims"`
+	}
+	var config configType
+	if err := json.Unmarshal([]byte(jsonconf), &config); err != nil {
+		return errors.New("auth_oidc: failed to parse config: " + err.Error() + "(" + jsonconf + ")")
+	}
+
+	if u, err := url.Parse(config.Issuer); err != nil || u.Host == "" {
+		return errors.New("auth_oidc: invalid issuer")
+	}
+	if config.ClientID == "" {
+		return errors.New("auth_oidc: missing client_id")
+	}
+	if config.Leeway != nil && *config.Leeway < 0 || config.Timeout < 0 {
+		return errors.New("auth_oidc: invalid config values")
+	}
+
+	a.issuer = config.Issuer
+	a.clientID = config.ClientID
+	a.leeway = defaultLeeway
+	if config.Leeway != nil {
+		a.leeway = time.Duration(*config.Leeway) * time.Second
+	}
+	timeout := defaultTimeout
+	if config.Timeout > 0 {
+		timeout = time.Duration(config.Timeout) * time.Second
+	}
+	a.keys = &keySet{issuer: config.Issuer, jwksURL: config.JwksURL, client: &http.Client{Timeout: timeout}}
+	a.autoCreate = config.AutoCreate
+	a.validated = config.Validated
+	a.nameClaim = config.NameClaim
+	a.tagClaims = config.TagClaims
+
+	return nil
+}
+
+// AddRecord links the identity from the ID token to the user.
+func (a *authenticator) AddRecord(rec *auth.Rec, secret []byte) (*auth.Rec, error) {
+	claims, err := a.verify(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	dup, err := store.Users.AddAuthRecord(rec.Uid, auth.LevelAuth, "oidc", a.unique(claims), []byte{}, time.Time{})
+	if dup {
+		return nil, types.ErrDuplicate
+	} else if err != nil {
+		return nil, err
+	}
+
+	rec.AuthLevel = auth.LevelAuth
+	rec.Tags = a.tags(claims)
+	return rec, nil
+}
+
+// UpdateRecord links the user to another identity.
+func (a *authenticator) UpdateRecord(rec *auth.Rec, secret []byte) error {
+	claims, err := a.verify(secret)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.Users.UpdateAuthRecord(rec.Uid, auth.LevelAuth, "oidc", a.unique(claims), []byte{}, time.Time{})
+	return err
+}
+
+// Authenticate verifies the ID token and finds the user. The user is created if not found and
+// auto-creation is enabled.
+func (a *authenticator) Authenticate(secret []byte) (*auth.Rec, []byte, error) {
+	claims, err := a.verify(secret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	unique := a.unique(claims)
+	uid, authLvl, _, _, err := store.Users.GetAuthUniqueRecord("oidc", unique)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tags := a.tags(claims)
+	if uid.IsZero() {
+		if !a.autoCreate {
+			return nil, nil, types.ErrFailed
+		}
+		if uid, err = a.createUser(unique, claims, tags); err != nil {
+			return nil, nil, err
+		}
+		authLvl = auth.LevelAuth
+	} else if tags, err = a.syncTags(uid, tags); err != nil {
+		return nil, nil, err
+	}
+
+	var features auth.Feature
+	if a.validated {
+		features = auth.Validated
+	}
+
+	// Lifetime of the session token does not depend on expiration of the ID token.
+	return &auth.Rec{
+		Uid:       uid,
+		AuthLevel: authLvl,
+		Features:  features,
+		Tags:      tags}, nil, nil
+}
+
+// IsUnique checks if the identity is not linked to any user yet.
+func (a *authenticator) IsUnique(secret []byte) (bool, error) {
+	claims, err := a.verify(secret)
+	if err != nil {
+		return false, err
+	}
+
+	uid, _, _, _, err := store.Users.GetAuthUniqueRecord("oidc", a.unique(claims))
+	if err != nil {
+		return false, err
+	}
+	if uid.IsZero() {
+		return true, nil
+	}
+	return false, types.ErrDuplicate
+}
+
+// GenSecret is not supported: ID tokens are issued by the identity provider.
+func (authenticator) GenSecret(rec *auth.Rec) ([]byte, time.Time, error) {
+	return nil, time.Time{}, types.ErrUnsupported
+}
+
+// DelRecords deletes the link to the identity.
+func (authenticator) DelRecords(uid types.Uid) error {
+	return store.Users.DelAuthRecords(uid, "oidc")
+}
+
+// createUser creates an account for the new identity.
+func (a *authenticator) createUser(unique string, claims map[string]interface{}, tags []string) (types.Uid, error) {
+	user := types.User{
+		Access: types.DefaultAccess{
+			Auth: types.ModeCP2P,
+			Anon: types.ModeNone,
+		},
+		Tags: tags,
+	}
+	if name, ok := claims[a.nameClaim].(string); ok && name != "" {
+		user.Public = map[string]interface{}{"fn": name}
+	}
+
+	if _, err := store.Users.Create(&user, nil); err != nil {
+		return types.ZeroUid, err
+	}
+
+	dup, err := store.Users.AddAuthRecord(user.Uid(), auth.LevelAuth, "oidc", unique, []byte{}, time.Time{})
+	if err != nil {
+		// Delete incomplete user record.
+		store.Users.Delete(user.Uid(), false)
+		if dup {
+			// Created concurrently by another login.
+			return types.ZeroUid, types.ErrDuplicate
+		}
+		return types.ZeroUid, err
+	}
+
+	log.Println("oidc: created user", user.Uid().UserId())
+	return user.Uid(), nil
+}
+
+// unique returns the value which identifies the user in auth records: a hash of the issuer and the subject.
+// The subject can be up to 255 characters long, too long for auth records.
+func (a *authenticator) unique(claims map[string]interface{}) string {
+	sub, _ := claims["sub"].(string)
+	sum := sha256.Sum256([]byte(a.issuer + " " + sub))
+	return base64.RawURLEncoding.EncodeToString(sum[:subjectHashLength])
+}
+
+// tags generates tags from the configured claims. Claims can be strings or arrays of strings.
+func (a *authenticator) tags(claims map[string]interface{}) []string {
+	var tags []string
+	for claim, ns := range a.tagClaims {
+		var values []string
+		switch val := claims[claim].(type) {
+		case string:
+			values = []string{val}
+		case []interface{}:
+			for _, v := range val {
+				if str, ok := v.(string); ok {
+					values = append(values, str)
+				}
+			}
+		}
+		for _, val := range values {
+			if val == "" {
+				continue
+			}
+			if ns != "" {
+				val = ns + ":" + val
+			}
+			tags = append(tags, val)
+		}
+	}
+	return tags
+}
+
+// syncTags replaces tags in the namespaces of the configured claims, keeping all others.
+func (a *authenticator) syncTags(uid types.Uid, tags []string) ([]string, error) {
+	if len(a.tagClaims) == 0 {
+		return tags, nil
+	}
+
+	user, err := store.Users.Get(uid)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, types.ErrNotFound
+	}
+
+	fresh := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		fresh[tag] = true
+	}
+	var merged []string
+	changed := false
+	for _, tag := range user.Tags {
+		if fresh[tag] {
+			// Added back below.
+			continue
+		}
+		if a.managedTag(tag) {
+			changed = true
+			continue
+		}
+		merged = append(merged, tag)
+	}
+	merged = append(merged, tags...)
+
+	// Tags are updated on login only if there are any. Clear them here if the user lost all of them.
+	if len(merged) == 0 && changed {
+		if err = store.Users.Update(uid, map[string]interface{}{"Tags": []string{}}); err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
+
+// managedTag checks if the tag is in the namespace of one of the configured claims. Tags of claims
+// without a namespace cannot be told apart from other tags and are never removed.
+func (a *authenticator) managedTag(tag string) bool {
+	for _, ns := range a.tagClaims {
+		if ns != "" && strings.HasPrefix(tag, ns+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// verify checks the signature and the claims of the ID token and returns the claims.
+func (a *authenticator) verify(token []byte) (map[string]interface{}, error) {
+	if a.keys == nil {
+		return nil, types.ErrUnsupported
+	}
+
+	parts := strings.Split(string(token), ".")
+	if len(parts) != 3 {
+		return nil, types.ErrMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, types.ErrMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, types.ErrMalformed
+	}
+
+	key, err := a.keys.get(header.Kid)
+	if err != nil {
+		if err != types.ErrFailed {
+			log.Println("oidc: failed to get keys of the issuer", err)
+			return nil, types.ErrInternal
+		}
+		return nil, err
+	}
+	if err = verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, types.ErrMalformed
+	}
+
+	if iss, _ := claims["iss"].(string); iss != a.issuer {
+		return nil, types.ErrFailed
+	}
+	if !audienceContains(claims["aud"], a.clientID) {
+		return nil, types.ErrFailed
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, types.ErrMalformed
+	}
+
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, types.ErrMalformed
+	}
+	if time.Unix(int64(exp), 0).Add(a.leeway).Before(now) {
+		return nil, types.ErrExpired
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && time.Unix(int64(nbf), 0).Add(-a.leeway).After(now) {
+		return nil, types.ErrFailed
+	}
+	if iat, ok := claims["iat"].(float64); ok && time.Unix(int64(iat), 0).Add(-a.leeway).After(now) {
+		return nil, types.ErrFailed
+	}
+
+	return claims, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// audienceContains checks the 'aud' claim which is either a string or an array of strings.
+func audienceContains(aud interface{}, clientID string) bool {
+	switch val := aud.(type) {
+	case string:
+		return val == clientID
+	case []interface{}:
+		for _, v := range val {
+			if v == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifySignature checks the JWS signature of the signed content. The algorithm must match the type of the key.
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	var hasher hash.Hash
+	var hashType crypto.Hash
+	if len(alg) != 5 {
+		return types.ErrFailed
+	}
+	switch alg[2:] {
+	case "256":
+		hasher, hashType = sha256.New(), crypto.SHA256
+	case "384":
+		hasher, hashType = sha512.New384(), crypto.SHA384
+	case "512":
+		hasher, hashType = sha512.New(), crypto.SHA512
+	default:
+		return types.ErrFailed
+	}
+	hasher.Write([]byte(signed))
+	digest := hasher.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return types.ErrFailed
+		}
+		if rsa.VerifyPKCS1v15(pub, hashType, digest, sig) != nil {
+			return types.ErrFailed
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(sig) != 2*size {
+			return types.ErrFailed
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return types.ErrFailed
+		}
+		return nil
+	}
+	return types.ErrFailed
+}
+
+func init() {
+	store.RegisterAuthScheme("oidc", &authenticator{})
+}
@@ -0,0 +1,247 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nanfengpo/chat/server/auth"
+	"github.com/nanfengpo/chat/server/db/memory"
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+// issuer is a stand-in identity provider: it publishes the discovery document and the keys,
+// and issues ID tokens.
+type issuer struct {
+	*httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+	// Number of requests for keys.
+	jwksRequests int32
+}
+
+func newIssuer(t *testing.T) *issuer {
+	iss := &issuer{}
+	var err error
+	if iss.rsaKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal(err)
+	}
+	if iss.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(wrt http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(wrt).Encode(map[string]string{"issuer": iss.URL, "jwks_uri": iss.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(wrt http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&iss.jwksRequests, 1)
+		json.NewEncoder(wrt).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa1", "use": "sig", "alg": "RS256",
+				"n": b64(iss.rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(iss.rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec1", "crv": "P-256",
+				"x": b64(iss.ecKey.X.Bytes()), "y": b64(iss.ecKey.Y.Bytes())},
+			{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+		}})
+	})
+	iss.Server = httptest.NewServer(mux)
+	return iss
+}
+
+// token issues an ID token signed with the key of the given kind.
+func (iss *issuer) token(t *testing.T, kid string, claims map[string]interface{}) []byte {
+	alg := "RS256"
+	if kid == "ec1" {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	var err error
+	if alg == "RS256" {
+		sig, err = rsa.SignPKCS1v15(rand.Reader, iss.rsaKey, crypto.SHA256, digest[:])
+	} else {
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, iss.ecKey, digest[:])
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []byte(signed + "." + base64.RawURLEncoding.EncodeToString(sig))
+}
+
+func (iss *issuer) claims(sub string) map[string]interface{} {
+	now := time.Now().Unix()
+	return map[string]interface{}{
+		"iss":    iss.URL,
+		"aud":    []string{"chat-app", "other"},
+		"sub":    sub,
+		"iat":    now,
+		"exp":    now + 300,
+		"name":   "Alice Smith",
+		"email":  "alice@example.com",
+		"groups": []string{"eng", "admins"},
+	}
+}
+
+func newAuthenticator(t *testing.T, iss *issuer, extra string) *authenticator {
+	a := &authenticator{}
+	if err := a.Init(`{"issuer":"` + iss.URL + `","client_id":"chat-app","auto_create":true,` +
+		`"name_claim":"name","tag_claims":{"email":"email","groups":"group"}` + extra + `}`); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestVerify(t *testing.T) {
+	iss := newIssuer(t)
+	defer iss.Close()
+	a := newAuthenticator(t, iss, "")
+
+	if _, err := a.verify(iss.token(t, "rsa1", iss.claims("alice"))); err != nil {
+		t.Error("RS256:", err)
+	}
+	if _, err := a.verify(iss.token(t, "ec1", iss.claims("alice"))); err != nil {
+		t.Error("ES256:", err)
+	}
+
+	tests := map[string]struct {
+		mutate func(map[string]interface{})
+		want   error
+	}{
+		"wrong issuer":   {func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }, types.ErrFailed},
+		"wrong audience": {func(c map[string]interface{}) { c["aud"] = "other" }, types.ErrFailed},
+		"expired":        {func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, types.ErrExpired},
+		"not yet valid":  {func(c map[string]interface{}) { c["nbf"] = time.Now().Add(time.Hour).Unix() }, types.ErrFailed},
+		"missing sub":    {func(c map[string]interface{}) { delete(c, "sub") }, types.ErrMalformed},
+	}
+	for name, tc := range tests {
+		claims := iss.claims("alice")
+		tc.mutate(claims)
+		if _, err := a.verify(iss.token(t, "rsa1", claims)); err != tc.want {
+			t.Errorf("%s: got %v, want %v", name, err, tc.want)
+		}
+	}
+
+	// Tampered payload.
+	token := iss.token(t, "rsa1", iss.claims("alice"))
+	parts := strings.Split(string(token), ".")
+	forged, _ := json.Marshal(iss.claims("mallory"))
+	parts[1] = base64.RawURLEncoding.EncodeToString(forged)
+	if _, err := a.verify([]byte(strings.Join(parts, "."))); err != types.ErrFailed {
+		t.Error("tampered token: got", err)
+	}
+
+	// Algorithm must match the key: 'none' and HMAC with the public key are rejected.
+	header, _ := json.Marshal(map[string]string{"alg": "none", "kid": "rsa1"})
+	parts[0] = base64.RawURLEncoding.EncodeToString(header)
+	parts[2] = ""
+	if _, err := a.verify([]byte(strings.Join(parts, "."))); err != types.ErrFailed {
+		t.Error("alg none: got", err)
+	}
+
+	// Unknown key ID causes refetch of keys, but not too often.
+	requests := atomic.LoadInt32(&iss.jwksRequests)
+	if _, err := a.verify(iss.token(t, "hmac", iss.claims("alice"))); err != types.ErrFailed {
+		t.Error("unknown key: got", err)
+	}
+	if atomic.LoadInt32(&iss.jwksRequests) != requests {
+		t.Error("keys must not be refetched right away")
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	if err := memory.OpenTestStore(); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	iss := newIssuer(t)
+	defer iss.Close()
+
+	// Unknown users are rejected unless auto-creation is enabled.
+	a := newAuthenticator(t, iss, `,"auto_create":false`)
+	if _, _, err := a.Authenticate(iss.token(t, "rsa1", iss.claims("alice"))); err != types.ErrFailed {
+		t.Error("unknown user without auto-creation: got", err)
+	}
+
+	a = newAuthenticator(t, iss, `,"validated":true`)
+	rec, _, err := a.Authenticate(iss.token(t, "rsa1", iss.claims("alice")))
+	if err != nil {
+		t.Fatal("first login:", err)
+	}
+	if rec.AuthLevel != auth.LevelAuth || rec.Features != auth.Validated {
+		t.Error("unexpected auth record", rec)
+	}
+	sort.Strings(rec.Tags)
+	if strings.Join(rec.Tags, ",") != "email:alice@example.com,group:admins,group:eng" {
+		t.Error("unexpected tags", rec.Tags)
+	}
+	user, err := store.Users.Get(rec.Uid)
+	if err != nil || user == nil {
+		t.Fatal("user is not created", err)
+	}
+	if fn := user.Public.(map[string]interface{})["fn"]; fn != "Alice Smith" {
+		t.Error("unexpected public", user.Public)
+	}
+
+	// The same subject is mapped to the same user.
+	again, _, err := a.Authenticate(iss.token(t, "ec1", iss.claims("alice")))
+	if err != nil || again.Uid != rec.Uid {
+		t.Error("second login:", again, err)
+	}
+	// Tags of the claims are replaced, other tags are kept.
+	if err = store.Users.Update(rec.Uid, map[string]interface{}{
+		"Tags": []string{"email:alice@example.com", "group:admins", "group:eng", "tel:+15551234567"}}); err != nil {
+		t.Fatal(err)
+	}
+	claims := iss.claims("alice")
+	claims["groups"] = []string{"eng", "ops"}
+	again, _, err = a.Authenticate(iss.token(t, "rsa1", claims))
+	if err != nil {
+		t.Fatal("login with new claims:", err)
+	}
+	sort.Strings(again.Tags)
+	if strings.Join(again.Tags, ",") != "email:alice@example.com,group:eng,group:ops,tel:+15551234567" {
+		t.Error("unexpected tags after login", again.Tags)
+	}
+
+	if ok, err := a.IsUnique(iss.token(t, "rsa1", iss.claims("alice"))); ok || err != types.ErrDuplicate {
+		t.Error("IsUnique of a known subject:", ok, err)
+	}
+
+	// Another subject is another user.
+	bob, _, err := a.Authenticate(iss.token(t, "rsa1", iss.claims("bob")))
+	if err != nil || bob.Uid == rec.Uid {
+		t.Error("another subject:", bob, err)
+	}
+
+	// Deleted link: the subject is unknown again.
+	if err = a.DelRecords(bob.Uid); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := a.IsUnique(iss.token(t, "rsa1", iss.claims("bob"))); !ok || err != nil {
+		t.Error("IsUnique after DelRecords:", ok, err)
+	}
+}
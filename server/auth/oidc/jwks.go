@@ -0,0 +1,177 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+const (
+	// Keys are fetched again after this time even if they are all known.
+	keysMaxAge = time.Hour
+	// Unknown key IDs don't cause refetching more often than this.
+	keysMinRefresh = time.Minute
+	// Maximum size of responses of the issuer.
+	maxResponseSize = 1 << 20
+)
+
+// jwk is a JSON Web Key, RFC 7517. Only public RSA and EC keys are used.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey converts the JWK to a public key.
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) > 4 {
+			return nil, errors.New("oidc: invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New("oidc: unsupported curve " + k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("oidc: invalid EC key")
+		}
+		return key, nil
+	}
+	return nil, errors.New("oidc: unsupported key type " + k.Kty)
+}
+
+// keySet is a cache of the issuer's signing keys fetched from its JWKS endpoint.
+type keySet struct {
+	sync.Mutex
+	// Issuer URL, used for discovery of the JWKS URL if jwksURL is not configured.
+	issuer  string
+	jwksURL string
+	client  *http.Client
+
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// getJSON fetches a JSON document.
+func (ks *keySet) getJSON(url string, v interface{}) error {
+	resp, err := ks.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("oidc: " + url + " responded with " + resp.Status)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// refresh fetches the keys. Must be called with the lock held.
+func (ks *keySet) refresh() error {
+	ks.fetched = time.Now()
+
+	if ks.jwksURL == "" {
+		var discovery struct {
+			JwksURI string `json:"jwks_uri"`
+		}
+		if err := ks.getJSON(strings.TrimSuffix(ks.issuer, "/")+"/.well-known/openid-configuration",
+			&discovery); err != nil {
+			return err
+		}
+		if discovery.JwksURI == "" {
+			return errors.New("oidc: issuer does not provide jwks_uri")
+		}
+		ks.jwksURL = discovery.JwksURI
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := ks.getJSON(ks.jwksURL, &set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for i := range set.Keys {
+		k := &set.Keys[i]
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// Keys of unsupported types are skipped.
+		if pub, err := k.publicKey(); err == nil {
+			keys[k.Kid] = pub
+		}
+	}
+	ks.keys = keys
+	return nil
+}
+
+// get returns the key with the given ID. Keys are fetched again if the key is unknown: the issuer
+// may have rotated its keys.
+func (ks *keySet) get(kid string) (crypto.PublicKey, error) {
+	ks.Lock()
+	defer ks.Unlock()
+
+	key, ok := ks.keys[kid]
+	age := time.Since(ks.fetched)
+	if (!ok && age > keysMinRefresh) || age > keysMaxAge {
+		if err := ks.refresh(); err == nil {
+			key, ok = ks.keys[kid]
+		} else if !ok {
+			return nil, err
+		}
+		// Known keys remain valid if the issuer is temporarily unavailable.
+	}
+	if !ok {
+		return nil, types.ErrFailed
+	}
+	return key, nil
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"errors"
+	"strconv"
 	"time"
 
 	"github.com/nanfengpo/chat/server/auth"
@@ -22,7 +23,7 @@ type authenticator struct {
 }
 
 // tokenLayout defines positioning of various bytes in token.
-// [8:UID][4:expires][2:authLevel][2:serial-number][2:feature-bits][32:signature] = 50 bytes
+// [8:UID][4:expires][2:authLevel][2:serial-number][2:feature-bits][4:generation][32:signature] = 54 bytes
 type tokenLayout struct {
 	// User ID.
 	Uid uint64
@@ -34,6 +35,19 @@ type tokenLayout struct {
 	SerialNumber uint16
 	// Bitmap with feature bits.
 	Features uint16
+	// User's token generation - to invalidate all tokens of one user.
+	Generation uint32
+}
+
+// legacyTokenLayout is the layout of tokens issued before token generations were introduced.
+// Such tokens are accepted as tokens of generation 0 until they expire.
+// [8:UID][4:expires][2:authLevel][2:serial-number][2:feature-bits][32:signature] = 50 bytes
+type legacyTokenLayout struct {
+	Uid          uint64
+	Expires      uint32
+	AuthLevel    uint16
+	SerialNumber uint16
+	Features     uint16
 }
 
 // Init initializes the authenticator: parses the config and sets salt, serial number and lifetime.
@@ -74,31 +88,70 @@ func (authenticator) AddRecord(rec *auth.Rec, secret []byte) (*auth.Rec, error)
 	return nil, types.ErrUnsupported
 }
 
-// UpdateRecord is not supported, will produce an error.
+// UpdateRecord revokes all tokens issued to the user so far by advancing user's token generation.
+// The secret is ignored.
 func (authenticator) UpdateRecord(rec *auth.Rec, secret []byte) error {
-	return types.ErrUnsupported
+	gen, err := Generation(rec.Uid)
+	if err != nil {
+		return err
+	}
+
+	gen++
+	val := []byte(strconv.FormatUint(uint64(gen), 10))
+	if gen == 1 {
+		// The first revocation: the record does not exist yet.
+		_, err = store.Users.AddAuthRecord(rec.Uid, auth.LevelNone, "token", rec.Uid.UserId(), val, time.Time{})
+	} else {
+		_, err = store.Users.UpdateAuthRecord(rec.Uid, auth.LevelNone, "token", rec.Uid.UserId(), val, time.Time{})
+	}
+	return err
+}
+
+// Generation returns user's current token generation. Tokens of earlier generations are revoked.
+// JWTs issued by the 'jwt' scheme are revoked by the same generation.
+func Generation(uid types.Uid) (uint32, error) {
+	_, _, val, _, err := store.Users.GetAuthRecord(uid, "token")
+	if err == types.ErrNotFound {
+		// Tokens were never revoked.
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	gen, err := strconv.ParseUint(string(val), 10, 32)
+	if err != nil {
+		return 0, types.ErrInternal
+	}
+	return uint32(gen), nil
 }
 
 // Authenticate checks validity of provided token.
 func (ta *authenticator) Authenticate(token []byte) (*auth.Rec, []byte, error) {
 	var tl tokenLayout
+	var legacy legacyTokenLayout
 	dataSize := binary.Size(&tl)
-	if len(token) < dataSize+sha256.Size {
+	if legacySize := binary.Size(&legacy); len(token) == legacySize+sha256.Size {
+		// Token issued before generations were introduced.
+		if err := binary.Read(bytes.NewReader(token), binary.LittleEndian, &legacy); err != nil {
+			return nil, nil, types.ErrMalformed
+		}
+		tl = tokenLayout{
+			Uid:          legacy.Uid,
+			Expires:      legacy.Expires,
+			AuthLevel:    legacy.AuthLevel,
+			SerialNumber: legacy.SerialNumber,
+			Features:     legacy.Features,
+		}
+		dataSize = legacySize
+	} else if len(token) < dataSize+sha256.Size {
 		// Token is too short
 		return nil, nil, types.ErrMalformed
-	}
-
-	buf := bytes.NewBuffer(token)
-	err := binary.Read(buf, binary.LittleEndian, &tl)
-	if err != nil {
+	} else if err := binary.Read(bytes.NewReader(token), binary.LittleEndian, &tl); err != nil {
 		return nil, nil, types.ErrMalformed
 	}
 
-	hbuf := new(bytes.Buffer)
-	binary.Write(hbuf, binary.LittleEndian, &tl)
-
 	hasher := hmac.New(sha256.New, ta.hmacSalt)
-	hasher.Write(hbuf.Bytes())
+	hasher.Write(token[:dataSize])
 	if !hmac.Equal(token[dataSize:dataSize+sha256.Size], hasher.Sum(nil)) {
 		return nil, nil, types.ErrFailed
 	}
@@ -116,6 +169,15 @@ func (ta *authenticator) Authenticate(token []byte) (*auth.Rec, []byte, error) {
 		return nil, nil, types.ErrExpired
 	}
 
+	// Check if the token was revoked.
+	gen, err := Generation(types.Uid(tl.Uid))
+	if err != nil {
+		return nil, nil, err
+	}
+	if tl.Generation != gen {
+		return nil, nil, types.ErrFailed
+	}
+
 	return &auth.Rec{
 		Uid:       types.Uid(tl.Uid),
 		AuthLevel: auth.Level(tl.AuthLevel),
@@ -133,12 +195,18 @@ func (ta *authenticator) GenSecret(rec *auth.Rec) ([]byte, time.Time, error) {
 	}
 	expires := time.Now().Add(rec.Lifetime).UTC().Round(time.Millisecond)
 
+	gen, err := Generation(rec.Uid)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
 	tl := tokenLayout{
 		Uid:          uint64(rec.Uid),
 		Expires:      uint32(expires.Unix()),
 		AuthLevel:    uint16(rec.AuthLevel),
 		SerialNumber: uint16(ta.serialNumber),
 		Features:     uint16(rec.Features),
+		Generation:   gen,
 	}
 	buf := new(bytes.Buffer)
 	binary.Write(buf, binary.LittleEndian, &tl)
@@ -154,7 +222,8 @@ func (authenticator) IsUnique(token []byte) (bool, error) {
 	return false, types.ErrUnsupported
 }
 
-// DelRecords is a noop which always succeeds.
+// DelRecords is a noop which always succeeds. The record of user's token generation is kept:
+// tokens revoked earlier would become valid again if the generation were reset.
 func (authenticator) DelRecords(uid types.Uid) error {
 	return nil
 }
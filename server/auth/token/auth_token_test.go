@@ -0,0 +1,99 @@
+package token
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/nanfengpo/chat/server/auth"
+	"github.com/nanfengpo/chat/server/db/memory"
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+func TestRevocation(t *testing.T) {
+	if err := memory.OpenTestStore(); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	ta := &authenticator{}
+	if err := ta.Init(`{"key":"wfaY2RgF2S1OQI/ZlK+LSrp1KB2jwAdGAIHQ7JZn+Kc=","serial_num":1,"expire_in":3600}`); err != nil {
+		t.Fatal(err)
+	}
+
+	alice, bob := types.Uid(1001), types.Uid(1002)
+	genToken := func(uid types.Uid) []byte {
+		token, _, err := ta.GenSecret(&auth.Rec{Uid: uid, AuthLevel: auth.LevelAuth})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	oldAlice, oldBob := genToken(alice), genToken(bob)
+	firstAlice := oldAlice
+
+	rec, _, err := ta.Authenticate(oldAlice)
+	if err != nil || rec.Uid != alice || rec.AuthLevel != auth.LevelAuth {
+		t.Fatal("valid token rejected", err)
+	}
+
+	// Revoke twice: the record is created, then updated.
+	for i := 0; i < 2; i++ {
+		if err := ta.UpdateRecord(&auth.Rec{Uid: alice}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := ta.Authenticate(oldAlice); err != types.ErrFailed {
+			t.Error("revoked token accepted", i, err)
+		}
+		oldAlice = genToken(alice)
+		if _, _, err := ta.Authenticate(oldAlice); err != nil {
+			t.Error("token issued after revocation rejected", i, err)
+		}
+	}
+
+	// Tokens of other users are not affected.
+	if _, _, err := ta.Authenticate(oldBob); err != nil {
+		t.Error("token of another user rejected", err)
+	}
+
+	// The generation is never reset: revoked tokens remain revoked.
+	if err := ta.DelRecords(alice); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ta.Authenticate(firstAlice); err != types.ErrFailed {
+		t.Error("revoked token accepted after DelRecords", err)
+	}
+	if _, _, err := ta.Authenticate(oldAlice); err != nil {
+		t.Error("current token rejected after DelRecords", err)
+	}
+
+	// Tokens issued before generations were introduced belong to generation 0.
+	legacyToken := func(uid types.Uid) []byte {
+		buf := new(bytes.Buffer)
+		binary.Write(buf, binary.LittleEndian, &legacyTokenLayout{
+			Uid:          uint64(uid),
+			Expires:      uint32(time.Now().Add(time.Hour).Unix()),
+			AuthLevel:    uint16(auth.LevelAuth),
+			SerialNumber: 1,
+		})
+		hasher := hmac.New(sha256.New, ta.hmacSalt)
+		hasher.Write(buf.Bytes())
+		buf.Write(hasher.Sum(nil))
+		return buf.Bytes()
+	}
+	if rec, _, err := ta.Authenticate(legacyToken(bob)); err != nil || rec.Uid != bob {
+		t.Error("legacy token rejected", err)
+	}
+	if _, _, err := ta.Authenticate(legacyToken(alice)); err != types.ErrFailed {
+		t.Error("legacy token of a user with revoked tokens accepted", err)
+	}
+	forged := legacyToken(bob)
+	forged[0] ^= 1
+	if _, _, err := ta.Authenticate(forged); err != types.ErrFailed {
+		t.Error("legacy token with a bad signature accepted", err)
+	}
+}
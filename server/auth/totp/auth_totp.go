@@ -0,0 +1,483 @@
+// Package totp implements time-based one-time passwords (RFC 6238) as the second step of authentication.
+//
+// A user enables the second factor with {acc scheme="totp"}: the response contains a provisioning URI for
+// an authenticator app and a set of recovery codes. The user then confirms it with {acc scheme="totp"
+// secret="<code>"}. Once confirmed, a successful login with another scheme is answered with a challenge.
+// The client completes the login with {login scheme="totp" secret=<challenge followed by the code>}.
+// The second factor is disabled with {acc scheme="totp" secret="disable:<code>"}.
+package totp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanfengpo/chat/server/auth"
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+const (
+	// Length of the shared secret in bytes, as recommended by RFC 4226.
+	secretLength = 20
+	// Default number of digits in a code.
+	defaultDigits = 6
+	// Default time step in seconds.
+	defaultPeriod = 30
+	// Number of recovery codes to generate.
+	recoveryCodeCount = 8
+	// Length of a recovery code in bytes before encoding.
+	recoveryCodeLength = 5
+	// Number of bytes of recovery code hashes to keep.
+	recoveryHashLength = 6
+
+	// Lifetime of a login challenge.
+	defaultChallengeLifetime = 5 * time.Minute
+	// Number of failed attempts before the second factor is temporarily blocked.
+	defaultMaxFailures = 5
+	// How long the second factor remains blocked.
+	defaultBlockTime = 15 * time.Minute
+
+	// Prefix of the secret which disables the second factor.
+	disablePrefix = "disable:"
+
+	// Number of locks which serialize updates of user records.
+	lockCount = 64
+)
+
+// Base32 without padding, as used by authenticator apps.
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// authenticator is a singleton instance of the authenticator.
+type authenticator struct {
+	// Key for signing challenges. Nil if the authenticator is not configured.
+	hmacSalt []byte
+	// Name of the service displayed by authenticator apps.
+	issuer string
+	digits int
+	period int64
+	// Number of time steps before and after the current one to accept to compensate for clock drift.
+	skew int64
+
+	challengeLifetime time.Duration
+	maxFailures       int
+	blockTime         time.Duration
+
+	// Records are read, checked and saved under a lock, otherwise concurrent requests could use the same
+	// code twice or lose counted failures. Users are mapped to locks by uid.
+	locks [lockCount]sync.Mutex
+}
+
+// record is stored as the secret of the user's auth record of the "totp" scheme. The auth level of
+// the record is auth.LevelNone until the user confirms the second factor with a valid code.
+type record struct {
+	// Shared secret, base32-encoded.
+	Key string `json:"key"`
+	// Truncated hashes of unused recovery codes.
+	Recovery []string `json:"rec,omitempty"`
+	// The last accepted time step, to prevent replay of codes.
+	Step int64 `json:"step,omitempty"`
+	// Count of failed attempts in a row.
+	Fails int `json:"fails,omitempty"`
+	// The second factor is blocked until this time, Unix seconds.
+	BlockedUntil int64 `json:"until,omitempty"`
+}
+
+// challengeLayout defines positioning of various bytes in the login challenge.
+// [8:UID][4:expires][2:authLevel][2:feature-bits][32:signature] = 48 bytes
+type challengeLayout struct {
+	// User ID.
+	Uid uint64
+	// Challenge expiration time.
+	Expires uint32
+	// User's authentication level after the first step.
+	AuthLevel uint16
+	// Feature bits after the first step.
+	Features uint16
+}
+
+// Init initializes the authenticator.
+func (ta *authenticator) Init(jsonconf string) error {
+	if ta.hmacSalt != nil {
+		return errors.New("auth_totp: already initialized")
+	}
+
+	type configType struct {
+		// Key for signing login challenges.
+		Key []byte `json:"key"`
+		// Name of the service displayed by authenticator apps.
+		Issuer string `json:"issuer"`
+		// Number of digits in a code, 6 or 8.
+		Digits int `json:"digits"`
+		// Time step in seconds.
+		Period int `json:"period"`
+		// Number of time steps to accept before and after the current one.
+		Skew int `json:"skew"`
+		// Lifetime of a login challenge in seconds.
+		ChallengeExpireIn int `json:"challenge_expire_in"`
+		// Number of failed attempts before the second factor is temporarily blocked.
+		MaxFailures int `json:"max_failures"`
+		// For how long the second factor is blocked, in seconds.
+		BlockTime int `json:"block_time"`
+	}
+	var config configType
+	if err := json.Unmarshal([]byte(jsonconf), &config); err != nil {
+		return errors.New("auth_totp: failed to parse config: " + err.Error() + "(" + jsonconf + ")")
+	}
+
+	if len(config.Key) < sha256.Size {
+		return errors.New("auth_totp: the key is missing or too short")
+	}
+	if config.Digits == 0 {
+		config.Digits = defaultDigits
+	} else if config.Digits != 6 && config.Digits != 8 {
+		return errors.New("auth_totp: digits must be 6 or 8")
+	}
+	if config.Period == 0 {
+		config.Period = defaultPeriod
+	}
+	if config.Period < 0 || config.Skew < 0 || config.ChallengeExpireIn < 0 || config.MaxFailures < 0 ||
+		config.BlockTime < 0 {
+		return errors.New("auth_totp: invalid config values")
+	}
+
+	ta.hmacSalt = config.Key
+	ta.issuer = config.Issuer
+	ta.digits = config.Digits
+	ta.period = int64(config.Period)
+	ta.skew = int64(config.Skew)
+	ta.challengeLifetime = time.Duration(config.ChallengeExpireIn) * time.Second
+	if ta.challengeLifetime == 0 {
+		ta.challengeLifetime = defaultChallengeLifetime
+	}
+	ta.maxFailures = config.MaxFailures
+	if ta.maxFailures == 0 {
+		ta.maxFailures = defaultMaxFailures
+	}
+	ta.blockTime = time.Duration(config.BlockTime) * time.Second
+	if ta.blockTime == 0 {
+		ta.blockTime = defaultBlockTime
+	}
+
+	return nil
+}
+
+// AddRecord starts enrollment: generates a shared secret and recovery codes. The second factor is not
+// enforced until it's confirmed by UpdateRecord. The provisioning URI and the recovery codes are returned
+// in rec.Params. The secret is ignored.
+func (ta *authenticator) AddRecord(rec *auth.Rec, secret []byte) (*auth.Rec, error) {
+	if ta.hmacSalt == nil {
+		return nil, types.ErrUnsupported
+	}
+
+	key := make([]byte, secretLength)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	tr := record{Key: b32.EncodeToString(key)}
+
+	var codes []string
+	for i := 0; i < recoveryCodeCount; i++ {
+		code := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(code); err != nil {
+			return nil, err
+		}
+		str := strings.ToLower(b32.EncodeToString(code))
+		codes = append(codes, str)
+		tr.Recovery = append(tr.Recovery, recoveryHash(str))
+	}
+
+	data, err := json.Marshal(&tr)
+	if err != nil {
+		return nil, err
+	}
+	dup, err := store.Users.AddAuthRecord(rec.Uid, auth.LevelNone, "totp", rec.Uid.String(), data, time.Time{})
+	if dup {
+		return nil, types.ErrDuplicate
+	} else if err != nil {
+		return nil, err
+	}
+
+	rec.AuthLevel = auth.LevelNone
+	rec.Params = map[string]interface{}{
+		"uri":      ta.provisioningURI(rec.Uid, tr.Key),
+		"recovery": codes,
+	}
+	return rec, nil
+}
+
+// UpdateRecord confirms enrollment if the secret is a valid code or disables the second factor if the
+// secret is "disable:<code>". A pending enrollment can be disabled without a code.
+func (ta *authenticator) UpdateRecord(rec *auth.Rec, secret []byte) error {
+	if ta.hmacSalt == nil {
+		return types.ErrUnsupported
+	}
+
+	defer ta.lock(rec.Uid).Unlock()
+
+	tr, authLvl, err := getRecord(rec.Uid)
+	if err != nil {
+		return err
+	}
+
+	code := string(secret)
+	if strings.HasPrefix(code, disablePrefix) {
+		if authLvl != auth.LevelNone {
+			err = ta.check(tr, strings.TrimPrefix(code, disablePrefix), true)
+			if err != nil {
+				saveRecord(rec.Uid, tr, authLvl)
+				return err
+			}
+		}
+		return store.Users.DelAuthRecords(rec.Uid, "totp")
+	}
+
+	if authLvl != auth.LevelNone {
+		// Already confirmed.
+		return types.ErrDuplicate
+	}
+	err = ta.check(tr, code, false)
+	if err == nil {
+		// Valid code: enable the second factor.
+		authLvl = auth.LevelAuth
+	}
+	if serr := saveRecord(rec.Uid, tr, authLvl); serr != nil {
+		return serr
+	}
+	return err
+}
+
+// Authenticate completes the login: the secret is the challenge followed by a code or a recovery code.
+func (ta *authenticator) Authenticate(secret []byte) (*auth.Rec, []byte, error) {
+	if ta.hmacSalt == nil {
+		return nil, nil, types.ErrUnsupported
+	}
+
+	var cl challengeLayout
+	dataSize := binary.Size(&cl)
+	if len(secret) < dataSize+sha256.Size {
+		return nil, nil, types.ErrMalformed
+	}
+	if err := binary.Read(bytes.NewReader(secret), binary.LittleEndian, &cl); err != nil {
+		return nil, nil, types.ErrMalformed
+	}
+	if !hmac.Equal(secret[dataSize:dataSize+sha256.Size], ta.sign(&cl)) {
+		return nil, nil, types.ErrFailed
+	}
+	if time.Unix(int64(cl.Expires), 0).Before(time.Now()) {
+		return nil, nil, types.ErrExpired
+	}
+
+	uid := types.Uid(cl.Uid)
+	defer ta.lock(uid).Unlock()
+
+	tr, authLvl, err := getRecord(uid)
+	if err == types.ErrNotFound {
+		// The second factor was disabled after the challenge was issued.
+		return nil, nil, types.ErrFailed
+	} else if err != nil {
+		return nil, nil, err
+	}
+	if authLvl == auth.LevelNone {
+		return nil, nil, types.ErrFailed
+	}
+
+	err = ta.check(tr, string(secret[dataSize+sha256.Size:]), true)
+	if serr := saveRecord(uid, tr, authLvl); serr != nil {
+		return nil, nil, serr
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &auth.Rec{
+		Uid:       uid,
+		AuthLevel: auth.Level(cl.AuthLevel),
+		Features:  auth.Feature(cl.Features) | auth.TwoFactor}, nil, nil
+}
+
+// IsUnique is not supported, will produce an error.
+func (*authenticator) IsUnique(secret []byte) (bool, error) {
+	return false, types.ErrUnsupported
+}
+
+// GenSecret generates a login challenge for the user who passed the first step of authentication.
+func (ta *authenticator) GenSecret(rec *auth.Rec) ([]byte, time.Time, error) {
+	if ta.hmacSalt == nil {
+		return nil, time.Time{}, types.ErrUnsupported
+	}
+
+	expires := time.Now().Add(ta.challengeLifetime).UTC().Round(time.Second)
+	cl := challengeLayout{
+		Uid:       uint64(rec.Uid),
+		Expires:   uint32(expires.Unix()),
+		AuthLevel: uint16(rec.AuthLevel),
+		Features:  uint16(rec.Features &^ auth.TwoFactor),
+	}
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, &cl)
+	buf.Write(ta.sign(&cl))
+
+	return buf.Bytes(), expires, nil
+}
+
+// DelRecords deletes the user's second factor.
+func (*authenticator) DelRecords(uid types.Uid) error {
+	return store.Users.DelAuthRecords(uid, "totp")
+}
+
+// lock locks the user's record for the duration of a check.
+func (ta *authenticator) lock(uid types.Uid) *sync.Mutex {
+	mu := &ta.locks[uint64(uid)%lockCount]
+	mu.Lock()
+	return mu
+}
+
+// sign calculates the signature of the challenge.
+func (ta *authenticator) sign(cl *challengeLayout) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, cl)
+	hasher := hmac.New(sha256.New, ta.hmacSalt)
+	hasher.Write(buf.Bytes())
+	return hasher.Sum(nil)
+}
+
+// check verifies the code and updates the record: counts failures, marks the code as used. Recovery codes
+// are accepted if allowRecovery is true. A used recovery code is deleted. The caller must save the record.
+func (ta *authenticator) check(tr *record, code string, allowRecovery bool) error {
+	now := time.Now()
+	if tr.BlockedUntil > now.Unix() {
+		return types.ErrPolicy
+	}
+
+	code = strings.ToLower(strings.TrimSpace(code))
+	ok := false
+	if step := ta.matchCode(tr, code, now); step > 0 {
+		tr.Step = step
+		ok = true
+	} else if allowRecovery && len(code) > ta.digits {
+		hash := recoveryHash(code)
+		for i, rc := range tr.Recovery {
+			if subtle.ConstantTimeCompare([]byte(rc), []byte(hash)) == 1 {
+				tr.Recovery = append(tr.Recovery[:i], tr.Recovery[i+1:]...)
+				ok = true
+				break
+			}
+		}
+	}
+
+	if ok {
+		tr.Fails = 0
+		tr.BlockedUntil = 0
+		return nil
+	}
+
+	tr.Fails++
+	if tr.Fails >= ta.maxFailures {
+		tr.Fails = 0
+		tr.BlockedUntil = now.Add(ta.blockTime).Unix()
+	}
+	return types.ErrFailed
+}
+
+// matchCode finds the time step which matches the code within the allowed skew. Returns 0 if
+// no step matches or if the code was already used.
+func (ta *authenticator) matchCode(tr *record, code string, now time.Time) int64 {
+	if len(code) != ta.digits {
+		return 0
+	}
+	key, err := b32.DecodeString(tr.Key)
+	if err != nil {
+		return 0
+	}
+
+	current := now.Unix() / ta.period
+	for step := current - ta.skew; step <= current+ta.skew; step++ {
+		if step <= tr.Step {
+			// Replay of an already used code.
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(generateCode(key, step, ta.digits)), []byte(code)) == 1 {
+			return step
+		}
+	}
+	return 0
+}
+
+// provisioningURI returns the otpauth:// URI used by authenticator apps, usually shown as a QR code.
+func (ta *authenticator) provisioningURI(uid types.Uid, key string) string {
+	label := uid.UserId()
+	query := url.Values{}
+	query.Set("secret", key)
+	query.Set("digits", strconv.Itoa(ta.digits))
+	query.Set("period", strconv.FormatInt(ta.period, 10))
+	if ta.issuer != "" {
+		label = ta.issuer + ":" + label
+		query.Set("issuer", ta.issuer)
+	}
+	return "otpauth://totp/" + url.PathEscape(label) + "?" + query.Encode()
+}
+
+// generateCode calculates the HOTP value (RFC 4226) of the given counter.
+func generateCode(key []byte, counter int64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	code := strconv.FormatUint(uint64(value%mod), 10)
+	return strings.Repeat("0", digits-len(code)) + code
+}
+
+// recoveryHash returns a truncated hash of a recovery code. Hashes are truncated to fit
+// the record into the secret field of the auth table.
+func recoveryHash(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:recoveryHashLength])
+}
+
+func getRecord(uid types.Uid) (*record, auth.Level, error) {
+	_, authLvl, secret, _, err := store.Users.GetAuthRecord(uid, "totp")
+	if err != nil {
+		return nil, auth.LevelNone, err
+	}
+	var tr record
+	if err = json.Unmarshal(secret, &tr); err != nil {
+		return nil, auth.LevelNone, err
+	}
+	return &tr, authLvl, nil
+}
+
+func saveRecord(uid types.Uid, tr *record, authLvl auth.Level) error {
+	data, err := json.Marshal(tr)
+	if err != nil {
+		return err
+	}
+	_, err = store.Users.UpdateAuthRecord(uid, authLvl, "totp", uid.String(), data, time.Time{})
+	return err
+}
+
+func init() {
+	store.RegisterAuthScheme("totp", &authenticator{})
+}
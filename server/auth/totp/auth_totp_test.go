@@ -0,0 +1,220 @@
+package totp
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nanfengpo/chat/server/auth"
+	"github.com/nanfengpo/chat/server/db/memory"
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+// Test vectors from RFC 6238, Appendix B, SHA-1.
+func TestGenerateCode(t *testing.T) {
+	key := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+	for ts, want := range vectors {
+		if got := generateCode(key, ts/30, 8); got != want {
+			t.Errorf("T=%d: got %s, want %s", ts, got, want)
+		}
+	}
+}
+
+func TestRecordFitsAuthTable(t *testing.T) {
+	tr := record{Key: b32.EncodeToString(make([]byte, secretLength)), Step: time.Now().Unix() / 30,
+		Fails: 99, BlockedUntil: time.Now().Unix()}
+	for i := 0; i < recoveryCodeCount; i++ {
+		tr.Recovery = append(tr.Recovery, recoveryHash("code"))
+	}
+	data, _ := json.Marshal(&tr)
+	// MySQL keeps auth secrets in VARCHAR(255).
+	if len(data) > 255 {
+		t.Error("record is too long:", len(data))
+	}
+}
+
+func newAuthenticator(t *testing.T) *authenticator {
+	ta := &authenticator{}
+	if err := ta.Init(`{"key":"wfaY2RgF2S1OQI/ZlK+LSrp1KB2jwAdGAIHQ7JZn+Kc=","issuer":"Test Chat","skew":1}`); err != nil {
+		t.Fatal(err)
+	}
+	return ta
+}
+
+func currentCode(t *testing.T, ta *authenticator, uri string, offset int64) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := b32.DecodeString(u.Query().Get("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return generateCode(key, time.Now().Unix()/ta.period+offset, ta.digits)
+}
+
+func TestChallenge(t *testing.T) {
+	ta := newAuthenticator(t)
+	challenge, expires, err := ta.GenSecret(&auth.Rec{Uid: types.Uid(12345), AuthLevel: auth.LevelAuth})
+	if err != nil || expires.Before(time.Now()) {
+		t.Fatal("GenSecret:", err, expires)
+	}
+
+	tampered := append([]byte(nil), challenge...)
+	tampered[0] ^= 1
+	if _, _, err = ta.Authenticate(append(tampered, "123456"...)); err != types.ErrFailed {
+		t.Error("tampered challenge must be rejected, got", err)
+	}
+	if _, _, err = ta.Authenticate([]byte("123456")); err != types.ErrMalformed {
+		t.Error("missing challenge must be rejected, got", err)
+	}
+
+	ta.challengeLifetime = -time.Minute
+	expired, _, _ := ta.GenSecret(&auth.Rec{Uid: types.Uid(12345), AuthLevel: auth.LevelAuth})
+	if _, _, err = ta.Authenticate(append(expired, "123456"...)); err != types.ErrExpired {
+		t.Error("expired challenge must be rejected, got", err)
+	}
+}
+
+func TestEnrollAndLogin(t *testing.T) {
+	if err := memory.OpenTestStore(); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	ta := newAuthenticator(t)
+	uid := types.Uid(12345)
+
+	rec, err := ta.AddRecord(&auth.Rec{Uid: uid}, nil)
+	if err != nil {
+		t.Fatal("AddRecord:", err)
+	}
+	uri := rec.Params["uri"].(string)
+	recovery := rec.Params["recovery"].([]string)
+	if !strings.HasPrefix(uri, "otpauth://totp/Test%20Chat:"+uid.UserId()+"?") || len(recovery) != recoveryCodeCount {
+		t.Fatal("unexpected provisioning data", uri, recovery)
+	}
+	if _, lvl, _, _, _ := store.Users.GetAuthRecord(uid, "totp"); lvl != auth.LevelNone {
+		t.Error("enrollment must be pending until confirmed")
+	}
+
+	// Recovery codes cannot be used to confirm enrollment.
+	if err = ta.UpdateRecord(&auth.Rec{Uid: uid}, []byte(recovery[0])); err != types.ErrFailed {
+		t.Error("confirmation with recovery code: got", err)
+	}
+	confirmation := currentCode(t, ta, uri, 0)
+	if err = ta.UpdateRecord(&auth.Rec{Uid: uid}, []byte(confirmation)); err != nil {
+		t.Fatal("confirmation:", err)
+	}
+	if _, lvl, _, _, _ := store.Users.GetAuthRecord(uid, "totp"); lvl != auth.LevelAuth {
+		t.Error("second factor must be enabled after confirmation")
+	}
+
+	challenge, _, _ := ta.GenSecret(&auth.Rec{Uid: uid, AuthLevel: auth.LevelAuth, Features: auth.Validated})
+	// The code used for confirmation cannot be replayed.
+	if _, _, err = ta.Authenticate(append(challenge, confirmation...)); err != types.ErrFailed {
+		t.Error("replayed code: got", err)
+	}
+	res, _, err := ta.Authenticate(append(challenge, currentCode(t, ta, uri, 1)...))
+	if err != nil || res.Uid != uid || res.AuthLevel != auth.LevelAuth || res.Features != auth.Validated|auth.TwoFactor {
+		t.Fatal("login with code:", res, err)
+	}
+
+	// A recovery code works once.
+	secret := append(append([]byte(nil), challenge...), recovery[1]...)
+	if _, _, err = ta.Authenticate(secret); err != nil {
+		t.Error("login with recovery code:", err)
+	}
+	if _, _, err = ta.Authenticate(secret); err != types.ErrFailed {
+		t.Error("reused recovery code: got", err)
+	}
+
+	// Too many failures block the second factor.
+	for i := 0; i < ta.maxFailures; i++ {
+		ta.Authenticate(append(append([]byte(nil), challenge...), "000000"...))
+	}
+	if _, _, err = ta.Authenticate(append(challenge, recovery[2]...)); err != types.ErrPolicy {
+		t.Error("blocked second factor: got", err)
+	}
+
+	// Disabling requires a valid code. Blocking applies too.
+	if err = ta.UpdateRecord(&auth.Rec{Uid: uid}, []byte(disablePrefix+recovery[2])); err != types.ErrPolicy {
+		t.Error("disable while blocked: got", err)
+	}
+	tr, lvl, _ := getRecord(uid)
+	tr.BlockedUntil = 0
+	saveRecord(uid, tr, lvl)
+	if err = ta.UpdateRecord(&auth.Rec{Uid: uid}, []byte(disablePrefix+recovery[2])); err != nil {
+		t.Error("disable:", err)
+	}
+	if _, _, _, _, err = store.Users.GetAuthRecord(uid, "totp"); err != types.ErrNotFound {
+		t.Error("record must be deleted, got", err)
+	}
+}
+
+func TestConcurrentLogin(t *testing.T) {
+	if err := memory.OpenTestStore(); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	ta := newAuthenticator(t)
+	uid := types.Uid(12346)
+	rec, err := ta.AddRecord(&auth.Rec{Uid: uid}, nil)
+	if err != nil {
+		t.Fatal("AddRecord:", err)
+	}
+	if err = ta.UpdateRecord(&auth.Rec{Uid: uid}, []byte(currentCode(t, ta, rec.Params["uri"].(string), 0))); err != nil {
+		t.Fatal("confirmation:", err)
+	}
+	recovery := rec.Params["recovery"].([]string)
+	challenge, _, _ := ta.GenSecret(&auth.Rec{Uid: uid, AuthLevel: auth.LevelAuth})
+
+	// Runs the attempts in parallel, returns the number of successful ones.
+	parallel := func(code string, attempts int) int {
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		accepted := 0
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, _, err := ta.Authenticate(append(append([]byte(nil), challenge...), code...)); err == nil {
+					mu.Lock()
+					accepted++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		return accepted
+	}
+
+	if accepted := parallel(recovery[0], ta.maxFailures-1); accepted != 1 {
+		t.Error("recovery code must be accepted exactly once, accepted", accepted)
+	}
+	tr, lvl, _ := getRecord(uid)
+	if len(tr.Recovery) != recoveryCodeCount-1 {
+		t.Error("used recovery code must be deleted, left", len(tr.Recovery))
+	}
+
+	// Every failure is counted.
+	tr.Fails = 0
+	saveRecord(uid, tr, lvl)
+	parallel("wrong-recovery-code", ta.maxFailures-1)
+	if tr, _, _ := getRecord(uid); tr.Fails != ta.maxFailures-1 {
+		t.Error("expected", ta.maxFailures-1, "failures, got", tr.Fails)
+	}
+}
@@ -110,6 +110,22 @@ type ClusterResp struct {
 	Msg []byte
 	// Session ID to forward message to, if any.
 	FromSID string
+	// Disconnect the session after sending the message.
+	Terminate bool
+}
+
+// ClusterRateLimitReq reports usage of rate limit buckets to their owner node.
+type ClusterRateLimitReq struct {
+	// Name of the node sending this request
+	Node string
+	// Number of tokens consumed by bucket key
+	Usage map[string]int
+}
+
+// ClusterRateLimitResp lists buckets which are exhausted at the owner node.
+type ClusterRateLimitResp struct {
+	// Time to wait before the bucket can be used again, by bucket key
+	Blocked map[string]time.Duration
 }
 
 // Handle outbound node communication: read messages from the channel, forward to remote nodes.
@@ -328,7 +344,9 @@ func (Cluster) Proxy(msg *ClusterResp, unused *bool) error {
 	// This cluster member received a response from topic owner to be forwarded to a session
 	// Find appropriate session, send the message to it
 	if sess := globals.sessionStore.Get(msg.FromSID); sess != nil {
-		if !sess.queueOutBytes(msg.Msg) {
+		if msg.Terminate {
+			sess.terminateBytes(msg.Msg)
+		} else if !sess.queueOutBytes(msg.Msg) {
 			log.Println("cluster.Proxy: timeout")
 		}
 	} else {
@@ -338,6 +356,15 @@ func (Cluster) Proxy(msg *ClusterResp, unused *bool) error {
 	return nil
 }
 
+// RateLimit receives usage of rate limit buckets owned by this node from another node.
+// Called by a remote node.
+func (Cluster) RateLimit(msg *ClusterRateLimitReq, resp *ClusterRateLimitResp) error {
+	if globals.rateLimiter != nil {
+		resp.Blocked = globals.rateLimiter.report(msg.Usage)
+	}
+	return nil
+}
+
 // Given topic name, find appropriate cluster node to route message to
 func (c *Cluster) nodeForTopic(topic string) *ClusterNode {
 	key := c.ring.Get(topic)
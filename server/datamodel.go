@@ -9,6 +9,7 @@ package main
  *****************************************************************************/
 
 import (
+	"math"
 	"net/http"
 	"strings"
 	"time"
@@ -28,6 +29,10 @@ type MsgGetOpts struct {
 	BeforeId int `json:"before,omitempty"`
 	// Limit the number of messages loaded
 	Limit int `json:"limit,omitempty"`
+	// Load only replies to the message with this ID
+	Thread int `json:"thread,omitempty"`
+	// Full-text search query
+	Query string `json:"query,omitempty"`
 }
 
 // MsgGetQuery is a topic metadata or data query.
@@ -42,6 +47,8 @@ type MsgGetQuery struct {
 	Data *MsgGetOpts `json:"data,omitempty"`
 	// Parameters of "del" request: Since, Before, Limit.
 	Del *MsgGetOpts `json:"del,omitempty"`
+	// Parameters of "search" request: Query, Topic, Since, Before, Limit.
+	Search *MsgGetOpts `json:"search,omitempty"`
 }
 
 // MsgSetSub is a payload in set.sub request to update current subscription or invite another user, {sub.what} == "sub"
@@ -68,6 +75,28 @@ type MsgSetQuery struct {
 	Sub *MsgSetSub `json:"sub,omitempty"`
 	// Indexable tags for user discovery
 	Tags []string `json:"tags,omitempty"`
+	// Preferences of push notifications
+	Notify *MsgNotifyPrefs `json:"notify,omitempty"`
+}
+
+// MsgNotifyPrefs is user's preferences of push notifications. Mute and Mentions apply to subscriptions
+// of p2p and group topics, Quiet to all notifications of the user and is set through 'me'.
+type MsgNotifyPrefs struct {
+	// Don't notify until this time. Time in the past unmutes the topic.
+	MuteUntil *time.Time `json:"mute,omitempty"`
+	// Notify only of messages which mention the user.
+	Mentions *bool `json:"mentions,omitempty"`
+	// Daily period without notifications.
+	Quiet *MsgQuietHours `json:"quiet,omitempty"`
+}
+
+// MsgQuietHours is a daily period in user's time zone, like from "22:00" to "07:00" in "Europe/Berlin".
+// Empty From and To clear quiet hours.
+type MsgQuietHours struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	// IANA time zone name, UTC if missing.
+	TimeZone string `json:"tz,omitempty"`
 }
 
 // MsgFindQuery is a format of fndXXX.private.
@@ -161,9 +190,13 @@ const (
 	constMsgMetaData
 	constMsgMetaTags
 	constMsgMetaDel
+	constMsgMetaSearch
+	constMsgMetaSess
+	constMsgMetaNotify
 	constMsgDelTopic
 	constMsgDelMsg
 	constMsgDelSub
+	constMsgDelSess
 )
 
 func parseMsgClientMeta(params string) int {
@@ -181,6 +214,10 @@ func parseMsgClientMeta(params string) int {
 			bits |= constMsgMetaTags
 		case "del":
 			bits |= constMsgMetaDel
+		case "search":
+			bits |= constMsgMetaSearch
+		case "sess":
+			bits |= constMsgMetaSess
 		default:
 			// ignore unknown
 		}
@@ -198,6 +235,8 @@ func parseMsgClientDel(params string) int {
 		return constMsgDelTopic
 	case "sub":
 		return constMsgDelSub
+	case "sess":
+		return constMsgDelSess
 	default:
 		// ignore
 	}
@@ -224,6 +263,8 @@ type MsgClientPub struct {
 	NoEcho  bool                   `json:"noecho,omitempty"`
 	Head    map[string]interface{} `json:"head,omitempty"`
 	Content interface{}            `json:"content"`
+	// ID of the message being replied to
+	ReplyTo int `json:"reply,omitempty"`
 }
 
 // MsgClientGet is a query of topic state {get}.
@@ -245,7 +286,7 @@ type MsgClientDel struct {
 	Id    string `json:"id,omitempty"`
 	Topic string `json:"topic"`
 	// What to delete, either "msg" to delete messages (default) or "topic" to delete the topic or "sub"
-	// to delete a subscription to topic.
+	// to delete a subscription to topic or "sess" to terminate user's sessions.
 	What string `json:"what"`
 	// Delete messages with these IDs (either one by one or a set of ranges)
 	DelSeq []MsgDelRange `json:"delseq,omitempty"`
@@ -253,16 +294,21 @@ type MsgClientDel struct {
 	User string `json:"user,omitempty"`
 	// Request to hard-delete messages for all users, if such option is available.
 	Hard bool `json:"hard,omitempty"`
+	// ID of the session to terminate; all other sessions of the user if missing.
+	Sess string `json:"sess,omitempty"`
 }
 
 // MsgClientNote is a client-generated notification for topic subscribers {note}.
 type MsgClientNote struct {
 	// There is no Id -- server will not akn {ping} packets, they are "fire and forget"
 	Topic string `json:"topic"`
-	// what is being reported: "recv" - message received, "read" - message read, "kp" - typing notification
+	// what is being reported: "recv" - message received, "read" - message read, "kp" - typing notification,
+	// "react" - reaction added to message, "unreact" - reaction removed from message
 	What string `json:"what"`
 	// Server-issued message ID being reported
 	SeqId int `json:"seq,omitempty"`
+	// Reaction to message, such as an emoji; "react" and "unreact" only
+	Reaction string `json:"react,omitempty"`
 }
 
 // ClientComMessage is a wrapper for client messages.
@@ -326,6 +372,8 @@ type MsgTopicDesc struct {
 	Public interface{} `json:"public,omitempty"`
 	// Per-subscription private data
 	Private interface{} `json:"private,omitempty"`
+	// Preferences of push notifications
+	Notify *MsgNotifyPrefs `json:"notify,omitempty"`
 }
 
 // MsgTopicSub is topic subscription details, sent in Meta message.
@@ -347,6 +395,8 @@ type MsgTopicSub struct {
 	ReadSeqId int `json:"read,omitempty"`
 	// ID of the message reported by the given user as received
 	RecvSeqId int `json:"recv,omitempty"`
+	// Count of unread messages which mention the user, own subscriptions only
+	Mentions int `json:"mentions,omitempty"`
 	// Topic's public data
 	Public interface{} `json:"public,omitempty"`
 	// User's own private data per topic
@@ -381,6 +431,23 @@ type MsgDelValues struct {
 	DelSeq []MsgDelRange `json:"delseq,omitempty"`
 }
 
+// MsgSessionInfo describes a live session of the user, sent in Meta message.
+type MsgSessionInfo struct {
+	// Opaque ID of the session
+	Id string `json:"id"`
+	// This is the session which requested the list
+	Current bool `json:"current,omitempty"`
+	// Device ID and human language reported by the client
+	DeviceID string `json:"dev,omitempty"`
+	Lang     string `json:"lang,omitempty"`
+	// User agent reported by the client
+	UserAgent string `json:"ua,omitempty"`
+	// IP address of the client
+	RemoteAddr string `json:"ip,omitempty"`
+	// Time of the last message from the client
+	LastSeen *time.Time `json:"seen,omitempty"`
+}
+
 // MsgServerCtrl is a server control message {ctrl}.
 type MsgServerCtrl struct {
 	Id     string      `json:"id,omitempty"`
@@ -402,6 +469,14 @@ type MsgServerData struct {
 	SeqId     int                    `json:"seq"`
 	Head      map[string]interface{} `json:"head,omitempty"`
 	Content   interface{}            `json:"content"`
+	// Counts of reactions to the message, reaction -> count
+	Reactions map[string]int `json:"react,omitempty"`
+	// ID of the thread root message if this message is a reply
+	ReplyTo int `json:"reply,omitempty"`
+	// Number of replies to this message
+	ReplyCount int `json:"replies,omitempty"`
+	// Timestamp of the latest reply to this message
+	LastReplyAt *time.Time `json:"lastreply,omitempty"`
 }
 
 // MsgServerPres is presence notification {pres} (authoritative update).
@@ -455,6 +530,10 @@ type MsgServerMeta struct {
 	Del *MsgDelValues `json:"del,omitempty"`
 	// User discovery tags
 	Tags []string `json:"tags,omitempty"`
+	// Messages found by full-text search
+	Search []MsgServerData `json:"search,omitempty"`
+	// Live sessions of the user
+	Sess []MsgSessionInfo `json:"sess,omitempty"`
 }
 
 // MsgServerInfo is the server-side copy of MsgClientNote with From added (non-authoritative).
@@ -462,10 +541,13 @@ type MsgServerInfo struct {
 	Topic string `json:"topic"`
 	// ID of the user who originated the message
 	From string `json:"from"`
-	// what is being reported: "rcpt" - message received, "read" - message read, "kp" - typing notification
+	// what is being reported: "rcpt" - message received, "read" - message read, "kp" - typing notification,
+	// "react", "unreact" - reaction added to or removed from message
 	What string `json:"what"`
 	// Server-issued message ID being reported
 	SeqId int `json:"seq,omitempty"`
+	// Reaction to message, "react" and "unreact" only
+	Reaction string `json:"react,omitempty"`
 }
 
 // ServerComMessage is a wrapper for server-side messages.
@@ -807,6 +889,18 @@ func ErrLocked(id, topic string, ts time.Time) *ServerComMessage {
 		Timestamp: ts}}
 }
 
+// ErrTooManyRequests the client exceeded the rate limit (429). The client should retry after the
+// given number of seconds.
+func ErrTooManyRequests(id, topic string, ts time.Time, wait time.Duration) *ServerComMessage {
+	return &ServerComMessage{Ctrl: &MsgServerCtrl{
+		Id:        id,
+		Code:      http.StatusTooManyRequests, // 429
+		Text:      "too many requests",
+		Topic:     topic,
+		Params:    map[string]interface{}{"retry": int(math.Ceil(wait.Seconds()))},
+		Timestamp: ts}}
+}
+
 // ErrUnknown database or other server error (500).
 func ErrUnknown(id, topic string, ts time.Time) *ServerComMessage {
 	return &ServerComMessage{Ctrl: &MsgServerCtrl{
@@ -26,6 +26,9 @@ type Adapter interface {
 
 	// CreateDb creates the database optionally dropping an existing database first.
 	CreateDb(reset bool) error
+	// UpgradeDb upgrades the database to the version expected by the adapter. If dryRun is true, the
+	// database is not changed. Returns descriptions of the applied or planned upgrade steps.
+	UpgradeDb(dryRun bool) ([]string, error)
 
 	// User management
 
@@ -48,8 +51,12 @@ type Adapter interface {
 	CredGet(uid t.Uid, method string) ([]*t.Credential, error)
 	// CredIsConfirmed returns true if the given credential has been verified, false otherwise.
 	CredIsConfirmed(uid t.Uid, metod string) (bool, error)
-	// CredDel deletes given credential.
-	CredDel(uid t.Uid, method string) error
+	// CredGetOwner returns ID of the user who has confirmed the given credential, like method "email"
+	// and value "jdoe@example.com". Returns ZeroUid if the credential is not confirmed by anyone.
+	CredGetOwner(method, value string) (t.Uid, error)
+	// CredDel deletes credentials of the given method and value. All credentials of the method are deleted
+	// if the value is empty, all credentials of the user if the method is empty.
+	CredDel(uid t.Uid, method, value string) error
 	// CredConfirm marks given credential as validated.
 	CredConfirm(uid t.Uid, method string) error
 	// CredFail increments count of failed validation attepmts for the given credentials.
@@ -70,6 +77,18 @@ type Adapter interface {
 	// AuthUpdRecord modifies an authentication record.
 	AuthUpdRecord(user t.Uid, scheme, unique string, authLvl auth.Level, secret []byte, expires time.Time) (bool, error)
 
+	// Failed authentication attempts
+
+	// AuthFailGet returns the count of failed authentication attempts for the given key, such as
+	// "login:jdoe" or "ip:10.0.0.1", and the time of the last failure. Returns (0, zero time, nil) if
+	// there were no failures.
+	AuthFailGet(key string) (int, time.Time, error)
+	// AuthFailAdd records a failed authentication attempt for the given key and returns the updated
+	// count. The count starts over if the previous failure happened before resetBefore.
+	AuthFailAdd(key string, resetBefore time.Time) (int, error)
+	// AuthFailDel clears failed authentication attempts for the given key.
+	AuthFailDel(key string) error
+
 	// Topic management
 
 	// TopicCreate creates a topic
@@ -121,6 +140,15 @@ type Adapter interface {
 	MessageSave(msg *t.Message) error
 	// MessageGetAll returns messages matching the query
 	MessageGetAll(topic string, forUser t.Uid, opts *t.QueryOpt) ([]t.Message, error)
+	// MessageEdit replaces Head and Content of an existing message identified by Topic and SeqId.
+	// The previous version of the message is preserved as a revision.
+	MessageEdit(msg *t.Message) error
+	// MessageReactionAdd records user's reaction to a message. Returns ErrDuplicate if the user has
+	// already reacted with the same reaction, ErrNotFound if the message does not exist or is deleted.
+	MessageReactionAdd(topic string, seqId int, user t.Uid, reaction string) error
+	// MessageReactionDelete removes user's reaction to a message. Returns ErrNotFound if
+	// there is no such reaction.
+	MessageReactionDelete(topic string, seqId int, user t.Uid, reaction string) error
 	// MessageDeleteList marks messages as deleted.
 	// Soft- or Hard- is defined by forUser value: forUSer.IsZero == true is hard.
 	MessageDeleteList(topic string, toDel *t.DelMessage) error
@@ -128,6 +156,11 @@ type Adapter interface {
 	MessageGetDeleted(topic string, forUser t.Uid, opts *t.QueryOpt) ([]t.DelMessage, error)
 	// MessageAttachments connects given message to a list of file record IDs.
 	MessageAttachments(msgId t.Uid, fids []string) error
+	// MessageIndex saves the list of words of a message for full-text search.
+	MessageIndex(topic string, seqId int, words []string) error
+	// MessageSearch returns messages from the given topics which contain all the words, newest first.
+	// Messages hard-deleted or soft-deleted for forUser are skipped.
+	MessageSearch(topics []string, forUser t.Uid, words []string, opts *t.QueryOpt) ([]t.Message, error)
 
 	// Devices (for push notifications)
 
@@ -0,0 +1,499 @@
+// Package adaptertest is a conformance test suite for implementations of adapter.Adapter. Every adapter
+// runs the suite from its own tests to make sure that all adapters interpret the interface the same way,
+// including edge cases like keepDeleted, QueryOpt.IfModifiedSince and single-message ranges (Range.Hi == 0).
+//
+// The suite expects an open adapter with a freshly created empty database:
+//
+//	func TestConformance(t *testing.T) {
+//		adp := &adapter{}
+//		if err := adp.Open(config); err != nil {
+//			t.Fatal(err)
+//		}
+//		defer adp.Close()
+//		if err := adp.CreateDb(true); err != nil {
+//			t.Fatal(err)
+//		}
+//		adaptertest.Run(t, adp)
+//	}
+package adaptertest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/nanfengpo/chat/server/auth"
+	"github.com/nanfengpo/chat/server/db"
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+// UidKey is the key used by the suite to initialize the generator of IDs.
+const UidKey = "la6YsO+bNX/+XIkOqc5Svw=="
+
+type suite struct {
+	adp adapter.Adapter
+}
+
+// Run runs all conformance tests against the adapter.
+func Run(t *testing.T, adp adapter.Adapter) {
+	key, _ := base64.StdEncoding.DecodeString(UidKey)
+	if err := store.InitUidGenerator(1, key); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &suite{adp: adp}
+	t.Run("Upgrade", s.testUpgrade)
+	t.Run("Users", s.testUsers)
+	t.Run("Auth", s.testAuth)
+	t.Run("AuthFail", s.testAuthFail)
+	t.Run("Creds", s.testCreds)
+	t.Run("Topics", s.testTopics)
+	t.Run("Subscriptions", s.testSubscriptions)
+	t.Run("P2P", s.testP2P)
+	t.Run("Messages", s.testMessages)
+	t.Run("Deletes", s.testDeletes)
+	t.Run("Threads", s.testThreads)
+	t.Run("Devices", s.testDevices)
+	t.Run("Files", s.testFiles)
+}
+
+// A freshly created database is current: nothing to upgrade.
+func (s *suite) testUpgrade(t *testing.T) {
+	if err := s.adp.CheckDbVersion(); err != nil {
+		t.Fatal("CheckDbVersion:", err)
+	}
+	for _, dryRun := range []bool{true, false} {
+		if steps, err := s.adp.UpgradeDb(dryRun); err != nil || len(steps) != 0 {
+			t.Error("UpgradeDb: got", steps, err)
+		}
+	}
+}
+
+// newUser creates a user with the given public name and tags.
+func (s *suite) newUser(t *testing.T, name string, tags ...string) types.Uid {
+	t.Helper()
+
+	uid := store.GetUid()
+	user := &types.User{
+		Access: types.DefaultAccess{Auth: types.ModeCPublic, Anon: types.ModeNone},
+		Public: name,
+		Tags:   tags,
+	}
+	user.SetUid(uid)
+	user.InitTimes()
+	if err := s.adp.UserCreate(user); err != nil {
+		t.Fatal("UserCreate:", err)
+	}
+	return uid
+}
+
+// newTopic creates a group topic with the given public name and tags.
+func (s *suite) newTopic(t *testing.T, name string, tags ...string) string {
+	t.Helper()
+
+	topic := &types.Topic{
+		ObjHeader: types.ObjHeader{Id: "grp" + store.GetUidString()},
+		Access:    types.DefaultAccess{Auth: types.ModeCPublic, Anon: types.ModeNone},
+		Public:    name,
+		Tags:      tags,
+	}
+	topic.InitTimes()
+	if err := s.adp.TopicCreate(topic); err != nil {
+		t.Fatal("TopicCreate:", err)
+	}
+	return topic.Id
+}
+
+// newSub returns a subscription of the user to the topic.
+func newSub(topic string, uid types.Uid) *types.Subscription {
+	sub := &types.Subscription{
+		User:      uid.String(),
+		Topic:     topic,
+		ModeWant:  types.ModeCPublic,
+		ModeGiven: types.ModeCPublic,
+	}
+	sub.InitTimes()
+	return sub
+}
+
+// users returns IDs of users from the list of subscriptions, sorted.
+func users(subs []types.Subscription) []string {
+	var ids []string
+	for _, sub := range subs {
+		ids = append(ids, sub.User)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// topics returns names of topics from the list of subscriptions, sorted.
+func topics(subs []types.Subscription) []string {
+	var names []string
+	for _, sub := range subs {
+		names = append(names, sub.Topic)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sorted returns a sorted copy of the strings.
+func sorted(vals ...string) []string {
+	vals = append([]string(nil), vals...)
+	sort.Strings(vals)
+	return vals
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *suite) testUsers(t *testing.T) {
+	alice := s.newUser(t, "Alice", "email:alice@example.com", "tag:common")
+	bob := s.newUser(t, "Bob", "email:bob@example.com", "tag:common")
+
+	user, err := s.adp.UserGet(alice)
+	if err != nil {
+		t.Fatal("UserGet:", err)
+	}
+	if user == nil || user.Id != alice.String() || user.Public != "Alice" {
+		t.Fatalf("UserGet: got %+v", user)
+	}
+	if !equal(sorted(user.Tags...), sorted("email:alice@example.com", "tag:common")) {
+		t.Error("UserGet: wrong tags", user.Tags)
+	}
+
+	if user, err = s.adp.UserGet(store.GetUid()); err != nil || user != nil {
+		t.Error("UserGet of a missing user must return (nil, nil), got", user, err)
+	}
+
+	all, err := s.adp.UserGetAll(alice, bob, store.GetUid())
+	if err != nil {
+		t.Fatal("UserGetAll:", err)
+	}
+	if len(all) != 2 {
+		t.Error("UserGetAll: expected 2 users, got", len(all))
+	}
+
+	// Tags: all required tags must match, the callee is skipped.
+	found, err := s.adp.FindUsers(alice, []string{"tag:common"}, nil)
+	if err != nil {
+		t.Fatal("FindUsers:", err)
+	}
+	if !equal(users(found), []string{bob.String()}) {
+		t.Error("FindUsers: expected only bob, got", users(found))
+	}
+	found, _ = s.adp.FindUsers(types.ZeroUid, []string{"tag:common", "email:alice@example.com"}, nil)
+	if !equal(users(found), []string{alice.String()}) {
+		t.Error("FindUsers: every required tag must match, got", users(found))
+	}
+	found, _ = s.adp.FindUsers(types.ZeroUid, nil, []string{"email:alice@example.com", "email:bob@example.com"})
+	if !equal(users(found), sorted(alice.String(), bob.String())) {
+		t.Error("FindUsers: any optional tag must match, got", users(found))
+	}
+	found, _ = s.adp.FindUsers(types.ZeroUid, []string{"tag:common"}, []string{"email:bob@example.com"})
+	if len(found) != 2 || found[0].User != bob.String() {
+		t.Error("FindUsers: results must be sorted by the number of matches, got", users(found))
+	}
+
+	// Updating tags re-indexes the user.
+	if err = s.adp.UserUpdate(bob, map[string]interface{}{
+		"Tags": types.StringSlice{"email:robert@example.com"}, "UpdatedAt": types.TimeNow()}); err != nil {
+		t.Fatal("UserUpdate:", err)
+	}
+	if found, _ = s.adp.FindUsers(types.ZeroUid, []string{"email:bob@example.com"}, nil); len(found) != 0 {
+		t.Error("FindUsers: old tags must not match after update, got", users(found))
+	}
+	if found, _ = s.adp.FindUsers(types.ZeroUid, []string{"email:robert@example.com"}, nil); len(found) != 1 {
+		t.Error("FindUsers: new tags must match after update, got", users(found))
+	}
+
+	if err = s.adp.UserUpdate(bob, map[string]interface{}{"QuietHours": "22:00-07:00 Europe/Berlin"}); err != nil {
+		t.Fatal("UserUpdate:", err)
+	}
+	if user, _ = s.adp.UserGet(bob); user == nil || user.QuietHours != "22:00-07:00 Europe/Berlin" {
+		t.Error("UserUpdate: quiet hours not saved, got", user)
+	}
+
+	// Soft-deleted user is still returned, but marked as deleted.
+	if err = s.adp.UserDelete(bob, true); err != nil {
+		t.Fatal("UserDelete soft:", err)
+	}
+	if user, err = s.adp.UserGet(bob); err != nil || user == nil || user.DeletedAt == nil {
+		t.Error("UserGet: soft-deleted user must be marked as deleted, got", user, err)
+	}
+
+	carol := s.newUser(t, "Carol")
+	if err = s.adp.UserDelete(carol, false); err != nil {
+		t.Fatal("UserDelete hard:", err)
+	}
+	if user, err = s.adp.UserGet(carol); err != nil || user != nil {
+		t.Error("UserGet: hard-deleted user must be gone, got", user, err)
+	}
+}
+
+func (s *suite) testAuth(t *testing.T) {
+	alice := s.newUser(t, "Alice")
+	bob := s.newUser(t, "Bob")
+	login := "basic:" + alice.String()
+	secret := []byte("secret")
+	expires := types.TimeNow().Add(time.Hour)
+
+	if _, err := s.adp.AuthAddRecord(alice, "basic", login, auth.LevelAuth, secret, time.Time{}); err != nil {
+		t.Fatal("AuthAddRecord:", err)
+	}
+	if dupe, err := s.adp.AuthAddRecord(bob, "basic", login, auth.LevelAuth, secret, time.Time{}); !dupe ||
+		err != types.ErrDuplicate {
+		t.Error("AuthAddRecord: duplicate unique must be reported, got", dupe, err)
+	}
+
+	uid, lvl, sec, _, err := s.adp.AuthGetUniqueRecord(login)
+	if err != nil || uid != alice || lvl != auth.LevelAuth || !bytes.Equal(sec, secret) {
+		t.Error("AuthGetUniqueRecord: got", uid, lvl, sec, err)
+	}
+	if uid, _, _, _, err = s.adp.AuthGetUniqueRecord("basic:missing"); err != nil || !uid.IsZero() {
+		t.Error("AuthGetUniqueRecord of a missing record must return (ZeroUid, nil), got", uid, err)
+	}
+
+	unique, lvl, _, _, err := s.adp.AuthGetRecord(alice, "basic")
+	if err != nil || unique != login || lvl != auth.LevelAuth {
+		t.Error("AuthGetRecord: got", unique, lvl, err)
+	}
+	if _, _, _, _, err = s.adp.AuthGetRecord(bob, "basic"); err != types.ErrNotFound {
+		t.Error("AuthGetRecord of a missing record must return ErrNotFound, got", err)
+	}
+
+	// Changing the unique replaces the record.
+	newLogin := "basic:new" + alice.String()
+	if _, err = s.adp.AuthUpdRecord(alice, "basic", newLogin, auth.LevelAuth, []byte("new"), expires); err != nil {
+		t.Fatal("AuthUpdRecord:", err)
+	}
+	if uid, _, _, _, _ = s.adp.AuthGetUniqueRecord(login); !uid.IsZero() {
+		t.Error("AuthUpdRecord: old unique must be gone")
+	}
+	uid, _, sec, exp, _ := s.adp.AuthGetUniqueRecord(newLogin)
+	if uid != alice || !bytes.Equal(sec, []byte("new")) || !exp.Equal(expires) {
+		t.Error("AuthUpdRecord: got", uid, sec, exp)
+	}
+
+	if _, err = s.adp.AuthAddRecord(alice, "token", "token:"+alice.String(), auth.LevelAuth, nil,
+		time.Time{}); err != nil {
+		t.Fatal("AuthAddRecord:", err)
+	}
+	if err = s.adp.AuthDelRecord(alice, newLogin); err != nil {
+		t.Fatal("AuthDelRecord:", err)
+	}
+	if uid, _, _, _, _ = s.adp.AuthGetUniqueRecord(newLogin); !uid.IsZero() {
+		t.Error("AuthDelRecord: record must be gone")
+	}
+	if count, err := s.adp.AuthDelAllRecords(alice); err != nil || count != 1 {
+		t.Error("AuthDelAllRecords: expected 1 record deleted, got", count, err)
+	}
+}
+
+func (s *suite) testAuthFail(t *testing.T) {
+	key := "login:mallory"
+
+	if count, last, err := s.adp.AuthFailGet(key); err != nil || count != 0 || !last.IsZero() {
+		t.Error("AuthFailGet with no failures must return (0, zero time, nil), got", count, last, err)
+	}
+	for i := 1; i <= 3; i++ {
+		if count, err := s.adp.AuthFailAdd(key, types.TimeNow().Add(-time.Hour)); err != nil || count != i {
+			t.Fatal("AuthFailAdd: expected", i, "got", count, err)
+		}
+	}
+	if count, last, err := s.adp.AuthFailGet(key); err != nil || count != 3 || last.IsZero() {
+		t.Error("AuthFailGet: got", count, last, err)
+	}
+
+	// Failures older than resetBefore are forgotten.
+	if count, err := s.adp.AuthFailAdd(key, types.TimeNow().Add(time.Second)); err != nil || count != 1 {
+		t.Error("AuthFailAdd: count must start over, got", count, err)
+	}
+
+	if err := s.adp.AuthFailDel(key); err != nil {
+		t.Fatal("AuthFailDel:", err)
+	}
+	if count, _, err := s.adp.AuthFailGet(key); err != nil || count != 0 {
+		t.Error("AuthFailDel: failures must be gone, got", count, err)
+	}
+}
+
+func (s *suite) testCreds(t *testing.T) {
+	alice := s.newUser(t, "Alice")
+	bob := s.newUser(t, "Bob")
+	email := "creds" + alice.String() + "@example.com"
+
+	newCred := func(uid types.Uid) *types.Credential {
+		cred := &types.Credential{User: uid.String(), Method: "email", Value: email, Resp: "123456"}
+		cred.InitTimes()
+		return cred
+	}
+
+	if err := s.adp.CredAdd(newCred(alice)); err != nil {
+		t.Fatal("CredAdd:", err)
+	}
+	// Unconfirmed credentials of different users don't conflict.
+	if err := s.adp.CredAdd(newCred(bob)); err != nil {
+		t.Fatal("CredAdd of another user:", err)
+	}
+	if err := s.adp.CredAdd(newCred(alice)); err != types.ErrDuplicate {
+		t.Error("CredAdd: duplicate must be reported, got", err)
+	}
+
+	if ok, err := s.adp.CredIsConfirmed(alice, "email"); err != nil || ok {
+		t.Error("CredIsConfirmed: expected false, got", ok, err)
+	}
+	if uid, err := s.adp.CredGetOwner("email", email); err != nil || !uid.IsZero() {
+		t.Error("CredGetOwner of an unconfirmed credential must return ZeroUid, got", uid, err)
+	}
+	if err := s.adp.CredFail(alice, "email"); err != nil {
+		t.Fatal("CredFail:", err)
+	}
+	creds, err := s.adp.CredGet(alice, "email")
+	if err != nil || len(creds) != 1 || creds[0].Retries != 1 || creds[0].Value != email || creds[0].Done {
+		t.Fatal("CredGet: got", creds, err)
+	}
+
+	if err = s.adp.CredConfirm(alice, "email"); err != nil {
+		t.Fatal("CredConfirm:", err)
+	}
+	if ok, err := s.adp.CredIsConfirmed(alice, "email"); err != nil || !ok {
+		t.Error("CredIsConfirmed: expected true, got", ok, err)
+	}
+	if uid, err := s.adp.CredGetOwner("email", email); err != nil || uid != alice {
+		t.Error("CredGetOwner: expected", alice, "got", uid, err)
+	}
+	// Confirmed value is unique.
+	if err = s.adp.CredConfirm(bob, "email"); err != types.ErrDuplicate {
+		t.Error("CredConfirm: duplicate must be reported, got", err)
+	}
+	if err = s.adp.CredConfirm(bob, "tel"); err != types.ErrNotFound {
+		t.Error("CredConfirm of a missing credential must return ErrNotFound, got", err)
+	}
+
+	if creds, _ = s.adp.CredGet(alice, ""); len(creds) != 1 || !creds[0].Done {
+		t.Error("CredGet: expected one confirmed credential, got", creds)
+	}
+
+	// Deleting a single value keeps other credentials of the method.
+	phone := newCred(bob)
+	phone.Value = "other" + email
+	if err = s.adp.CredAdd(phone); err != nil {
+		t.Fatal("CredAdd:", err)
+	}
+	if err = s.adp.CredDel(bob, "email", email); err != nil {
+		t.Fatal("CredDel:", err)
+	}
+	if creds, _ = s.adp.CredGet(bob, ""); len(creds) != 1 || creds[0].Value != phone.Value {
+		t.Error("CredDel: only the given value must be deleted, got", creds)
+	}
+
+	if err = s.adp.CredDel(bob, "email", ""); err != nil {
+		t.Fatal("CredDel:", err)
+	}
+	if creds, _ = s.adp.CredGet(bob, ""); len(creds) != 0 {
+		t.Error("CredDel: credentials must be gone, got", creds)
+	}
+}
+
+func (s *suite) testDevices(t *testing.T) {
+	alice := s.newUser(t, "Alice")
+	bob := s.newUser(t, "Bob")
+	device := "device-" + alice.String()
+
+	def := &types.DeviceDef{DeviceId: device, Platform: "android", LastSeen: types.TimeNow(), Lang: "en"}
+	if err := s.adp.DeviceUpsert(alice, def); err != nil {
+		t.Fatal("DeviceUpsert:", err)
+	}
+	devs, count, err := s.adp.DeviceGetAll(alice, bob)
+	if err != nil || count != 1 || len(devs[alice]) != 1 || devs[alice][0].DeviceId != device ||
+		devs[alice][0].Platform != "android" || devs[alice][0].Lang != "en" {
+		t.Fatal("DeviceGetAll: got", devs, count, err)
+	}
+
+	// The same device registered by another user moves to that user.
+	if err = s.adp.DeviceUpsert(bob, def); err != nil {
+		t.Fatal("DeviceUpsert:", err)
+	}
+	devs, count, _ = s.adp.DeviceGetAll(alice, bob)
+	if count != 1 || len(devs[alice]) != 0 || len(devs[bob]) != 1 {
+		t.Error("DeviceUpsert: device must belong to the last user, got", devs)
+	}
+
+	if err = s.adp.DeviceDelete(bob, device); err != nil {
+		t.Fatal("DeviceDelete:", err)
+	}
+	if _, count, _ = s.adp.DeviceGetAll(alice, bob); count != 0 {
+		t.Error("DeviceDelete: device must be gone, got", count)
+	}
+}
+
+func (s *suite) testFiles(t *testing.T) {
+	alice := s.newUser(t, "Alice")
+	topic := s.newTopic(t, "Files")
+
+	newFile := func(location string) string {
+		fd := &types.FileDef{User: alice.String(), Status: types.UploadStarted, MimeType: "image/png",
+			Location: location}
+		fd.SetUid(store.GetUid())
+		fd.InitTimes()
+		if err := s.adp.FileStartUpload(fd); err != nil {
+			t.Fatal("FileStartUpload:", err)
+		}
+		return fd.Id
+	}
+
+	used := newFile("/files/used")
+	unused := newFile("/files/unused")
+
+	fd, err := s.adp.FileFinishUpload(used, types.UploadCompleted, 1024)
+	if err != nil || fd == nil || fd.Status != types.UploadCompleted || fd.Size != 1024 {
+		t.Fatal("FileFinishUpload: got", fd, err)
+	}
+	if _, err = s.adp.FileFinishUpload(store.GetUidString(), types.UploadCompleted, 1); err != types.ErrNotFound {
+		t.Error("FileFinishUpload of a missing file must return ErrNotFound, got", err)
+	}
+	if fd, err = s.adp.FileGet(used); err != nil || fd == nil || fd.Location != "/files/used" || fd.Size != 1024 {
+		t.Error("FileGet: got", fd, err)
+	}
+	if fd, err = s.adp.FileGet(store.GetUidString()); err != nil || fd != nil {
+		t.Error("FileGet of a missing file must return (nil, nil), got", fd, err)
+	}
+
+	msg := s.saveMessage(t, topic, alice, 1, 0)
+	if err = s.adp.MessageAttachments(msg.Uid(), []string{used}); err != nil {
+		t.Fatal("MessageAttachments:", err)
+	}
+
+	cutoff := types.TimeNow().Add(time.Minute)
+	locations, err := s.adp.FileDeleteUnused(cutoff, 0)
+	if err != nil || !equal(sorted(locations...), []string{"/files/unused"}) {
+		t.Error("FileDeleteUnused: only the unused file must be deleted, got", locations, err)
+	}
+	if fd, _ = s.adp.FileGet(unused); fd != nil {
+		t.Error("FileDeleteUnused: record of the unused file must be gone")
+	}
+
+	// Hard-deleting the message releases the file.
+	if err = s.adp.MessageDeleteList(topic, &types.DelMessage{Topic: topic, DelId: 1,
+		SeqIdRanges: []types.Range{{Low: 1}}}); err != nil {
+		t.Fatal("MessageDeleteList:", err)
+	}
+	if locations, _ = s.adp.FileDeleteUnused(time.Time{}, 0); !equal(locations, []string{"/files/used"}) {
+		t.Error("FileDeleteUnused: file of a deleted message must be deleted, got", locations)
+	}
+	if fd, _ = s.adp.FileGet(used); fd != nil {
+		t.Error("FileDeleteUnused: record must be gone")
+	}
+}
@@ -0,0 +1,559 @@
+package adaptertest
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+// saveMessage saves a message with the given SeqId. The content is the SeqId.
+func (s *suite) saveMessage(t *testing.T, topic string, from types.Uid, seqId, replyTo int) *types.Message {
+	t.Helper()
+
+	msg := &types.Message{
+		SeqId:   seqId,
+		Topic:   topic,
+		From:    from.String(),
+		Content: "message " + strconv.Itoa(seqId),
+		ReplyTo: replyTo,
+	}
+	msg.CreatedAt = types.TimeNow().Add(time.Duration(seqId) * time.Millisecond)
+	msg.UpdatedAt = msg.CreatedAt
+	if err := s.adp.MessageSave(msg); err != nil {
+		t.Fatal("MessageSave:", err)
+	}
+	if err := s.adp.TopicUpdateOnMessage(topic, msg); err != nil {
+		t.Fatal("TopicUpdateOnMessage:", err)
+	}
+	return msg
+}
+
+// seqIds returns SeqIds of the messages in the order returned by the adapter.
+func seqIds(msgs []types.Message) []int {
+	var ids []int
+	for _, msg := range msgs {
+		ids = append(ids, msg.SeqId)
+	}
+	return ids
+}
+
+func equalInts(a []int, b ...int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *suite) testTopics(t *testing.T) {
+	topic := s.newTopic(t, "Topic", "topic:one", "topic:common")
+	other := s.newTopic(t, "Other", "topic:common")
+
+	top, err := s.adp.TopicGet(topic)
+	if err != nil || top == nil || top.Id != topic || top.Public != "Topic" {
+		t.Fatal("TopicGet: got", top, err)
+	}
+	if top, err = s.adp.TopicGet("grp" + "missing"); err != nil || top != nil {
+		t.Error("TopicGet of a missing topic must return (nil, nil), got", top, err)
+	}
+	if err = s.adp.TopicCreate(&types.Topic{ObjHeader: types.ObjHeader{Id: topic}}); err == nil {
+		t.Error("TopicCreate: duplicate topic must be rejected")
+	}
+
+	found, err := s.adp.FindTopics([]string{"topic:common"}, nil)
+	if err != nil || !equal(topics(found), sorted(topic, other)) {
+		t.Error("FindTopics: got", topics(found), err)
+	}
+	found, _ = s.adp.FindTopics([]string{"topic:common", "topic:one"}, nil)
+	if !equal(topics(found), []string{topic}) {
+		t.Error("FindTopics: every required tag must match, got", topics(found))
+	}
+
+	if err = s.adp.TopicUpdate(other, map[string]interface{}{
+		"Tags": types.StringSlice{"topic:two"}, "Public": "Updated", "UpdatedAt": types.TimeNow()}); err != nil {
+		t.Fatal("TopicUpdate:", err)
+	}
+	if found, _ = s.adp.FindTopics([]string{"topic:two"}, nil); !equal(topics(found), []string{other}) {
+		t.Error("FindTopics: new tags must match after update, got", topics(found))
+	}
+	if top, _ = s.adp.TopicGet(other); top == nil || top.Public != "Updated" {
+		t.Error("TopicUpdate: public must be updated, got", top)
+	}
+
+	msg := &types.Message{SeqId: 7, Topic: topic}
+	msg.CreatedAt = types.TimeNow()
+	if err = s.adp.TopicUpdateOnMessage(topic, msg); err != nil {
+		t.Fatal("TopicUpdateOnMessage:", err)
+	}
+	if top, _ = s.adp.TopicGet(topic); top == nil || top.SeqId != 7 || top.TouchedAt == nil ||
+		!top.TouchedAt.Equal(msg.CreatedAt) {
+		t.Error("TopicUpdateOnMessage: got", top)
+	}
+
+	if err = s.adp.TopicDelete(other); err != nil {
+		t.Fatal("TopicDelete:", err)
+	}
+	if top, _ = s.adp.TopicGet(other); top != nil {
+		t.Error("TopicDelete: topic must be gone")
+	}
+}
+
+func (s *suite) testSubscriptions(t *testing.T) {
+	alice := s.newUser(t, "Alice")
+	bob := s.newUser(t, "Bob")
+	topic := s.newTopic(t, "Subs")
+	other := s.newTopic(t, "Other")
+
+	count, err := s.adp.TopicShare([]*types.Subscription{newSub(topic, alice), newSub(topic, bob),
+		newSub(other, bob)})
+	if err != nil || count != 3 {
+		t.Fatal("TopicShare: got", count, err)
+	}
+
+	sub, err := s.adp.SubscriptionGet(topic, bob)
+	if err != nil || sub == nil || sub.User != bob.String() || sub.Topic != topic ||
+		sub.ModeGiven != types.ModeCPublic {
+		t.Fatal("SubscriptionGet: got", sub, err)
+	}
+	if sub, err = s.adp.SubscriptionGet(topic, missingUid()); err != nil || sub != nil {
+		t.Error("SubscriptionGet of a missing subscription must return (nil, nil), got", sub, err)
+	}
+
+	if err = s.adp.SubsUpdate(topic, bob, map[string]interface{}{"ReadSeqId": 5, "RecvSeqId": 6,
+		"MentionCount": 2, "UpdatedAt": types.TimeNow()}); err != nil {
+		t.Fatal("SubsUpdate:", err)
+	}
+	if sub, _ = s.adp.SubscriptionGet(topic, bob); sub == nil || sub.ReadSeqId != 5 || sub.RecvSeqId != 6 ||
+		sub.MentionCount != 2 {
+		t.Error("SubsUpdate: got", sub)
+	}
+	// Notification preferences.
+	muteUntil := types.TimeNow().Add(time.Hour)
+	if err = s.adp.SubsUpdate(topic, bob, map[string]interface{}{"MuteUntil": &muteUntil,
+		"MentionsOnly": true}); err != nil {
+		t.Fatal("SubsUpdate:", err)
+	}
+	if subs, _ := s.adp.SubsForTopic(topic, false, &types.QueryOpt{User: bob}); len(subs) != 1 ||
+		subs[0].MuteUntil == nil || !subs[0].MuteUntil.Equal(muteUntil) || !subs[0].MentionsOnly {
+		t.Error("SubsUpdate: notification preferences not saved, got", subs)
+	}
+	if subs, _ := s.adp.UsersForTopic(topic, false, &types.QueryOpt{User: alice}); len(subs) != 1 ||
+		subs[0].MuteUntil != nil || subs[0].MentionsOnly {
+		t.Error("UsersForTopic: preferences of other users must not change, got", subs)
+	}
+
+	// Zero user updates all subscriptions to the topic.
+	if err = s.adp.SubsUpdate(topic, types.ZeroUid, map[string]interface{}{"DelId": 3}); err != nil {
+		t.Fatal("SubsUpdate all:", err)
+	}
+	subs, _ := s.adp.SubsForTopic(topic, false, nil)
+	for _, ss := range subs {
+		if ss.DelId != 3 {
+			t.Error("SubsUpdate: all subscriptions must be updated, got", ss.User, ss.DelId)
+		}
+	}
+
+	// Filters and limits.
+	if subs, err = s.adp.SubsForTopic(topic, false, nil); err != nil ||
+		!equal(users(subs), sorted(alice.String(), bob.String())) {
+		t.Error("SubsForTopic: got", users(subs), err)
+	}
+	if subs, _ = s.adp.SubsForTopic(topic, false, &types.QueryOpt{User: bob}); !equal(users(subs),
+		[]string{bob.String()}) {
+		t.Error("SubsForTopic: filter by user, got", users(subs))
+	}
+	if subs, _ = s.adp.SubsForTopic(topic, false, &types.QueryOpt{Limit: 1}); len(subs) != 1 {
+		t.Error("SubsForTopic: limit, got", users(subs))
+	}
+	if subs, _ = s.adp.SubsForUser(bob, false, nil); !equal(topics(subs), sorted(topic, other)) {
+		t.Error("SubsForUser: got", topics(subs))
+	}
+	if subs, _ = s.adp.SubsForUser(bob, false, &types.QueryOpt{Topic: other}); !equal(topics(subs),
+		[]string{other}) {
+		t.Error("SubsForUser: filter by topic, got", topics(subs))
+	}
+
+	// IfModifiedSince must not filter anything out: unmodified entries are stripped by the caller.
+	future := types.TimeNow().Add(time.Hour)
+	ims := &types.QueryOpt{IfModifiedSince: &future}
+	if subs, _ = s.adp.SubsForTopic(topic, false, ims); len(subs) != 2 {
+		t.Error("SubsForTopic: IfModifiedSince must be ignored, got", users(subs))
+	}
+	if subs, _ = s.adp.SubsForUser(bob, false, ims); len(subs) != 2 {
+		t.Error("SubsForUser: IfModifiedSince must be ignored, got", topics(subs))
+	}
+	if subs, _ = s.adp.TopicsForUser(bob, false, ims); len(subs) != 2 {
+		t.Error("TopicsForUser: IfModifiedSince must be ignored, got", topics(subs))
+	}
+	if subs, _ = s.adp.UsersForTopic(topic, false, ims); len(subs) != 2 {
+		t.Error("UsersForTopic: IfModifiedSince must be ignored, got", users(subs))
+	}
+
+	// Public is denormalized from the topic or the user.
+	subs, _ = s.adp.TopicsForUser(bob, false, &types.QueryOpt{Topic: topic})
+	if len(subs) != 1 || subs[0].GetPublic() != "Subs" || subs[0].GetSeqId() != 0 {
+		t.Error("TopicsForUser: got", subs)
+	}
+	subs, _ = s.adp.UsersForTopic(topic, false, &types.QueryOpt{User: alice})
+	if len(subs) != 1 || subs[0].GetPublic() != "Alice" {
+		t.Error("UsersForTopic: got", subs)
+	}
+
+	// keepDeleted.
+	if err = s.adp.SubsDelete(topic, bob); err != nil {
+		t.Fatal("SubsDelete:", err)
+	}
+	if sub, _ = s.adp.SubscriptionGet(topic, bob); sub != nil {
+		t.Error("SubscriptionGet must not return deleted subscriptions, got", sub)
+	}
+	if subs, _ = s.adp.SubsForTopic(topic, false, nil); !equal(users(subs), []string{alice.String()}) {
+		t.Error("SubsForTopic: deleted subscriptions must be skipped, got", users(subs))
+	}
+	subs, _ = s.adp.SubsForTopic(topic, true, nil)
+	if !equal(users(subs), sorted(alice.String(), bob.String())) {
+		t.Error("SubsForTopic: deleted subscriptions must be kept, got", users(subs))
+	}
+	for _, ss := range subs {
+		if (ss.User == bob.String()) != (ss.DeletedAt != nil) {
+			t.Error("SubsForTopic: only deleted subscriptions must be marked as deleted, got", ss.User, ss.DeletedAt)
+		}
+	}
+	if subs, _ = s.adp.SubsForUser(bob, false, nil); !equal(topics(subs), []string{other}) {
+		t.Error("SubsForUser: deleted subscriptions must be skipped, got", topics(subs))
+	}
+	if subs, _ = s.adp.SubsForUser(bob, true, nil); len(subs) != 2 {
+		t.Error("SubsForUser: deleted subscriptions must be kept, got", topics(subs))
+	}
+	if subs, _ = s.adp.TopicsForUser(bob, false, nil); !equal(topics(subs), []string{other}) {
+		t.Error("TopicsForUser: deleted subscriptions must be skipped, got", topics(subs))
+	}
+	if subs, _ = s.adp.TopicsForUser(bob, true, nil); len(subs) != 2 {
+		t.Error("TopicsForUser: deleted subscriptions must be kept, got", topics(subs))
+	}
+	if subs, _ = s.adp.UsersForTopic(topic, false, nil); len(subs) != 1 {
+		t.Error("UsersForTopic: deleted subscriptions must be skipped, got", users(subs))
+	}
+	if subs, _ = s.adp.UsersForTopic(topic, true, nil); len(subs) != 2 {
+		t.Error("UsersForTopic: deleted subscriptions must be kept, got", users(subs))
+	}
+
+	// Sharing again undeletes the subscription and keeps values persisted through deletion.
+	resub := newSub(topic, bob)
+	resub.ModeGiven = types.ModeCFull
+	if _, err = s.adp.TopicShare([]*types.Subscription{resub}); err != nil {
+		t.Fatal("TopicShare:", err)
+	}
+	sub, _ = s.adp.SubscriptionGet(topic, bob)
+	if sub == nil || sub.ModeGiven != types.ModeCFull || sub.ReadSeqId != 5 || sub.DelId != 3 {
+		t.Error("TopicShare: subscription must be undeleted, got", sub)
+	}
+
+	if err = s.adp.SubsDelForTopic(topic); err != nil {
+		t.Fatal("SubsDelForTopic:", err)
+	}
+	if subs, _ = s.adp.SubsForTopic(topic, false, nil); len(subs) != 0 {
+		t.Error("SubsDelForTopic: all subscriptions must be deleted, got", users(subs))
+	}
+	if err = s.adp.SubsDelForUser(bob); err != nil {
+		t.Fatal("SubsDelForUser:", err)
+	}
+	if subs, _ = s.adp.SubsForUser(bob, false, nil); len(subs) != 0 {
+		t.Error("SubsDelForUser: all subscriptions must be deleted, got", topics(subs))
+	}
+}
+
+// missingUid returns an ID of a user which does not exist.
+func missingUid() types.Uid {
+	return types.Uid(1)
+}
+
+func (s *suite) testP2P(t *testing.T) {
+	alice := s.newUser(t, "Alice")
+	bob := s.newUser(t, "Bob")
+	topic := alice.P2PName(bob)
+
+	initiator := newSub(topic, alice)
+	invited := newSub(topic, bob)
+	invited.ModeGiven = types.ModeCFull
+	if err := s.adp.TopicCreateP2P(initiator, invited); err != nil {
+		t.Fatal("TopicCreateP2P:", err)
+	}
+
+	if top, err := s.adp.TopicGet(topic); err != nil || top == nil {
+		t.Fatal("TopicCreateP2P: topic must be created, got", top, err)
+	}
+	subs, err := s.adp.TopicsForUser(alice, false, nil)
+	if err != nil || len(subs) != 1 {
+		t.Fatal("TopicsForUser: got", subs, err)
+	}
+	if subs[0].Topic != topic || subs[0].GetPublic() != "Bob" || subs[0].GetWith() != bob.UserId() {
+		t.Error("TopicsForUser: p2p subscription must describe the other user, got", subs[0])
+	}
+	if sub, _ := s.adp.SubscriptionGet(topic, bob); sub == nil || sub.ModeGiven != types.ModeCFull {
+		t.Error("TopicCreateP2P: invited subscription, got", sub)
+	}
+}
+
+func (s *suite) testMessages(t *testing.T) {
+	alice := s.newUser(t, "Alice")
+	bob := s.newUser(t, "Bob")
+	topic := s.newTopic(t, "Messages")
+
+	for seq := 1; seq <= 5; seq++ {
+		s.saveMessage(t, topic, alice, seq, 0)
+	}
+	// Replies to the first message.
+	s.saveMessage(t, topic, bob, 6, 1)
+	s.saveMessage(t, topic, bob, 7, 1)
+
+	msgs, err := s.adp.MessageGetAll(topic, bob, nil)
+	if err != nil || !equalInts(seqIds(msgs), 7, 6, 5, 4, 3, 2, 1) {
+		t.Fatal("MessageGetAll: messages must be sorted newest first, got", seqIds(msgs), err)
+	}
+	if msgs[6].From != alice.String() || msgs[6].Content != "message 1" {
+		t.Error("MessageGetAll: got", msgs[6])
+	}
+	if msgs[6].ReplyCount != 2 || msgs[6].LastReplyAt == nil {
+		t.Error("MessageSave: replies must be counted on the root message, got", msgs[6].ReplyCount)
+	}
+
+	// Since is inclusive, Before is exclusive.
+	msgs, _ = s.adp.MessageGetAll(topic, bob, &types.QueryOpt{Since: 2, Before: 4})
+	if !equalInts(seqIds(msgs), 3, 2) {
+		t.Error("MessageGetAll: [Since, Before) range, got", seqIds(msgs))
+	}
+	msgs, _ = s.adp.MessageGetAll(topic, bob, &types.QueryOpt{Limit: 2})
+	if !equalInts(seqIds(msgs), 7, 6) {
+		t.Error("MessageGetAll: limit must keep the newest messages, got", seqIds(msgs))
+	}
+	msgs, _ = s.adp.MessageGetAll(topic, bob, &types.QueryOpt{Thread: 1})
+	if !equalInts(seqIds(msgs), 7, 6) {
+		t.Error("MessageGetAll: thread, got", seqIds(msgs))
+	}
+
+	// Editing.
+	edit := &types.Message{SeqId: 2, Topic: topic, Content: "edited"}
+	edit.UpdatedAt = types.TimeNow()
+	if err = s.adp.MessageEdit(edit); err != nil {
+		t.Fatal("MessageEdit:", err)
+	}
+	msgs, _ = s.adp.MessageGetAll(topic, bob, &types.QueryOpt{Since: 2, Before: 3})
+	if len(msgs) != 1 || msgs[0].Content != "edited" {
+		t.Error("MessageEdit: got", msgs)
+	}
+	if err = s.adp.MessageEdit(&types.Message{SeqId: 100, Topic: topic}); err != types.ErrNotFound {
+		t.Error("MessageEdit of a missing message must return ErrNotFound, got", err)
+	}
+
+	// Reactions.
+	if err = s.adp.MessageReactionAdd(topic, 3, alice, "+1"); err != nil {
+		t.Fatal("MessageReactionAdd:", err)
+	}
+	if err = s.adp.MessageReactionAdd(topic, 3, bob, "+1"); err != nil {
+		t.Fatal("MessageReactionAdd:", err)
+	}
+	if err = s.adp.MessageReactionAdd(topic, 3, bob, "+1"); err != types.ErrDuplicate {
+		t.Error("MessageReactionAdd: duplicate must be reported, got", err)
+	}
+	if err = s.adp.MessageReactionAdd(topic, 100, bob, "+1"); err != types.ErrNotFound {
+		t.Error("MessageReactionAdd to a missing message must return ErrNotFound, got", err)
+	}
+	msgs, _ = s.adp.MessageGetAll(topic, bob, &types.QueryOpt{Since: 3, Before: 4})
+	if len(msgs) != 1 || msgs[0].Reactions["+1"] != 2 {
+		t.Error("MessageReactionAdd: got", msgs)
+	}
+	if err = s.adp.MessageReactionDelete(topic, 3, alice, "+1"); err != nil {
+		t.Fatal("MessageReactionDelete:", err)
+	}
+	if err = s.adp.MessageReactionDelete(topic, 3, alice, "+1"); err != types.ErrNotFound {
+		t.Error("MessageReactionDelete of a missing reaction must return ErrNotFound, got", err)
+	}
+	msgs, _ = s.adp.MessageGetAll(topic, bob, &types.QueryOpt{Since: 3, Before: 4})
+	if len(msgs) != 1 || msgs[0].Reactions["+1"] != 1 {
+		t.Error("MessageReactionDelete: got", msgs)
+	}
+
+	// Full-text search on the adapter's index.
+	if err = s.adp.MessageIndex(topic, 4, []string{"hello", "world"}); err != nil {
+		t.Fatal("MessageIndex:", err)
+	}
+	if err = s.adp.MessageIndex(topic, 5, []string{"hello"}); err != nil {
+		t.Fatal("MessageIndex:", err)
+	}
+	msgs, err = s.adp.MessageSearch([]string{topic}, bob, []string{"hello"}, nil)
+	if err == types.ErrUnsupported {
+		return
+	}
+	if err != nil || !equalInts(seqIds(msgs), 5, 4) {
+		t.Error("MessageSearch: got", seqIds(msgs), err)
+	}
+	msgs, _ = s.adp.MessageSearch([]string{topic}, bob, []string{"hello", "world"}, nil)
+	if !equalInts(seqIds(msgs), 4) {
+		t.Error("MessageSearch: all words must match, got", seqIds(msgs))
+	}
+}
+
+func (s *suite) testDeletes(t *testing.T) {
+	alice := s.newUser(t, "Alice")
+	bob := s.newUser(t, "Bob")
+	topic := s.newTopic(t, "Deletes")
+
+	for seq := 1; seq <= 8; seq++ {
+		s.saveMessage(t, topic, alice, seq, 0)
+		if err := s.adp.MessageIndex(topic, seq, []string{"secret"}); err != nil {
+			t.Fatal("MessageIndex:", err)
+		}
+	}
+
+	// Soft-delete a single message (Hi == 0) for bob.
+	if err := s.adp.MessageDeleteList(topic, &types.DelMessage{Topic: topic, DeletedFor: bob.String(), DelId: 1,
+		SeqIdRanges: []types.Range{{Low: 1}}}); err != nil {
+		t.Fatal("MessageDeleteList soft:", err)
+	}
+	msgs, _ := s.adp.MessageGetAll(topic, bob, nil)
+	if !equalInts(seqIds(msgs), 8, 7, 6, 5, 4, 3, 2) {
+		t.Error("MessageGetAll: soft-deleted message must be hidden, got", seqIds(msgs))
+	}
+	msgs, _ = s.adp.MessageGetAll(topic, alice, nil)
+	if len(msgs) != 8 {
+		t.Error("MessageGetAll: message soft-deleted for another user must be visible, got", seqIds(msgs))
+	}
+
+	// Hard-delete a range [2, 4): 2 and 3 are deleted, 4 is not.
+	if err := s.adp.MessageDeleteList(topic, &types.DelMessage{Topic: topic, DelId: 2,
+		SeqIdRanges: []types.Range{{Low: 2, Hi: 4}}}); err != nil {
+		t.Fatal("MessageDeleteList hard:", err)
+	}
+	// Hard-delete a single message (Hi == 0) and a range of one message.
+	if err := s.adp.MessageDeleteList(topic, &types.DelMessage{Topic: topic, DelId: 3,
+		SeqIdRanges: []types.Range{{Low: 5}, {Low: 7, Hi: 8}}}); err != nil {
+		t.Fatal("MessageDeleteList hard:", err)
+	}
+	msgs, _ = s.adp.MessageGetAll(topic, alice, nil)
+	if !equalInts(seqIds(msgs), 8, 6, 4, 1) {
+		t.Error("MessageGetAll: hard-deleted messages must be hidden, got", seqIds(msgs))
+	}
+	// Words of hard-deleted messages are removed from the index.
+	msgs, err := s.adp.MessageSearch([]string{topic}, alice, []string{"secret"}, nil)
+	if err != types.ErrUnsupported && (err != nil || !equalInts(seqIds(msgs), 8, 6, 4, 1)) {
+		t.Error("MessageSearch: hard-deleted messages must not be found, got", seqIds(msgs), err)
+	}
+
+	// The log of deletions.
+	dels, err := s.adp.MessageGetDeleted(topic, bob, nil)
+	if err != nil || len(dels) != 3 {
+		t.Fatal("MessageGetDeleted: expected 3 entries, got", dels, err)
+	}
+	if dels[0].DelId != 1 || dels[0].DeletedFor != bob.String() || len(dels[0].SeqIdRanges) != 1 ||
+		dels[0].SeqIdRanges[0] != (types.Range{Low: 1}) {
+		t.Error("MessageGetDeleted: soft-delete entry, got", dels[0])
+	}
+	if dels[1].DelId != 2 || dels[1].DeletedFor != "" || len(dels[1].SeqIdRanges) != 1 ||
+		dels[1].SeqIdRanges[0] != (types.Range{Low: 2, Hi: 4}) {
+		t.Error("MessageGetDeleted: range entry, got", dels[1])
+	}
+	// Ranges of a single message are reported with Hi == 0.
+	if dels[2].DelId != 3 || len(dels[2].SeqIdRanges) != 2 ||
+		dels[2].SeqIdRanges[0] != (types.Range{Low: 5}) || dels[2].SeqIdRanges[1] != (types.Range{Low: 7}) {
+		t.Error("MessageGetDeleted: single message entries, got", dels[2])
+	}
+
+	if dels, _ = s.adp.MessageGetDeleted(topic, alice, nil); len(dels) != 2 {
+		t.Error("MessageGetDeleted: soft-deletes of other users must be skipped, got", dels)
+	}
+	// Since is inclusive, Before is exclusive.
+	dels, _ = s.adp.MessageGetDeleted(topic, bob, &types.QueryOpt{Since: 2, Before: 3})
+	if len(dels) != 1 || dels[0].DelId != 2 {
+		t.Error("MessageGetDeleted: [Since, Before) range, got", dels)
+	}
+	if dels, _ = s.adp.MessageGetDeleted(topic, bob, &types.QueryOpt{Limit: 1}); len(dels) != 1 ||
+		dels[0].DelId != 1 {
+		t.Error("MessageGetDeleted: limit must keep the oldest entries, got", dels)
+	}
+
+	// Deleting all messages of the topic.
+	if err = s.adp.MessageDeleteList(topic, nil); err != nil {
+		t.Fatal("MessageDeleteList all:", err)
+	}
+	if msgs, _ = s.adp.MessageGetAll(topic, alice, nil); len(msgs) != 0 {
+		t.Error("MessageDeleteList: all messages must be gone, got", seqIds(msgs))
+	}
+	if dels, _ = s.adp.MessageGetDeleted(topic, bob, nil); len(dels) != 0 {
+		t.Error("MessageDeleteList: log of deletions must be gone, got", dels)
+	}
+}
+
+// sameTime checks if the time is set and equal to the expected time with the precision of the database.
+func sameTime(actual *time.Time, expected time.Time) bool {
+	if actual == nil {
+		return false
+	}
+	diff := actual.Sub(expected)
+	return diff > -time.Millisecond && diff < time.Millisecond
+}
+
+func (s *suite) testThreads(t *testing.T) {
+	alice := s.newUser(t, "Alice")
+	bob := s.newUser(t, "Bob")
+	topic := s.newTopic(t, "Threads")
+
+	s.saveMessage(t, topic, alice, 1, 0)
+	reply2 := s.saveMessage(t, topic, bob, 2, 1)
+	reply3 := s.saveMessage(t, topic, bob, 3, 1)
+	reply4 := s.saveMessage(t, topic, bob, 4, 1)
+
+	root := func(user types.Uid) types.Message {
+		t.Helper()
+		msgs, err := s.adp.MessageGetAll(topic, user, &types.QueryOpt{Since: 1, Before: 2})
+		if err != nil || len(msgs) != 1 {
+			t.Fatal("MessageGetAll: root message, got", msgs, err)
+		}
+		return msgs[0]
+	}
+
+	// Replies soft-deleted by the user are not counted for the user.
+	if err := s.adp.MessageDeleteList(topic, &types.DelMessage{Topic: topic, DeletedFor: bob.String(), DelId: 1,
+		SeqIdRanges: []types.Range{{Low: 4}}}); err != nil {
+		t.Fatal("MessageDeleteList soft:", err)
+	}
+	if msg := root(bob); msg.ReplyCount != 2 || !sameTime(msg.LastReplyAt, reply3.CreatedAt) {
+		t.Error("MessageDeleteList: soft-deleted reply must not be counted, got", msg.ReplyCount, msg.LastReplyAt)
+	}
+	if msg := root(alice); msg.ReplyCount != 3 || !sameTime(msg.LastReplyAt, reply4.CreatedAt) {
+		t.Error("MessageDeleteList: reply soft-deleted by another user must be counted, got",
+			msg.ReplyCount, msg.LastReplyAt)
+	}
+
+	// Hard-deleted replies are not counted for anyone.
+	if err := s.adp.MessageDeleteList(topic, &types.DelMessage{Topic: topic, DelId: 2,
+		SeqIdRanges: []types.Range{{Low: 3}}}); err != nil {
+		t.Fatal("MessageDeleteList hard:", err)
+	}
+	if msg := root(alice); msg.ReplyCount != 2 || !sameTime(msg.LastReplyAt, reply4.CreatedAt) {
+		t.Error("MessageDeleteList: hard-deleted reply must not be counted, got", msg.ReplyCount, msg.LastReplyAt)
+	}
+	if msg := root(bob); msg.ReplyCount != 1 || !sameTime(msg.LastReplyAt, reply2.CreatedAt) {
+		t.Error("MessageDeleteList: got", msg.ReplyCount, msg.LastReplyAt)
+	}
+
+	if err := s.adp.MessageDeleteList(topic, &types.DelMessage{Topic: topic, DelId: 3,
+		SeqIdRanges: []types.Range{{Low: 2, Hi: 5}}}); err != nil {
+		t.Fatal("MessageDeleteList hard:", err)
+	}
+	if msg := root(alice); msg.ReplyCount != 0 || msg.LastReplyAt != nil {
+		t.Error("MessageDeleteList: all replies are deleted, got", msg.ReplyCount, msg.LastReplyAt)
+	}
+
+	// New replies are counted again.
+	s.saveMessage(t, topic, alice, 5, 0)
+	reply6 := s.saveMessage(t, topic, alice, 6, 1)
+	if msg := root(bob); msg.ReplyCount != 1 || !sameTime(msg.LastReplyAt, reply6.CreatedAt) {
+		t.Error("MessageSave: reply after deletions, got", msg.ReplyCount, msg.LastReplyAt)
+	}
+}
@@ -0,0 +1,2131 @@
+// Package bolt implements the storage adapter on top of the embedded key-value store
+// go.etcd.io/bbolt. The whole database is a single local file, no database server is needed.
+// The file can be opened by one process only, so the adapter is suitable for single-node
+// deployments, development and testing.
+package bolt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/nanfengpo/chat/server/auth"
+	"github.com/nanfengpo/chat/server/store"
+	t "github.com/nanfengpo/chat/server/store/types"
+	bbolt "go.etcd.io/bbolt"
+)
+
+// adapter holds bbolt database handle.
+type adapter struct {
+	db      *bbolt.DB
+	file    string
+	version int
+}
+
+const (
+	defaultFile = "nanfengpo.db"
+
+	dbVersion = 110
+
+	adapterName = "bolt"
+)
+
+type configType struct {
+	// Path to the database file. It's created if missing.
+	File string `json:"file,omitempty"`
+	// Time in milliseconds to wait for the exclusive lock on the file.
+	Timeout int `json:"timeout,omitempty"`
+}
+
+const (
+	// Default time to wait for the file lock.
+	defaultTimeout = time.Second
+
+	// Maximum number of records to return.
+	maxResults = 1024
+	// Maximum number of topic subscribers to return
+	maxSubscribers = 256
+)
+
+// Top-level buckets. Values are JSON-encoded unless stated otherwise.
+var (
+	// Database metadata: "version" -> schema version as a decimal string.
+	bucketMeta = []byte("kvmeta")
+	// Users: uid -> t.User. Devices are stored inside the user record.
+	bucketUsers = []byte("users")
+	// Index of user tags: tag + "\x00" + uid -> uid.
+	bucketUserTags = []byte("usertags")
+	// Index of devices: device hash -> uid.
+	bucketDevices = []byte("devices")
+	// Authentication records: unique -> authRecord.
+	bucketAuth = []byte("auth")
+	// Index of authentication records: uid + ":" + scheme -> unique.
+	bucketAuthUsers = []byte("authusers")
+	// Topics: name -> t.Topic.
+	bucketTopics = []byte("topics")
+	// Index of topic tags: tag + "\x00" + topic -> topic.
+	bucketTopicTags = []byte("topictags")
+	// Subscriptions: topic + ":" + uid -> t.Subscription.
+	bucketSubs = []byte("subscriptions")
+	// Index of subscriptions by user: uid + ":" + topic -> topic.
+	bucketUserSubs = []byte("usersubs")
+	// Messages: one nested bucket per topic, seqId -> message.
+	bucketMessages = []byte("messages")
+	// Index of messages by ID: message id -> topic + "\x00" + seqId.
+	bucketMessageIds = []byte("messageids")
+	// Deletion log: one nested bucket per topic, delId + serial -> t.DelMessage.
+	bucketDellog = []byte("dellog")
+	// Credentials: [uid + ":"] + method + ":" + value -> t.Credential. Unconfirmed credentials are prefixed
+	// with the uid so multiple users can attempt to validate the same value.
+	bucketCreds = []byte("credentials")
+	// Index of credentials by user: uid + ":" + method + ":" + value -> key in credentials.
+	bucketUserCreds = []byte("usercreds")
+	// Records of uploaded files: file id -> fileRecord.
+	bucketFiles = []byte("fileuploads")
+	// Failed authentication attempts: "login:" + login or "ip:" + address -> authFail.
+	bucketAuthFail = []byte("authfail")
+
+	allBuckets = [][]byte{bucketMeta, bucketUsers, bucketUserTags, bucketDevices, bucketAuth, bucketAuthUsers,
+		bucketTopics, bucketTopicTags, bucketSubs, bucketUserSubs, bucketMessages, bucketMessageIds, bucketDellog,
+		bucketCreds, bucketUserCreds, bucketFiles, bucketAuthFail}
+)
+
+// Authentication record.
+type authRecord struct {
+	Userid  string
+	Scheme  string
+	AuthLvl auth.Level
+	Secret  []byte
+	Expires time.Time
+}
+
+// Count of failed authentication attempts.
+type authFail struct {
+	Failures int
+	LastAt   time.Time
+}
+
+// Stored message. It extends t.Message with the data which is not returned to the caller as is.
+type message struct {
+	t.Message
+	// Users who reacted to the message: reaction -> list of user IDs. Shadows t.Message.Reactions.
+	Reactions map[string][]string `json:",omitempty"`
+	// Earlier versions of the message, oldest first.
+	Revisions []revision `json:",omitempty"`
+	// Normalized words for full-text search.
+	Words []string `json:",omitempty"`
+	// IDs of the files attached to the message.
+	Attachments []string `json:",omitempty"`
+}
+
+// Earlier version of an edited message.
+type revision struct {
+	CreatedAt time.Time
+	Head      t.MessageHeaders
+	Content   interface{}
+}
+
+// Record of an uploaded file with a count of messages which use it.
+type fileRecord struct {
+	t.FileDef
+	UseCount int
+}
+
+// Open initializes the database file.
+func (a *adapter) Open(jsonconfig string) error {
+	if a.db != nil {
+		return errors.New("bolt adapter is already connected")
+	}
+
+	var config configType
+	if jsonconfig != "" {
+		if err := json.Unmarshal([]byte(jsonconfig), &config); err != nil {
+			return errors.New("bolt adapter failed to parse config: " + err.Error())
+		}
+	}
+
+	a.file = config.File
+	if a.file == "" {
+		a.file = defaultFile
+	}
+	timeout := defaultTimeout
+	if config.Timeout > 0 {
+		timeout = time.Duration(config.Timeout) * time.Millisecond
+	}
+
+	var err error
+	a.db, err = bbolt.Open(a.file, 0600, &bbolt.Options{Timeout: timeout})
+	if err != nil {
+		a.db = nil
+		return err
+	}
+
+	a.version = -1
+
+	return nil
+}
+
+// Close closes the underlying database file.
+func (a *adapter) Close() error {
+	var err error
+	if a.db != nil {
+		err = a.db.Close()
+		a.db = nil
+		a.version = -1
+	}
+	return err
+}
+
+// IsOpen returns true if the database file is open, false otherwise.
+func (a *adapter) IsOpen() bool {
+	return a.db != nil
+}
+
+// Read current database version
+func (a *adapter) getDbVersion() (int, error) {
+	var vers int
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		meta := tx.Bucket(bucketMeta)
+		if meta == nil {
+			return errors.New("Database not initialized")
+		}
+		var err error
+		vers, err = strconv.Atoi(string(meta.Get([]byte("version"))))
+		return err
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	a.version = vers
+
+	return vers, nil
+}
+
+// CheckDbVersion checks whether the actual DB version matches the expected version of this adapter.
+func (a *adapter) CheckDbVersion() error {
+	if a.version <= 0 {
+		a.getDbVersion()
+	}
+
+	if a.version > 0 && a.version < dbVersion {
+		return errors.New("Outdated database version " + strconv.Itoa(a.version) +
+			". Expected " + strconv.Itoa(dbVersion) + ", run 'tinode-db -upgrade'")
+	}
+	if a.version != dbVersion {
+		return errors.New("Invalid database version " + strconv.Itoa(a.version) +
+			". Expected " + strconv.Itoa(dbVersion))
+	}
+
+	return nil
+}
+
+// GetName returns string that adapter uses to register itself with store.
+func (a *adapter) GetName() string {
+	return adapterName
+}
+
+// CreateDb initializes the storage. If reset is true, the database file is wiped first.
+func (a *adapter) CreateDb(reset bool) error {
+	if reset {
+		// Recreating the file is faster than deleting the buckets one by one and it releases
+		// the disk space.
+		if err := a.db.Close(); err != nil {
+			return err
+		}
+		a.db = nil
+		if err := os.Remove(a.file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		var err error
+		if a.db, err = bbolt.Open(a.file, 0600, &bbolt.Options{Timeout: defaultTimeout}); err != nil {
+			a.db = nil
+			return err
+		}
+	}
+
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		if tx.Bucket(bucketMeta) != nil {
+			return errors.New("Database already exists")
+		}
+		for _, name := range allBuckets {
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(bucketMeta).Put([]byte("version"), []byte(strconv.Itoa(dbVersion)))
+	})
+}
+
+// getJSON reads a JSON document from the bucket. Returns false if the key is not found.
+func getJSON(b *bbolt.Bucket, key []byte, val interface{}) (bool, error) {
+	data := b.Get(key)
+	if data == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, val)
+}
+
+// putJSON writes a JSON document to the bucket.
+func putJSON(b *bbolt.Bucket, key []byte, val interface{}) error {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// patchJSON replaces top-level fields of a stored JSON document with the values from the update.
+// The keys of the update are the names of the fields of the stored struct. A missing document
+// is not an error.
+func patchJSON(b *bbolt.Bucket, key []byte, update map[string]interface{}) error {
+	data := b.Get(key)
+	if data == nil {
+		return nil
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	for field, val := range update {
+		raw, err := json.Marshal(val)
+		if err != nil {
+			return err
+		}
+		doc[field] = raw
+	}
+	return putJSON(b, key, doc)
+}
+
+// prefixKeys returns copies of all keys in the bucket which start with the prefix. Keys are copied
+// so the bucket can be modified while the keys are processed.
+func prefixKeys(b *bbolt.Bucket, prefix string) [][]byte {
+	var keys [][]byte
+	p := []byte(prefix)
+	c := b.Cursor()
+	for k, _ := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	return keys
+}
+
+// seqKey converts a sequential ID into a key which sorts in numeric order.
+func seqKey(seq int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(seq))
+	return key
+}
+
+// keySeq is the reverse of seqKey.
+func keySeq(key []byte) int {
+	return int(binary.BigEndian.Uint64(key[:8]))
+}
+
+func tagKey(tag, owner string) []byte {
+	return []byte(tag + "\x00" + owner)
+}
+
+// addTags indexes tags of a user or a topic.
+func addTags(b *bbolt.Bucket, owner string, tags []string) error {
+	for _, tag := range tags {
+		if err := b.Put(tagKey(tag, owner), []byte(owner)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeTags removes tags of a user or a topic from the index.
+func removeTags(b *bbolt.Bucket, owner string, tags []string) error {
+	for _, tag := range tags {
+		if err := b.Delete(tagKey(tag, owner)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractTags finds tags in the update. Returns false if tags are not being updated.
+func extractTags(update map[string]interface{}) ([]string, bool) {
+	val, ok := update["Tags"]
+	if !ok {
+		return nil, false
+	}
+	switch tags := val.(type) {
+	case t.StringSlice:
+		return []string(tags), true
+	case []string:
+		return tags, true
+	}
+	return nil, true
+}
+
+// UserCreate creates a new user. Returns error and true if error is due to duplicate user name
+func (a *adapter) UserCreate(user *t.User) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		users := tx.Bucket(bucketUsers)
+		if users.Get([]byte(user.Id)) != nil {
+			return t.ErrDuplicate
+		}
+		if err := putJSON(users, []byte(user.Id), user); err != nil {
+			return err
+		}
+		return addTags(tx.Bucket(bucketUserTags), user.Id, user.Tags)
+	})
+}
+
+// Add user's authentication record
+func (a *adapter) AuthAddRecord(uid t.Uid, scheme, unique string, authLvl auth.Level,
+	secret []byte, expires time.Time) (bool, error) {
+
+	var dupe bool
+	err := a.db.Update(func(tx *bbolt.Tx) error {
+		var err error
+		dupe, err = authAddRecord(tx, uid, scheme, unique, authLvl, secret, expires)
+		return err
+	})
+	return dupe, err
+}
+
+func authAddRecord(tx *bbolt.Tx, uid t.Uid, scheme, unique string, authLvl auth.Level,
+	secret []byte, expires time.Time) (bool, error) {
+
+	records := tx.Bucket(bucketAuth)
+	index := tx.Bucket(bucketAuthUsers)
+	userScheme := []byte(uid.String() + ":" + scheme)
+	if records.Get([]byte(unique)) != nil || index.Get(userScheme) != nil {
+		return true, t.ErrDuplicate
+	}
+	err := putJSON(records, []byte(unique), &authRecord{
+		Userid:  uid.String(),
+		Scheme:  scheme,
+		AuthLvl: authLvl,
+		Secret:  secret,
+		Expires: expires})
+	if err != nil {
+		return false, err
+	}
+	return false, index.Put(userScheme, []byte(unique))
+}
+
+// Delete user's authentication record.
+func (a *adapter) AuthDelRecord(uid t.Uid, unique string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		var rec authRecord
+		found, err := getJSON(tx.Bucket(bucketAuth), []byte(unique), &rec)
+		if err != nil || !found || rec.Userid != uid.String() {
+			return err
+		}
+		if err = tx.Bucket(bucketAuth).Delete([]byte(unique)); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketAuthUsers).Delete([]byte(rec.Userid + ":" + rec.Scheme))
+	})
+}
+
+// Delete user's all authentication records
+func (a *adapter) AuthDelAllRecords(uid t.Uid) (int, error) {
+	var count int
+	err := a.db.Update(func(tx *bbolt.Tx) error {
+		index := tx.Bucket(bucketAuthUsers)
+		for _, key := range prefixKeys(index, uid.String()+":") {
+			if err := tx.Bucket(bucketAuth).Delete(index.Get(key)); err != nil {
+				return err
+			}
+			if err := index.Delete(key); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Update user's authentication secret.
+func (a *adapter) AuthUpdRecord(uid t.Uid, scheme, unique string, authLvl auth.Level,
+	secret []byte, expires time.Time) (bool, error) {
+
+	var dupe bool
+	err := a.db.Update(func(tx *bbolt.Tx) error {
+		index := tx.Bucket(bucketAuthUsers)
+		userScheme := []byte(uid.String() + ":" + scheme)
+		old := index.Get(userScheme)
+		if old == nil {
+			// If the record is not found, don't update it
+			return t.ErrNotFound
+		}
+		// The 'unique' is the key of the record. If it has changed, replace the record.
+		if err := tx.Bucket(bucketAuth).Delete(append([]byte(nil), old...)); err != nil {
+			return err
+		}
+		if err := index.Delete(userScheme); err != nil {
+			return err
+		}
+		var err error
+		dupe, err = authAddRecord(tx, uid, scheme, unique, authLvl, secret, expires)
+		return err
+	})
+	return dupe, err
+}
+
+// Retrieve user's authentication record
+func (a *adapter) AuthGetRecord(uid t.Uid, scheme string) (string, auth.Level, []byte, time.Time, error) {
+	var unique string
+	var rec authRecord
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		key := tx.Bucket(bucketAuthUsers).Get([]byte(uid.String() + ":" + scheme))
+		if key == nil {
+			return t.ErrNotFound
+		}
+		unique = string(key)
+		found, err := getJSON(tx.Bucket(bucketAuth), key, &rec)
+		if err == nil && !found {
+			err = t.ErrNotFound
+		}
+		return err
+	})
+	if err != nil {
+		return "", 0, nil, time.Time{}, err
+	}
+
+	return unique, rec.AuthLvl, rec.Secret, rec.Expires, nil
+}
+
+// Retrieve user's authentication record
+func (a *adapter) AuthGetUniqueRecord(unique string) (t.Uid, auth.Level, []byte, time.Time, error) {
+	var rec authRecord
+	var found bool
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		found, err = getJSON(tx.Bucket(bucketAuth), []byte(unique), &rec)
+		return err
+	})
+	if err != nil || !found {
+		return t.ZeroUid, 0, nil, time.Time{}, err
+	}
+
+	return t.ParseUid(rec.Userid), rec.AuthLvl, rec.Secret, rec.Expires, nil
+}
+
+// AuthFailGet returns the count of failed authentication attempts for the given key.
+func (a *adapter) AuthFailGet(key string) (int, time.Time, error) {
+	var rec authFail
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		_, err := getJSON(tx.Bucket(bucketAuthFail), []byte(key), &rec)
+		return err
+	})
+	return rec.Failures, rec.LastAt, err
+}
+
+// AuthFailAdd increments the count of failed authentication attempts for the given key.
+func (a *adapter) AuthFailAdd(key string, resetBefore time.Time) (int, error) {
+	var rec authFail
+	err := a.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketAuthFail)
+		if _, err := getJSON(b, []byte(key), &rec); err != nil {
+			return err
+		}
+		if rec.LastAt.Before(resetBefore) {
+			rec.Failures = 0
+		}
+		rec.Failures++
+		rec.LastAt = t.TimeNow()
+		return putJSON(b, []byte(key), &rec)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rec.Failures, nil
+}
+
+// AuthFailDel clears failed authentication attempts for the given key.
+func (a *adapter) AuthFailDel(key string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketAuthFail).Delete([]byte(key))
+	})
+}
+
+// UserGet fetches a single user by user id. If user is not found it returns (nil, nil)
+func (a *adapter) UserGet(uid t.Uid) (*t.User, error) {
+	var user *t.User
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		var usr t.User
+		found, err := getJSON(tx.Bucket(bucketUsers), []byte(uid.String()), &usr)
+		if found && err == nil {
+			user = &usr
+		}
+		return err
+	})
+	return user, err
+}
+
+func (a *adapter) UserGetAll(ids ...t.Uid) ([]t.User, error) {
+	users := []t.User{}
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketUsers)
+		for _, id := range ids {
+			var usr t.User
+			found, err := getJSON(b, []byte(id.String()), &usr)
+			if err != nil {
+				return err
+			}
+			if found {
+				users = append(users, usr)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (a *adapter) UserDelete(uid t.Uid, soft bool) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		users := tx.Bucket(bucketUsers)
+		key := []byte(uid.String())
+		if soft {
+			now := t.TimeNow()
+			return patchJSON(users, key, map[string]interface{}{"DeletedAt": now, "UpdatedAt": now})
+		}
+
+		var usr t.User
+		found, err := getJSON(users, key, &usr)
+		if err != nil || !found {
+			return err
+		}
+		if err = removeTags(tx.Bucket(bucketUserTags), usr.Id, usr.Tags); err != nil {
+			return err
+		}
+		for hash := range usr.Devices {
+			if err = tx.Bucket(bucketDevices).Delete([]byte(hash)); err != nil {
+				return err
+			}
+		}
+		return users.Delete(key)
+	})
+}
+
+// UserUpdate updates user object.
+func (a *adapter) UserUpdate(uid t.Uid, update map[string]interface{}) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		users := tx.Bucket(bucketUsers)
+		key := []byte(uid.String())
+		var old t.User
+		found, err := getJSON(users, key, &old)
+		if err != nil || !found {
+			return err
+		}
+		if err = patchJSON(users, key, update); err != nil {
+			return err
+		}
+		if tags, ok := extractTags(update); ok {
+			index := tx.Bucket(bucketUserTags)
+			if err = removeTags(index, old.Id, old.Tags); err != nil {
+				return err
+			}
+			return addTags(index, old.Id, tags)
+		}
+		return nil
+	})
+}
+
+// *****************************
+
+func topicCreate(tx *bbolt.Tx, topic *t.Topic) error {
+	topics := tx.Bucket(bucketTopics)
+	if topics.Get([]byte(topic.Id)) != nil {
+		return t.ErrDuplicate
+	}
+	if err := putJSON(topics, []byte(topic.Id), topic); err != nil {
+		return err
+	}
+	return addTags(tx.Bucket(bucketTopicTags), topic.Id, topic.Tags)
+}
+
+// TopicCreate creates a topic from template
+func (a *adapter) TopicCreate(topic *t.Topic) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		return topicCreate(tx, topic)
+	})
+}
+
+// createSubscription saves a subscription. If the subscription already exists and undelete is true,
+// the old subscription is undeleted and its times and ModeGiven are updated. Otherwise the old
+// subscription is replaced but values persisted through soft-deletion are kept.
+func createSubscription(tx *bbolt.Tx, sub *t.Subscription, undelete bool) error {
+	subs := tx.Bucket(bucketSubs)
+	key := []byte(sub.Topic + ":" + sub.User)
+
+	var old t.Subscription
+	found, err := getJSON(subs, key, &old)
+	if err != nil {
+		return err
+	}
+
+	if found && undelete {
+		old.DeletedAt = nil
+		old.CreatedAt = sub.CreatedAt
+		old.UpdatedAt = sub.UpdatedAt
+		old.ModeGiven = sub.ModeGiven
+		err = putJSON(subs, key, &old)
+	} else {
+		rec := *sub
+		rec.Id = string(key)
+		rec.DeletedAt = nil
+		if found {
+			rec.DelId = old.DelId
+			rec.RecvSeqId = old.RecvSeqId
+			rec.ReadSeqId = old.ReadSeqId
+		}
+		err = putJSON(subs, key, &rec)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(bucketUserSubs).Put([]byte(sub.User+":"+sub.Topic), []byte(sub.Topic))
+}
+
+// TopicCreateP2P given two users creates a p2p topic
+func (a *adapter) TopicCreateP2P(initiator, invited *t.Subscription) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		if err := createSubscription(tx, initiator, false); err != nil {
+			return err
+		}
+		if err := createSubscription(tx, invited, true); err != nil {
+			return err
+		}
+
+		topic := &t.Topic{ObjHeader: t.ObjHeader{Id: initiator.Topic}}
+		topic.ObjHeader.MergeTimes(&initiator.ObjHeader)
+		topic.TouchedAt = initiator.GetTouchedAt()
+		return topicCreate(tx, topic)
+	})
+}
+
+// TopicGet loads a single topic by name, if it exists. If the topic does not exist the call returns (nil, nil)
+func (a *adapter) TopicGet(topic string) (*t.Topic, error) {
+	var tt *t.Topic
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		var top t.Topic
+		found, err := getJSON(tx.Bucket(bucketTopics), []byte(topic), &top)
+		if found && err == nil {
+			tt = &top
+		}
+		return err
+	})
+	return tt, err
+}
+
+// subsForUser loads subscriptions of the given user, applying filters and limits.
+func subsForUser(tx *bbolt.Tx, uid t.Uid, keepDeleted bool, opts *t.QueryOpt) ([]t.Subscription, error) {
+	limit := maxResults
+	var topic string
+	if opts != nil {
+		// Ignore IfModifiedSince - we must return all entries
+		// Those unmodified will be stripped of Public & Private.
+
+		topic = opts.Topic
+		if opts.Limit > 0 && opts.Limit < limit {
+			limit = opts.Limit
+		}
+	}
+
+	subs := tx.Bucket(bucketSubs)
+	index := tx.Bucket(bucketUserSubs)
+	var result []t.Subscription
+	for _, key := range prefixKeys(index, uid.String()+":") {
+		name := string(index.Get(key))
+		if topic != "" && name != topic {
+			continue
+		}
+		var sub t.Subscription
+		found, err := getJSON(subs, []byte(name+":"+uid.String()), &sub)
+		if err != nil {
+			return nil, err
+		}
+		if !found || (!keepDeleted && sub.DeletedAt != nil) {
+			continue
+		}
+		result = append(result, sub)
+		if len(result) == limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+// subsForTopic loads subscriptions to the given topic, applying filters and limits.
+func subsForTopic(tx *bbolt.Tx, topic string, keepDeleted bool, opts *t.QueryOpt) ([]t.Subscription, error) {
+	limit := maxSubscribers
+	var user string
+	if opts != nil {
+		// Ignore IfModifiedSince - we must return all entries
+		// Those unmodified will be stripped of Public & Private.
+
+		if !opts.User.IsZero() {
+			user = opts.User.String()
+		}
+		if opts.Limit > 0 && opts.Limit < limit {
+			limit = opts.Limit
+		}
+	}
+
+	prefix := []byte(topic + ":")
+	var result []t.Subscription
+	c := tx.Bucket(bucketSubs).Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		var sub t.Subscription
+		if err := json.Unmarshal(v, &sub); err != nil {
+			return nil, err
+		}
+		if (user != "" && sub.User != user) || (!keepDeleted && sub.DeletedAt != nil) {
+			continue
+		}
+		result = append(result, sub)
+		if len(result) == limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+// TopicsForUser loads user's contact list: p2p and grp topics, except for 'me' & 'fnd' subscriptions.
+// Reads and denormalizes Public value.
+func (a *adapter) TopicsForUser(uid t.Uid, keepDeleted bool, opts *t.QueryOpt) ([]t.Subscription, error) {
+	var subs []t.Subscription
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		all, err := subsForUser(tx, uid, keepDeleted, opts)
+		if err != nil {
+			return err
+		}
+
+		topics := tx.Bucket(bucketTopics)
+		users := tx.Bucket(bucketUsers)
+		for _, sub := range all {
+			tcat := t.GetTopicCat(sub.Topic)
+
+			// 'me' or 'fnd' subscription, skip
+			if tcat == t.TopicCatMe || tcat == t.TopicCatFnd {
+				continue
+			}
+
+			var top t.Topic
+			found, err := getJSON(topics, []byte(sub.Topic), &top)
+			if err != nil {
+				return err
+			}
+			if !found {
+				continue
+			}
+			sub.ObjHeader.MergeTimes(&top.ObjHeader)
+			sub.SetSeqId(top.SeqId)
+			sub.SetTouchedAt(top.TouchedAt)
+
+			if tcat == t.TopicCatGrp {
+				// all done with a grp topic
+				sub.SetPublic(top.Public)
+				subs = append(subs, sub)
+				continue
+			}
+
+			// p2p subscription, find the other user to get user.Public
+			uid1, uid2, _ := t.ParseP2P(sub.Topic)
+			if uid1 == uid {
+				uid1 = uid2
+			}
+			var usr t.User
+			found, err = getJSON(users, []byte(uid1.String()), &usr)
+			if err != nil {
+				return err
+			}
+			if !found {
+				continue
+			}
+			sub.ObjHeader.MergeTimes(&usr.ObjHeader)
+			sub.SetPublic(usr.Public)
+			sub.SetWith(uid1.UserId())
+			sub.SetDefaultAccess(usr.Access.Auth, usr.Access.Anon)
+			sub.SetLastSeenAndUA(usr.LastSeen, usr.UserAgent)
+			subs = append(subs, sub)
+		}
+		return nil
+	})
+	return subs, err
+}
+
+// UsersForTopic loads users subscribed to the given topic
+func (a *adapter) UsersForTopic(topic string, keepDeleted bool, opts *t.QueryOpt) ([]t.Subscription, error) {
+	var subs []t.Subscription
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		all, err := subsForTopic(tx, topic, keepDeleted, opts)
+		if err != nil {
+			return err
+		}
+
+		users := tx.Bucket(bucketUsers)
+		for _, sub := range all {
+			var usr t.User
+			found, err := getJSON(users, []byte(sub.User), &usr)
+			if err != nil {
+				return err
+			}
+			if !found {
+				continue
+			}
+			sub.ObjHeader.MergeTimes(&usr.ObjHeader)
+			sub.SetPublic(usr.Public)
+			subs = append(subs, sub)
+		}
+		return nil
+	})
+	return subs, err
+}
+
+// TopicShare creates topic subscriptions. Subscriptions which were marked as deleted are undeleted.
+func (a *adapter) TopicShare(shares []*t.Subscription) (int, error) {
+	err := a.db.Update(func(tx *bbolt.Tx) error {
+		for _, sub := range shares {
+			if err := createSubscription(tx, sub, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(shares), nil
+}
+
+func (a *adapter) TopicDelete(topic string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		topics := tx.Bucket(bucketTopics)
+		var top t.Topic
+		found, err := getJSON(topics, []byte(topic), &top)
+		if err != nil || !found {
+			return err
+		}
+		if err = removeTags(tx.Bucket(bucketTopicTags), top.Id, top.Tags); err != nil {
+			return err
+		}
+		return topics.Delete([]byte(topic))
+	})
+}
+
+func (a *adapter) TopicUpdateOnMessage(topic string, msg *t.Message) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		return patchJSON(tx.Bucket(bucketTopics), []byte(topic),
+			map[string]interface{}{"SeqId": msg.SeqId, "TouchedAt": msg.CreatedAt})
+	})
+}
+
+func (a *adapter) TopicUpdate(topic string, update map[string]interface{}) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		topics := tx.Bucket(bucketTopics)
+		var old t.Topic
+		found, err := getJSON(topics, []byte(topic), &old)
+		if err != nil || !found {
+			return err
+		}
+		if err = patchJSON(topics, []byte(topic), update); err != nil {
+			return err
+		}
+		if tags, ok := extractTags(update); ok {
+			index := tx.Bucket(bucketTopicTags)
+			if err = removeTags(index, old.Id, old.Tags); err != nil {
+				return err
+			}
+			return addTags(index, old.Id, tags)
+		}
+		return nil
+	})
+}
+
+// Get a subscription of a user to a topic
+func (a *adapter) SubscriptionGet(topic string, user t.Uid) (*t.Subscription, error) {
+	var sub *t.Subscription
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		var ss t.Subscription
+		found, err := getJSON(tx.Bucket(bucketSubs), []byte(topic+":"+user.String()), &ss)
+		if found && err == nil && ss.DeletedAt == nil {
+			sub = &ss
+		}
+		return err
+	})
+	return sub, err
+}
+
+// Update time when the user was last attached to the topic
+func (a *adapter) SubsLastSeen(topic string, user t.Uid, lastSeen map[string]time.Time) error {
+	// Not used: last seen time is stored on the user object.
+	return nil
+}
+
+// SubsForUser loads a list of user's subscriptions to topics. Does NOT load Public value.
+func (a *adapter) SubsForUser(forUser t.Uid, keepDeleted bool, opts *t.QueryOpt) ([]t.Subscription, error) {
+	var subs []t.Subscription
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		subs, err = subsForUser(tx, forUser, keepDeleted, opts)
+		return err
+	})
+	return subs, err
+}
+
+// SubsForTopic fetches all subsciptions for a topic. Does NOT load Public value.
+func (a *adapter) SubsForTopic(topic string, keepDeleted bool, opts *t.QueryOpt) ([]t.Subscription, error) {
+	var subs []t.Subscription
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		subs, err = subsForTopic(tx, topic, keepDeleted, opts)
+		return err
+	})
+	return subs, err
+}
+
+// SubsUpdate updates one or all subscriptions to the given topic.
+func (a *adapter) SubsUpdate(topic string, user t.Uid, update map[string]interface{}) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		subs := tx.Bucket(bucketSubs)
+		if !user.IsZero() {
+			// Update one topic subscription
+			return patchJSON(subs, []byte(topic+":"+user.String()), update)
+		}
+		// Update all topic subscriptions
+		for _, key := range prefixKeys(subs, topic+":") {
+			if err := patchJSON(subs, key, update); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SubsDelete marks subscription as deleted.
+func (a *adapter) SubsDelete(topic string, user t.Uid) error {
+	now := t.TimeNow()
+	return a.SubsUpdate(topic, user, map[string]interface{}{"UpdatedAt": now, "DeletedAt": now})
+}
+
+// SubsDelForTopic marks all subscriptions to the given topic as deleted
+func (a *adapter) SubsDelForTopic(topic string) error {
+	now := t.TimeNow()
+	return a.SubsUpdate(topic, t.ZeroUid, map[string]interface{}{"UpdatedAt": now, "DeletedAt": now})
+}
+
+// SubsDelForUser marks all subscriptions of a given user as deleted
+func (a *adapter) SubsDelForUser(user t.Uid) error {
+	now := t.TimeNow()
+	update := map[string]interface{}{"UpdatedAt": now, "DeletedAt": now}
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		index := tx.Bucket(bucketUserSubs)
+		for _, key := range prefixKeys(index, user.String()+":") {
+			err := patchJSON(tx.Bucket(bucketSubs), []byte(string(index.Get(key))+":"+user.String()), update)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// tagMatch is an owner of tags (user or topic) found by a tag search.
+type tagMatch struct {
+	owner   string
+	matches int
+}
+
+// findByTags returns owners of tags in the index which have all of the required tags and at least
+// one tag in total, ordered by the number of matching tags from high to low.
+func findByTags(index *bbolt.Bucket, req, opt []string) []tagMatch {
+	required := make(map[string]struct{})
+	for _, tag := range req {
+		required[tag] = struct{}{}
+	}
+
+	matches := make(map[string]int)
+	reqMatches := make(map[string]int)
+	seen := make(map[string]struct{})
+	for _, tag := range append(req, opt...) {
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+		seen[tag] = struct{}{}
+
+		prefix := []byte(tag + "\x00")
+		c := index.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			owner := string(v)
+			matches[owner]++
+			if _, ok := required[tag]; ok {
+				reqMatches[owner]++
+			}
+		}
+	}
+
+	var found []tagMatch
+	for owner, count := range matches {
+		if reqMatches[owner] < len(required) {
+			continue
+		}
+		found = append(found, tagMatch{owner: owner, matches: count})
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].matches != found[j].matches {
+			return found[i].matches > found[j].matches
+		}
+		return found[i].owner < found[j].owner
+	})
+	if len(found) > maxResults {
+		found = found[:maxResults]
+	}
+	return found
+}
+
+// foundTags returns tags which were used in the search query.
+func foundTags(tags []string, req, opt []string) []string {
+	index := make(map[string]struct{})
+	for _, tag := range append(req, opt...) {
+		index[tag] = struct{}{}
+	}
+	found := make([]string, 0, 1)
+	for _, tag := range tags {
+		if _, ok := index[tag]; ok {
+			found = append(found, tag)
+		}
+	}
+	return found
+}
+
+// Returns a list of users who match given tags, such as "email:jdoe@example.com" or "tel:18003287448".
+// Every required tag must match. Results are sorted by the number of matched tags from high to low.
+func (a *adapter) FindUsers(uid t.Uid, req, opt []string) ([]t.Subscription, error) {
+	var subs []t.Subscription
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		users := tx.Bucket(bucketUsers)
+		for _, match := range findByTags(tx.Bucket(bucketUserTags), req, opt) {
+			if match.owner == uid.String() {
+				// Skip the callee
+				continue
+			}
+			var usr t.User
+			found, err := getJSON(users, []byte(match.owner), &usr)
+			if err != nil {
+				return err
+			}
+			if !found {
+				continue
+			}
+			var sub t.Subscription
+			sub.CreatedAt = usr.CreatedAt
+			sub.UpdatedAt = usr.UpdatedAt
+			sub.User = usr.Id
+			sub.SetPublic(usr.Public)
+			// TODO: maybe report default access to user
+			// sub.SetDefaultAccess(user.Access.Auth, user.Access.Anon)
+			sub.Private = foundTags(usr.Tags, req, opt)
+			subs = append(subs, sub)
+		}
+		return nil
+	})
+	return subs, err
+}
+
+// Returns a list of topics with matching tags.
+// Every required tag must match. Results are sorted by the number of matched tags from high to low.
+func (a *adapter) FindTopics(req, opt []string) ([]t.Subscription, error) {
+	var subs []t.Subscription
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		topics := tx.Bucket(bucketTopics)
+		for _, match := range findByTags(tx.Bucket(bucketTopicTags), req, opt) {
+			var top t.Topic
+			found, err := getJSON(topics, []byte(match.owner), &top)
+			if err != nil {
+				return err
+			}
+			if !found {
+				continue
+			}
+			var sub t.Subscription
+			sub.CreatedAt = top.CreatedAt
+			sub.UpdatedAt = top.UpdatedAt
+			sub.Topic = top.Id
+			sub.SetPublic(top.Public)
+			// TODO: maybe report default access to user
+			// sub.SetDefaultAccess(user.Access.Auth, user.Access.Anon)
+			sub.Private = foundTags(top.Tags, req, opt)
+			subs = append(subs, sub)
+		}
+		return nil
+	})
+	return subs, err
+}
+
+// Messages
+
+// toMessage converts a stored message into the form returned to the caller.
+func (m *message) toMessage() t.Message {
+	msg := m.Message
+	msg.Reactions = nil
+	if len(m.Reactions) > 0 {
+		msg.Reactions = make(map[string]int, len(m.Reactions))
+		for reaction, users := range m.Reactions {
+			msg.Reactions[reaction] = len(users)
+		}
+	}
+	return msg
+}
+
+// isDeletedFor checks if the message is soft-deleted for the given user.
+func (m *message) isDeletedFor(user string) bool {
+	for _, sd := range m.DeletedFor {
+		if sd.User == user {
+			return true
+		}
+	}
+	return false
+}
+
+func messageKey(topic string, seqId int) []byte {
+	return append([]byte(topic+"\x00"), seqKey(seqId)...)
+}
+
+func (a *adapter) MessageSave(msg *t.Message) error {
+	msg.SetUid(store.GetUid())
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.Bucket(bucketMessages).CreateBucketIfNotExists([]byte(msg.Topic))
+		if err != nil {
+			return err
+		}
+		key := seqKey(msg.SeqId)
+		if b.Get(key) != nil {
+			return t.ErrDuplicate
+		}
+		if err = putJSON(b, key, &message{Message: *msg}); err != nil {
+			return err
+		}
+		if err = tx.Bucket(bucketMessageIds).Put([]byte(msg.Id), messageKey(msg.Topic, msg.SeqId)); err != nil {
+			return err
+		}
+
+		if msg.ReplyTo > 0 {
+			// Update the counter of replies on the root message of the thread.
+			var root message
+			found, err := getJSON(b, seqKey(msg.ReplyTo), &root)
+			if err != nil || !found {
+				return err
+			}
+			root.ReplyCount++
+			lastReplyAt := msg.CreatedAt
+			root.LastReplyAt = &lastReplyAt
+			return putJSON(b, seqKey(msg.ReplyTo), &root)
+		}
+		return nil
+	})
+}
+
+func (a *adapter) MessageGetAll(topic string, forUser t.Uid, opts *t.QueryOpt) ([]t.Message, error) {
+	var limit = maxResults
+	var lower = 0
+	var upper = 0
+	var thread = 0
+
+	if opts != nil {
+		if opts.Since > 0 {
+			lower = opts.Since
+		}
+		if opts.Before > 0 {
+			upper = opts.Before
+		}
+		if opts.Limit > 0 && opts.Limit < limit {
+			limit = opts.Limit
+		}
+		thread = opts.Thread
+	}
+
+	var msgs []t.Message
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketMessages).Bucket([]byte(topic))
+		if b == nil {
+			return nil
+		}
+
+		// Iterate from the newest to the oldest message.
+		c := b.Cursor()
+		var k, v []byte
+		if upper > 0 {
+			if k, v = c.Seek(seqKey(upper)); k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		} else {
+			k, v = c.Last()
+		}
+
+		user := forUser.String()
+		for ; k != nil && keySeq(k) >= lower && len(msgs) < limit; k, v = c.Prev() {
+			var msg message
+			if err := json.Unmarshal(v, &msg); err != nil {
+				return err
+			}
+			if msg.DelId > 0 || msg.isDeletedFor(user) {
+				continue
+			}
+			if thread > 0 && msg.ReplyTo != thread {
+				continue
+			}
+			msgs = append(msgs, msg.toMessage())
+		}
+
+		roots := make(map[int]*t.Message)
+		for i := range msgs {
+			if msgs[i].ReplyCount > 0 {
+				roots[msgs[i].SeqId] = &msgs[i]
+			}
+		}
+		return countReplies(b, user, roots)
+	})
+	return msgs, err
+}
+
+// countReplies recomputes thread statistics of the root messages counting the replies which are not
+// hard-deleted and, if the user is given, not soft-deleted for the user.
+func countReplies(b *bbolt.Bucket, user string, roots map[int]*t.Message) error {
+	if len(roots) == 0 {
+		return nil
+	}
+	first := 0
+	for seq, root := range roots {
+		root.ReplyCount = 0
+		root.LastReplyAt = nil
+		if first == 0 || seq < first {
+			first = seq
+		}
+	}
+
+	// Replies always follow the root message.
+	c := b.Cursor()
+	for k, v := c.Seek(seqKey(first + 1)); k != nil; k, v = c.Next() {
+		var msg message
+		if err := json.Unmarshal(v, &msg); err != nil {
+			return err
+		}
+		root := roots[msg.ReplyTo]
+		if root == nil || msg.DelId > 0 || (user != "" && msg.isDeletedFor(user)) {
+			continue
+		}
+		root.ReplyCount++
+		if root.LastReplyAt == nil || msg.CreatedAt.After(*root.LastReplyAt) {
+			lastReplyAt := msg.CreatedAt
+			root.LastReplyAt = &lastReplyAt
+		}
+	}
+	return nil
+}
+
+// updateMessage loads a live (not hard-deleted) message, passes it to the callback for changes and
+// saves it back.
+func updateMessage(tx *bbolt.Tx, topic string, seqId int, change func(msg *message) error) error {
+	b := tx.Bucket(bucketMessages).Bucket([]byte(topic))
+	if b == nil {
+		return t.ErrNotFound
+	}
+	var msg message
+	found, err := getJSON(b, seqKey(seqId), &msg)
+	if err != nil {
+		return err
+	}
+	if !found || msg.DelId > 0 {
+		return t.ErrNotFound
+	}
+	if err = change(&msg); err != nil {
+		return err
+	}
+	return putJSON(b, seqKey(seqId), &msg)
+}
+
+// MessageEdit replaces Head and Content of a message. The previous version is kept as a revision.
+func (a *adapter) MessageEdit(msg *t.Message) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		return updateMessage(tx, msg.Topic, msg.SeqId, func(old *message) error {
+			old.Revisions = append(old.Revisions, revision{
+				CreatedAt: old.UpdatedAt,
+				Head:      old.Head,
+				Content:   old.Content})
+			old.UpdatedAt = msg.UpdatedAt
+			old.Head = msg.Head
+			old.Content = msg.Content
+			msg.Id = old.Id
+			return nil
+		})
+	})
+}
+
+// MessageReactionAdd records a reaction of the user to the message.
+func (a *adapter) MessageReactionAdd(topic string, seqId int, user t.Uid, reaction string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		return updateMessage(tx, topic, seqId, func(msg *message) error {
+			for _, uid := range msg.Reactions[reaction] {
+				if uid == user.String() {
+					return t.ErrDuplicate
+				}
+			}
+			if msg.Reactions == nil {
+				msg.Reactions = make(map[string][]string)
+			}
+			msg.Reactions[reaction] = append(msg.Reactions[reaction], user.String())
+			return nil
+		})
+	})
+}
+
+// MessageReactionDelete removes a reaction of the user from the message.
+func (a *adapter) MessageReactionDelete(topic string, seqId int, user t.Uid, reaction string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		return updateMessage(tx, topic, seqId, func(msg *message) error {
+			users := msg.Reactions[reaction]
+			for i, uid := range users {
+				if uid == user.String() {
+					users = append(users[:i], users[i+1:]...)
+					if len(users) == 0 {
+						delete(msg.Reactions, reaction)
+					} else {
+						msg.Reactions[reaction] = users
+					}
+					return nil
+				}
+			}
+			return t.ErrNotFound
+		})
+	})
+}
+
+// Get ranges of deleted messages
+func (a *adapter) MessageGetDeleted(topic string, forUser t.Uid, opts *t.QueryOpt) ([]t.DelMessage, error) {
+	var limit = maxResults
+	var lower = 0
+	var upper = 0
+
+	if opts != nil {
+		if opts.Since > 0 {
+			lower = opts.Since
+		}
+		if opts.Before > 0 {
+			upper = opts.Before
+		}
+		if opts.Limit > 0 && opts.Limit < limit {
+			limit = opts.Limit
+		}
+	}
+
+	var dmsgs []t.DelMessage
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketDellog).Bucket([]byte(topic))
+		if b == nil {
+			return nil
+		}
+
+		user := forUser.String()
+		c := b.Cursor()
+		for k, v := c.Seek(seqKey(lower)); k != nil && len(dmsgs) < limit; k, v = c.Next() {
+			if upper > 0 && keySeq(k) >= upper {
+				break
+			}
+			var dmsg t.DelMessage
+			if err := json.Unmarshal(v, &dmsg); err != nil {
+				return err
+			}
+			if dmsg.DeletedFor != "" && dmsg.DeletedFor != user {
+				continue
+			}
+			for i := range dmsg.SeqIdRanges {
+				if dmsg.SeqIdRanges[i].Hi <= dmsg.SeqIdRanges[i].Low+1 {
+					dmsg.SeqIdRanges[i].Hi = 0
+				}
+			}
+			dmsgs = append(dmsgs, dmsg)
+		}
+		return nil
+	})
+	return dmsgs, err
+}
+
+// releaseFiles decrements use counters of the files attached to a hard-deleted message.
+func releaseFiles(tx *bbolt.Tx, fids []string) error {
+	files := tx.Bucket(bucketFiles)
+	now := t.TimeNow()
+	for _, fid := range fids {
+		var fr fileRecord
+		found, err := getJSON(files, []byte(fid), &fr)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+		if fr.UseCount > 0 {
+			fr.UseCount--
+		}
+		fr.UpdatedAt = now
+		if err = putJSON(files, []byte(fid), &fr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MessageDeleteList deletes messages in the given topic with seqIds from the list
+func (a *adapter) MessageDeleteList(topic string, toDel *t.DelMessage) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		messages := tx.Bucket(bucketMessages)
+
+		if toDel == nil {
+			// Delete all messages of the topic together with the deletion log.
+			if b := messages.Bucket([]byte(topic)); b != nil {
+				c := b.Cursor()
+				for k, v := c.First(); k != nil; k, v = c.Next() {
+					var msg message
+					if err := json.Unmarshal(v, &msg); err != nil {
+						return err
+					}
+					if err := tx.Bucket(bucketMessageIds).Delete([]byte(msg.Id)); err != nil {
+						return err
+					}
+					if err := releaseFiles(tx, msg.Attachments); err != nil {
+						return err
+					}
+				}
+				if err := messages.DeleteBucket([]byte(topic)); err != nil {
+					return err
+				}
+			}
+			err := tx.Bucket(bucketDellog).DeleteBucket([]byte(topic))
+			if err == bbolt.ErrBucketNotFound {
+				err = nil
+			}
+			return err
+		}
+
+		// Record the deletion in the log.
+		dellog, err := tx.Bucket(bucketDellog).CreateBucketIfNotExists([]byte(topic))
+		if err != nil {
+			return err
+		}
+		serial, err := dellog.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err = putJSON(dellog, append(seqKey(toDel.DelId), seqKey(int(serial))...), toDel); err != nil {
+			return err
+		}
+
+		b := messages.Bucket([]byte(topic))
+		if b == nil {
+			return nil
+		}
+
+		// Collect affected keys first: the bucket must not be modified while the cursor is in use.
+		var keys [][]byte
+		c := b.Cursor()
+		for _, rng := range toDel.SeqIdRanges {
+			hi := rng.Hi
+			if hi == 0 {
+				// Hi is exclusive, 0 means a single message.
+				hi = rng.Low + 1
+			}
+			for k, _ := c.Seek(seqKey(rng.Low)); k != nil && keySeq(k) < hi; k, _ = c.Next() {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+		}
+
+		now := t.TimeNow()
+		// Threads which lose replies.
+		var roots []int
+		for _, key := range keys {
+			var msg message
+			if _, err = getJSON(b, key, &msg); err != nil {
+				return err
+			}
+			if msg.DelId > 0 {
+				// Already hard-deleted.
+				continue
+			}
+			if toDel.DeletedFor == "" {
+				// Hard-delete: keep the message record but clear the content.
+				if err = releaseFiles(tx, msg.Attachments); err != nil {
+					return err
+				}
+				msg.DeletedAt = &now
+				msg.DelId = toDel.DelId
+				msg.DeletedFor = nil
+				msg.Head = nil
+				msg.Content = nil
+				msg.Reactions = nil
+				msg.Revisions = nil
+				msg.Words = nil
+				msg.Attachments = nil
+				if msg.ReplyTo > 0 {
+					roots = append(roots, msg.ReplyTo)
+				}
+			} else if !msg.isDeletedFor(toDel.DeletedFor) {
+				// Soft-delete: mark the message as deleted for the user.
+				msg.DeletedFor = append(msg.DeletedFor, t.SoftDelete{User: toDel.DeletedFor, DelId: toDel.DelId})
+			} else {
+				continue
+			}
+			if err = putJSON(b, key, &msg); err != nil {
+				return err
+			}
+		}
+		return recountReplies(b, roots)
+	})
+}
+
+// recountReplies recomputes and saves thread statistics of the root messages.
+func recountReplies(b *bbolt.Bucket, roots []int) error {
+	msgs := make(map[int]*message)
+	stats := make(map[int]*t.Message)
+	for _, seq := range roots {
+		if msgs[seq] != nil {
+			continue
+		}
+		var root message
+		found, err := getJSON(b, seqKey(seq), &root)
+		if err != nil {
+			return err
+		}
+		if found {
+			msgs[seq] = &root
+			stats[seq] = &root.Message
+		}
+	}
+	if err := countReplies(b, "", stats); err != nil {
+		return err
+	}
+	for seq, root := range msgs {
+		if err := putJSON(b, seqKey(seq), root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MessageAttachments connects given message to a list of file record IDs.
+func (a *adapter) MessageAttachments(msgId t.Uid, fids []string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		ref := tx.Bucket(bucketMessageIds).Get([]byte(msgId.String()))
+		if ref == nil || len(ref) < 9 {
+			return t.ErrNotFound
+		}
+		topic := string(ref[:len(ref)-9])
+		seqId := keySeq(ref[len(ref)-8:])
+
+		now := t.TimeNow()
+		err := updateMessage(tx, topic, seqId, func(msg *message) error {
+			msg.Attachments = append(msg.Attachments, fids...)
+			msg.UpdatedAt = now
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		files := tx.Bucket(bucketFiles)
+		for _, fid := range fids {
+			var fr fileRecord
+			found, err := getJSON(files, []byte(fid), &fr)
+			if err != nil {
+				return err
+			}
+			if !found {
+				continue
+			}
+			fr.UseCount++
+			fr.UpdatedAt = now
+			if err = putJSON(files, []byte(fid), &fr); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MessageIndex saves normalized words of the message for full-text search.
+func (a *adapter) MessageIndex(topic string, seqId int, words []string) error {
+	err := a.db.Update(func(tx *bbolt.Tx) error {
+		return updateMessage(tx, topic, seqId, func(msg *message) error {
+			msg.Words = words
+			return nil
+		})
+	})
+	if err == t.ErrNotFound {
+		// The message was deleted before it was indexed.
+		err = nil
+	}
+	return err
+}
+
+// hasWords checks if the message has all the given words.
+func (m *message) hasWords(words []string) bool {
+	for _, word := range words {
+		found := false
+		for _, w := range m.Words {
+			if w == word {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// MessageSearch finds messages in the given topics which contain all of the words.
+// Messages are scanned sequentially, newest first.
+func (a *adapter) MessageSearch(topics []string, forUser t.Uid, words []string,
+	opts *t.QueryOpt) ([]t.Message, error) {
+
+	if len(topics) == 0 || len(words) == 0 {
+		return nil, nil
+	}
+
+	var limit = maxResults
+	var lower = 0
+	var upper = 0
+
+	if opts != nil {
+		if opts.Since > 0 {
+			lower = opts.Since
+		}
+		if opts.Before > 0 {
+			upper = opts.Before
+		}
+		if opts.Limit > 0 && opts.Limit < limit {
+			limit = opts.Limit
+		}
+	}
+
+	var msgs []t.Message
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		user := forUser.String()
+		for _, topic := range topics {
+			b := tx.Bucket(bucketMessages).Bucket([]byte(topic))
+			if b == nil {
+				continue
+			}
+			// Each topic contributes at most 'limit' of its newest matching messages.
+			count := 0
+			c := b.Cursor()
+			for k, v := c.Last(); k != nil && keySeq(k) >= lower && count < limit; k, v = c.Prev() {
+				if upper > 0 && keySeq(k) >= upper {
+					continue
+				}
+				var msg message
+				if err := json.Unmarshal(v, &msg); err != nil {
+					return err
+				}
+				if msg.DelId > 0 || msg.isDeletedFor(user) || !msg.hasWords(words) {
+					continue
+				}
+				msgs = append(msgs, msg.toMessage())
+				count++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].CreatedAt.After(msgs[j].CreatedAt)
+	})
+	if len(msgs) > limit {
+		msgs = msgs[:limit]
+	}
+
+	return msgs, nil
+}
+
+func deviceHasher(deviceID string) string {
+	// Generate custom key as [64-bit hash of device id] to ensure predictable
+	// length of the key
+	hasher := fnv.New64()
+	hasher.Write([]byte(deviceID))
+	return strconv.FormatUint(uint64(hasher.Sum64()), 16)
+}
+
+// deviceRemove removes the device from the user record and from the index.
+func deviceRemove(tx *bbolt.Tx, user, hash string) error {
+	users := tx.Bucket(bucketUsers)
+	var usr t.User
+	found, err := getJSON(users, []byte(user), &usr)
+	if err != nil {
+		return err
+	}
+	if found {
+		if _, ok := usr.Devices[hash]; ok {
+			delete(usr.Devices, hash)
+			if err = putJSON(users, []byte(user), &usr); err != nil {
+				return err
+			}
+		}
+	}
+
+	devices := tx.Bucket(bucketDevices)
+	if string(devices.Get([]byte(hash))) == user {
+		return devices.Delete([]byte(hash))
+	}
+	return nil
+}
+
+// Device management for push notifications
+func (a *adapter) DeviceUpsert(uid t.Uid, def *t.DeviceDef) error {
+	hash := deviceHasher(def.DeviceId)
+	user := uid.String()
+
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		devices := tx.Bucket(bucketDevices)
+		// The device may be registered to another user, i.e. when one user logs out and another logs in
+		// on the same device.
+		if owner := string(devices.Get([]byte(hash))); owner != "" && owner != user {
+			if err := deviceRemove(tx, owner, hash); err != nil {
+				return err
+			}
+		}
+
+		users := tx.Bucket(bucketUsers)
+		var usr t.User
+		found, err := getJSON(users, []byte(user), &usr)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return t.ErrNotFound
+		}
+		if usr.Devices == nil {
+			usr.Devices = make(map[string]*t.DeviceDef)
+		}
+		usr.Devices[hash] = def
+		if err = putJSON(users, []byte(user), &usr); err != nil {
+			return err
+		}
+		return devices.Put([]byte(hash), []byte(user))
+	})
+}
+
+func (a *adapter) DeviceGetAll(uids ...t.Uid) (map[t.Uid][]t.DeviceDef, int, error) {
+	result := make(map[t.Uid][]t.DeviceDef)
+	count := 0
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		users := tx.Bucket(bucketUsers)
+		for _, uid := range uids {
+			var usr t.User
+			found, err := getJSON(users, []byte(uid.String()), &usr)
+			if err != nil {
+				return err
+			}
+			if !found || len(usr.Devices) == 0 {
+				continue
+			}
+			udev := make([]t.DeviceDef, 0, len(usr.Devices))
+			for _, def := range usr.Devices {
+				udev = append(udev, *def)
+			}
+			result[uid] = udev
+			count += len(udev)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return result, count, nil
+}
+
+func (a *adapter) DeviceDelete(uid t.Uid, deviceID string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		return deviceRemove(tx, uid.String(), deviceHasher(deviceID))
+	})
+}
+
+// Credential management
+
+// credsForUser returns keys of the user's credentials in the index, optionally limited to one method.
+func credsForUser(tx *bbolt.Tx, uid t.Uid, method string) [][]byte {
+	prefix := uid.String() + ":"
+	if method != "" {
+		prefix += method + ":"
+	}
+	return prefixKeys(tx.Bucket(bucketUserCreds), prefix)
+}
+
+// CredAdd adds a credential record. Unconfirmed credentials are keyed by user, so one user cannot
+// block another from validating the same value.
+func (a *adapter) CredAdd(cred *t.Credential) error {
+	// Enforce uniqueness: if credential is confirmed, "method:value" must be unique.
+	// if credential is not yet confirmed, "userid:method:value" is unique.
+	key := cred.Method + ":" + cred.Value
+	if !cred.Done {
+		key = cred.User + ":" + key
+	}
+	cred.Id = key
+
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		creds := tx.Bucket(bucketCreds)
+		if creds.Get([]byte(key)) != nil {
+			return t.ErrDuplicate
+		}
+		if err := putJSON(creds, []byte(key), cred); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketUserCreds).Put([]byte(cred.User+":"+cred.Method+":"+cred.Value), []byte(key))
+	})
+}
+
+// CredGetOwner returns ID of the user who has confirmed the credential. Confirmed credentials
+// are keyed by "method:value".
+func (a *adapter) CredGetOwner(method, value string) (t.Uid, error) {
+	var cred t.Credential
+	var found bool
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		found, err = getJSON(tx.Bucket(bucketCreds), []byte(method+":"+value), &cred)
+		return err
+	})
+	if err != nil || !found || !cred.Done {
+		return t.ZeroUid, err
+	}
+	return t.ParseUid(cred.User), nil
+}
+
+// CredIsConfirmed returns true if the user has at least one confirmed credential of the given method.
+func (a *adapter) CredIsConfirmed(uid t.Uid, method string) (bool, error) {
+	creds, err := a.CredGet(uid, method)
+	if err != nil {
+		return false, err
+	}
+	for _, cred := range creds {
+		if cred.Done {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CredDel deletes credentials for the given method and value. If value is empty, deletes all credentials
+// of the method. If method is empty, deletes all user's credentials.
+func (a *adapter) CredDel(uid t.Uid, method, value string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		index := tx.Bucket(bucketUserCreds)
+		for _, key := range credsForUser(tx, uid, method) {
+			if method != "" && value != "" && string(key) != uid.String()+":"+method+":"+value {
+				continue
+			}
+			if err := tx.Bucket(bucketCreds).Delete(index.Get(key)); err != nil {
+				return err
+			}
+			if err := index.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CredConfirm marks given credentials as validated.
+func (a *adapter) CredConfirm(uid t.Uid, method string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		keys := credsForUser(tx, uid, method)
+		if len(keys) == 0 {
+			return t.ErrNotFound
+		}
+
+		creds := tx.Bucket(bucketCreds)
+		index := tx.Bucket(bucketUserCreds)
+		now := t.TimeNow()
+		for _, key := range keys {
+			oldKey := append([]byte(nil), index.Get(key)...)
+			var cred t.Credential
+			found, err := getJSON(creds, oldKey, &cred)
+			if err != nil {
+				return err
+			}
+			if !found || cred.Done {
+				continue
+			}
+
+			// Confirmed credentials are keyed by method:value only.
+			newKey := []byte(cred.Method + ":" + cred.Value)
+			if creds.Get(newKey) != nil {
+				return t.ErrDuplicate
+			}
+			cred.Id = string(newKey)
+			cred.Done = true
+			cred.UpdatedAt = now
+			if err = creds.Delete(oldKey); err != nil {
+				return err
+			}
+			if err = putJSON(creds, newKey, &cred); err != nil {
+				return err
+			}
+			if err = index.Put(key, newKey); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CredFail increments count of failed validation attepmts for the given credentials.
+func (a *adapter) CredFail(uid t.Uid, method string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		creds := tx.Bucket(bucketCreds)
+		index := tx.Bucket(bucketUserCreds)
+		now := t.TimeNow()
+		for _, key := range credsForUser(tx, uid, method) {
+			credKey := append([]byte(nil), index.Get(key)...)
+			var cred t.Credential
+			found, err := getJSON(creds, credKey, &cred)
+			if err != nil {
+				return err
+			}
+			if !found || cred.Done {
+				continue
+			}
+			cred.Retries++
+			cred.UpdatedAt = now
+			if err = putJSON(creds, credKey, &cred); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CredGet returns credential records for the given user and method. If method is empty,
+// returns all user's credentials.
+func (a *adapter) CredGet(uid t.Uid, method string) ([]*t.Credential, error) {
+	var result []*t.Credential
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		creds := tx.Bucket(bucketCreds)
+		index := tx.Bucket(bucketUserCreds)
+		for _, key := range credsForUser(tx, uid, method) {
+			var cred t.Credential
+			found, err := getJSON(creds, index.Get(key), &cred)
+			if err != nil {
+				return err
+			}
+			if found {
+				result = append(result, &cred)
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// FileUploads
+
+// FileStartUpload initializes a file upload
+func (a *adapter) FileStartUpload(fd *t.FileDef) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		return putJSON(tx.Bucket(bucketFiles), []byte(fd.Id), &fileRecord{FileDef: *fd})
+	})
+}
+
+// FileFinishUpload marks file upload as completed, successfully or otherwise
+func (a *adapter) FileFinishUpload(fid string, status int, size int64) (*t.FileDef, error) {
+	if t.ParseUid(fid).IsZero() {
+		return nil, t.ErrMalformed
+	}
+
+	var fd *t.FileDef
+	err := a.db.Update(func(tx *bbolt.Tx) error {
+		files := tx.Bucket(bucketFiles)
+		var fr fileRecord
+		found, err := getJSON(files, []byte(fid), &fr)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return t.ErrNotFound
+		}
+		fr.UpdatedAt = t.TimeNow()
+		fr.Status = status
+		fr.Size = size
+		if err = putJSON(files, []byte(fid), &fr); err != nil {
+			return err
+		}
+		fd = &fr.FileDef
+		return nil
+	})
+	return fd, err
+}
+
+// FileGet fetches a record of a specific file
+func (a *adapter) FileGet(fid string) (*t.FileDef, error) {
+	if t.ParseUid(fid).IsZero() {
+		return nil, t.ErrMalformed
+	}
+
+	var fd *t.FileDef
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		var fr fileRecord
+		found, err := getJSON(tx.Bucket(bucketFiles), []byte(fid), &fr)
+		if found && err == nil {
+			fd = &fr.FileDef
+		}
+		return err
+	})
+	return fd, err
+}
+
+// FileDeleteUnused deletes records where UseCount is zero. If olderThan is non-zero, deletes
+// unused records with UpdatedAt before olderThan.
+// Returns array of FileDef.Location of deleted filerecords so actual files can be deleted too.
+func (a *adapter) FileDeleteUnused(olderThan time.Time, limit int) ([]string, error) {
+	var locations []string
+	err := a.db.Update(func(tx *bbolt.Tx) error {
+		files := tx.Bucket(bucketFiles)
+		var keys [][]byte
+		c := files.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var fr fileRecord
+			if err := json.Unmarshal(v, &fr); err != nil {
+				return err
+			}
+			if fr.UseCount > 0 || (!olderThan.IsZero() && !fr.UpdatedAt.Before(olderThan)) {
+				continue
+			}
+			keys = append(keys, append([]byte(nil), k...))
+			locations = append(locations, fr.Location)
+			if limit > 0 && len(keys) == limit {
+				break
+			}
+		}
+		for _, key := range keys {
+			if err := files.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
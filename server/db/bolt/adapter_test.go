@@ -0,0 +1,31 @@
+package bolt
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nanfengpo/chat/server/db/adaptertest"
+)
+
+func TestConformance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bolt-adapter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config, _ := json.Marshal(&configType{File: filepath.Join(dir, "test.db")})
+	adp := &adapter{}
+	if err = adp.Open(string(config)); err != nil {
+		t.Fatal(err)
+	}
+	defer adp.Close()
+	if err = adp.CreateDb(true); err != nil {
+		t.Fatal(err)
+	}
+
+	adaptertest.Run(t, adp)
+}
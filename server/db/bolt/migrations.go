@@ -0,0 +1,40 @@
+package bolt
+
+import (
+	"strconv"
+
+	"github.com/nanfengpo/chat/server/db/migrate"
+	bbolt "go.etcd.io/bbolt"
+)
+
+// Steps of the schema upgrade starting with version 109 which introduced the adapter. A new step must
+// be added every time dbVersion is changed.
+func (a *adapter) migrations() []migrate.Step {
+	return []migrate.Step{
+		{Version: 110, Desc: "add bucket of failed authentication attempts", Apply: func() error {
+			return a.db.Update(func(tx *bbolt.Tx) error {
+				_, err := tx.CreateBucketIfNotExists(bucketAuthFail)
+				return err
+			})
+		}},
+	}
+}
+
+// UpgradeDb upgrades the database to dbVersion one step at a time. The version is saved after
+// every step.
+func (a *adapter) UpgradeDb(dryRun bool) ([]string, error) {
+	version, err := a.getDbVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.Run(a.migrations(), version, dbVersion, func(vers int) error {
+		if err := a.db.Update(func(tx *bbolt.Tx) error {
+			return tx.Bucket(bucketMeta).Put([]byte("version"), []byte(strconv.Itoa(vers)))
+		}); err != nil {
+			return err
+		}
+		a.version = vers
+		return nil
+	}, dryRun)
+}
@@ -0,0 +1,13 @@
+// +build bolt
+
+package bolt
+
+import (
+	"github.com/nanfengpo/chat/server/store"
+)
+
+// The adapter is registered with the store only when built with the tag 'bolt'. The rest of the
+// package has no build tags so that the conformance test runs by default.
+func init() {
+	store.RegisterAdapter(adapterName, &adapter{})
+}
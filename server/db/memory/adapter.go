@@ -0,0 +1,1715 @@
+// Package memory implements the storage adapter which keeps all data in memory. Nothing is persisted:
+// the data is lost when the adapter is closed. The adapter is the reference implementation of
+// adapter.Adapter: it's used to verify the conformance test suite in server/db/adaptertest and to
+// run the server without a database, e.g. for development. Build with the tag 'memory' to register
+// the adapter with the store.
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nanfengpo/chat/server/auth"
+	db "github.com/nanfengpo/chat/server/db"
+	"github.com/nanfengpo/chat/server/store"
+	t "github.com/nanfengpo/chat/server/store/types"
+)
+
+// adapter holds the data.
+type adapter struct {
+	sync.RWMutex
+
+	open bool
+
+	// uid -> user. Devices are stored inside the user record.
+	users map[string]*t.User
+	// unique -> authentication record
+	auth map[string]*authRecord
+	// "login:" + login or "ip:" + address -> failed authentication attempts
+	authFail map[string]*authFail
+	// name -> topic
+	topics map[string]*t.Topic
+	// topic + ":" + uid -> subscription
+	subs map[string]*t.Subscription
+	// topic -> seqId -> message
+	messages map[string]map[int]*message
+	// topic -> log of deletions in order of DelId
+	dellog map[string][]t.DelMessage
+	// [uid + ":"] + method + ":" + value -> credential. Unconfirmed credentials are prefixed with the uid.
+	creds map[string]*t.Credential
+	// file id -> record of the file
+	files map[string]*fileRecord
+}
+
+const (
+	adapterName = "memory"
+)
+
+const (
+	// Maximum number of records to return.
+	maxResults = 1024
+	// Maximum number of topic subscribers to return
+	maxSubscribers = 256
+)
+
+// Authentication record.
+type authRecord struct {
+	userid  string
+	scheme  string
+	authLvl auth.Level
+	secret  []byte
+	expires time.Time
+}
+
+// Count of failed authentication attempts.
+type authFail struct {
+	failures int
+	lastAt   time.Time
+}
+
+// Stored message with the data which is not returned to the caller as is.
+type message struct {
+	t.Message
+	// Users who reacted to the message: reaction -> list of user IDs.
+	reactions map[string][]string
+	// Earlier versions of the message, oldest first.
+	revisions []revision
+	// Normalized words for full-text search.
+	words []string
+	// IDs of the files attached to the message.
+	attachments []string
+}
+
+// Earlier version of an edited message.
+type revision struct {
+	createdAt time.Time
+	head      t.MessageHeaders
+	content   interface{}
+}
+
+// Record of an uploaded file with a count of messages which use it.
+type fileRecord struct {
+	t.FileDef
+	useCount int
+}
+
+// New creates an instance of the adapter. Tests of other packages use it to register the adapter
+// with the store without the build tag.
+func New() db.Adapter {
+	return &adapter{}
+}
+
+// OpenTestStore registers the adapter with the store unless another adapter is already registered
+// and opens an empty database. Tests of other packages use it to get a working store. The caller
+// must call store.Close when done.
+func OpenTestStore() error {
+	if store.GetAdapterName() == "" {
+		store.RegisterAdapter(adapterName, New())
+	}
+	return store.InitDb(`{"uid_key":"la6YsO+bNX/+XIkOqc5Svw=="}`, true)
+}
+
+// Open initializes an empty database. The config is ignored.
+func (a *adapter) Open(jsonconfig string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.open {
+		return errors.New("memory adapter is already open")
+	}
+
+	a.reset()
+	a.open = true
+
+	return nil
+}
+
+// reset clears all data.
+func (a *adapter) reset() {
+	a.users = make(map[string]*t.User)
+	a.auth = make(map[string]*authRecord)
+	a.authFail = make(map[string]*authFail)
+	a.topics = make(map[string]*t.Topic)
+	a.subs = make(map[string]*t.Subscription)
+	a.messages = make(map[string]map[int]*message)
+	a.dellog = make(map[string][]t.DelMessage)
+	a.creds = make(map[string]*t.Credential)
+	a.files = make(map[string]*fileRecord)
+}
+
+// Close drops all data.
+func (a *adapter) Close() error {
+	a.Lock()
+	defer a.Unlock()
+
+	a.open = false
+	a.reset()
+
+	return nil
+}
+
+// IsOpen returns true if the adapter is open, false otherwise.
+func (a *adapter) IsOpen() bool {
+	a.RLock()
+	defer a.RUnlock()
+
+	return a.open
+}
+
+// CheckDbVersion checks whether the database is initialized. The in-memory database has no schema.
+func (a *adapter) CheckDbVersion() error {
+	if !a.IsOpen() {
+		return errors.New("Database not initialized")
+	}
+	return nil
+}
+
+// GetName returns string that adapter uses to register itself with store.
+func (a *adapter) GetName() string {
+	return adapterName
+}
+
+// CreateDb wipes all data. The database always exists while the adapter is open.
+func (a *adapter) CreateDb(reset bool) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if !a.open {
+		return errors.New("memory adapter is not open")
+	}
+	a.reset()
+
+	return nil
+}
+
+// UpgradeDb does nothing: the data is never older than the adapter.
+func (a *adapter) UpgradeDb(dryRun bool) ([]string, error) {
+	if !a.IsOpen() {
+		return nil, errors.New("memory adapter is not open")
+	}
+	return nil, nil
+}
+
+// applyUpdate replaces fields of obj with the values from the update. The keys of the update
+// are the names of the fields. Values are converted to the types of the fields through JSON.
+func applyUpdate(obj interface{}, update map[string]interface{}) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	var doc map[string]json.RawMessage
+	if err = json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	for field, val := range update {
+		raw, err := json.Marshal(val)
+		if err != nil {
+			return err
+		}
+		doc[field] = raw
+	}
+	if data, err = json.Marshal(doc); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, obj)
+}
+
+// extractTags finds tags in the update. Returns false if tags are not being updated.
+func extractTags(update map[string]interface{}) ([]string, bool) {
+	val, ok := update["Tags"]
+	if !ok {
+		return nil, false
+	}
+	switch tags := val.(type) {
+	case t.StringSlice:
+		return []string(tags), true
+	case []string:
+		return tags, true
+	}
+	return nil, true
+}
+
+// copyUser returns a copy of the user record which can be changed by the caller.
+func copyUser(user *t.User) t.User {
+	usr := *user
+	usr.Tags = append(t.StringSlice(nil), user.Tags...)
+	usr.Devices = nil
+	if len(user.Devices) > 0 {
+		usr.Devices = make(map[string]*t.DeviceDef, len(user.Devices))
+		for hash, def := range user.Devices {
+			dev := *def
+			usr.Devices[hash] = &dev
+		}
+	}
+	return usr
+}
+
+// copyTopic returns a copy of the topic record which can be changed by the caller.
+func copyTopic(topic *t.Topic) t.Topic {
+	top := *topic
+	top.Tags = append(t.StringSlice(nil), topic.Tags...)
+	return top
+}
+
+// UserCreate creates a new user. Returns error and true if error is due to duplicate user name
+func (a *adapter) UserCreate(user *t.User) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if _, ok := a.users[user.Id]; ok {
+		return t.ErrDuplicate
+	}
+	usr := copyUser(user)
+	a.users[user.Id] = &usr
+
+	return nil
+}
+
+// Add user's authentication record
+func (a *adapter) AuthAddRecord(uid t.Uid, scheme, unique string, authLvl auth.Level,
+	secret []byte, expires time.Time) (bool, error) {
+
+	a.Lock()
+	defer a.Unlock()
+
+	return a.authAddRecord(uid, scheme, unique, authLvl, secret, expires)
+}
+
+func (a *adapter) authAddRecord(uid t.Uid, scheme, unique string, authLvl auth.Level,
+	secret []byte, expires time.Time) (bool, error) {
+
+	if _, ok := a.auth[unique]; ok {
+		return true, t.ErrDuplicate
+	}
+	if a.authFind(uid, scheme) != "" {
+		return true, t.ErrDuplicate
+	}
+	a.auth[unique] = &authRecord{
+		userid:  uid.String(),
+		scheme:  scheme,
+		authLvl: authLvl,
+		secret:  append([]byte(nil), secret...),
+		expires: expires}
+
+	return false, nil
+}
+
+// authFind returns the unique of the user's authentication record for the given scheme.
+func (a *adapter) authFind(uid t.Uid, scheme string) string {
+	user := uid.String()
+	for unique, rec := range a.auth {
+		if rec.userid == user && rec.scheme == scheme {
+			return unique
+		}
+	}
+	return ""
+}
+
+// Delete user's authentication record.
+func (a *adapter) AuthDelRecord(uid t.Uid, unique string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if rec, ok := a.auth[unique]; ok && rec.userid == uid.String() {
+		delete(a.auth, unique)
+	}
+
+	return nil
+}
+
+// Delete user's all authentication records
+func (a *adapter) AuthDelAllRecords(uid t.Uid) (int, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	count := 0
+	user := uid.String()
+	for unique, rec := range a.auth {
+		if rec.userid == user {
+			delete(a.auth, unique)
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Update user's authentication secret.
+func (a *adapter) AuthUpdRecord(uid t.Uid, scheme, unique string, authLvl auth.Level,
+	secret []byte, expires time.Time) (bool, error) {
+
+	a.Lock()
+	defer a.Unlock()
+
+	old := a.authFind(uid, scheme)
+	if old == "" {
+		// If the record is not found, don't update it
+		return false, t.ErrNotFound
+	}
+	if old != unique {
+		if _, ok := a.auth[unique]; ok {
+			return true, t.ErrDuplicate
+		}
+	}
+	delete(a.auth, old)
+
+	return a.authAddRecord(uid, scheme, unique, authLvl, secret, expires)
+}
+
+// Retrieve user's authentication record
+func (a *adapter) AuthGetRecord(uid t.Uid, scheme string) (string, auth.Level, []byte, time.Time, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	unique := a.authFind(uid, scheme)
+	if unique == "" {
+		return "", 0, nil, time.Time{}, t.ErrNotFound
+	}
+	rec := a.auth[unique]
+
+	return unique, rec.authLvl, append([]byte(nil), rec.secret...), rec.expires, nil
+}
+
+// Retrieve user's authentication record
+func (a *adapter) AuthGetUniqueRecord(unique string) (t.Uid, auth.Level, []byte, time.Time, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	rec, ok := a.auth[unique]
+	if !ok {
+		return t.ZeroUid, 0, nil, time.Time{}, nil
+	}
+
+	return t.ParseUid(rec.userid), rec.authLvl, append([]byte(nil), rec.secret...), rec.expires, nil
+}
+
+// AuthFailGet returns the count of failed authentication attempts for the given key.
+func (a *adapter) AuthFailGet(key string) (int, time.Time, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	rec, ok := a.authFail[key]
+	if !ok {
+		return 0, time.Time{}, nil
+	}
+	return rec.failures, rec.lastAt, nil
+}
+
+// AuthFailAdd increments the count of failed authentication attempts for the given key.
+func (a *adapter) AuthFailAdd(key string, resetBefore time.Time) (int, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	rec, ok := a.authFail[key]
+	if !ok || rec.lastAt.Before(resetBefore) {
+		rec = &authFail{}
+		a.authFail[key] = rec
+	}
+	rec.failures++
+	rec.lastAt = t.TimeNow()
+	return rec.failures, nil
+}
+
+// AuthFailDel clears failed authentication attempts for the given key.
+func (a *adapter) AuthFailDel(key string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	delete(a.authFail, key)
+	return nil
+}
+
+// UserGet fetches a single user by user id. If user is not found it returns (nil, nil)
+func (a *adapter) UserGet(uid t.Uid) (*t.User, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	user, ok := a.users[uid.String()]
+	if !ok {
+		return nil, nil
+	}
+	usr := copyUser(user)
+
+	return &usr, nil
+}
+
+func (a *adapter) UserGetAll(ids ...t.Uid) ([]t.User, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	users := []t.User{}
+	for _, id := range ids {
+		if user, ok := a.users[id.String()]; ok {
+			users = append(users, copyUser(user))
+		}
+	}
+
+	return users, nil
+}
+
+func (a *adapter) UserDelete(uid t.Uid, soft bool) error {
+	a.Lock()
+	defer a.Unlock()
+
+	user, ok := a.users[uid.String()]
+	if !ok {
+		return nil
+	}
+	if soft {
+		now := t.TimeNow()
+		user.UpdatedAt = now
+		user.DeletedAt = &now
+	} else {
+		delete(a.users, uid.String())
+	}
+
+	return nil
+}
+
+// UserUpdate updates user object.
+func (a *adapter) UserUpdate(uid t.Uid, update map[string]interface{}) error {
+	a.Lock()
+	defer a.Unlock()
+
+	user, ok := a.users[uid.String()]
+	if !ok {
+		return nil
+	}
+	usr := copyUser(user)
+	if err := applyUpdate(&usr, update); err != nil {
+		return err
+	}
+	if tags, ok := extractTags(update); ok {
+		usr.Tags = append(t.StringSlice(nil), tags...)
+	}
+	a.users[uid.String()] = &usr
+
+	return nil
+}
+
+// *****************************
+
+// TopicCreate creates a topic from template
+func (a *adapter) TopicCreate(topic *t.Topic) error {
+	a.Lock()
+	defer a.Unlock()
+
+	return a.topicCreate(topic)
+}
+
+func (a *adapter) topicCreate(topic *t.Topic) error {
+	if _, ok := a.topics[topic.Id]; ok {
+		return t.ErrDuplicate
+	}
+	top := copyTopic(topic)
+	a.topics[topic.Id] = &top
+
+	return nil
+}
+
+// createSubscription saves a subscription. If the subscription already exists and undelete is true,
+// the old subscription is undeleted and its times and ModeGiven are updated. Otherwise the old
+// subscription is replaced but values persisted through soft-deletion are kept.
+func (a *adapter) createSubscription(sub *t.Subscription, undelete bool) {
+	key := sub.Topic + ":" + sub.User
+	old, found := a.subs[key]
+	if found && undelete {
+		old.DeletedAt = nil
+		old.CreatedAt = sub.CreatedAt
+		old.UpdatedAt = sub.UpdatedAt
+		old.ModeGiven = sub.ModeGiven
+		return
+	}
+
+	rec := *sub
+	rec.Id = key
+	rec.DeletedAt = nil
+	if found {
+		rec.DelId = old.DelId
+		rec.RecvSeqId = old.RecvSeqId
+		rec.ReadSeqId = old.ReadSeqId
+	}
+	a.subs[key] = &rec
+}
+
+// TopicCreateP2P given two users creates a p2p topic
+func (a *adapter) TopicCreateP2P(initiator, invited *t.Subscription) error {
+	a.Lock()
+	defer a.Unlock()
+
+	a.createSubscription(initiator, false)
+	a.createSubscription(invited, true)
+
+	topic := &t.Topic{ObjHeader: t.ObjHeader{Id: initiator.Topic}}
+	topic.ObjHeader.MergeTimes(&initiator.ObjHeader)
+	topic.TouchedAt = initiator.GetTouchedAt()
+
+	return a.topicCreate(topic)
+}
+
+// TopicGet loads a single topic by name, if it exists. If the topic does not exist the call returns (nil, nil)
+func (a *adapter) TopicGet(topic string) (*t.Topic, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	tt, ok := a.topics[topic]
+	if !ok {
+		return nil, nil
+	}
+	top := copyTopic(tt)
+
+	return &top, nil
+}
+
+// subsForUser returns subscriptions of the given user ordered by topic name, applying filters and limits.
+func (a *adapter) subsForUser(uid t.Uid, keepDeleted bool, opts *t.QueryOpt) []t.Subscription {
+	limit := maxResults
+	var topic string
+	if opts != nil {
+		// Ignore IfModifiedSince - we must return all entries
+		// Those unmodified will be stripped of Public & Private.
+
+		topic = opts.Topic
+		if opts.Limit > 0 && opts.Limit < limit {
+			limit = opts.Limit
+		}
+	}
+
+	user := uid.String()
+	var subs []t.Subscription
+	for _, sub := range a.subs {
+		if sub.User != user || (topic != "" && sub.Topic != topic) || (!keepDeleted && sub.DeletedAt != nil) {
+			continue
+		}
+		subs = append(subs, *sub)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].Topic < subs[j].Topic
+	})
+	if len(subs) > limit {
+		subs = subs[:limit]
+	}
+
+	return subs
+}
+
+// subsForTopic returns subscriptions to the given topic ordered by user ID, applying filters and limits.
+func (a *adapter) subsForTopic(topic string, keepDeleted bool, opts *t.QueryOpt) []t.Subscription {
+	limit := maxSubscribers
+	var user string
+	if opts != nil {
+		// Ignore IfModifiedSince - we must return all entries
+		// Those unmodified will be stripped of Public & Private.
+
+		if !opts.User.IsZero() {
+			user = opts.User.String()
+		}
+		if opts.Limit > 0 && opts.Limit < limit {
+			limit = opts.Limit
+		}
+	}
+
+	var subs []t.Subscription
+	for _, sub := range a.subs {
+		if sub.Topic != topic || (user != "" && sub.User != user) || (!keepDeleted && sub.DeletedAt != nil) {
+			continue
+		}
+		subs = append(subs, *sub)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].User < subs[j].User
+	})
+	if len(subs) > limit {
+		subs = subs[:limit]
+	}
+
+	return subs
+}
+
+// TopicsForUser loads user's contact list: p2p and grp topics, except for 'me' & 'fnd' subscriptions.
+// Reads and denormalizes Public value.
+func (a *adapter) TopicsForUser(uid t.Uid, keepDeleted bool, opts *t.QueryOpt) ([]t.Subscription, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var subs []t.Subscription
+	for _, sub := range a.subsForUser(uid, keepDeleted, opts) {
+		tcat := t.GetTopicCat(sub.Topic)
+
+		// 'me' or 'fnd' subscription, skip
+		if tcat == t.TopicCatMe || tcat == t.TopicCatFnd {
+			continue
+		}
+
+		top, ok := a.topics[sub.Topic]
+		if !ok {
+			continue
+		}
+		sub.ObjHeader.MergeTimes(&top.ObjHeader)
+		sub.SetSeqId(top.SeqId)
+		sub.SetTouchedAt(top.TouchedAt)
+
+		if tcat == t.TopicCatGrp {
+			// all done with a grp topic
+			sub.SetPublic(top.Public)
+			subs = append(subs, sub)
+			continue
+		}
+
+		// p2p subscription, find the other user to get user.Public
+		uid1, uid2, _ := t.ParseP2P(sub.Topic)
+		if uid1 == uid {
+			uid1 = uid2
+		}
+		usr, ok := a.users[uid1.String()]
+		if !ok {
+			continue
+		}
+		sub.ObjHeader.MergeTimes(&usr.ObjHeader)
+		sub.SetPublic(usr.Public)
+		sub.SetWith(uid1.UserId())
+		sub.SetDefaultAccess(usr.Access.Auth, usr.Access.Anon)
+		sub.SetLastSeenAndUA(usr.LastSeen, usr.UserAgent)
+		subs = append(subs, sub)
+	}
+
+	return subs, nil
+}
+
+// UsersForTopic loads users subscribed to the given topic
+func (a *adapter) UsersForTopic(topic string, keepDeleted bool, opts *t.QueryOpt) ([]t.Subscription, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var subs []t.Subscription
+	for _, sub := range a.subsForTopic(topic, keepDeleted, opts) {
+		usr, ok := a.users[sub.User]
+		if !ok {
+			continue
+		}
+		sub.ObjHeader.MergeTimes(&usr.ObjHeader)
+		sub.SetPublic(usr.Public)
+		subs = append(subs, sub)
+	}
+
+	return subs, nil
+}
+
+// TopicShare creates topic subscriptions. Subscriptions which were marked as deleted are undeleted.
+func (a *adapter) TopicShare(shares []*t.Subscription) (int, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	for _, sub := range shares {
+		a.createSubscription(sub, true)
+	}
+
+	return len(shares), nil
+}
+
+func (a *adapter) TopicDelete(topic string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	delete(a.topics, topic)
+
+	return nil
+}
+
+func (a *adapter) TopicUpdateOnMessage(topic string, msg *t.Message) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if top, ok := a.topics[topic]; ok {
+		touched := msg.CreatedAt
+		top.SeqId = msg.SeqId
+		top.TouchedAt = &touched
+	}
+
+	return nil
+}
+
+func (a *adapter) TopicUpdate(topic string, update map[string]interface{}) error {
+	a.Lock()
+	defer a.Unlock()
+
+	tt, ok := a.topics[topic]
+	if !ok {
+		return nil
+	}
+	top := copyTopic(tt)
+	if err := applyUpdate(&top, update); err != nil {
+		return err
+	}
+	if tags, ok := extractTags(update); ok {
+		top.Tags = append(t.StringSlice(nil), tags...)
+	}
+	a.topics[topic] = &top
+
+	return nil
+}
+
+// Get a subscription of a user to a topic
+func (a *adapter) SubscriptionGet(topic string, user t.Uid) (*t.Subscription, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	sub, ok := a.subs[topic+":"+user.String()]
+	if !ok || sub.DeletedAt != nil {
+		return nil, nil
+	}
+	ss := *sub
+
+	return &ss, nil
+}
+
+// Update time when the user was last attached to the topic
+func (a *adapter) SubsLastSeen(topic string, user t.Uid, lastSeen map[string]time.Time) error {
+	// Not used: last seen time is stored on the user object.
+	return nil
+}
+
+// SubsForUser loads a list of user's subscriptions to topics. Does NOT load Public value.
+func (a *adapter) SubsForUser(forUser t.Uid, keepDeleted bool, opts *t.QueryOpt) ([]t.Subscription, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	return a.subsForUser(forUser, keepDeleted, opts), nil
+}
+
+// SubsForTopic fetches all subsciptions for a topic. Does NOT load Public value.
+func (a *adapter) SubsForTopic(topic string, keepDeleted bool, opts *t.QueryOpt) ([]t.Subscription, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	return a.subsForTopic(topic, keepDeleted, opts), nil
+}
+
+// updateSubs applies the update to subscriptions which match the filter.
+func (a *adapter) updateSubs(match func(sub *t.Subscription) bool, update map[string]interface{}) error {
+	for key, sub := range a.subs {
+		if !match(sub) {
+			continue
+		}
+		ss := *sub
+		if err := applyUpdate(&ss, update); err != nil {
+			return err
+		}
+		a.subs[key] = &ss
+	}
+	return nil
+}
+
+// SubsUpdate updates one or all subscriptions to the given topic.
+func (a *adapter) SubsUpdate(topic string, user t.Uid, update map[string]interface{}) error {
+	a.Lock()
+	defer a.Unlock()
+
+	return a.updateSubs(func(sub *t.Subscription) bool {
+		return sub.Topic == topic && (user.IsZero() || sub.User == user.String())
+	}, update)
+}
+
+// SubsDelete marks subscription as deleted.
+func (a *adapter) SubsDelete(topic string, user t.Uid) error {
+	now := t.TimeNow()
+	return a.SubsUpdate(topic, user, map[string]interface{}{"UpdatedAt": now, "DeletedAt": now})
+}
+
+// SubsDelForTopic marks all subscriptions to the given topic as deleted
+func (a *adapter) SubsDelForTopic(topic string) error {
+	now := t.TimeNow()
+	return a.SubsUpdate(topic, t.ZeroUid, map[string]interface{}{"UpdatedAt": now, "DeletedAt": now})
+}
+
+// SubsDelForUser marks all subscriptions of a given user as deleted
+func (a *adapter) SubsDelForUser(user t.Uid) error {
+	a.Lock()
+	defer a.Unlock()
+
+	now := t.TimeNow()
+	return a.updateSubs(func(sub *t.Subscription) bool {
+		return sub.User == user.String()
+	}, map[string]interface{}{"UpdatedAt": now, "DeletedAt": now})
+}
+
+// tagMatch is an owner of tags (user or topic) found by a tag search.
+type tagMatch struct {
+	owner     string
+	matches   int
+	foundTags []string
+}
+
+// matchTags checks the tags of a user or a topic against the query. Returns nil if some
+// required tags are missing or nothing matched.
+func matchTags(owner string, tags, req, opt []string) *tagMatch {
+	found := make([]string, 0, 1)
+	var reqCount int
+	for _, tag := range tags {
+		isReq, isOpt := false, false
+		for _, r := range req {
+			if r == tag {
+				isReq = true
+				break
+			}
+		}
+		for _, o := range opt {
+			if o == tag {
+				isOpt = true
+				break
+			}
+		}
+		if isReq {
+			reqCount++
+		}
+		if isReq || isOpt {
+			found = append(found, tag)
+		}
+	}
+
+	if len(found) == 0 || reqCount < len(req) {
+		return nil
+	}
+	return &tagMatch{owner: owner, matches: len(found), foundTags: found}
+}
+
+// sortMatches orders matches by the number of matched tags from high to low and applies the limit.
+func sortMatches(found []*tagMatch) []*tagMatch {
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].matches != found[j].matches {
+			return found[i].matches > found[j].matches
+		}
+		return found[i].owner < found[j].owner
+	})
+	if len(found) > maxResults {
+		found = found[:maxResults]
+	}
+	return found
+}
+
+// Returns a list of users who match given tags, such as "email:jdoe@example.com" or "tel:18003287448".
+// Every required tag must match. Results are sorted by the number of matched tags from high to low.
+func (a *adapter) FindUsers(uid t.Uid, req, opt []string) ([]t.Subscription, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var found []*tagMatch
+	for id, usr := range a.users {
+		if match := matchTags(id, usr.Tags, req, opt); match != nil {
+			found = append(found, match)
+		}
+	}
+
+	var subs []t.Subscription
+	for _, match := range sortMatches(found) {
+		if match.owner == uid.String() {
+			// Skip the callee
+			continue
+		}
+		usr := a.users[match.owner]
+		var sub t.Subscription
+		sub.CreatedAt = usr.CreatedAt
+		sub.UpdatedAt = usr.UpdatedAt
+		sub.User = usr.Id
+		sub.SetPublic(usr.Public)
+		// TODO: maybe report default access to user
+		// sub.SetDefaultAccess(user.Access.Auth, user.Access.Anon)
+		sub.Private = match.foundTags
+		subs = append(subs, sub)
+	}
+
+	return subs, nil
+}
+
+// Returns a list of topics with matching tags.
+// Every required tag must match. Results are sorted by the number of matched tags from high to low.
+func (a *adapter) FindTopics(req, opt []string) ([]t.Subscription, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var found []*tagMatch
+	for name, top := range a.topics {
+		if match := matchTags(name, top.Tags, req, opt); match != nil {
+			found = append(found, match)
+		}
+	}
+
+	var subs []t.Subscription
+	for _, match := range sortMatches(found) {
+		top := a.topics[match.owner]
+		var sub t.Subscription
+		sub.CreatedAt = top.CreatedAt
+		sub.UpdatedAt = top.UpdatedAt
+		sub.Topic = top.Id
+		sub.SetPublic(top.Public)
+		// TODO: maybe report default access to user
+		// sub.SetDefaultAccess(user.Access.Auth, user.Access.Anon)
+		sub.Private = match.foundTags
+		subs = append(subs, sub)
+	}
+
+	return subs, nil
+}
+
+// Messages
+
+// toMessage converts a stored message into the form returned to the caller.
+func (m *message) toMessage() t.Message {
+	msg := m.Message
+	msg.DeletedFor = append([]t.SoftDelete(nil), m.DeletedFor...)
+	msg.Reactions = nil
+	if len(m.reactions) > 0 {
+		msg.Reactions = make(map[string]int, len(m.reactions))
+		for reaction, users := range m.reactions {
+			msg.Reactions[reaction] = len(users)
+		}
+	}
+	return msg
+}
+
+// isDeletedFor checks if the message is soft-deleted for the given user.
+func (m *message) isDeletedFor(user string) bool {
+	for _, sd := range m.DeletedFor {
+		if sd.User == user {
+			return true
+		}
+	}
+	return false
+}
+
+// seqIds returns sequential IDs of messages in the topic in the range [lower, upper), newest first.
+// Upper equal to 0 means no upper limit.
+func (a *adapter) seqIds(topic string, lower, upper int) []int {
+	var seqs []int
+	for seq := range a.messages[topic] {
+		if seq >= lower && (upper == 0 || seq < upper) {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(seqs)))
+	return seqs
+}
+
+// liveMessage returns a message which is not hard-deleted.
+func (a *adapter) liveMessage(topic string, seqId int) (*message, error) {
+	msg, ok := a.messages[topic][seqId]
+	if !ok || msg.DelId > 0 {
+		return nil, t.ErrNotFound
+	}
+	return msg, nil
+}
+
+func (a *adapter) MessageSave(msg *t.Message) error {
+	msg.SetUid(store.GetUid())
+
+	a.Lock()
+	defer a.Unlock()
+
+	msgs := a.messages[msg.Topic]
+	if msgs == nil {
+		msgs = make(map[int]*message)
+		a.messages[msg.Topic] = msgs
+	}
+	if _, ok := msgs[msg.SeqId]; ok {
+		return t.ErrDuplicate
+	}
+	msgs[msg.SeqId] = &message{Message: *msg}
+
+	if msg.ReplyTo > 0 {
+		// Update the counter of replies on the root message of the thread.
+		if root, ok := msgs[msg.ReplyTo]; ok {
+			root.ReplyCount++
+			lastReplyAt := msg.CreatedAt
+			root.LastReplyAt = &lastReplyAt
+		}
+	}
+
+	return nil
+}
+
+func (a *adapter) MessageGetAll(topic string, forUser t.Uid, opts *t.QueryOpt) ([]t.Message, error) {
+	var limit = maxResults
+	var lower = 0
+	var upper = 0
+	var thread = 0
+
+	if opts != nil {
+		if opts.Since > 0 {
+			lower = opts.Since
+		}
+		if opts.Before > 0 {
+			upper = opts.Before
+		}
+		if opts.Limit > 0 && opts.Limit < limit {
+			limit = opts.Limit
+		}
+		thread = opts.Thread
+	}
+
+	a.RLock()
+	defer a.RUnlock()
+
+	user := forUser.String()
+	var msgs []t.Message
+	for _, seq := range a.seqIds(topic, lower, upper) {
+		msg := a.messages[topic][seq]
+		if msg.DelId > 0 || msg.isDeletedFor(user) {
+			continue
+		}
+		if thread > 0 && msg.ReplyTo != thread {
+			continue
+		}
+		msgs = append(msgs, msg.toMessage())
+		if len(msgs) == limit {
+			break
+		}
+	}
+
+	roots := make(map[int]*t.Message)
+	for i := range msgs {
+		if msgs[i].ReplyCount > 0 {
+			roots[msgs[i].SeqId] = &msgs[i]
+		}
+	}
+	a.countReplies(topic, user, roots)
+
+	return msgs, nil
+}
+
+// countReplies recomputes thread statistics of the root messages counting the replies which are not
+// hard-deleted and, if the user is given, not soft-deleted for the user.
+func (a *adapter) countReplies(topic, user string, roots map[int]*t.Message) {
+	if len(roots) == 0 {
+		return
+	}
+	for _, root := range roots {
+		root.ReplyCount = 0
+		root.LastReplyAt = nil
+	}
+	for _, msg := range a.messages[topic] {
+		root := roots[msg.ReplyTo]
+		if root == nil || msg.DelId > 0 || (user != "" && msg.isDeletedFor(user)) {
+			continue
+		}
+		root.ReplyCount++
+		if root.LastReplyAt == nil || msg.CreatedAt.After(*root.LastReplyAt) {
+			lastReplyAt := msg.CreatedAt
+			root.LastReplyAt = &lastReplyAt
+		}
+	}
+}
+
+// MessageEdit replaces Head and Content of a message. The previous version is kept as a revision.
+func (a *adapter) MessageEdit(msg *t.Message) error {
+	a.Lock()
+	defer a.Unlock()
+
+	old, err := a.liveMessage(msg.Topic, msg.SeqId)
+	if err != nil {
+		return err
+	}
+	old.revisions = append(old.revisions, revision{
+		createdAt: old.UpdatedAt,
+		head:      old.Head,
+		content:   old.Content})
+	old.UpdatedAt = msg.UpdatedAt
+	old.Head = msg.Head
+	old.Content = msg.Content
+	msg.Id = old.Id
+
+	return nil
+}
+
+// MessageReactionAdd records a reaction of the user to the message.
+func (a *adapter) MessageReactionAdd(topic string, seqId int, user t.Uid, reaction string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	msg, err := a.liveMessage(topic, seqId)
+	if err != nil {
+		return err
+	}
+	for _, uid := range msg.reactions[reaction] {
+		if uid == user.String() {
+			return t.ErrDuplicate
+		}
+	}
+	if msg.reactions == nil {
+		msg.reactions = make(map[string][]string)
+	}
+	msg.reactions[reaction] = append(msg.reactions[reaction], user.String())
+
+	return nil
+}
+
+// MessageReactionDelete removes a reaction of the user from the message.
+func (a *adapter) MessageReactionDelete(topic string, seqId int, user t.Uid, reaction string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	msg, err := a.liveMessage(topic, seqId)
+	if err != nil {
+		return err
+	}
+	users := msg.reactions[reaction]
+	for i, uid := range users {
+		if uid == user.String() {
+			users = append(users[:i], users[i+1:]...)
+			if len(users) == 0 {
+				delete(msg.reactions, reaction)
+			} else {
+				msg.reactions[reaction] = users
+			}
+			return nil
+		}
+	}
+
+	return t.ErrNotFound
+}
+
+// Get ranges of deleted messages
+func (a *adapter) MessageGetDeleted(topic string, forUser t.Uid, opts *t.QueryOpt) ([]t.DelMessage, error) {
+	var limit = maxResults
+	var lower = 0
+	var upper = 0
+
+	if opts != nil {
+		if opts.Since > 0 {
+			lower = opts.Since
+		}
+		if opts.Before > 0 {
+			upper = opts.Before
+		}
+		if opts.Limit > 0 && opts.Limit < limit {
+			limit = opts.Limit
+		}
+	}
+
+	a.RLock()
+	defer a.RUnlock()
+
+	user := forUser.String()
+	var dmsgs []t.DelMessage
+	for _, dmsg := range a.dellog[topic] {
+		if dmsg.DelId < lower || (upper > 0 && dmsg.DelId >= upper) {
+			continue
+		}
+		if dmsg.DeletedFor != "" && dmsg.DeletedFor != user {
+			continue
+		}
+		ranges := make([]t.Range, len(dmsg.SeqIdRanges))
+		for i, rng := range dmsg.SeqIdRanges {
+			if rng.Hi <= rng.Low+1 {
+				rng.Hi = 0
+			}
+			ranges[i] = rng
+		}
+		dmsg.SeqIdRanges = ranges
+		dmsgs = append(dmsgs, dmsg)
+		if len(dmsgs) == limit {
+			break
+		}
+	}
+
+	return dmsgs, nil
+}
+
+// releaseFiles decrements use counters of the files attached to a hard-deleted message.
+func (a *adapter) releaseFiles(fids []string) {
+	now := t.TimeNow()
+	for _, fid := range fids {
+		if fr, ok := a.files[fid]; ok {
+			if fr.useCount > 0 {
+				fr.useCount--
+			}
+			fr.UpdatedAt = now
+		}
+	}
+}
+
+// MessageDeleteList deletes messages in the given topic with seqIds from the list
+func (a *adapter) MessageDeleteList(topic string, toDel *t.DelMessage) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if toDel == nil {
+		// Delete all messages of the topic together with the deletion log.
+		for _, msg := range a.messages[topic] {
+			if msg.DelId == 0 {
+				a.releaseFiles(msg.attachments)
+			}
+		}
+		delete(a.messages, topic)
+		delete(a.dellog, topic)
+		return nil
+	}
+
+	// Record the deletion in the log, keeping the log ordered by DelId.
+	rec := *toDel
+	rec.SeqIdRanges = append([]t.Range(nil), toDel.SeqIdRanges...)
+	log := append(a.dellog[topic], rec)
+	sort.SliceStable(log, func(i, j int) bool {
+		return log[i].DelId < log[j].DelId
+	})
+	a.dellog[topic] = log
+
+	now := t.TimeNow()
+	// Threads which lose replies.
+	roots := make(map[int]*t.Message)
+	for _, rng := range toDel.SeqIdRanges {
+		hi := rng.Hi
+		if hi == 0 {
+			// Hi is exclusive, 0 means a single message.
+			hi = rng.Low + 1
+		}
+		for _, seq := range a.seqIds(topic, rng.Low, hi) {
+			msg := a.messages[topic][seq]
+			if msg.DelId > 0 {
+				// Already hard-deleted.
+				continue
+			}
+			if toDel.DeletedFor == "" {
+				// Hard-delete: keep the message record but clear the content.
+				a.releaseFiles(msg.attachments)
+				deletedAt := now
+				msg.DeletedAt = &deletedAt
+				msg.DelId = toDel.DelId
+				msg.DeletedFor = nil
+				msg.Head = nil
+				msg.Content = nil
+				msg.reactions = nil
+				msg.revisions = nil
+				msg.words = nil
+				msg.attachments = nil
+				if root, ok := a.messages[topic][msg.ReplyTo]; ok {
+					roots[msg.ReplyTo] = &root.Message
+				}
+			} else if !msg.isDeletedFor(toDel.DeletedFor) {
+				// Soft-delete: mark the message as deleted for the user.
+				msg.DeletedFor = append(msg.DeletedFor, t.SoftDelete{User: toDel.DeletedFor, DelId: toDel.DelId})
+			}
+		}
+	}
+	a.countReplies(topic, "", roots)
+
+	return nil
+}
+
+// MessageAttachments connects given message to a list of file record IDs.
+func (a *adapter) MessageAttachments(msgId t.Uid, fids []string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	id := msgId.String()
+	var msg *message
+	for _, msgs := range a.messages {
+		for _, m := range msgs {
+			if m.Id == id {
+				msg = m
+				break
+			}
+		}
+		if msg != nil {
+			break
+		}
+	}
+	if msg == nil || msg.DelId > 0 {
+		return t.ErrNotFound
+	}
+
+	now := t.TimeNow()
+	msg.attachments = append(msg.attachments, fids...)
+	msg.UpdatedAt = now
+	for _, fid := range fids {
+		if fr, ok := a.files[fid]; ok {
+			fr.useCount++
+			fr.UpdatedAt = now
+		}
+	}
+
+	return nil
+}
+
+// MessageIndex saves normalized words of the message for full-text search.
+func (a *adapter) MessageIndex(topic string, seqId int, words []string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if msg, err := a.liveMessage(topic, seqId); err == nil {
+		msg.words = append([]string(nil), words...)
+	}
+
+	return nil
+}
+
+// hasWords checks if the message has all the given words.
+func (m *message) hasWords(words []string) bool {
+	for _, word := range words {
+		found := false
+		for _, w := range m.words {
+			if w == word {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// MessageSearch finds messages in the given topics which contain all of the words.
+func (a *adapter) MessageSearch(topics []string, forUser t.Uid, words []string,
+	opts *t.QueryOpt) ([]t.Message, error) {
+
+	if len(topics) == 0 || len(words) == 0 {
+		return nil, nil
+	}
+
+	var limit = maxResults
+	var lower = 0
+	var upper = 0
+
+	if opts != nil {
+		if opts.Since > 0 {
+			lower = opts.Since
+		}
+		if opts.Before > 0 {
+			upper = opts.Before
+		}
+		if opts.Limit > 0 && opts.Limit < limit {
+			limit = opts.Limit
+		}
+	}
+
+	a.RLock()
+	defer a.RUnlock()
+
+	user := forUser.String()
+	var msgs []t.Message
+	for _, topic := range topics {
+		// Each topic contributes at most 'limit' of its newest matching messages.
+		count := 0
+		for _, seq := range a.seqIds(topic, lower, upper) {
+			msg := a.messages[topic][seq]
+			if msg.DelId > 0 || msg.isDeletedFor(user) || !msg.hasWords(words) {
+				continue
+			}
+			msgs = append(msgs, msg.toMessage())
+			count++
+			if count == limit {
+				break
+			}
+		}
+	}
+
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].CreatedAt.After(msgs[j].CreatedAt)
+	})
+	if len(msgs) > limit {
+		msgs = msgs[:limit]
+	}
+
+	return msgs, nil
+}
+
+func deviceHasher(deviceID string) string {
+	// Generate custom key as [64-bit hash of device id] to ensure predictable
+	// length of the key
+	hasher := fnv.New64()
+	hasher.Write([]byte(deviceID))
+	return strconv.FormatUint(uint64(hasher.Sum64()), 16)
+}
+
+// Device management for push notifications
+func (a *adapter) DeviceUpsert(uid t.Uid, def *t.DeviceDef) error {
+	hash := deviceHasher(def.DeviceId)
+
+	a.Lock()
+	defer a.Unlock()
+
+	user, ok := a.users[uid.String()]
+	if !ok {
+		return t.ErrNotFound
+	}
+
+	// The device may be registered to another user, i.e. when one user logs out and another logs in
+	// on the same device.
+	for _, usr := range a.users {
+		delete(usr.Devices, hash)
+	}
+
+	if user.Devices == nil {
+		user.Devices = make(map[string]*t.DeviceDef)
+	}
+	dev := *def
+	user.Devices[hash] = &dev
+
+	return nil
+}
+
+func (a *adapter) DeviceGetAll(uids ...t.Uid) (map[t.Uid][]t.DeviceDef, int, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	result := make(map[t.Uid][]t.DeviceDef)
+	count := 0
+	for _, uid := range uids {
+		user, ok := a.users[uid.String()]
+		if !ok || len(user.Devices) == 0 {
+			continue
+		}
+		udev := make([]t.DeviceDef, 0, len(user.Devices))
+		for _, def := range user.Devices {
+			udev = append(udev, *def)
+		}
+		result[uid] = udev
+		count += len(udev)
+	}
+
+	return result, count, nil
+}
+
+func (a *adapter) DeviceDelete(uid t.Uid, deviceID string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if user, ok := a.users[uid.String()]; ok {
+		delete(user.Devices, deviceHasher(deviceID))
+	}
+
+	return nil
+}
+
+// Credential management
+
+// credKeys returns keys of the user's credentials, optionally limited to one method, in stable order.
+func (a *adapter) credKeys(uid t.Uid, method string) []string {
+	user := uid.String()
+	var keys []string
+	for key, cred := range a.creds {
+		if cred.User == user && (method == "" || cred.Method == method) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return a.creds[keys[i]].Method+":"+a.creds[keys[i]].Value < a.creds[keys[j]].Method+":"+a.creds[keys[j]].Value
+	})
+	return keys
+}
+
+// CredAdd adds a credential record. Unconfirmed credentials are keyed by user, so one user cannot
+// block another from validating the same value.
+func (a *adapter) CredAdd(cred *t.Credential) error {
+	// Enforce uniqueness: if credential is confirmed, "method:value" must be unique.
+	// if credential is not yet confirmed, "userid:method:value" is unique.
+	key := cred.Method + ":" + cred.Value
+	if !cred.Done {
+		key = cred.User + ":" + key
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	if _, ok := a.creds[key]; ok {
+		return t.ErrDuplicate
+	}
+	cred.Id = key
+	rec := *cred
+	a.creds[key] = &rec
+
+	return nil
+}
+
+// CredGetOwner returns ID of the user who has confirmed the credential. Confirmed credentials
+// are keyed by "method:value".
+func (a *adapter) CredGetOwner(method, value string) (t.Uid, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	cred, ok := a.creds[method+":"+value]
+	if !ok || !cred.Done {
+		return t.ZeroUid, nil
+	}
+	return t.ParseUid(cred.User), nil
+}
+
+// CredIsConfirmed returns true if the user has at least one confirmed credential of the given method.
+func (a *adapter) CredIsConfirmed(uid t.Uid, method string) (bool, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	for _, key := range a.credKeys(uid, method) {
+		if a.creds[key].Done {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// CredDel deletes credentials for the given method and value. If value is empty, deletes all credentials
+// of the method. If method is empty, deletes all user's credentials.
+func (a *adapter) CredDel(uid t.Uid, method, value string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	for _, key := range a.credKeys(uid, method) {
+		if method != "" && value != "" && a.creds[key].Value != value {
+			continue
+		}
+		delete(a.creds, key)
+	}
+
+	return nil
+}
+
+// CredConfirm marks given credentials as validated.
+func (a *adapter) CredConfirm(uid t.Uid, method string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	keys := a.credKeys(uid, method)
+	if len(keys) == 0 {
+		return t.ErrNotFound
+	}
+
+	now := t.TimeNow()
+	for _, key := range keys {
+		cred := a.creds[key]
+		if cred.Done {
+			continue
+		}
+		// Confirmed credentials are keyed by method:value only.
+		newKey := cred.Method + ":" + cred.Value
+		if _, ok := a.creds[newKey]; ok {
+			return t.ErrDuplicate
+		}
+		delete(a.creds, key)
+		cred.Id = newKey
+		cred.Done = true
+		cred.UpdatedAt = now
+		a.creds[newKey] = cred
+	}
+
+	return nil
+}
+
+// CredFail increments count of failed validation attepmts for the given credentials.
+func (a *adapter) CredFail(uid t.Uid, method string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	now := t.TimeNow()
+	for _, key := range a.credKeys(uid, method) {
+		if cred := a.creds[key]; !cred.Done {
+			cred.Retries++
+			cred.UpdatedAt = now
+		}
+	}
+
+	return nil
+}
+
+// CredGet returns credential records for the given user and method. If method is empty,
+// returns all user's credentials.
+func (a *adapter) CredGet(uid t.Uid, method string) ([]*t.Credential, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	var result []*t.Credential
+	for _, key := range a.credKeys(uid, method) {
+		cred := *a.creds[key]
+		result = append(result, &cred)
+	}
+
+	return result, nil
+}
+
+// FileUploads
+
+// FileStartUpload initializes a file upload
+func (a *adapter) FileStartUpload(fd *t.FileDef) error {
+	a.Lock()
+	defer a.Unlock()
+
+	a.files[fd.Id] = &fileRecord{FileDef: *fd}
+
+	return nil
+}
+
+// FileFinishUpload marks file upload as completed, successfully or otherwise
+func (a *adapter) FileFinishUpload(fid string, status int, size int64) (*t.FileDef, error) {
+	if t.ParseUid(fid).IsZero() {
+		return nil, t.ErrMalformed
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	fr, ok := a.files[fid]
+	if !ok {
+		return nil, t.ErrNotFound
+	}
+	fr.UpdatedAt = t.TimeNow()
+	fr.Status = status
+	fr.Size = size
+	fd := fr.FileDef
+
+	return &fd, nil
+}
+
+// FileGet fetches a record of a specific file
+func (a *adapter) FileGet(fid string) (*t.FileDef, error) {
+	if t.ParseUid(fid).IsZero() {
+		return nil, t.ErrMalformed
+	}
+
+	a.RLock()
+	defer a.RUnlock()
+
+	fr, ok := a.files[fid]
+	if !ok {
+		return nil, nil
+	}
+	fd := fr.FileDef
+
+	return &fd, nil
+}
+
+// FileDeleteUnused deletes records where UseCount is zero. If olderThan is non-zero, deletes
+// unused records with UpdatedAt before olderThan.
+// Returns array of FileDef.Location of deleted filerecords so actual files can be deleted too.
+func (a *adapter) FileDeleteUnused(olderThan time.Time, limit int) ([]string, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	var fids []string
+	for fid, fr := range a.files {
+		if fr.useCount > 0 || (!olderThan.IsZero() && !fr.UpdatedAt.Before(olderThan)) {
+			continue
+		}
+		fids = append(fids, fid)
+	}
+	// Delete the oldest records first.
+	sort.Slice(fids, func(i, j int) bool {
+		return a.files[fids[i]].UpdatedAt.Before(a.files[fids[j]].UpdatedAt)
+	})
+	if limit > 0 && len(fids) > limit {
+		fids = fids[:limit]
+	}
+
+	var locations []string
+	for _, fid := range fids {
+		locations = append(locations, a.files[fid].Location)
+		delete(a.files, fid)
+	}
+
+	return locations, nil
+}
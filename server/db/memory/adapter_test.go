@@ -0,0 +1,20 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/nanfengpo/chat/server/db/adaptertest"
+)
+
+func TestConformance(t *testing.T) {
+	adp := &adapter{}
+	if err := adp.Open(""); err != nil {
+		t.Fatal(err)
+	}
+	defer adp.Close()
+	if err := adp.CreateDb(true); err != nil {
+		t.Fatal(err)
+	}
+
+	adaptertest.Run(t, adp)
+}
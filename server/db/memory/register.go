@@ -0,0 +1,13 @@
+// +build memory
+
+package memory
+
+import (
+	"github.com/nanfengpo/chat/server/store"
+)
+
+// The adapter is registered with the store only when built with the tag 'memory'. Otherwise
+// the package is available to tests only.
+func init() {
+	store.RegisterAdapter(adapterName, &adapter{})
+}
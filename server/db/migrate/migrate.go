@@ -0,0 +1,79 @@
+// Package migrate runs forward-only upgrades of database schemas. Each adapter keeps a list of steps,
+// one step per schema version. The database records the version after every step, so an interrupted
+// upgrade resumes from the last completed step.
+package migrate
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Step is a single step of a schema upgrade.
+type Step struct {
+	// Version of the schema after the step is applied. A step upgrades the schema from Version-1.
+	Version int
+	// Description of the step which is shown to the user.
+	Desc string
+	// Apply performs the step.
+	Apply func() error
+}
+
+// String describes the step as 'from -> to: description'.
+func (s *Step) String() string {
+	return strconv.Itoa(s.Version-1) + " -> " + strconv.Itoa(s.Version) + ": " + s.Desc
+}
+
+// Plan selects steps which upgrade the schema from version 'from' to version 'to'. It fails if the path
+// has gaps or if the schema is newer than the target: downgrades are not supported.
+func Plan(steps []Step, from, to int) ([]Step, error) {
+	if from > to {
+		return nil, errors.New("migrate: database version " + strconv.Itoa(from) +
+			" is newer than the supported version " + strconv.Itoa(to) + ", downgrades are not supported")
+	}
+
+	var plan []Step
+	version := from
+	for _, step := range steps {
+		if step.Version <= from || step.Version > to {
+			continue
+		}
+		if step.Version != version+1 {
+			break
+		}
+		plan = append(plan, step)
+		version = step.Version
+	}
+
+	if version != to {
+		return nil, errors.New("migrate: no upgrade from version " + strconv.Itoa(version) +
+			" to " + strconv.Itoa(version+1))
+	}
+
+	return plan, nil
+}
+
+// Run upgrades the schema from version 'from' to version 'to'. After each step the new version is
+// saved with setVersion. If dryRun is true, nothing is changed. Returns descriptions of the steps which
+// were applied or, in case of a dry run, which would be applied.
+func Run(steps []Step, from, to int, setVersion func(int) error, dryRun bool) ([]string, error) {
+	plan, err := Plan(steps, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []string
+	for i := range plan {
+		step := &plan[i]
+		if !dryRun {
+			if err := step.Apply(); err != nil {
+				return done, errors.New("migrate: " + step.String() + " failed: " + err.Error())
+			}
+			if err := setVersion(step.Version); err != nil {
+				return done, err
+			}
+		}
+		done = append(done, step.String())
+	}
+
+	return done, nil
+}
@@ -0,0 +1,53 @@
+package migrate
+
+import (
+	"testing"
+)
+
+func testSteps(applied *[]int) []Step {
+	var steps []Step
+	for v := 101; v <= 104; v++ {
+		vers := v
+		steps = append(steps, Step{Version: vers, Desc: "step", Apply: func() error {
+			*applied = append(*applied, vers)
+			return nil
+		}})
+	}
+	return steps
+}
+
+func TestRun(t *testing.T) {
+	var applied, saved []int
+	setVersion := func(v int) error {
+		saved = append(saved, v)
+		return nil
+	}
+
+	done, err := Run(testSteps(&applied), 102, 104, setVersion, true)
+	if err != nil || len(done) != 2 || done[0] != "102 -> 103: step" || len(applied) != 0 || len(saved) != 0 {
+		t.Fatal("dry run must plan steps without applying them, got", done, applied, saved, err)
+	}
+
+	done, err = Run(testSteps(&applied), 102, 104, setVersion, false)
+	if err != nil || len(done) != 2 || len(applied) != 2 || applied[0] != 103 || applied[1] != 104 ||
+		len(saved) != 2 || saved[1] != 104 {
+		t.Fatal("steps must be applied in order, got", done, applied, saved, err)
+	}
+
+	if done, err = Run(testSteps(&applied), 104, 104, setVersion, false); err != nil || len(done) != 0 {
+		t.Error("current database must not be changed, got", done, err)
+	}
+}
+
+func TestPlanErrors(t *testing.T) {
+	var applied []int
+	if _, err := Plan(testSteps(&applied), 105, 104); err == nil {
+		t.Error("downgrade must fail")
+	}
+	if _, err := Plan(testSteps(&applied), 99, 104); err == nil {
+		t.Error("upgrade from an unknown version must fail")
+	}
+	if _, err := Plan(testSteps(&applied), 101, 106); err == nil {
+		t.Error("upgrade to an unknown version must fail")
+	}
+}
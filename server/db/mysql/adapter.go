@@ -24,13 +24,15 @@ type adapter struct {
 	dsn     string
 	dbName  string
 	version int
+	// Shortest word in the FULLTEXT index, innodb_ft_min_token_size.
+	ftMinToken int
 }
 
 const (
 	defaultDSN      = "root:@tcp(localhost:3306)/nanfengpo?parseTime=true"
 	defaultDatabase = "nanfengpo"
 
-	dbVersion = 105
+	dbVersion = 112
 
 	adapterName = "mysql"
 )
@@ -45,6 +47,8 @@ const (
 	maxResults = 1024
 	// Maximum number of topic subscribers to return
 	maxSubscribers = 256
+	// Default value of innodb_ft_min_token_size
+	defaultFtMinToken = 3
 )
 
 // Open initializes database session
@@ -84,6 +88,11 @@ func (a *adapter) Open(jsonconfig string) error {
 		err = nil
 	}
 
+	// Shorter words are not indexed by InnoDB and must be searched for differently.
+	if a.db.Get(&a.ftMinToken, "SELECT @@innodb_ft_min_token_size") != nil || a.ftMinToken <= 0 {
+		a.ftMinToken = defaultFtMinToken
+	}
+
 	return err
 }
 
@@ -128,6 +137,10 @@ func (a *adapter) CheckDbVersion() error {
 		}
 	}
 
+	if a.version > 0 && a.version < dbVersion {
+		return errors.New("Outdated database version " + strconv.Itoa(a.version) +
+			". Expected " + strconv.Itoa(dbVersion) + ", run 'tinode-db -upgrade'")
+	}
 	if a.version != dbVersion {
 		return errors.New("Invalid database version " + strconv.Itoa(a.version) +
 			". Expected " + strconv.Itoa(dbVersion))
@@ -208,6 +221,7 @@ func (a *adapter) CreateDb(reset bool) error {
 			useragent VARCHAR(255) DEFAULT '',
 			public    JSON,
 			tags      JSON,
+			quiethours VARCHAR(64) DEFAULT '',
 			PRIMARY KEY(id)
 		)`); err != nil {
 		return err
@@ -261,6 +275,17 @@ func (a *adapter) CreateDb(reset bool) error {
 		return err
 	}
 
+	// Failed authentication attempts by login or remote address.
+	if _, err = tx.Exec(
+		`CREATE TABLE authfail(
+			name     VARCHAR(96) NOT NULL,
+			failures INT NOT NULL DEFAULT 0,
+			lastat   DATETIME(3) NOT NULL,
+			PRIMARY KEY(name)
+		)`); err != nil {
+		return err
+	}
+
 	// Topics
 	if _, err = tx.Exec(
 		`CREATE TABLE topics(
@@ -307,9 +332,12 @@ func (a *adapter) CreateDb(reset bool) error {
 			delid      INT DEFAULT 0,
 			recvseqid  INT DEFAULT 0,
 			readseqid  INT DEFAULT 0,
+			mentioncount INT DEFAULT 0,
 			modewant	CHAR(8),
 			modegiven  	CHAR(8),
 			private 	JSON,
+			muteuntil 	DATETIME(3),
+			mentionsonly BOOLEAN DEFAULT FALSE,
 			PRIMARY KEY(id)	,
 			FOREIGN KEY(userid) REFERENCES users(id),
 			UNIQUE INDEX subscriptions_topic_userid(topic, userid),
@@ -318,7 +346,10 @@ func (a *adapter) CreateDb(reset bool) error {
 		return err
 	}
 
-	// Messages
+	// Messages. Full-text search must find all words, thus the FULLTEXT index is created without stopwords.
+	if _, err = tx.Exec("SET SESSION innodb_ft_enable_stopword=OFF"); err != nil {
+		return err
+	}
 	if _, err = tx.Exec(
 		`CREATE TABLE messages(
 			id        INT NOT NULL AUTO_INCREMENT,
@@ -331,10 +362,48 @@ func (a *adapter) CreateDb(reset bool) error {
 			"`from`   BIGINT NOT NULL," +
 			`head     JSON,
 			content   JSON,
+			replyto   INT DEFAULT 0,
+			replycount INT DEFAULT 0,
+			lastreplyat DATETIME(3),
+			searchtext TEXT,
 			PRIMARY KEY(id),` +
 			"FOREIGN KEY(`from`) REFERENCES users(id)," +
 			`FOREIGN KEY(topic) REFERENCES topics(name),
-			UNIQUE INDEX messages_topic_seqid(topic, seqid)
+			UNIQUE INDEX messages_topic_seqid(topic, seqid),
+			INDEX messages_topic_replyto_seqid(topic, replyto, seqid),
+			FULLTEXT INDEX messages_searchtext(searchtext)
+		);`); err != nil {
+		return err
+	}
+
+	// Earlier revisions of edited messages
+	if _, err = tx.Exec(
+		`CREATE TABLE msgrevisions(
+			id			INT NOT NULL AUTO_INCREMENT,
+			createdat	DATETIME(3) NOT NULL,
+			topic		CHAR(25) NOT NULL,
+			seqid		INT NOT NULL,
+			head		JSON,
+			content		JSON,
+			PRIMARY KEY(id),
+			FOREIGN KEY(topic) REFERENCES topics(name),
+			INDEX msgrevisions_topic_seqid(topic, seqid)
+		);`); err != nil {
+		return err
+	}
+
+	// Reactions to messages
+	if _, err = tx.Exec(
+		`CREATE TABLE reactions(
+			id			INT NOT NULL AUTO_INCREMENT,
+			createdat	DATETIME(3) NOT NULL,
+			topic		CHAR(25) NOT NULL,
+			seqid		INT NOT NULL,
+			userid		BIGINT NOT NULL,
+			content		VARCHAR(32) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL,
+			PRIMARY KEY(id),
+			FOREIGN KEY(topic) REFERENCES topics(name),
+			UNIQUE INDEX reactions_topic_seqid_userid_content(topic, seqid, userid, content)
 		);`); err != nil {
 		return err
 	}
@@ -512,8 +581,8 @@ func (a *adapter) AuthUpdRecord(uid t.Uid, scheme, unique string, authLvl auth.L
 		exp = &expires
 	}
 
-	_, err := a.db.Exec("UPDATE auth SET uname=?,authLvl=?,secret=?,expires=? WHERE uname=?",
-		unique, authLvl, secret, exp, unique)
+	_, err := a.db.Exec("UPDATE auth SET uname=?,authLvl=?,secret=?,expires=? WHERE userid=? AND scheme=?",
+		unique, authLvl, secret, exp, store.DecodeUid(uid), scheme)
 	if isDupe(err) {
 		return true, t.ErrDuplicate
 	}
@@ -536,8 +605,8 @@ func (a *adapter) AuthGetRecord(uid t.Uid, scheme string) (string, auth.Level, [
 		store.DecodeUid(uid), scheme)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			// Nothing found - clear the error
-			err = nil
+			// Nothing found - report it, the caller cannot use an empty record
+			err = t.ErrNotFound
 		}
 		return "", 0, nil, expires, err
 	}
@@ -576,6 +645,50 @@ func (a *adapter) AuthGetUniqueRecord(unique string) (t.Uid, auth.Level, []byte,
 	return store.EncodeUid(record.Userid), record.Authlvl, record.Secret, expires, nil
 }
 
+// AuthFailGet returns the count of failed authentication attempts for the given key.
+func (a *adapter) AuthFailGet(key string) (int, time.Time, error) {
+	var record struct {
+		Failures int
+		Lastat   time.Time
+	}
+	err := a.db.Get(&record, "SELECT failures,lastat FROM authfail WHERE name=?", key)
+	if err == sql.ErrNoRows {
+		return 0, time.Time{}, nil
+	}
+	return record.Failures, record.Lastat, err
+}
+
+// AuthFailAdd increments the count of failed authentication attempts for the given key.
+func (a *adapter) AuthFailAdd(key string, resetBefore time.Time) (int, error) {
+	tx, err := a.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// The failures are updated before lastat, so the condition uses the time of the previous failure.
+	if _, err = tx.Exec("INSERT INTO authfail(name,failures,lastat) VALUES(?,1,?) "+
+		"ON DUPLICATE KEY UPDATE failures=IF(lastat<?,1,failures+1),lastat=VALUES(lastat)",
+		key, t.TimeNow(), resetBefore); err != nil {
+		return 0, err
+	}
+	var count int
+	if err = tx.Get(&count, "SELECT failures FROM authfail WHERE name=?", key); err != nil {
+		return 0, err
+	}
+	return count, tx.Commit()
+}
+
+// AuthFailDel clears failed authentication attempts for the given key.
+func (a *adapter) AuthFailDel(key string) error {
+	_, err := a.db.Exec("DELETE FROM authfail WHERE name=?", key)
+	return err
+}
+
 // UserGet fetches a single user by user id. If user is not found it returns (nil, nil)
 func (a *adapter) UserGet(uid t.Uid) (*t.User, error) {
 	var user t.User
@@ -794,7 +907,7 @@ func (a *adapter) TopicGet(topic string) (*t.Topic, error) {
 func (a *adapter) TopicsForUser(uid t.Uid, keepDeleted bool, opts *t.QueryOpt) ([]t.Subscription, error) {
 	// Fetch user's subscriptions
 	q := `SELECT createdat,updatedat,deletedat,topic,delid,recvseqid,
-		readseqid,modewant,modegiven,private FROM subscriptions WHERE userid=?`
+		readseqid,mentioncount,modewant,modegiven,private,muteuntil,mentionsonly FROM subscriptions WHERE userid=?`
 	args := []interface{}{store.DecodeUid(uid)}
 	if !keepDeleted {
 		// Filter out rows with defined DeletedAt
@@ -939,7 +1052,7 @@ func (a *adapter) TopicsForUser(uid t.Uid, keepDeleted bool, opts *t.QueryOpt) (
 func (a *adapter) UsersForTopic(topic string, keepDeleted bool, opts *t.QueryOpt) ([]t.Subscription, error) {
 	// Fetch all subscribed users. The number of users is not large
 	q := `SELECT s.createdat,s.updatedat,s.deletedat,s.userid,s.topic,s.delid,s.recvseqid,
-		s.readseqid,s.modewant,s.modegiven,u.public,s.private
+		s.readseqid,s.mentioncount,s.modewant,s.modegiven,u.public,s.private,s.muteuntil,s.mentionsonly
 		FROM subscriptions AS s JOIN users AS u ON s.userid=u.id 
 		WHERE s.topic=?`
 	args := []interface{}{topic}
@@ -977,8 +1090,8 @@ func (a *adapter) UsersForTopic(topic string, keepDeleted bool, opts *t.QueryOpt
 		if err = rows.Scan(
 			&sub.CreatedAt, &sub.UpdatedAt, &sub.DeletedAt,
 			&sub.User, &sub.Topic, &sub.DelId, &sub.RecvSeqId,
-			&sub.ReadSeqId, &sub.ModeWant, &sub.ModeGiven,
-			&public, &sub.Private); err != nil {
+			&sub.ReadSeqId, &sub.MentionCount, &sub.ModeWant, &sub.ModeGiven,
+			&public, &sub.Private, &sub.MuteUntil, &sub.MentionsOnly); err != nil {
 			break
 		}
 
@@ -1110,7 +1223,7 @@ func (a *adapter) SubsLastSeen(topic string, user t.Uid, lastSeen map[string]tim
 // SubsForUser loads a list of user's subscriptions to topics. Does NOT load Public value.
 func (a *adapter) SubsForUser(forUser t.Uid, keepDeleted bool, opts *t.QueryOpt) ([]t.Subscription, error) {
 	q := `SELECT createdat,updatedat,deletedat,userid AS user,topic,delid,recvseqid,
-		readseqid,modewant,modegiven,private FROM subscriptions WHERE userid=?`
+		readseqid,mentioncount,modewant,modegiven,private,muteuntil,mentionsonly FROM subscriptions WHERE userid=?`
 	args := []interface{}{store.DecodeUid(forUser)}
 
 	if !keepDeleted {
@@ -1157,7 +1270,7 @@ func (a *adapter) SubsForUser(forUser t.Uid, keepDeleted bool, opts *t.QueryOpt)
 // the latter does not.
 func (a *adapter) SubsForTopic(topic string, keepDeleted bool, opts *t.QueryOpt) ([]t.Subscription, error) {
 	q := `SELECT createdat,updatedat,deletedat,userid AS user,topic,delid,recvseqid,
-		readseqid,modewant,modegiven,private FROM subscriptions WHERE topic=?`
+		readseqid,mentioncount,modewant,modegiven,private,muteuntil,mentionsonly FROM subscriptions WHERE topic=?`
 	args := []interface{}{topic}
 
 	if !keepDeleted {
@@ -1368,16 +1481,37 @@ func (a *adapter) FindTopics(req, opt []string) ([]t.Subscription, error) {
 }
 
 // Messages
-func (a *adapter) MessageSave(msg *t.Message) error {
-	res, err := a.db.Exec(
-		"INSERT INTO messages(createdAt,updatedAt,seqid,topic,`from`,head,content) VALUES(?,?,?,?,?,?,?)",
+func (a *adapter) MessageSave(msg *t.Message) (err error) {
+	tx, err := a.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	res, err := tx.Exec(
+		"INSERT INTO messages(createdAt,updatedAt,seqid,topic,`from`,head,content,replyto) VALUES(?,?,?,?,?,?,?,?)",
 		msg.CreatedAt, msg.UpdatedAt, msg.SeqId, msg.Topic,
-		store.DecodeUid(t.ParseUid(msg.From)), msg.Head, toJSON(msg.Content))
-	if err == nil {
-		id, _ := res.LastInsertId()
-		msg.SetUid(t.Uid(id))
+		store.DecodeUid(t.ParseUid(msg.From)), msg.Head, toJSON(msg.Content), msg.ReplyTo)
+	if err != nil {
+		return err
 	}
-	return err
+
+	if msg.ReplyTo > 0 {
+		// Update thread statistics of the root message.
+		if _, err = tx.Exec("UPDATE messages SET replycount=replycount+1,lastreplyat=? WHERE topic=? AND seqid=?",
+			msg.CreatedAt, msg.Topic, msg.ReplyTo); err != nil {
+			return err
+		}
+	}
+
+	id, _ := res.LastInsertId()
+	msg.SetUid(t.Uid(id))
+
+	return tx.Commit()
 }
 
 func (a *adapter) MessageGetAll(topic string, forUser t.Uid, opts *t.QueryOpt) ([]t.Message, error) {
@@ -1400,13 +1534,21 @@ func (a *adapter) MessageGetAll(topic string, forUser t.Uid, opts *t.QueryOpt) (
 	}
 
 	unum := store.DecodeUid(forUser)
-	rows, err := a.db.Queryx(
-		"SELECT m.createdat,m.updatedat,m.deletedat,m.delid,m.seqid,m.topic,m.`from`,m.head,m.content"+
-			" FROM messages AS m LEFT JOIN dellog AS d"+
-			" ON d.topic=m.topic AND m.seqid BETWEEN d.low AND d.hi AND d.deletedfor=?"+
-			" WHERE m.delid=0 AND m.topic=? AND m.seqid BETWEEN ? AND ? AND d.deletedfor IS NULL"+
-			" ORDER BY m.seqid DESC LIMIT ?",
-		unum, topic, lower, upper, limit)
+	query := "SELECT m.createdat,m.updatedat,m.deletedat,m.delid,m.seqid,m.topic,m.`from`,m.head,m.content," +
+		"m.replyto,m.replycount,m.lastreplyat" +
+		" FROM messages AS m LEFT JOIN dellog AS d" +
+		" ON d.topic=m.topic AND m.seqid BETWEEN d.low AND d.hi AND d.deletedfor=?" +
+		" WHERE m.delid=0 AND m.topic=? AND m.seqid BETWEEN ? AND ? AND d.deletedfor IS NULL"
+	args := []interface{}{unum, topic, lower, upper}
+	if opts != nil && opts.Thread > 0 {
+		// Only replies to the given message
+		query += " AND m.replyto=?"
+		args = append(args, opts.Thread)
+	}
+	query += " ORDER BY m.seqid DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := a.db.Queryx(query, args...)
 
 	if err != nil {
 		return nil, err
@@ -1424,9 +1566,160 @@ func (a *adapter) MessageGetAll(topic string, forUser t.Uid, opts *t.QueryOpt) (
 	}
 	rows.Close()
 
+	if err == nil && len(msgs) > 0 {
+		err = a.messageReactions(topic, msgs)
+	}
+	if err == nil && len(msgs) > 0 {
+		err = a.messageThreads(topic, unum, msgs)
+	}
+
 	return msgs, err
 }
 
+// messageThreads recomputes thread statistics of messages counting only the replies visible to the user,
+// i.e. not soft-deleted by the user.
+func (a *adapter) messageThreads(topic string, forUser int64, msgs []t.Message) error {
+	index := make(map[int]int)
+	args := []interface{}{forUser, topic}
+	for i := range msgs {
+		if msgs[i].ReplyCount > 0 {
+			index[msgs[i].SeqId] = i
+			args = append(args, msgs[i].SeqId)
+			msgs[i].ReplyCount = 0
+			msgs[i].LastReplyAt = nil
+		}
+	}
+	if len(index) == 0 {
+		return nil
+	}
+
+	rows, err := a.db.Query("SELECT m.replyto,COUNT(*),MAX(m.createdat) FROM messages AS m LEFT JOIN dellog AS d"+
+		" ON d.topic=m.topic AND m.seqid BETWEEN d.low AND d.hi AND d.deletedfor=?"+
+		" WHERE m.topic=? AND m.delid=0 AND d.deletedfor IS NULL"+
+		" AND m.replyto IN (?"+strings.Repeat(",?", len(index)-1)+") GROUP BY m.replyto", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var root, count int
+		var lastReplyAt *time.Time
+		if err = rows.Scan(&root, &count, &lastReplyAt); err != nil {
+			return err
+		}
+		if i, ok := index[root]; ok {
+			msgs[i].ReplyCount = count
+			msgs[i].LastReplyAt = lastReplyAt
+		}
+	}
+	return rows.Err()
+}
+
+// messageReactions fills in counts of reactions to messages. Messages must be sorted by SeqId descending.
+func (a *adapter) messageReactions(topic string, msgs []t.Message) error {
+	rows, err := a.db.Queryx("SELECT seqid,content,COUNT(*) FROM reactions WHERE topic=? AND seqid BETWEEN ? AND ?"+
+		" GROUP BY seqid,content", topic, msgs[len(msgs)-1].SeqId, msgs[0].SeqId)
+	if err != nil {
+		return err
+	}
+
+	index := make(map[int]int, len(msgs))
+	for i := range msgs {
+		index[msgs[i].SeqId] = i
+	}
+
+	var seqId, count int
+	var reaction string
+	for rows.Next() {
+		if err = rows.Scan(&seqId, &reaction, &count); err != nil {
+			break
+		}
+		if i, ok := index[seqId]; ok {
+			if msgs[i].Reactions == nil {
+				msgs[i].Reactions = make(map[string]int)
+			}
+			msgs[i].Reactions[reaction] = count
+		}
+	}
+	rows.Close()
+
+	return err
+}
+
+// MessageReactionAdd records user's reaction to a message.
+func (a *adapter) MessageReactionAdd(topic string, seqId int, user t.Uid, reaction string) error {
+	// Reactions can be added only to existing messages.
+	res, err := a.db.Exec("INSERT INTO reactions(createdat,topic,seqid,userid,content)"+
+		" SELECT ?,topic,seqid,?,? FROM messages WHERE topic=? AND seqid=? AND delid=0",
+		t.TimeNow(), store.DecodeUid(user), reaction, topic, seqId)
+	if err != nil {
+		if isDupe(err) {
+			return t.ErrDuplicate
+		}
+		return err
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return t.ErrNotFound
+	}
+	return nil
+}
+
+// MessageReactionDelete removes user's reaction to a message.
+func (a *adapter) MessageReactionDelete(topic string, seqId int, user t.Uid, reaction string) error {
+	res, err := a.db.Exec("DELETE FROM reactions WHERE topic=? AND seqid=? AND userid=? AND content=?",
+		topic, seqId, store.DecodeUid(user), reaction)
+	if err != nil {
+		return err
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return t.ErrNotFound
+	}
+	return nil
+}
+
+// MessageEdit replaces head and content of a message, saving the old version to msgrevisions.
+func (a *adapter) MessageEdit(msg *t.Message) (err error) {
+	tx, err := a.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var old struct {
+		Id      int64
+		Head    []byte
+		Content []byte
+	}
+	err = tx.Get(&old, "SELECT id,head,content FROM messages WHERE topic=? AND seqid=? AND delid=0 FOR UPDATE",
+		msg.Topic, msg.SeqId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = t.ErrNotFound
+		}
+		return err
+	}
+
+	if _, err = tx.Exec("INSERT INTO msgrevisions(createdat,topic,seqid,head,content) VALUES(?,?,?,?,?)",
+		msg.UpdatedAt, msg.Topic, msg.SeqId, old.Head, old.Content); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("UPDATE messages SET updatedat=?,head=?,content=? WHERE id=?",
+		msg.UpdatedAt, msg.Head, toJSON(msg.Content), old.Id); err != nil {
+		return err
+	}
+
+	msg.SetUid(t.Uid(old.Id))
+
+	return tx.Commit()
+}
+
 var dellog struct {
 	Topic      string
 	Deletedfor int64
@@ -1478,10 +1771,10 @@ func (a *adapter) MessageGetDeleted(topic string, forUser t.Uid, opts *t.QueryOp
 			dmsg.Topic = dellog.Topic
 			if dellog.Deletedfor > 0 {
 				dmsg.DeletedFor = store.EncodeUid(dellog.Deletedfor).String()
+			} else {
+				dmsg.DeletedFor = ""
 			}
-			if dmsg.SeqIdRanges == nil {
-				dmsg.SeqIdRanges = []t.Range{}
-			}
+			dmsg.SeqIdRanges = []t.Range{}
 		}
 		if dellog.Hi <= dellog.Low+1 {
 			dellog.Hi = 0
@@ -1512,6 +1805,12 @@ func (a *adapter) MessageDeleteList(topic string, toDel *t.DelMessage) (err erro
 	if toDel == nil {
 		// Whole topic is being deleted, thus also deleting all messages.
 		_, err = tx.Exec("DELETE FROM dellog WHERE topic=?", topic)
+		if err == nil {
+			_, err = tx.Exec("DELETE FROM msgrevisions WHERE topic=?", topic)
+		}
+		if err == nil {
+			_, err = tx.Exec("DELETE FROM reactions WHERE topic=?", topic)
+		}
 		if err == nil {
 			_, err = tx.Exec("DELETE FROM messages WHERE topic=?", topic)
 		}
@@ -1562,6 +1861,17 @@ func (a *adapter) MessageDeleteList(topic string, toDel *t.DelMessage) (err erro
 				// MySQL's BETWEEN is inclusive-inclusive thus decrement Hi by 1.
 				args = append(args, toDel.SeqIdRanges[0].Low, toDel.SeqIdRanges[0].Hi-1)
 			}
+
+			// Earlier revisions of and reactions to hard-deleted messages are deleted too.
+			_, err = tx.Exec("DELETE m.* FROM msgrevisions AS m WHERE "+where, args...)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec("DELETE m.* FROM reactions AS m WHERE "+where, args...)
+			if err != nil {
+				return err
+			}
+
 			where += " AND m.deletedAt IS NULL"
 
 			_, err = tx.Exec("DELETE fml.* FROM filemsglinks AS fml INNER JOIN messages AS m ON m.id=fml.msgid WHERE "+
@@ -1570,9 +1880,18 @@ func (a *adapter) MessageDeleteList(topic string, toDel *t.DelMessage) (err erro
 				return err
 			}
 
-			_, err = tx.Exec("UPDATE messages AS m SET m.deletedAt=?,m.delId=?,m.head=NULL,m.content=NULL WHERE "+
+			// Threads which lose replies need their statistics recomputed.
+			var roots []int
+			if roots, err = threadRoots(tx, where, args); err != nil {
+				return err
+			}
+
+			_, err = tx.Exec("UPDATE messages AS m SET m.deletedAt=?,m.delId=?,m.head=NULL,m.content=NULL,m.searchtext=NULL WHERE "+
 				where,
 				append([]interface{}{t.TimeNow(), toDel.DelId}, args...)...)
+			if err == nil {
+				err = recountReplies(tx, topic, roots)
+			}
 		}
 	}
 
@@ -1583,6 +1902,42 @@ func (a *adapter) MessageDeleteList(topic string, toDel *t.DelMessage) (err erro
 	return tx.Commit()
 }
 
+// threadRoots returns SeqIds of the messages which have replies among the messages matching the condition.
+func threadRoots(tx *sql.Tx, where string, args []interface{}) ([]int, error) {
+	rows, err := tx.Query("SELECT DISTINCT m.replyto FROM messages AS m WHERE "+where+" AND m.replyto>0", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roots []int
+	for rows.Next() {
+		var root int
+		if err = rows.Scan(&root); err != nil {
+			return nil, err
+		}
+		roots = append(roots, root)
+	}
+	return roots, rows.Err()
+}
+
+// recountReplies recomputes thread statistics of the root messages from the replies which are not hard-deleted.
+func recountReplies(tx *sql.Tx, topic string, roots []int) error {
+	for _, root := range roots {
+		var count int
+		var lastReplyAt *time.Time
+		if err := tx.QueryRow("SELECT COUNT(*),MAX(createdat) FROM messages WHERE topic=? AND replyto=? AND delid=0",
+			topic, root).Scan(&count, &lastReplyAt); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE messages SET replycount=?,lastreplyat=? WHERE topic=? AND seqid=?",
+			count, lastReplyAt, topic, root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // MessageAttachments connects given message to a list of file record IDs.
 func (a *adapter) MessageAttachments(msgId t.Uid, fids []string) error {
 	var args []interface{}
@@ -1626,6 +1981,84 @@ func (a *adapter) MessageAttachments(msgId t.Uid, fids []string) error {
 	return tx.Commit()
 }
 
+// MessageIndex saves words of the message into a column with a FULLTEXT index.
+func (a *adapter) MessageIndex(topic string, seqId int, words []string) error {
+	_, err := a.db.Exec("UPDATE messages SET searchtext=? WHERE topic=? AND seqid=?",
+		strings.Join(words, " "), topic, seqId)
+	return err
+}
+
+// MessageSearch finds messages which contain all the words using the FULLTEXT index.
+func (a *adapter) MessageSearch(topics []string, forUser t.Uid, words []string,
+	opts *t.QueryOpt) ([]t.Message, error) {
+
+	if len(topics) == 0 || len(words) == 0 {
+		return nil, nil
+	}
+
+	var limit = maxResults
+	var lower = 0
+	var upper = 1 << 31
+
+	if opts != nil {
+		if opts.Since > 0 {
+			lower = opts.Since
+		}
+		if opts.Before > 0 {
+			upper = opts.Before - 1
+		}
+		if opts.Limit > 0 && opts.Limit < limit {
+			limit = opts.Limit
+		}
+	}
+
+	args := []interface{}{store.DecodeUid(forUser), topics, lower, upper}
+	var cond string
+	var indexed []string
+	for _, word := range words {
+		if len([]rune(word)) >= a.ftMinToken {
+			indexed = append(indexed, word)
+			continue
+		}
+		// Words shorter than innodb_ft_min_token_size are not in the FULLTEXT index: match them
+		// against the space-separated list of words.
+		cond += " AND CONCAT(' ',m.searchtext,' ') LIKE ?"
+		args = append(args, "% "+word+" %")
+	}
+	if len(indexed) > 0 {
+		// Boolean mode: each word is required.
+		cond += " AND MATCH(m.searchtext) AGAINST(? IN BOOLEAN MODE)"
+		args = append(args, "+"+strings.Join(indexed, " +"))
+	}
+
+	q, args, _ := sqlx.In(
+		"SELECT m.createdat,m.updatedat,m.deletedat,m.delid,m.seqid,m.topic,m.`from`,m.head,m.content,"+
+			"m.replyto,m.replycount,m.lastreplyat"+
+			" FROM messages AS m LEFT JOIN dellog AS d"+
+			" ON d.topic=m.topic AND m.seqid BETWEEN d.low AND d.hi AND d.deletedfor=?"+
+			" WHERE m.delid=0 AND m.topic IN (?) AND m.seqid BETWEEN ? AND ? AND d.deletedfor IS NULL"+
+			cond+" ORDER BY m.createdat DESC LIMIT ?",
+		append(args, limit)...)
+	rows, err := a.db.Queryx(a.db.Rebind(q), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []t.Message
+	var msg t.Message
+	for rows.Next() {
+		if err = rows.StructScan(&msg); err != nil {
+			break
+		}
+		msg.From = encodeString(msg.From).String()
+		msg.Content = fromJSON(msg.Content)
+		msgs = append(msgs, msg)
+	}
+	rows.Close()
+
+	return msgs, err
+}
+
 func deviceHasher(deviceID string) string {
 	// Generate custom key as [64-bit hash of device id] to ensure predictable
 	// length of the key
@@ -1729,6 +2162,20 @@ func (a *adapter) CredAdd(cred *t.Credential) error {
 	return err
 }
 
+// CredGetOwner returns ID of the user who has confirmed the credential.
+func (a *adapter) CredGetOwner(method, value string) (t.Uid, error) {
+	var userId int64
+	err := a.db.Get(&userId, "SELECT userid FROM credentials WHERE synthetic=? AND done=1", method+":"+value)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// Nothing found - clear the error
+			err = nil
+		}
+		return t.ZeroUid, err
+	}
+	return store.EncodeUid(userId), nil
+}
+
 func (a *adapter) CredIsConfirmed(uid t.Uid, method string) (bool, error) {
 	var done int
 	err := a.db.Get(&done, "SELECT done FROM credentials WHERE userid=? AND method=?",
@@ -1741,12 +2188,16 @@ func (a *adapter) CredIsConfirmed(uid t.Uid, method string) (bool, error) {
 	return done > 0, err
 }
 
-func (a *adapter) CredDel(uid t.Uid, method string) error {
+func (a *adapter) CredDel(uid t.Uid, method, value string) error {
 	query := "DELETE FROM credentials WHERE userid=?"
 	args := []interface{}{store.DecodeUid(uid)}
 	if method != "" {
 		query += " AND method=?"
 		args = append(args, method)
+		if value != "" {
+			query += " AND value=?"
+			args = append(args, value)
+		}
 	}
 	_, err := a.db.Exec(query, args...)
 	return err
@@ -0,0 +1,180 @@
+// +build mysql
+
+package mysql
+
+import (
+	"strings"
+
+	"github.com/nanfengpo/chat/server/db/migrate"
+	"github.com/nanfengpo/chat/server/search"
+	t "github.com/nanfengpo/chat/server/store/types"
+)
+
+// Number of messages indexed at once when upgrading to version 109.
+const indexBatchSize = 1000
+
+// Steps of the schema upgrade starting with version 105. A new step must be added every time
+// dbVersion is changed.
+func (a *adapter) migrations() []migrate.Step {
+	return []migrate.Step{
+		{Version: 106, Desc: "add table of message revisions", Apply: func() error {
+			_, err := a.db.Exec(
+				`CREATE TABLE IF NOT EXISTS msgrevisions(
+					id			INT NOT NULL AUTO_INCREMENT,
+					createdat	DATETIME(3) NOT NULL,
+					topic		CHAR(25) NOT NULL,
+					seqid		INT NOT NULL,
+					head		JSON,
+					content		JSON,
+					PRIMARY KEY(id),
+					FOREIGN KEY(topic) REFERENCES topics(name),
+					INDEX msgrevisions_topic_seqid(topic, seqid)
+				);`)
+			return err
+		}},
+		{Version: 107, Desc: "add table of reactions", Apply: func() error {
+			_, err := a.db.Exec(
+				`CREATE TABLE IF NOT EXISTS reactions(
+					id			INT NOT NULL AUTO_INCREMENT,
+					createdat	DATETIME(3) NOT NULL,
+					topic		CHAR(25) NOT NULL,
+					seqid		INT NOT NULL,
+					userid		BIGINT NOT NULL,
+					content		VARCHAR(32) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL,
+					PRIMARY KEY(id),
+					FOREIGN KEY(topic) REFERENCES topics(name),
+					UNIQUE INDEX reactions_topic_seqid_userid_content(topic, seqid, userid, content)
+				);`)
+			return err
+		}},
+		{Version: 108, Desc: "add columns and index of replies to messages", Apply: func() error {
+			_, err := a.db.Exec(
+				`ALTER TABLE messages
+					ADD COLUMN replyto INT DEFAULT 0,
+					ADD COLUMN replycount INT DEFAULT 0,
+					ADD COLUMN lastreplyat DATETIME(3),
+					ADD INDEX messages_topic_replyto_seqid(topic, replyto, seqid);`)
+			return err
+		}},
+		{Version: 109, Desc: "add full-text index of messages and index existing messages", Apply: func() error {
+			// The step is repeated if indexing of existing messages is interrupted.
+			var exists int
+			if err := a.db.Get(&exists, "SELECT COUNT(*) FROM information_schema.columns "+
+				"WHERE table_schema=DATABASE() AND table_name='messages' AND column_name='searchtext'"); err != nil {
+				return err
+			}
+			if exists == 0 {
+				if err := a.addSearchIndex(); err != nil {
+					return err
+				}
+			}
+			return a.indexMessages()
+		}},
+		{Version: 110, Desc: "add table of failed authentication attempts", Apply: func() error {
+			_, err := a.db.Exec(
+				`CREATE TABLE IF NOT EXISTS authfail(
+					name		VARCHAR(96) NOT NULL,
+					failures	INT NOT NULL DEFAULT 0,
+					lastat		DATETIME(3) NOT NULL,
+					PRIMARY KEY(name)
+				);`)
+			return err
+		}},
+		{Version: 111, Desc: "add columns of notification preferences", Apply: func() error {
+			if _, err := a.db.Exec(`ALTER TABLE users ADD COLUMN quiethours VARCHAR(64) DEFAULT '';`); err != nil {
+				return err
+			}
+			_, err := a.db.Exec(
+				`ALTER TABLE subscriptions
+					ADD COLUMN muteuntil DATETIME(3),
+					ADD COLUMN mentionsonly BOOLEAN DEFAULT FALSE;`)
+			return err
+		}},
+		{Version: 112, Desc: "add counter of unread mentions to subscriptions", Apply: func() error {
+			_, err := a.db.Exec(`ALTER TABLE subscriptions ADD COLUMN mentioncount INT DEFAULT 0;`)
+			return err
+		}},
+	}
+}
+
+// UpgradeDb upgrades the database to dbVersion one step at a time. MySQL cannot roll back changes
+// of the schema, so the version is saved after every step.
+func (a *adapter) UpgradeDb(dryRun bool) ([]string, error) {
+	version, err := a.getDbVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.Run(a.migrations(), version, dbVersion, func(vers int) error {
+		if _, err := a.db.Exec("UPDATE kvmeta SET `value`=? WHERE `key`='version'", vers); err != nil {
+			return err
+		}
+		a.version = vers
+		return nil
+	}, dryRun)
+}
+
+// addSearchIndex adds the column with words of messages and the FULLTEXT index on it.
+func (a *adapter) addSearchIndex() error {
+	// The FULLTEXT index is created without stopwords. The session variable must be set
+	// on the same connection, thus the transaction.
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec("SET SESSION innodb_ft_enable_stopword=OFF"); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(
+		`ALTER TABLE messages
+			ADD COLUMN searchtext TEXT,
+			ADD FULLTEXT INDEX messages_searchtext(searchtext);`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// indexMessages saves words of the messages which are not indexed yet, so messages sent before
+// the upgrade can be found too.
+func (a *adapter) indexMessages() error {
+	lastId := 0
+	for {
+		rows, err := a.db.Queryx("SELECT id,content FROM messages WHERE id>? AND delid=0 AND searchtext IS NULL "+
+			"ORDER BY id LIMIT ?", lastId, indexBatchSize)
+		if err != nil {
+			return err
+		}
+
+		words := make(map[int]string)
+		count := 0
+		for rows.Next() {
+			var id int
+			var content interface{}
+			if err = rows.Scan(&id, &content); err != nil {
+				break
+			}
+			lastId = id
+			count++
+			if list := search.MessageWords(&t.Message{Content: fromJSON(content)}); len(list) > 0 {
+				words[id] = strings.Join(list, " ")
+			}
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		for id, text := range words {
+			if _, err = a.db.Exec("UPDATE messages SET searchtext=? WHERE id=?", text, id); err != nil {
+				return err
+			}
+		}
+		if count < indexBatchSize {
+			return nil
+		}
+	}
+}
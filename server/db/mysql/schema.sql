@@ -24,6 +24,7 @@ CREATE TABLE users(
 	useragent 	VARCHAR(255) DEFAULT '',
 	public 		JSON,
 	tags		JSON, -- Denormalized array of tags
+	quiethours	VARCHAR(64) DEFAULT '',
 	
 	PRIMARY KEY(id)
 );
@@ -71,6 +72,16 @@ CREATE TABLE auth(
 );
 
 
+# Failed authentication attempts by login or remote address.
+CREATE TABLE authfail(
+	name		VARCHAR(96) NOT NULL,
+	failures	INT NOT NULL DEFAULT 0,
+	lastat		DATETIME(3) NOT NULL,
+
+	PRIMARY KEY(name)
+);
+
+
 # Topics
 CREATE TABLE topics(
 	id 			INT NOT NULL AUTO_INCREMENT,
@@ -112,9 +123,12 @@ CREATE TABLE subscriptions(
 	delid      INT DEFAULT 0,
 	recvseqid  INT DEFAULT 0,
 	readseqid  INT DEFAULT 0,
+	mentioncount INT DEFAULT 0,
 	modewant	CHAR(8),
 	modegiven  	CHAR(8),
 	private 	JSON,
+	muteuntil 	DATETIME(3),
+	mentionsonly BOOLEAN DEFAULT FALSE,
 	
 	PRIMARY KEY(id)	,
 	FOREIGN KEY(userid) REFERENCES users(id),
@@ -122,7 +136,8 @@ CREATE TABLE subscriptions(
 	INDEX subscriptions_topic (topic)
 );
 
-# Messages
+# Messages. The FULLTEXT index must be created without stopwords.
+SET SESSION innodb_ft_enable_stopword=OFF;
 CREATE TABLE messages(
 	id 			INT NOT NULL AUTO_INCREMENT,
 	createdat 	DATETIME(3) NOT NULL,
@@ -134,11 +149,45 @@ CREATE TABLE messages(
 	`from` 		BIGINT NOT NULL,
 	head 		JSON,
 	content 	JSON,
+	replyto		INT DEFAULT 0,
+	replycount	INT DEFAULT 0,
+	lastreplyat	DATETIME(3),
+	searchtext	TEXT,
 	
 	PRIMARY KEY(id),
 	FOREIGN KEY(`from`) REFERENCES users(id),
 	FOREIGN KEY(topic) REFERENCES topics(name),
-	UNIQUE INDEX messages_topic_seqid (topic, seqid)
+	UNIQUE INDEX messages_topic_seqid (topic, seqid),
+	INDEX messages_topic_replyto_seqid (topic, replyto, seqid),
+	FULLTEXT INDEX messages_searchtext (searchtext)
+);
+
+# Earlier revisions of edited messages
+CREATE TABLE msgrevisions(
+	id			INT NOT NULL AUTO_INCREMENT,
+	createdat	DATETIME(3) NOT NULL,
+	topic		CHAR(25) NOT NULL,
+	seqid		INT NOT NULL,
+	head		JSON,
+	content		JSON,
+
+	PRIMARY KEY(id),
+	FOREIGN KEY(topic) REFERENCES topics(name),
+	INDEX msgrevisions_topic_seqid (topic, seqid)
+);
+
+# Reactions to messages
+CREATE TABLE reactions(
+	id			INT NOT NULL AUTO_INCREMENT,
+	createdat	DATETIME(3) NOT NULL,
+	topic		CHAR(25) NOT NULL,
+	seqid		INT NOT NULL,
+	userid		BIGINT NOT NULL,
+	content		VARCHAR(32) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL,
+
+	PRIMARY KEY(id),
+	FOREIGN KEY(topic) REFERENCES topics(name),
+	UNIQUE INDEX reactions_topic_seqid_userid_content (topic, seqid, userid, content)
 );
 
 # Deletion log
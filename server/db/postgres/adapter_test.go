@@ -0,0 +1,31 @@
+// +build postgres
+
+package postgres
+
+import (
+	"os"
+	"testing"
+
+	"github.com/nanfengpo/chat/server/db/adaptertest"
+)
+
+// The test needs a running server. The database named in the config is dropped and re-created,
+// don't point it to a database with any data, e.g.
+// TEST_POSTGRES_CONFIG='{"database": "tinode_test", ...}' go test -tags postgres
+func TestConformance(t *testing.T) {
+	config := os.Getenv("TEST_POSTGRES_CONFIG")
+	if config == "" {
+		t.Skip("TEST_POSTGRES_CONFIG is not set")
+	}
+
+	adp := &adapter{}
+	if err := adp.Open(config); err != nil {
+		t.Fatal(err)
+	}
+	defer adp.Close()
+	if err := adp.CreateDb(true); err != nil {
+		t.Fatal(err)
+	}
+
+	adaptertest.Run(t, adp)
+}
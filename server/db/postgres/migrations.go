@@ -0,0 +1,55 @@
+// +build postgres
+
+package postgres
+
+import (
+	"github.com/nanfengpo/chat/server/db/migrate"
+)
+
+// Steps of the schema upgrade starting with version 109 which introduced the adapter. A new step must
+// be added every time dbVersion is changed.
+func (a *adapter) migrations() []migrate.Step {
+	return []migrate.Step{
+		{Version: 110, Desc: "add table of failed authentication attempts", Apply: func() error {
+			_, err := a.db.Exec(
+				`CREATE TABLE IF NOT EXISTS authfail(
+					name		VARCHAR(96) NOT NULL,
+					failures	INT NOT NULL DEFAULT 0,
+					lastat		TIMESTAMP(3) NOT NULL,
+					PRIMARY KEY(name)
+				);`)
+			return err
+		}},
+		{Version: 111, Desc: "add columns of notification preferences", Apply: func() error {
+			if _, err := a.db.Exec(`ALTER TABLE users ADD COLUMN quiethours VARCHAR(64) DEFAULT '';`); err != nil {
+				return err
+			}
+			_, err := a.db.Exec(
+				`ALTER TABLE subscriptions
+					ADD COLUMN muteuntil TIMESTAMP(3),
+					ADD COLUMN mentionsonly BOOLEAN DEFAULT FALSE;`)
+			return err
+		}},
+		{Version: 112, Desc: "add counter of unread mentions to subscriptions", Apply: func() error {
+			_, err := a.db.Exec(`ALTER TABLE subscriptions ADD COLUMN mentioncount INT DEFAULT 0;`)
+			return err
+		}},
+	}
+}
+
+// UpgradeDb upgrades the database to dbVersion one step at a time. The version is saved after
+// every step.
+func (a *adapter) UpgradeDb(dryRun bool) ([]string, error) {
+	version, err := a.getDbVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.Run(a.migrations(), version, dbVersion, func(vers int) error {
+		if _, err := a.db.Exec("UPDATE kvmeta SET value=$1 WHERE key='version'", vers); err != nil {
+			return err
+		}
+		a.version = vers
+		return nil
+	}, dryRun)
+}
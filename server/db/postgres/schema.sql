@@ -0,0 +1,255 @@
+DROP DATABASE IF EXISTS nanfengpo;
+
+CREATE DATABASE nanfengpo ENCODING 'UTF8';
+
+\c nanfengpo
+
+
+CREATE TABLE kvmeta(
+	key 	VARCHAR(32),
+	value 	TEXT,
+	PRIMARY KEY(key)
+);
+
+INSERT INTO kvmeta(key, value) VALUES('version', '112');
+
+CREATE TABLE users(
+	id 			BIGINT NOT NULL,
+	createdat 	TIMESTAMP(3) NOT NULL,
+	updatedat 	TIMESTAMP(3) NOT NULL,
+	deletedat 	TIMESTAMP(3),
+	state 		INT DEFAULT 0,
+	access 		JSONB,
+	lastseen 	TIMESTAMP,
+	useragent 	VARCHAR(255) DEFAULT '',
+	public 		JSONB,
+	tags		JSONB, -- Denormalized array of tags
+	quiethours	VARCHAR(64) DEFAULT '',
+
+	PRIMARY KEY(id)
+);
+
+-- Indexed user tags.
+CREATE TABLE usertags(
+	id 		SERIAL,
+	userid 	BIGINT NOT NULL,
+	tag 	VARCHAR(96) NOT NULL,
+
+	PRIMARY KEY(id),
+	FOREIGN KEY(userid) REFERENCES users(id)
+);
+CREATE INDEX usertags_tag ON usertags(tag);
+
+-- Indexed devices. Normalized into a separate table.
+CREATE TABLE devices(
+	id 			SERIAL,
+	userid 		BIGINT NOT NULL,
+	hash 		VARCHAR(16) NOT NULL,
+	deviceid 	TEXT NOT NULL,
+	platform	VARCHAR(32),
+	lastseen 	TIMESTAMP NOT NULL,
+	lang 		VARCHAR(8),
+
+	PRIMARY KEY(id),
+	FOREIGN KEY(userid) REFERENCES users(id)
+);
+CREATE UNIQUE INDEX devices_hash ON devices(hash);
+
+-- Authentication records for the basic authentication scheme.
+CREATE TABLE auth(
+	id 		SERIAL,
+	uname	VARCHAR(32) NOT NULL,
+	userid 	BIGINT NOT NULL,
+	scheme	VARCHAR(16) NOT NULL,
+	authlvl	INT NOT NULL,
+	secret 	BYTEA NOT NULL,
+	expires TIMESTAMP,
+
+	PRIMARY KEY(id),
+	FOREIGN KEY(userid) REFERENCES users(id)
+);
+CREATE UNIQUE INDEX auth_userid_scheme ON auth(userid, scheme);
+CREATE UNIQUE INDEX auth_uname ON auth(uname);
+
+
+-- Failed authentication attempts by login or remote address.
+CREATE TABLE authfail(
+	name		VARCHAR(96) NOT NULL,
+	failures	INT NOT NULL DEFAULT 0,
+	lastat		TIMESTAMP(3) NOT NULL,
+
+	PRIMARY KEY(name)
+);
+
+
+-- Topics
+CREATE TABLE topics(
+	id 			SERIAL,
+	createdat 	TIMESTAMP(3) NOT NULL,
+	updatedat 	TIMESTAMP(3) NOT NULL,
+	deletedat 	TIMESTAMP(3),
+	touchedat 	TIMESTAMP(3),
+	name 		VARCHAR(25) NOT NULL,
+	usebt 		INT DEFAULT 0,
+	access 		JSONB,
+	seqid 		INT NOT NULL DEFAULT 0,
+	delid 		INT DEFAULT 0,
+	public 		JSONB,
+	tags		JSONB, -- Denormalized array of tags
+
+	PRIMARY KEY(id)
+);
+CREATE UNIQUE INDEX topics_name ON topics(name);
+
+-- Indexed topic tags.
+CREATE TABLE topictags(
+	id 		SERIAL,
+	topic 	VARCHAR(25) NOT NULL,
+	tag 	VARCHAR(96) NOT NULL,
+
+	PRIMARY KEY(id),
+	FOREIGN KEY(topic) REFERENCES topics(name)
+);
+CREATE INDEX topictags_tag ON topictags(tag);
+
+-- Subscriptions
+CREATE TABLE subscriptions(
+	id 			SERIAL,
+	createdat 	TIMESTAMP(3) NOT NULL,
+	updatedat 	TIMESTAMP(3) NOT NULL,
+	deletedat 	TIMESTAMP(3),
+	userid 		BIGINT NOT NULL,
+	topic 		VARCHAR(25) NOT NULL,
+	delid		INT DEFAULT 0,
+	recvseqid	INT DEFAULT 0,
+	readseqid	INT DEFAULT 0,
+	mentioncount INT DEFAULT 0,
+	modewant	VARCHAR(8),
+	modegiven	VARCHAR(8),
+	private 	JSONB,
+	muteuntil 	TIMESTAMP(3),
+	mentionsonly BOOLEAN DEFAULT FALSE,
+
+	PRIMARY KEY(id),
+	FOREIGN KEY(userid) REFERENCES users(id)
+);
+CREATE UNIQUE INDEX subscriptions_topic_userid ON subscriptions(topic, userid);
+CREATE INDEX subscriptions_topic ON subscriptions(topic);
+
+-- Messages
+CREATE TABLE messages(
+	id 			SERIAL,
+	createdat 	TIMESTAMP(3) NOT NULL,
+	updatedat 	TIMESTAMP(3) NOT NULL,
+	deletedat 	TIMESTAMP(3),
+	delid 		INT DEFAULT 0,
+	seqid 		INT NOT NULL,
+	topic 		VARCHAR(25) NOT NULL,
+	"from" 		BIGINT NOT NULL,
+	head 		JSONB,
+	content 	JSONB,
+	replyto		INT DEFAULT 0,
+	replycount	INT DEFAULT 0,
+	lastreplyat	TIMESTAMP(3),
+	searchtext	TEXT,
+
+	PRIMARY KEY(id),
+	FOREIGN KEY("from") REFERENCES users(id),
+	FOREIGN KEY(topic) REFERENCES topics(name)
+);
+CREATE UNIQUE INDEX messages_topic_seqid ON messages(topic, seqid);
+CREATE INDEX messages_topic_replyto_seqid ON messages(topic, replyto, seqid);
+-- Full-text index. Queries must use the same expression to hit the index.
+CREATE INDEX messages_searchtext ON messages USING GIN(to_tsvector('simple', searchtext));
+
+-- Earlier revisions of edited messages
+CREATE TABLE msgrevisions(
+	id			SERIAL,
+	createdat	TIMESTAMP(3) NOT NULL,
+	topic		VARCHAR(25) NOT NULL,
+	seqid		INT NOT NULL,
+	head		JSONB,
+	content		JSONB,
+
+	PRIMARY KEY(id),
+	FOREIGN KEY(topic) REFERENCES topics(name)
+);
+CREATE INDEX msgrevisions_topic_seqid ON msgrevisions(topic, seqid);
+
+-- Reactions to messages
+CREATE TABLE reactions(
+	id			SERIAL,
+	createdat	TIMESTAMP(3) NOT NULL,
+	topic		VARCHAR(25) NOT NULL,
+	seqid		INT NOT NULL,
+	userid		BIGINT NOT NULL,
+	content		VARCHAR(32) NOT NULL,
+
+	PRIMARY KEY(id),
+	FOREIGN KEY(topic) REFERENCES topics(name)
+);
+CREATE UNIQUE INDEX reactions_topic_seqid_userid_content ON reactions(topic, seqid, userid, content);
+
+-- Deletion log
+CREATE TABLE dellog(
+	id			SERIAL,
+	topic		VARCHAR(25) NOT NULL,
+	deletedfor	BIGINT NOT NULL DEFAULT 0,
+	delid		INT NOT NULL,
+	low			INT NOT NULL,
+	hi			INT NOT NULL,
+
+	PRIMARY KEY(id),
+	FOREIGN KEY(topic) REFERENCES topics(name)
+);
+-- For getting the list of deleted message ranges
+CREATE INDEX dellog_topic_delid_deletedfor ON dellog(topic, delid, deletedfor);
+-- Used when getting not-yet-deleted messages(messages LEFT JOIN dellog)
+CREATE INDEX dellog_topic_deletedfor_low_hi ON dellog(topic, deletedfor, low, hi);
+-- Used when deleting a user
+CREATE INDEX dellog_deletedfor ON dellog(deletedfor);
+
+-- User credentials
+CREATE TABLE credentials(
+	id			SERIAL,
+	createdat 	TIMESTAMP(3) NOT NULL,
+	updatedat 	TIMESTAMP(3) NOT NULL,
+	method 		VARCHAR(16) NOT NULL,
+	value		VARCHAR(128) NOT NULL,
+	synthetic	VARCHAR(192) NOT NULL,
+	userid 		BIGINT NOT NULL,
+	resp		VARCHAR(255),
+	done		BOOLEAN NOT NULL DEFAULT FALSE,
+	retries		INT NOT NULL DEFAULT 0,
+
+	PRIMARY KEY(id),
+	FOREIGN KEY(userid) REFERENCES users(id)
+);
+CREATE UNIQUE INDEX credentials_uniqueness ON credentials(synthetic);
+
+-- Records of uploaded files. Files themselves are stored elsewhere.
+CREATE TABLE fileuploads(
+	id			BIGINT NOT NULL,
+	createdat	TIMESTAMP(3) NOT NULL,
+	updatedat	TIMESTAMP(3) NOT NULL,
+	userid		BIGINT NOT NULL,
+	status		INT NOT NULL,
+	mimetype	VARCHAR(255) NOT NULL,
+	size		BIGINT NOT NULL,
+	location	VARCHAR(2048) NOT NULL,
+
+	PRIMARY KEY(id),
+	FOREIGN KEY(userid) REFERENCES users(id)
+);
+
+-- Links between uploaded files and messages.
+CREATE TABLE filemsglinks(
+	id			SERIAL,
+	createdat	TIMESTAMP(3) NOT NULL,
+	fileid		BIGINT NOT NULL,
+	msgid		INT NOT NULL,
+
+	PRIMARY KEY(id),
+	FOREIGN KEY(fileid) REFERENCES fileuploads(id) ON DELETE CASCADE,
+	FOREIGN KEY(msgid) REFERENCES messages(id) ON DELETE CASCADE
+);
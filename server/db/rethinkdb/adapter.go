@@ -27,7 +27,7 @@ const (
 	defaultHost     = "localhost:28015"
 	defaultDatabase = "nanfengpo"
 
-	dbVersion = 105
+	dbVersion = 110
 
 	adapterName = "rethinkdb"
 )
@@ -157,6 +157,10 @@ func (a *adapter) CheckDbVersion() error {
 		a.getDbVersion()
 	}
 
+	if a.version > 0 && a.version < dbVersion {
+		return errors.New("Outdated database version " + strconv.Itoa(a.version) +
+			". Expected " + strconv.Itoa(dbVersion) + ", run 'tinode-db -upgrade'")
+	}
 	if a.version != dbVersion {
 		return errors.New("Invalid database version " + strconv.Itoa(a.version) +
 			". Expected " + strconv.Itoa(dbVersion))
@@ -221,6 +225,11 @@ func (a *adapter) CreateDb(reset bool) error {
 		return err
 	}
 
+	// Failed authentication attempts {Id, Failures, LastAt}. Id is "login:" + login or "ip:" + address.
+	if _, err := rdb.DB(a.dbName).TableCreate("authfail", rdb.TableCreateOpts{PrimaryKey: "Id"}).RunWrite(a.conn); err != nil {
+		return err
+	}
+
 	// Subscription to a topic. The primary key is a Topic:User string
 	if _, err := rdb.DB(a.dbName).TableCreate("subscriptions", rdb.TableCreateOpts{PrimaryKey: "Id"}).RunWrite(a.conn); err != nil {
 		return err
@@ -252,6 +261,13 @@ func (a *adapter) CreateDb(reset bool) error {
 		}).RunWrite(a.conn); err != nil {
 		return err
 	}
+	// Compound index of replies to messages
+	if _, err := rdb.DB(a.dbName).Table("messages").IndexCreateFunc("Topic_ReplyTo_SeqId",
+		func(row rdb.Term) interface{} {
+			return []interface{}{row.Field("Topic"), row.Field("ReplyTo").Default(0), row.Field("SeqId")}
+		}).RunWrite(a.conn); err != nil {
+		return err
+	}
 	// Compound index of hard-deleted messages
 	if _, err := rdb.DB(a.dbName).Table("messages").IndexCreateFunc("Topic_DelId",
 		func(row rdb.Term) interface{} {
@@ -458,6 +474,54 @@ func (a *adapter) AuthGetUniqueRecord(unique string) (t.Uid, auth.Level, []byte,
 	return t.ParseUid(record.Userid), record.AuthLvl, record.Secret, record.Expires, nil
 }
 
+// AuthFailGet returns the count of failed authentication attempts for the given key.
+func (a *adapter) AuthFailGet(key string) (int, time.Time, error) {
+	cursor, err := rdb.DB(a.dbName).Table("authfail").Get(key).Run(a.conn)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return 0, time.Time{}, nil
+	}
+
+	var record struct {
+		Failures int
+		LastAt   time.Time
+	}
+	if err = cursor.One(&record); err != nil {
+		return 0, time.Time{}, err
+	}
+	return record.Failures, record.LastAt, nil
+}
+
+// AuthFailAdd increments the count of failed authentication attempts for the given key.
+func (a *adapter) AuthFailAdd(key string, resetBefore time.Time) (int, error) {
+	now := t.TimeNow()
+	// Replace with a function is atomic: it either creates the record or updates the existing one.
+	resp, err := rdb.DB(a.dbName).Table("authfail").Get(key).Replace(func(row rdb.Term) interface{} {
+		return rdb.Branch(row.Eq(nil).Or(row.Field("LastAt").Lt(resetBefore)),
+			map[string]interface{}{"Id": key, "Failures": 1, "LastAt": now},
+			row.Merge(map[string]interface{}{"Failures": row.Field("Failures").Add(1), "LastAt": now}))
+	}, rdb.ReplaceOpts{ReturnChanges: true}).RunWrite(a.conn)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.Changes) == 0 {
+		return 0, t.ErrInternal
+	}
+	record, _ := resp.Changes[0].NewValue.(map[string]interface{})
+	count, _ := record["Failures"].(float64)
+	return int(count), nil
+}
+
+// AuthFailDel clears failed authentication attempts for the given key.
+func (a *adapter) AuthFailDel(key string) error {
+	_, err := rdb.DB(a.dbName).Table("authfail").Get(key).Delete().RunWrite(a.conn)
+	return err
+}
+
 // UserGet fetches a single user by user id. If user is not found it returns (nil, nil)
 func (a *adapter) UserGet(uid t.Uid) (*t.User, error) {
 	cursor, err := rdb.DB(a.dbName).Table("users").Get(uid.String()).Run(a.conn)
@@ -989,8 +1053,7 @@ func (a *adapter) FindUsers(uid t.Uid, req, opt []string) ([]t.Subscription, err
 		allTags = append(allTags, tag)
 		index[tag] = struct{}{}
 	}
-	// Query for selecting matches where every group includes at least one required match (restricting search to
-	// group members).
+	// Query for selecting matches which include all required tags (restricting search to group members).
 	/*
 		r.db('nanfengpo').
 			table('users').
@@ -998,7 +1061,7 @@ func (a *adapter) FindUsers(uid t.Uid, req, opt []string) ([]t.Subscription, err
 			pluck("Id", "Access", "CreatedAt", "UpdatedAt", "Public", "Tags").
 			group("Id").ungroup().
 			map(function(row) { return row.getField('reduction').nth(0).merge({matchedCount: row.getField('reduction').count()}); }).
-			filter(function(row) { return row.getField("Tags").setIntersection([<required tags here>]).count().ne(0); }).
+			filter(function(row) { return row.getField("Tags").setIntersection([<required tags here>]).count().eq(<count of required tags>); }).
 			orderBy(r.desc('matchedCount')).
 			limit(20);
 	*/
@@ -1022,7 +1085,7 @@ func (a *adapter) FindUsers(uid t.Uid, req, opt []string) ([]t.Subscription, err
 			reqTags = append(reqTags, tag)
 		}
 		query = query.Filter(func(row rdb.Term) rdb.Term {
-			return row.Field("Tags").SetIntersection(reqTags).Count().Ne(0)
+			return row.Field("Tags").SetIntersection(reqTags).Count().Eq(len(reqTags))
 		})
 	}
 	cursor, err := query.OrderBy(rdb.Desc("MatchedTagsCount")).Limit(maxResults).Run(a.conn)
@@ -1090,7 +1153,7 @@ func (a *adapter) FindTopics(req, opt []string) ([]t.Subscription, error) {
 			reqTags = append(reqTags, tag)
 		}
 		query = query.Filter(func(row rdb.Term) rdb.Term {
-			return row.Field("Tags").SetIntersection(reqTags).Count().Ne(0)
+			return row.Field("Tags").SetIntersection(reqTags).Count().Eq(len(reqTags))
 		})
 	}
 
@@ -1131,6 +1194,19 @@ func (a *adapter) FindTopics(req, opt []string) ([]t.Subscription, error) {
 func (a *adapter) MessageSave(msg *t.Message) error {
 	msg.SetUid(store.GetUid())
 	_, err := rdb.DB(a.dbName).Table("messages").Insert(msg).RunWrite(a.conn)
+	if err != nil || msg.ReplyTo <= 0 {
+		return err
+	}
+
+	// Update thread statistics of the root message.
+	_, err = rdb.DB(a.dbName).Table("messages").
+		GetAllByIndex("Topic_SeqId", []interface{}{msg.Topic, msg.ReplyTo}).
+		Update(func(row rdb.Term) interface{} {
+			return map[string]interface{}{
+				"ReplyCount":  row.Field("ReplyCount").Default(0).Add(1),
+				"LastReplyAt": msg.CreatedAt,
+			}
+		}).RunWrite(a.conn)
 	return err
 }
 
@@ -1155,14 +1231,22 @@ func (a *adapter) MessageGetAll(topic string, forUser t.Uid, opts *t.QueryOpt) (
 		}
 	}
 
-	lower = []interface{}{topic, lower}
-	upper = []interface{}{topic, upper}
+	index := "Topic_SeqId"
+	if opts != nil && opts.Thread > 0 {
+		// Only replies to the given message
+		index = "Topic_ReplyTo_SeqId"
+		lower = []interface{}{topic, opts.Thread, lower}
+		upper = []interface{}{topic, opts.Thread, upper}
+	} else {
+		lower = []interface{}{topic, lower}
+		upper = []interface{}{topic, upper}
+	}
 
 	requester := forUser.String()
 	cursor, err := rdb.DB(a.dbName).Table("messages").
-		Between(lower, upper, rdb.BetweenOpts{Index: "Topic_SeqId"}).
+		Between(lower, upper, rdb.BetweenOpts{Index: index}).
 		// Ordering by index must come before filtering
-		OrderBy(rdb.OrderByOpts{Index: rdb.Desc("Topic_SeqId")}).
+		OrderBy(rdb.OrderByOpts{Index: rdb.Desc(index)}).
 		// Skip hard-deleted messages
 		Filter(rdb.Row.HasFields("DelId").Not()).
 		// Skip messages soft-deleted for the current user
@@ -1171,7 +1255,17 @@ func (a *adapter) MessageGetAll(topic string, forUser t.Uid, opts *t.QueryOpt) (
 				func(df rdb.Term) interface{} {
 					return df.Field("User").Eq(requester)
 				}))
-		}).Limit(limit).Run(a.conn)
+		}).Limit(limit).
+		// Replace lists of users who reacted to the message with counts.
+		Merge(func(row rdb.Term) interface{} {
+			return map[string]interface{}{
+				"Reactions": rdb.Literal(row.Field("Reactions").Default(map[string]interface{}{}).
+					CoerceTo("array").
+					Map(func(kv rdb.Term) interface{} {
+						return []interface{}{kv.Nth(0), kv.Nth(1).Count()}
+					}).CoerceTo("object")),
+			}
+		}).Run(a.conn)
 
 	if err != nil {
 		return nil, err
@@ -1183,9 +1277,168 @@ func (a *adapter) MessageGetAll(topic string, forUser t.Uid, opts *t.QueryOpt) (
 		return nil, err
 	}
 
+	roots := make(map[int]*t.Message)
+	for i := range msgs {
+		if msgs[i].ReplyCount > 0 {
+			roots[msgs[i].SeqId] = &msgs[i]
+		}
+	}
+	if err = a.countReplies(topic, requester, roots); err != nil {
+		return nil, err
+	}
+
 	return msgs, nil
 }
 
+// countReplies recomputes thread statistics of the root messages counting the replies which are not
+// hard-deleted and, if the user is given, not soft-deleted for the user.
+func (a *adapter) countReplies(topic, user string, roots map[int]*t.Message) error {
+	for seq, root := range roots {
+		query := rdb.DB(a.dbName).Table("messages").
+			Between([]interface{}{topic, seq, rdb.MinVal}, []interface{}{topic, seq, rdb.MaxVal},
+				rdb.BetweenOpts{Index: "Topic_ReplyTo_SeqId"}).
+			Filter(rdb.Row.HasFields("DelId").Not())
+		if user != "" {
+			query = query.Filter(func(row rdb.Term) interface{} {
+				return rdb.Not(row.Field("DeletedFor").Default([]interface{}{}).Contains(
+					func(df rdb.Term) interface{} {
+						return df.Field("User").Eq(user)
+					}))
+			})
+		}
+		cursor, err := query.Field("CreatedAt").Run(a.conn)
+		if err != nil {
+			return err
+		}
+		var times []time.Time
+		err = cursor.All(&times)
+		cursor.Close()
+		if err != nil {
+			return err
+		}
+
+		root.ReplyCount = len(times)
+		root.LastReplyAt = nil
+		for i := range times {
+			if root.LastReplyAt == nil || times[i].After(*root.LastReplyAt) {
+				root.LastReplyAt = &times[i]
+			}
+		}
+	}
+	return nil
+}
+
+// recountReplies recomputes and saves thread statistics of the root messages.
+func (a *adapter) recountReplies(topic string, roots []int) error {
+	for _, seq := range roots {
+		var root t.Message
+		if err := a.countReplies(topic, "", map[int]*t.Message{seq: &root}); err != nil {
+			return err
+		}
+		if _, err := rdb.DB(a.dbName).Table("messages").
+			GetAllByIndex("Topic_SeqId", []interface{}{topic, seq}).
+			Update(map[string]interface{}{"ReplyCount": root.ReplyCount, "LastReplyAt": root.LastReplyAt}).
+			RunWrite(a.conn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MessageEdit replaces Head and Content of a message. The old version is appended to message's Revisions.
+func (a *adapter) MessageEdit(msg *t.Message) error {
+	cursor, err := rdb.DB(a.dbName).Table("messages").
+		GetAllByIndex("Topic_SeqId", []interface{}{msg.Topic, msg.SeqId}).
+		// Hard-deleted messages cannot be edited
+		Filter(rdb.Row.HasFields("DelId").Not()).
+		Field("Id").Run(a.conn)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return t.ErrNotFound
+	}
+
+	var id string
+	if err = cursor.One(&id); err != nil {
+		return err
+	}
+
+	_, err = rdb.DB(a.dbName).Table("messages").Get(id).
+		Update(func(row rdb.Term) interface{} {
+			return map[string]interface{}{
+				"UpdatedAt": msg.UpdatedAt,
+				// Literal prevents merging of the old and new values.
+				"Head":    rdb.Literal(msg.Head),
+				"Content": rdb.Literal(msg.Content),
+				"Revisions": row.Field("Revisions").Default([]interface{}{}).Append(
+					map[string]interface{}{
+						"CreatedAt": msg.UpdatedAt,
+						"Head":      row.Field("Head").Default(nil),
+						"Content":   row.Field("Content").Default(nil),
+					}),
+			}
+		}).RunWrite(a.conn)
+	if err != nil {
+		return err
+	}
+
+	msg.Id = id
+	return nil
+}
+
+// MessageReactionAdd adds user to the list of users who reacted to the message with the given reaction.
+func (a *adapter) MessageReactionAdd(topic string, seqId int, user t.Uid, reaction string) error {
+	res, err := rdb.DB(a.dbName).Table("messages").
+		GetAllByIndex("Topic_SeqId", []interface{}{topic, seqId}).
+		Filter(rdb.Row.HasFields("DelId").Not()).
+		Update(func(row rdb.Term) interface{} {
+			return map[string]interface{}{
+				"Reactions": map[string]interface{}{
+					reaction: row.Field("Reactions").Field(reaction).Default([]interface{}{}).
+						SetInsert(user.String()),
+				},
+			}
+		}).RunWrite(a.conn)
+	if err != nil {
+		return err
+	}
+	if res.Replaced == 0 {
+		if res.Unchanged > 0 {
+			// The user is already in the list.
+			return t.ErrDuplicate
+		}
+		return t.ErrNotFound
+	}
+	return nil
+}
+
+// MessageReactionDelete removes user from the list of users who reacted to the message with the given reaction.
+func (a *adapter) MessageReactionDelete(topic string, seqId int, user t.Uid, reaction string) error {
+	res, err := rdb.DB(a.dbName).Table("messages").
+		GetAllByIndex("Topic_SeqId", []interface{}{topic, seqId}).
+		Filter(rdb.Row.HasFields("DelId").Not()).
+		Update(func(row rdb.Term) interface{} {
+			users := row.Field("Reactions").Field(reaction).Default([]interface{}{}).
+				SetDifference([]interface{}{user.String()})
+			return map[string]interface{}{
+				"Reactions": map[string]interface{}{
+					// Remove the reaction altogether when the last user is removed.
+					reaction: rdb.Branch(users.IsEmpty(), rdb.Literal(), users),
+				},
+			}
+		}).RunWrite(a.conn)
+	if err != nil {
+		return err
+	}
+	if res.Replaced == 0 {
+		return t.ErrNotFound
+	}
+	return nil
+}
+
 // Get ranges of deleted messages
 func (a *adapter) MessageGetDeleted(topic string, forUser t.Uid, opts *t.QueryOpt) ([]t.DelMessage, error) {
 	var limit = maxResults
@@ -1230,6 +1483,15 @@ func (a *adapter) MessageGetDeleted(topic string, forUser t.Uid, opts *t.QueryOp
 		return nil, err
 	}
 
+	// Report single-message ranges the same way as other adapters: Hi is 0.
+	for i := range dmsgs {
+		for j := range dmsgs[i].SeqIdRanges {
+			if dmsgs[i].SeqIdRanges[j].Hi <= dmsgs[i].SeqIdRanges[j].Low+1 {
+				dmsgs[i].SeqIdRanges[j].Hi = 0
+			}
+		}
+	}
+
 	return dmsgs, nil
 }
 
@@ -1260,7 +1522,7 @@ func (a *adapter) MessageDeleteList(topic string, toDel *t.DelMessage) error {
 				if rng.Hi == 0 {
 					indexVals = append(indexVals, []interface{}{topic, rng.Low})
 				} else {
-					for i := rng.Low; i <= rng.Hi; i++ {
+					for i := rng.Low; i < rng.Hi; i++ {
 						indexVals = append(indexVals, []interface{}{topic, i})
 					}
 				}
@@ -1271,7 +1533,7 @@ func (a *adapter) MessageDeleteList(topic string, toDel *t.DelMessage) error {
 			query = query.Between(
 				[]interface{}{topic, toDel.SeqIdRanges[0].Low},
 				[]interface{}{topic, toDel.SeqIdRanges[0].Hi},
-				rdb.BetweenOpts{Index: "Topic_SeqId", RightBound: "closed"})
+				rdb.BetweenOpts{Index: "Topic_SeqId"})
 		}
 		// Skip already hard-deleted messages.
 		query = query.Filter(rdb.Row.HasFields("DelId").Not())
@@ -1304,11 +1566,26 @@ func (a *adapter) MessageDeleteList(topic string, toDel *t.DelMessage) error {
 				// Decrement UseCount.
 				Update(map[string]interface{}{"UseCount": rdb.Row.Field("UseCount").Default(0).Sub(1)}).
 				RunWrite(a.conn)
+			// Threads which lose replies need their statistics recomputed.
+			var roots []int
+			var cursor *rdb.Cursor
+			if cursor, err = query.Filter(rdb.Row.Field("ReplyTo").Default(0).Gt(0)).
+				Field("ReplyTo").Distinct().Run(a.conn); err == nil {
+				err = cursor.All(&roots)
+				cursor.Close()
+			}
+			if err != nil {
+				return err
+			}
+
 			// Hard-delete individual messages. Message is not deleted but all fields with content
 			// are replaced with nulls.
 			_, err = query.Update(map[string]interface{}{
 				"DeletedAt": t.TimeNow(), "DelId": toDel.DelId, "From": nil,
-				"Head": nil, "Content": nil, "Attachments": nil}).RunWrite(a.conn)
+				"Head": nil, "Content": nil, "Attachments": nil, "Revisions": nil, "Reactions": nil, "Words": nil}).RunWrite(a.conn)
+			if err == nil {
+				err = a.recountReplies(topic, roots)
+			}
 
 		} else {
 			// Soft-deleting: adding DelId to DeletedFor
@@ -1360,6 +1637,83 @@ func (a *adapter) MessageAttachments(msgId t.Uid, fids []string) error {
 	return err
 }
 
+// MessageIndex saves words of the message into the Words field.
+func (a *adapter) MessageIndex(topic string, seqId int, words []string) error {
+	_, err := rdb.DB(a.dbName).Table("messages").
+		GetAllByIndex("Topic_SeqId", []interface{}{topic, seqId}).
+		Update(map[string]interface{}{"Words": words}).RunWrite(a.conn)
+	return err
+}
+
+// MessageSearch finds messages which contain all the words by scanning messages of the given topics.
+func (a *adapter) MessageSearch(topics []string, forUser t.Uid, words []string,
+	opts *t.QueryOpt) ([]t.Message, error) {
+
+	if len(topics) == 0 || len(words) == 0 {
+		return nil, nil
+	}
+
+	var limit = maxResults
+	var lower, upper interface{}
+
+	upper = rdb.MaxVal
+	lower = rdb.MinVal
+
+	if opts != nil {
+		if opts.Since > 0 {
+			lower = opts.Since
+		}
+		if opts.Before > 0 {
+			upper = opts.Before
+		}
+		if opts.Limit > 0 && opts.Limit < limit {
+			limit = opts.Limit
+		}
+	}
+
+	ranges := make([]interface{}, len(topics))
+	for i, topic := range topics {
+		ranges[i] = rdb.DB(a.dbName).Table("messages").
+			Between([]interface{}{topic, lower}, []interface{}{topic, upper},
+				rdb.BetweenOpts{Index: "Topic_SeqId"})
+	}
+
+	wordList := make([]interface{}, len(words))
+	for i, word := range words {
+		wordList[i] = word
+	}
+
+	requester := forUser.String()
+	cursor, err := rdb.Union(ranges...).
+		// Skip hard-deleted messages
+		Filter(rdb.Row.HasFields("DelId").Not()).
+		// Skip messages soft-deleted for the current user
+		Filter(func(row rdb.Term) interface{} {
+			return rdb.Not(row.Field("DeletedFor").Default([]interface{}{}).Contains(
+				func(df rdb.Term) interface{} {
+					return df.Field("User").Eq(requester)
+				}))
+		}).
+		Filter(func(row rdb.Term) interface{} {
+			return row.Field("Words").Default([]interface{}{}).Contains(wordList...)
+		}).
+		OrderBy(rdb.Desc("CreatedAt")).
+		Limit(limit).
+		Without("Words", "Reactions", "Revisions").
+		Run(a.conn)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	var msgs []t.Message
+	if err = cursor.All(&msgs); err != nil {
+		return nil, err
+	}
+
+	return msgs, nil
+}
+
 func deviceHasher(deviceID string) string {
 	// Generate custom key as [64-bit hash of device id] to ensure predictable
 	// length of the key
@@ -1479,6 +1833,29 @@ func (a *adapter) CredAdd(cred *t.Credential) error {
 	return err
 }
 
+// CredGetOwner returns ID of the user who has confirmed the credential. Confirmed credentials
+// are keyed by "method:value".
+func (a *adapter) CredGetOwner(method, value string) (t.Uid, error) {
+	cursor, err := rdb.DB(a.dbName).Table("credentials").Get(method + ":" + value).Run(a.conn)
+	if err != nil {
+		return t.ZeroUid, err
+	}
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return t.ZeroUid, nil
+	}
+
+	var cred t.Credential
+	if err = cursor.One(&cred); err != nil {
+		return t.ZeroUid, err
+	}
+	if !cred.Done {
+		return t.ZeroUid, nil
+	}
+	return t.ParseUid(cred.User), nil
+}
+
 func (a *adapter) CredIsConfirmed(uid t.Uid, method string) (bool, error) {
 	creds, err := a.CredGet(uid, method)
 	if err != nil {
@@ -1491,11 +1868,14 @@ func (a *adapter) CredIsConfirmed(uid t.Uid, method string) (bool, error) {
 	return false, nil
 }
 
-func (a *adapter) CredDel(uid t.Uid, method string) error {
+func (a *adapter) CredDel(uid t.Uid, method, value string) error {
 	q := rdb.DB(a.dbName).Table("credentials").
 		GetAllByIndex("User", uid.String())
 	if method != "" {
 		q = q.Filter(map[string]interface{}{"Method": method})
+		if value != "" {
+			q = q.Filter(map[string]interface{}{"Value": value})
+		}
 	}
 	_, err := q.Delete().RunWrite(a.conn)
 	return err
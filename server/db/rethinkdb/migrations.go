@@ -0,0 +1,110 @@
+// +build rethinkdb
+
+package rethinkdb
+
+import (
+	"errors"
+
+	"github.com/nanfengpo/chat/server/db/migrate"
+	"github.com/nanfengpo/chat/server/search"
+	t "github.com/nanfengpo/chat/server/store/types"
+	rdb "gopkg.in/gorethink/gorethink.v4"
+)
+
+// Number of messages indexed at once when upgrading to version 110.
+const indexBatchSize = 1000
+
+// Steps of the schema upgrade starting with version 105. A new step must be added every time
+// dbVersion is changed. Documents are schemaless, so most changes need no upgrade of the data.
+func (a *adapter) migrations() []migrate.Step {
+	return []migrate.Step{
+		{Version: 106, Desc: "message revisions are stored in messages, nothing to do", Apply: func() error {
+			return nil
+		}},
+		{Version: 107, Desc: "reactions are stored in messages, nothing to do", Apply: func() error {
+			return nil
+		}},
+		{Version: 108, Desc: "add index of replies to messages", Apply: func() error {
+			if _, err := rdb.DB(a.dbName).Table("messages").IndexCreateFunc("Topic_ReplyTo_SeqId",
+				func(row rdb.Term) interface{} {
+					return []interface{}{row.Field("Topic"), row.Field("ReplyTo").Default(0), row.Field("SeqId")}
+				}).RunWrite(a.conn); err != nil {
+				return err
+			}
+			// Make sure the index is usable before the server starts.
+			_, err := rdb.DB(a.dbName).Table("messages").IndexWait("Topic_ReplyTo_SeqId").Run(a.conn)
+			return err
+		}},
+		{Version: 109, Desc: "add table of failed authentication attempts", Apply: func() error {
+			_, err := rdb.DB(a.dbName).TableCreate("authfail", rdb.TableCreateOpts{PrimaryKey: "Id"}).RunWrite(a.conn)
+			return err
+		}},
+		{Version: 110, Desc: "index words of existing messages", Apply: func() error {
+			return a.indexMessages()
+		}},
+	}
+}
+
+// indexMessages saves words of the messages which are not indexed yet, so messages sent before
+// the upgrade can be found too.
+func (a *adapter) indexMessages() error {
+	var lastId interface{} = rdb.MinVal
+	for {
+		cursor, err := rdb.DB(a.dbName).Table("messages").
+			Between(lastId, rdb.MaxVal, rdb.BetweenOpts{LeftBound: "open"}).
+			OrderBy(rdb.OrderByOpts{Index: "Id"}).
+			// Skip hard-deleted and already indexed messages.
+			Filter(rdb.Row.HasFields("DelId").Not().And(rdb.Row.HasFields("Words").Not())).
+			Limit(indexBatchSize).
+			Pluck("Id", "Content").Run(a.conn)
+		if err != nil {
+			return err
+		}
+
+		var msgs []struct {
+			Id      string
+			Content interface{}
+		}
+		err = cursor.All(&msgs)
+		cursor.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, msg := range msgs {
+			lastId = msg.Id
+			words := search.MessageWords(&t.Message{Content: msg.Content})
+			if len(words) == 0 {
+				continue
+			}
+			if _, err = rdb.DB(a.dbName).Table("messages").Get(msg.Id).
+				Update(map[string]interface{}{"Words": words}).RunWrite(a.conn); err != nil {
+				return err
+			}
+		}
+		if len(msgs) < indexBatchSize {
+			return nil
+		}
+	}
+}
+
+// UpgradeDb upgrades the database to dbVersion one step at a time. The version is saved after
+// every step.
+func (a *adapter) UpgradeDb(dryRun bool) ([]string, error) {
+	version, err := a.getDbVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version < 0 {
+		return nil, errors.New("Database not initialized")
+	}
+
+	return migrate.Run(a.migrations(), version, dbVersion, func(vers int) error {
+		if _, err := rdb.DB(a.dbName).Table("kvmeta").Get("version").
+			Update(map[string]interface{}{"value": vers}).RunWrite(a.conn); err != nil {
+			return err
+		}
+		a.version = vers
+		return nil
+	}, dryRun)
+}
@@ -31,15 +31,6 @@ func largeFileServe(wrt http.ResponseWriter, req *http.Request) {
 	enc := json.NewEncoder(wrt)
 	mh := store.GetMediaHandler()
 
-	//Check if media handler requests redirection to another service.
-	if redirTo := mh.Redirect(req.URL.String()); redirTo != "" {
-		wrt.Header().Set("Location", redirTo)
-		wrt.Header().Set("Content-Type", "application/json; charset=utf-8")
-		wrt.WriteHeader(http.StatusFound)
-		enc.Encode(InfoFound("", "", now))
-		return
-	}
-
 	writeHttpResponse := func(msg *ServerComMessage) {
 		if msg == nil {
 			msg = ErrUnknown("", "", now)
@@ -72,6 +63,16 @@ func largeFileServe(wrt http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// Check if media handler requests redirection to another service, e.g. to a presigned URL.
+	// Redirect only after the authorization check: the redirect URL grants access to the file.
+	if redirTo := mh.Redirect(req.URL.String()); redirTo != "" {
+		wrt.Header().Set("Location", redirTo)
+		wrt.Header().Set("Content-Type", "application/json; charset=utf-8")
+		wrt.WriteHeader(http.StatusFound)
+		enc.Encode(InfoFound("", "", now))
+		return
+	}
+
 	fd, rsc, err := mh.Download(req.URL.String())
 	if err != nil {
 		writeHttpResponse(decodeStoreError(err, "", "", now, nil))
@@ -111,14 +112,15 @@ func largeFileUpload(wrt http.ResponseWriter, req *http.Request) {
 		enc.Encode(msg)
 	}
 
-	// Check if this is a POST request
-	if req.Method != http.MethodPost {
+	// Regular uploads are sent with POST. Resumable uploads use other methods as well.
+	resumable := isResumableUpload(req)
+	if req.Method != http.MethodPost && !resumable {
 		writeHttpResponse(ErrOperationNotAllowed("", "", now))
 		return
 	}
 
-	if globals.maxFileUploadSize > 0 {
-		// Enforce maximum upload size.
+	if globals.maxFileUploadSize > 0 && !resumable {
+		// Enforce maximum upload size. Resumable uploads enforce it across all chunks.
 		req.Body = http.MaxBytesReader(wrt, req.Body, globals.maxFileUploadSize)
 	}
 
@@ -143,6 +145,11 @@ func largeFileUpload(wrt http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if resumable {
+		writeHttpResponse(resumableUpload(wrt, req, uid, now))
+		return
+	}
+
 	file, _, err := req.FormFile("file")
 	if err != nil {
 		log.Println("Error reading file", err)
@@ -191,9 +198,12 @@ func largeFileRunGarbageCollection(period time.Duration, block int) chan<- bool
 		for {
 			select {
 			case <-gcTimer:
-				if err := store.Files.DeleteUnused(time.Now().Add(-time.Hour), block); err != nil {
+				// Records of abandoned partial uploads are deleted here too: each received chunk
+				// updates the record, so an upload without activity looks like an old unused file.
+				if err := store.Files.DeleteUnused(time.Now().Add(-unusedFileExpire), block); err != nil {
 					log.Println("media gc:", err)
 				}
+				resumableUploadGc(time.Now().Add(-unusedFileExpire))
 			case <-stop:
 				return
 			}
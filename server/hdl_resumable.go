@@ -0,0 +1,296 @@
+/******************************************************************************
+ *
+ *  Description :
+ *
+ *    Resumable uploads of large files. The file is sent in chunks. If the
+ *    connection is lost, the upload continues from the last received byte
+ *    instead of starting over:
+ *
+ *    POST   /v0/file/u/ with 'Upload-Resumable: true' header starts an upload.
+ *           The response contains the URL of the upload in params.upload.
+ *    PATCH  <upload URL> with 'Upload-Offset: N' header appends the request
+ *           body to the upload at offset N. The last chunk must also have the
+ *           'Upload-Complete: true' header. Response to the last chunk contains
+ *           params.url of the file, same as a regular upload.
+ *    HEAD   <upload URL> reports the number of received bytes in the
+ *           'Upload-Offset' header.
+ *    DELETE <upload URL> cancels the upload.
+ *
+ *    The progress is recorded in the file record. Received data is kept in
+ *    a local directory until the upload is completed, then it's passed to
+ *    the media handler. In a cluster the data is kept by the node which
+ *    started the upload: all requests of the upload must be routed to that
+ *    node. Requests which reach other nodes are rejected.
+ *
+ *****************************************************************************/
+
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+const (
+	// Base URL of uploads.
+	uploadBaseURL = "/v0/file/u/"
+
+	// Uploaded files which are not attached to any message and partial uploads without
+	// activity are garbage collected after this time.
+	unusedFileExpire = time.Hour
+)
+
+// Partial uploads which are being written to at the moment. Concurrent requests to the same upload
+// are rejected. Uploads are not shared between cluster nodes, thus a lock local to the process is enough.
+var partialUploads = struct {
+	sync.Mutex
+	busy map[string]bool
+}{busy: make(map[string]bool)}
+
+// isResumableUpload checks if the request belongs to a resumable upload.
+func isResumableUpload(req *http.Request) bool {
+	if req.Method == http.MethodPost {
+		return isHeaderTrue(req.Header.Get("Upload-Resumable"))
+	}
+	return req.Method == http.MethodPatch || req.Method == http.MethodHead || req.Method == http.MethodDelete
+}
+
+func isHeaderTrue(val string) bool {
+	// '?1' is a boolean in the syntax of structured HTTP headers.
+	val = strings.ToLower(strings.TrimSpace(val))
+	return val == "true" || val == "1" || val == "?1"
+}
+
+// Location of the data of a partial upload.
+func partialUploadPath(fid string) string {
+	return filepath.Join(globals.resumableUploadDir, fid)
+}
+
+// resumableUpload handles requests of resumable uploads of an authenticated user.
+func resumableUpload(wrt http.ResponseWriter, req *http.Request, uid types.Uid, now time.Time) *ServerComMessage {
+	if req.Method == http.MethodPost {
+		return resumableUploadStart(wrt, uid, now)
+	}
+
+	fid := strings.TrimPrefix(path.Clean(req.URL.Path), uploadBaseURL)
+	if types.ParseUid(fid).IsZero() {
+		return ErrMalformed("", "", now)
+	}
+
+	partialUploads.Lock()
+	if partialUploads.busy[fid] {
+		partialUploads.Unlock()
+		return ErrCommandOutOfSequence("", "", now)
+	}
+	partialUploads.busy[fid] = true
+	partialUploads.Unlock()
+
+	defer func() {
+		partialUploads.Lock()
+		delete(partialUploads.busy, fid)
+		partialUploads.Unlock()
+	}()
+
+	fd, err := store.Files.Get(fid)
+	if err != nil {
+		return decodeStoreError(err, "", "", now, nil)
+	}
+	// Uploads of other users are reported as missing.
+	if fd == nil || fd.User != uid.String() || fd.Status != types.UploadStarted {
+		return ErrNotFound("", "", now)
+	}
+	// The data is kept by the node which started the upload.
+	if stat, err := os.Stat(partialUploadPath(fid)); err != nil || stat.Size() < fd.Size {
+		log.Println("Partial upload is not at this node", fid, err)
+		return ErrNotFound("", "", now)
+	}
+
+	switch req.Method {
+	case http.MethodHead:
+		wrt.Header().Set("Upload-Offset", strconv.FormatInt(fd.Size, 10))
+		return NoErr("", "", now)
+	case http.MethodDelete:
+		os.Remove(partialUploadPath(fid))
+		store.Files.FinishUpload(fid, false, fd.Size)
+		return NoErr("", "", now)
+	}
+
+	return resumableUploadChunk(wrt, req, fd, uid, now)
+}
+
+// resumableUploadStart creates a record of a partial upload.
+func resumableUploadStart(wrt http.ResponseWriter, uid types.Uid, now time.Time) *ServerComMessage {
+	fdef := types.FileDef{}
+	fdef.Id = store.GetUidString()
+	fdef.InitTimes()
+	fdef.User = uid.String()
+
+	// The presence of the file marks the node which keeps the data of the upload.
+	spool, err := os.OpenFile(partialUploadPath(fdef.Id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		log.Println("Failed to create partial upload", err)
+		return ErrUnknown("", "", now)
+	}
+	spool.Close()
+
+	// The record has no location until the data is passed to the media handler.
+	if err = store.Files.StartUpload(&fdef); err != nil {
+		os.Remove(partialUploadPath(fdef.Id))
+		log.Println("Failed to start resumable upload", err)
+		return decodeStoreError(err, "", "", now, nil)
+	}
+
+	upload := uploadBaseURL + fdef.Id
+	wrt.Header().Set("Location", upload)
+	wrt.Header().Set("Upload-Offset", "0")
+
+	resp := NoErrCreated("", "", now)
+	resp.Ctrl.Params = map[string]interface{}{"upload": upload, "offset": 0}
+	return resp
+}
+
+// resumableUploadChunk appends a chunk of data to a partial upload and completes the upload
+// after the last chunk.
+func resumableUploadChunk(wrt http.ResponseWriter, req *http.Request, fd *types.FileDef, uid types.Uid,
+	now time.Time) *ServerComMessage {
+
+	offset, err := strconv.ParseInt(req.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return ErrMalformed("", "", now)
+	}
+	if offset != fd.Size {
+		// The client is out of sync: tell it where to continue.
+		wrt.Header().Set("Upload-Offset", strconv.FormatInt(fd.Size, 10))
+		resp := ErrCommandOutOfSequence("", "", now)
+		resp.Ctrl.Params = map[string]interface{}{"offset": fd.Size}
+		return resp
+	}
+
+	body := req.Body
+	// The limit applies to the whole file, not to each chunk.
+	limit := int64(-1)
+	if globals.maxFileUploadSize > 0 {
+		limit = globals.maxFileUploadSize - offset
+		// One byte over the limit is enough to tell that the file is too large.
+		body = ioutil.NopCloser(io.LimitReader(body, limit+1))
+	}
+
+	spool, err := os.OpenFile(partialUploadPath(fd.Id), os.O_WRONLY, 0600)
+	if err != nil {
+		log.Println("Failed to open partial upload", fd.Id, err)
+		return ErrUnknown("", "", now)
+	}
+	// Discard bytes written after the last recorded offset, if any.
+	if err = spool.Truncate(offset); err == nil {
+		_, err = spool.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		spool.Close()
+		log.Println("Failed to prepare partial upload", fd.Id, err)
+		return ErrUnknown("", "", now)
+	}
+
+	received, err := io.Copy(spool, body)
+	spool.Close()
+	size := offset + received
+
+	if limit >= 0 && received > limit {
+		// The file cannot be completed without exceeding the limit.
+		os.Remove(partialUploadPath(fd.Id))
+		store.Files.FinishUpload(fd.Id, false, size)
+		return ErrTooLarge("", "", now)
+	}
+	if err != nil {
+		// Connection lost: keep what was received, the client will resume from there.
+		log.Println("Partial upload interrupted", fd.Id, size, err)
+	}
+
+	if _, uerr := store.Files.UpdateUpload(fd.Id, size); uerr != nil {
+		log.Println("Failed to update partial upload", fd.Id, uerr)
+		return decodeStoreError(uerr, "", "", now, nil)
+	}
+	if err != nil {
+		return ErrMalformed("", "", now)
+	}
+
+	if !isHeaderTrue(req.Header.Get("Upload-Complete")) {
+		wrt.Header().Set("Upload-Offset", strconv.FormatInt(size, 10))
+		resp := NoErr("", "", now)
+		resp.Ctrl.Params = map[string]interface{}{"offset": size}
+		return resp
+	}
+
+	return resumableUploadFinish(fd.Id, size, uid, now)
+}
+
+// resumableUploadFinish passes the received data to the media handler.
+func resumableUploadFinish(fid string, size int64, uid types.Uid, now time.Time) *ServerComMessage {
+	spool, err := os.Open(partialUploadPath(fid))
+	if err != nil {
+		log.Println("Failed to open partial upload", fid, err)
+		return ErrUnknown("", "", now)
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(partialUploadPath(fid))
+	}()
+
+	fdef := types.FileDef{}
+	fdef.Id = store.GetUidString()
+	fdef.InitTimes()
+	fdef.User = uid.String()
+
+	buff := make([]byte, 512)
+	n, err := spool.Read(buff)
+	if err != nil && err != io.EOF {
+		log.Println("Failed to detect mime type", err)
+		return ErrUnknown("", "", now)
+	}
+	fdef.MimeType = http.DetectContentType(buff[:n])
+	if _, err = spool.Seek(0, io.SeekStart); err != nil {
+		log.Println("Failed to reset partial upload", err)
+		return ErrUnknown("", "", now)
+	}
+
+	url, err := store.GetMediaHandler().Upload(&fdef, spool)
+	// The record of the partial upload is no longer needed. It's garbage collected as an unused file.
+	store.Files.FinishUpload(fid, err == nil, size)
+	if err != nil {
+		log.Println("Failed to upload file", fdef.Id, err)
+		return decodeStoreError(err, "", "", now, nil)
+	}
+
+	resp := NoErr("", "", now)
+	resp.Ctrl.Params = map[string]string{"url": url}
+	return resp
+}
+
+// resumableUploadGc deletes data of partial uploads abandoned before the given time.
+func resumableUploadGc(olderThan time.Time) {
+	files, err := ioutil.ReadDir(globals.resumableUploadDir)
+	if err != nil {
+		log.Println("media gc: failed to read partial uploads", err)
+		return
+	}
+
+	partialUploads.Lock()
+	defer partialUploads.Unlock()
+
+	for _, file := range files {
+		if file.ModTime().Before(olderThan) && !partialUploads.busy[file.Name()] {
+			os.Remove(filepath.Join(globals.resumableUploadDir, file.Name()))
+		}
+	}
+}
@@ -335,7 +335,7 @@ func authHttpRequest(req *http.Request) (types.Uid, []byte, error) {
 			return uid, nil, types.ErrMalformed
 		}
 		if authhdl := store.GetAuthHandler(authMethod); authhdl != nil {
-			rec, challenge, err := authhdl.Authenticate(decodedSecret)
+			rec, challenge, err := authenticate(authhdl, decodedSecret, req.RemoteAddr)
 			if err != nil {
 				return uid, nil, err
 			}
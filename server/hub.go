@@ -281,6 +281,10 @@ func topicInit(sreg *sessionJoin, h *Hub) {
 		t.accessAuth = user.Access.Auth
 		t.accessAnon = user.Access.Anon
 
+		if t.quietHours, err = types.ParseQuietHours(user.QuietHours); err != nil {
+			log.Println("hub: invalid quiet hours of user", user.Id, err)
+		}
+
 		if err = t.loadSubscribers(); err != nil {
 			log.Println("hub: cannot load subscribers for '" + t.name + "' (" + err.Error() + ")")
 			sreg.sess.queueOut(ErrUnknown(sreg.pkt.Id, t.xoriginal, timestamp))
@@ -409,6 +413,10 @@ func topicInit(sreg *sessionJoin, h *Hub) {
 					delID:     subs[i].DelId,
 					recvID:    subs[i].RecvSeqId,
 					readID:    subs[i].ReadSeqId,
+
+					mentionCount: subs[i].MentionCount,
+					muteUntil:    subs[i].MutedUntil(),
+					mentionsOnly: subs[i].MentionsOnly,
 				}
 			}
 
@@ -588,6 +596,9 @@ func topicInit(sreg *sessionJoin, h *Hub) {
 			userData.delID = sub1.DelId
 			userData.readID = sub1.ReadSeqId
 			userData.recvID = sub1.RecvSeqId
+			userData.mentionCount = sub1.MentionCount
+			userData.muteUntil = sub1.MutedUntil()
+			userData.mentionsOnly = sub1.MentionsOnly
 			t.perUser[userID1] = userData
 
 			t.perUser[userID2] = perUserData{
@@ -598,6 +609,10 @@ func topicInit(sreg *sessionJoin, h *Hub) {
 				delID:     sub2.DelId,
 				readID:    sub2.ReadSeqId,
 				recvID:    sub2.RecvSeqId,
+
+				mentionCount: sub2.MentionCount,
+				muteUntil:    sub2.MutedUntil(),
+				mentionsOnly: sub2.MentionsOnly,
 			}
 
 			log.Println("hub: marking request as 'topic created'")
@@ -785,7 +800,11 @@ func (t *Topic) loadSubscribers() error {
 			recvID:    sub.RecvSeqId,
 			private:   sub.Private,
 			modeWant:  sub.ModeWant,
-			modeGiven: sub.ModeGiven}
+			modeGiven: sub.ModeGiven,
+
+			mentionCount: sub.MentionCount,
+			muteUntil:    sub.MutedUntil(),
+			mentionsOnly: sub.MentionsOnly}
 
 		if (sub.ModeGiven & sub.ModeWant).IsOwner() {
 			t.owner = uid
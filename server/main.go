@@ -17,6 +17,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 	"strings"
@@ -30,16 +31,26 @@ import (
 	"github.com/nanfengpo/chat/server/auth"
 	_ "github.com/nanfengpo/chat/server/auth/anon"
 	_ "github.com/nanfengpo/chat/server/auth/basic"
+	_ "github.com/nanfengpo/chat/server/auth/jwt"
+	_ "github.com/nanfengpo/chat/server/auth/ldap"
+	_ "github.com/nanfengpo/chat/server/auth/oidc"
 	_ "github.com/nanfengpo/chat/server/auth/token"
+	_ "github.com/nanfengpo/chat/server/auth/totp"
 
 	// Database backends
+	_ "github.com/nanfengpo/chat/server/db/bolt"
+	_ "github.com/nanfengpo/chat/server/db/memory"
 	_ "github.com/nanfengpo/chat/server/db/mysql"
+	_ "github.com/nanfengpo/chat/server/db/postgres"
 	_ "github.com/nanfengpo/chat/server/db/rethinkdb"
 
 	// Push notifications
 	"github.com/nanfengpo/chat/server/push"
+	_ "github.com/nanfengpo/chat/server/push/apns"
 	_ "github.com/nanfengpo/chat/server/push/fcm"
 	_ "github.com/nanfengpo/chat/server/push/stdout"
+	_ "github.com/nanfengpo/chat/server/push/webhook"
+	_ "github.com/nanfengpo/chat/server/push/webpush"
 
 	"github.com/nanfengpo/chat/server/store"
 
@@ -50,6 +61,10 @@ import (
 
 	// File upload handlers
 	_ "github.com/nanfengpo/chat/server/media/fs"
+	_ "github.com/nanfengpo/chat/server/media/s3"
+
+	// Full-text search indexes
+	_ "github.com/nanfengpo/chat/server/search/inverted"
 )
 
 const (
@@ -84,6 +99,12 @@ const (
 	// maxDeleteCount is the maximum allowed number of messages to delete in one call.
 	defaultMaxDeleteCount = 1024
 
+	// maxReactionLength is the maximum length of a reaction to a message in bytes.
+	maxReactionLength = 32
+
+	// Default directory for partially uploaded files, relative to the system temp directory.
+	defaultResumableDir = "nanfengpo-uploads"
+
 	// Mount point where static content is served, http://host-name/<defaultStaticMount>
 	defaultStaticMount = "/"
 
@@ -136,6 +157,11 @@ var globals struct {
 
 	// Maximum allowed upload size.
 	maxFileUploadSize int64
+	// Directory for partially uploaded files of resumable uploads.
+	resumableUploadDir string
+
+	// Limits of client messages; nil if unlimited.
+	rateLimiter *rateLimiter
 }
 
 type validatorConfig struct {
@@ -156,10 +182,20 @@ type mediaConfig struct {
 	GcPeriod int `json:"gc_period"`
 	// Number of entries to delete in one pass
 	GcBlockSize int `json:"gc_block_size"`
+	// Directory for partially uploaded files of resumable uploads. In case of a cluster each node
+	// uses a subdirectory named after the node.
+	ResumableDir string `json:"resumable_dir"`
 	// Individual handler config params to pass to handlers unchanged.
 	Handlers map[string]json.RawMessage `json:"handlers"`
 }
 
+type searchConfig struct {
+	// The name of the full-text search index to use.
+	UseIndex string `json:"use_index"`
+	// Individual index config params to pass to indexes unchanged.
+	Indexes map[string]json.RawMessage `json:"indexes"`
+}
+
 // Contentx of the configuration file
 type configType struct {
 	// Default HTTP(S) address:port to listen on for websocket and long polling clients. Either a
@@ -196,6 +232,11 @@ type configType struct {
 	Auth      map[string]json.RawMessage  `json:"auth_config"`
 	Validator map[string]*validatorConfig `json:"acc_validation"`
 	Media     *mediaConfig                `json:"media"`
+	Search    *searchConfig               `json:"search"`
+	RateLimit json.RawMessage             `json:"rate_limit"`
+
+	// Templates of push notification text by language.
+	PushTemplates json.RawMessage `json:"push_templates"`
 }
 
 func main() {
@@ -342,6 +383,17 @@ func main() {
 			config.Media = nil
 		} else {
 			globals.maxFileUploadSize = config.Media.MaxFileUploadSize
+			globals.resumableUploadDir = config.Media.ResumableDir
+			if globals.resumableUploadDir == "" {
+				globals.resumableUploadDir = filepath.Join(os.TempDir(), defaultResumableDir)
+			}
+			if globals.cluster != nil {
+				// Each node keeps data of the uploads it started.
+				globals.resumableUploadDir = filepath.Join(globals.resumableUploadDir, globals.cluster.thisNodeName)
+			}
+			if err = os.MkdirAll(globals.resumableUploadDir, 0700); err != nil {
+				log.Fatal("Failed to create directory for resumable uploads", err)
+			}
 			if config.Media.Handlers != nil {
 				var conf string
 				if params := config.Media.Handlers[config.Media.UseHandler]; params != nil {
@@ -357,6 +409,22 @@ func main() {
 		}
 	}
 
+	if config.Search != nil && config.Search.UseIndex != "" {
+		var conf string
+		if params := config.Search.Indexes[config.Search.UseIndex]; params != nil {
+			conf = string(params)
+		}
+		if err = store.UseSearchIndex(config.Search.UseIndex, conf); err != nil {
+			log.Fatal("Failed to init search index", config.Search.UseIndex, err)
+		}
+	}
+
+	if config.PushTemplates != nil {
+		if err = push.InitTemplates(string(config.PushTemplates)); err != nil {
+			log.Fatal("Failed to initialize push notification templates:", err)
+		}
+	}
+
 	err = push.Init(string(config.Push))
 	if err != nil {
 		log.Fatal("Failed to initialize push notifications:", err)
@@ -365,6 +433,16 @@ func main() {
 		push.Stop()
 		log.Println("Stopped push notifications")
 	}()
+	startPushWorkers()
+
+	if config.RateLimit != nil {
+		if globals.rateLimiter, err = newRateLimiter(config.RateLimit); err != nil {
+			log.Fatal("Failed to initialize rate limits:", err)
+		}
+		if globals.rateLimiter != nil {
+			go globals.rateLimiter.run()
+		}
+	}
 
 	// Keep inactive LP sessions for 15 seconds
 	globals.sessionStore = NewSessionStore(idleSessionTimeout + 15*time.Second)
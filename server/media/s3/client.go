@@ -0,0 +1,266 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+const (
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	// The payload is not signed: S3 accepts it and the payload does not have to be read twice.
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	// SHA-256 of an empty payload.
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	amzDateFormat   = "20060102T150405Z"
+	shortDateFormat = "20060102"
+)
+
+// client is a minimal client of the S3 REST API which signs requests with AWS Signature Version 4.
+// It works with Amazon S3 and with S3-compatible storage like MinIO or Ceph.
+type client struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	// Use path-style URLs http://host/bucket/key instead of virtual host-style http://bucket.host/key.
+	pathStyle bool
+
+	http *http.Client
+}
+
+// s3Error is an error response of S3.
+type s3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+// objectURL returns URL of the object with the given key.
+func (c *client) objectURL(key string) *url.URL {
+	u := *c.endpoint
+	if c.pathStyle {
+		u.Path = "/" + c.bucket + "/" + key
+	} else {
+		u.Host = c.bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = ""
+	return &u
+}
+
+// uriEncode encodes the string as required by the signature: all characters except unreserved
+// A-Z, a-z, 0-9, '-', '_', '.', '~' are percent-encoded. The slash is kept if encodeSlash is false.
+func uriEncode(s string, encodeSlash bool) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			buf.WriteByte(c)
+		} else {
+			buf.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+		}
+	}
+	return buf.String()
+}
+
+// canonicalQuery sorts and encodes query parameters.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		vals := append([]string(nil), query[key]...)
+		sort.Strings(vals)
+		for _, val := range vals {
+			parts = append(parts, uriEncode(key, true)+"="+uriEncode(val, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// scope returns the credential scope of the signature.
+func (c *client) scope(now time.Time) string {
+	return now.Format(shortDateFormat) + "/" + c.region + "/s3/aws4_request"
+}
+
+// signature calculates the signature of the canonical request.
+func (c *client) signature(canonicalRequest string, now time.Time) string {
+	stringToSign := signingAlgorithm + "\n" + now.Format(amzDateFormat) + "\n" + c.scope(now) + "\n" +
+		sha256Hex(canonicalRequest)
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), now.Format(shortDateFormat))
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// sign adds the Authorization header to the request. All headers of the request and the Host are signed.
+func (c *client) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, vals := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(vals, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders bytes.Buffer
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := req.Method + "\n" +
+		uriEncode(req.URL.Path, false) + "\n" +
+		canonicalQuery(req.URL.Query()) + "\n" +
+		canonicalHeaders.String() + "\n" +
+		signedHeaders + "\n" +
+		payloadHash
+
+	req.Header.Set("Authorization", signingAlgorithm+" Credential="+c.accessKey+"/"+c.scope(now)+
+		",SignedHeaders="+signedHeaders+",Signature="+c.signature(canonicalRequest, now))
+}
+
+// presign returns a URL which grants access to the object without credentials until it expires.
+// The query is added to the URL, e.g. response-content-type to override headers of the response.
+func (c *client) presign(method, key string, query url.Values, ttl time.Duration, now time.Time) string {
+	now = now.UTC()
+	u := c.objectURL(key)
+
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("X-Amz-Algorithm", signingAlgorithm)
+	q.Set("X-Amz-Credential", c.accessKey+"/"+c.scope(now))
+	q.Set("X-Amz-Date", now.Format(amzDateFormat))
+	q.Set("X-Amz-Expires", strconv.Itoa(int(ttl/time.Second)))
+	q.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalRequest := method + "\n" +
+		uriEncode(u.Path, false) + "\n" +
+		canonicalQuery(q) + "\n" +
+		"host:" + u.Host + "\n\n" +
+		"host\n" +
+		unsignedPayload
+
+	u.RawQuery = canonicalQuery(q) + "&X-Amz-Signature=" + c.signature(canonicalRequest, now)
+	return u.String()
+}
+
+// do signs and executes the request. Responses other than 2xx are converted to errors.
+func (c *client) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	c.sign(req, payloadHash, time.Now())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, types.ErrNotFound
+	}
+
+	var s3err s3Error
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if xml.Unmarshal(body, &s3err) == nil && s3err.Code != "" {
+		return nil, errors.New("s3: " + s3err.Code + ": " + s3err.Message)
+	}
+	return nil, errors.New("s3: unexpected response " + resp.Status)
+}
+
+// putObject uploads the object. S3 requires the size of the object to be known in advance.
+func (c *client) putObject(key, contentType string, body io.Reader, size int64) error {
+	req, err := http.NewRequest(http.MethodPut, c.objectURL(key).String(), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := c.do(req, unsignedPayload)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// getObject starts download of the object from the given offset.
+func (c *client) getObject(key string, offset int64) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, c.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+
+	resp, err := c.do(req, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// deleteObject deletes the object. Deleting a missing object is not an error.
+func (c *client) deleteObject(key string) error {
+	req, err := http.NewRequest(http.MethodDelete, c.objectURL(key).String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req, emptyPayloadHash)
+	if err == types.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,299 @@
+// Package s3 implements github.com/nanfengpo/chat/server/media interface by storing media objects in
+// Amazon S3 or in an S3-compatible storage like MinIO or Ceph. Unlike media/fs it does not need a file system
+// shared by all cluster nodes. Downloads can be redirected to presigned URLs so the files are served by
+// the storage directly instead of being proxied by the server.
+package s3
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/nanfengpo/chat/server/media"
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+const (
+	defaultServeURL = "/v0/file/s/"
+	defaultRegion   = "us-east-1"
+
+	// Presigned URLs cannot be valid for longer than 7 days.
+	maxPresignTTL = 7 * 24 * 3600
+)
+
+type configType struct {
+	// S3 endpoint, like "http://localhost:9000" for MinIO. Default: Amazon S3 in the given region.
+	Endpoint string `json:"endpoint,omitempty"`
+	Region   string `json:"region,omitempty"`
+	Bucket   string `json:"bucket,omitempty"`
+	// Credentials.
+	AccessKeyId     string `json:"access_key_id,omitempty"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+	// Use path-style URLs instead of virtual host-style. MinIO requires it.
+	PathStyle bool `json:"path_style,omitempty"`
+	// Lifetime of presigned download URLs in seconds. Downloads are proxied by the server if 0.
+	PresignTTL int    `json:"presign_ttl,omitempty"`
+	ServeURL   string `json:"serve_url,omitempty"`
+	// Timeout of requests to S3 in seconds.
+	Timeout int `json:"timeout,omitempty"`
+}
+
+type s3handler struct {
+	client     *client
+	presignTTL time.Duration
+	serveURL   string
+}
+
+func (sh *s3handler) Init(jsconf string) error {
+	var err error
+	var config configType
+
+	if err = json.Unmarshal([]byte(jsconf), &config); err != nil {
+		return errors.New("s3 handler failed to parse config: " + err.Error())
+	}
+
+	if config.Bucket == "" {
+		return errors.New("s3 handler: missing bucket")
+	}
+	if config.AccessKeyId == "" || config.SecretAccessKey == "" {
+		return errors.New("s3 handler: missing credentials")
+	}
+	if config.PresignTTL < 0 || config.PresignTTL > maxPresignTTL {
+		return errors.New("s3 handler: invalid presign_ttl")
+	}
+
+	region := config.Region
+	if region == "" {
+		region = defaultRegion
+	}
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	ep, err := url.Parse(endpoint)
+	if err != nil || ep.Host == "" {
+		return errors.New("s3 handler: invalid endpoint '" + endpoint + "'")
+	}
+
+	sh.client = &client{
+		endpoint:  ep,
+		region:    region,
+		bucket:    config.Bucket,
+		accessKey: config.AccessKeyId,
+		secretKey: config.SecretAccessKey,
+		pathStyle: config.PathStyle,
+		http:      &http.Client{Timeout: time.Duration(config.Timeout) * time.Second},
+	}
+
+	sh.presignTTL = time.Duration(config.PresignTTL) * time.Second
+	sh.serveURL = config.ServeURL
+	if sh.serveURL == "" {
+		sh.serveURL = defaultServeURL
+	}
+
+	return nil
+}
+
+// Redirect returns a presigned URL of the requested file. The file is then downloaded directly from S3.
+// Uploads and missing files are not redirected.
+func (sh *s3handler) Redirect(upath string) string {
+	if sh.presignTTL == 0 {
+		return ""
+	}
+
+	fid := sh.GetIdFromUrl(upath)
+	if fid.IsZero() {
+		return ""
+	}
+
+	fd, err := store.Files.Get(fid.String())
+	if err != nil || fd == nil || fd.Status != types.UploadCompleted {
+		return ""
+	}
+
+	query := url.Values{}
+	query.Set("response-content-type", fd.MimeType)
+	query.Set("response-content-disposition", "attachment")
+	return sh.client.presign(http.MethodGet, fd.Location, query, sh.presignTTL, time.Now())
+}
+
+// Upload processes request for file upload. The file is given as io.Reader.
+func (sh *s3handler) Upload(fdef *types.FileDef, file io.Reader) (string, error) {
+	// The object key is the file ID. Using base32 to keep keys case-insensitive like the fs handler.
+	fdef.Location = fdef.Uid().String32()
+
+	body, size, err := contentSize(file)
+	if err != nil {
+		return "", err
+	}
+
+	if err = store.Files.StartUpload(fdef); err != nil {
+		log.Println("s3: failed to create file record", fdef.Id, err)
+		return "", err
+	}
+
+	if err = sh.client.putObject(fdef.Location, fdef.MimeType, body, size); err != nil {
+		log.Println("s3: failed to upload", fdef.Id, err)
+		store.Files.FinishUpload(fdef.Id, false, 0)
+		return "", err
+	}
+
+	location := fdef.Location
+	fdef, err = store.Files.FinishUpload(fdef.Id, true, size)
+	if err != nil {
+		sh.client.deleteObject(location)
+		return "", err
+	}
+
+	fname := fdef.Id
+	ext, _ := mime.ExtensionsByType(fdef.MimeType)
+	if len(ext) > 0 {
+		fname += ext[0]
+	}
+
+	return sh.serveURL + fname, nil
+}
+
+// Download processes request for file download. The file is read from S3 as needed.
+// The returned ReadSeekCloser must be closed after use.
+func (sh *s3handler) Download(upath string) (*types.FileDef, media.ReadSeekCloser, error) {
+	fid := sh.GetIdFromUrl(upath)
+	if fid.IsZero() {
+		return nil, nil, types.ErrNotFound
+	}
+
+	fd, err := store.Files.Get(fid.String())
+	if err != nil {
+		log.Println("s3: file not found", fid)
+		return nil, nil, err
+	}
+	if fd == nil {
+		return nil, nil, types.ErrNotFound
+	}
+
+	return fd, &object{client: sh.client, key: fd.Location, size: fd.Size}, nil
+}
+
+// Delete deletes objects from S3 by provided slice of locations. All objects are attempted,
+// the first error is returned.
+func (sh *s3handler) Delete(locations []string) error {
+	var firstErr error
+	for _, loc := range locations {
+		if err := sh.client.deleteObject(loc); err != nil {
+			log.Println("s3: error deleting object", loc, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// GetIdFromUrl extracts file ID from download URL.
+func (sh *s3handler) GetIdFromUrl(upath string) types.Uid {
+	u, err := url.Parse(upath)
+	if err != nil {
+		return types.ZeroUid
+	}
+	dir, fname := path.Split(path.Clean(u.Path))
+
+	// Check path validity
+	if dir != sh.serveURL {
+		return types.ZeroUid
+	}
+
+	// Remove file extension and parse UID
+	return types.ParseUid(strings.Split(fname, ".")[0])
+}
+
+// contentSize finds the size of the content: S3 requires it before the upload starts. Uploaded files
+// are seekable, other readers are buffered in memory.
+func contentSize(file io.Reader) (io.Reader, int64, error) {
+	if seeker, ok := file.(io.Seeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, 0, err
+		}
+		end, err := seeker.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, err = seeker.Seek(start, io.SeekStart); err != nil {
+			return nil, 0, err
+		}
+		return file, end - start, nil
+	}
+
+	var buf bytes.Buffer
+	size, err := io.Copy(&buf, file)
+	return &buf, size, err
+}
+
+// object is a ReadSeekCloser of an S3 object. Data is requested from the current offset when
+// it's read for the first time after Seek.
+type object struct {
+	client *client
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (o *object) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		body, err := o.client.getObject(o.key, o.offset)
+		if err != nil {
+			return 0, err
+		}
+		o.body = body
+	}
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+func (o *object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	default:
+		return 0, errors.New("s3: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("s3: negative position")
+	}
+
+	if offset != o.offset {
+		o.Close()
+		o.offset = offset
+	}
+	return o.offset, nil
+}
+
+func (o *object) Close() error {
+	var err error
+	if o.body != nil {
+		err = o.body.Close()
+		o.body = nil
+	}
+	return err
+}
+
+func init() {
+	store.RegisterMediaHandler("s3", &s3handler{})
+}
@@ -0,0 +1,298 @@
+/******************************************************************************
+ *
+ *  Description :
+ *
+ *  User's preferences of push notifications: muted subscriptions, mentions-only
+ *  subscriptions and quiet hours. Mentions of users in messages.
+ *
+ *****************************************************************************/
+
+package main
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanfengpo/chat/server/push"
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+// Drafty entity type of a mention.
+const draftyMention = "MN"
+
+const (
+	// Number of goroutines which prepare and send push notifications.
+	pushWorkers = 8
+	// Number of push receipts waiting for the workers.
+	pushQueueSize = 1024
+	// How long preferences of users are cached for push notifications. Changes made at other
+	// cluster nodes take effect after this time.
+	pushPrefsLifetime = time.Minute
+	// Expired preferences are removed when the cache grows beyond this size.
+	pushPrefsCacheSize = 4096
+)
+
+// pushQueue passes push receipts from topics to the workers.
+var pushQueue chan *push.Receipt
+
+// pushPrefs are preferences of a user needed to send push notifications.
+type pushPrefs struct {
+	quiet *types.QuietHours
+	// Name of the user as the sender of the message.
+	name    string
+	expires time.Time
+}
+
+// pushPrefsCache keeps preferences of recently notified users so they are not loaded for every message.
+var pushPrefsCache = struct {
+	sync.Mutex
+	users map[types.Uid]*pushPrefs
+}{users: make(map[types.Uid]*pushPrefs)}
+
+// quietHoursPrefs converts quiet hours to a form suitable for sending to the client.
+func quietHoursPrefs(quiet *types.QuietHours) *MsgNotifyPrefs {
+	if quiet == nil {
+		return nil
+	}
+	clock := func(m int) string {
+		return time.Date(0, 1, 1, m/60, m%60, 0, 0, time.UTC).Format("15:04")
+	}
+	return &MsgNotifyPrefs{Quiet: &MsgQuietHours{
+		From:     clock(quiet.From),
+		To:       clock(quiet.To),
+		TimeZone: quiet.Location.String()}}
+}
+
+// subscriptionPrefs converts subscription's notification preferences to a form suitable for sending
+// to the client. Returns nil if the preferences have default values.
+func subscriptionPrefs(pud *perUserData, now time.Time) *MsgNotifyPrefs {
+	var prefs MsgNotifyPrefs
+	if pud.muteUntil.After(now) {
+		muteUntil := pud.muteUntil
+		prefs.MuteUntil = &muteUntil
+	}
+	if pud.mentionsOnly {
+		mentions := true
+		prefs.Mentions = &mentions
+	}
+	if prefs.MuteUntil == nil && prefs.Mentions == nil {
+		return nil
+	}
+	return &prefs
+}
+
+// wantsPush checks if the subscriber should receive a push notification of a message given
+// the subscription's preferences.
+func wantsPush(pud *perUserData, mentioned bool, now time.Time) bool {
+	if pud.muteUntil.After(now) {
+		return false
+	}
+	return !pud.mentionsOnly || mentioned
+}
+
+// mentionedUsers returns users mentioned in the message. Mentions are listed as user IDs in
+// head["mentions"] or are Drafty entities of type "MN" with the user ID as "val".
+func mentionedUsers(head map[string]interface{}, content interface{}) map[types.Uid]bool {
+	mentioned := make(map[types.Uid]bool)
+	add := func(val interface{}) {
+		if userID, ok := val.(string); ok && strings.HasPrefix(userID, "usr") {
+			if uid := types.ParseUserId(userID); !uid.IsZero() {
+				mentioned[uid] = true
+			}
+		}
+	}
+
+	if list, ok := head["mentions"].([]interface{}); ok {
+		for _, val := range list {
+			add(val)
+		}
+	}
+
+	if drafty, ok := content.(map[string]interface{}); ok {
+		ents, _ := drafty["ent"].([]interface{})
+		for _, ent := range ents {
+			if ent, ok := ent.(map[string]interface{}); ok && ent["tp"] == draftyMention {
+				if data, ok := ent["data"].(map[string]interface{}); ok {
+					add(data["val"])
+				}
+			}
+		}
+	}
+
+	return mentioned
+}
+
+// mentionedSubscribers returns the subscribers mentioned in the message, except the sender and users
+// who cannot read the message. Returns an error if any of the mentioned users is not subscribed.
+func (t *Topic) mentionedSubscribers(data *MsgServerData, from types.Uid) (map[types.Uid]bool, error) {
+	var err error
+	mentioned := mentionedUsers(data.Head, data.Content)
+	for uid := range mentioned {
+		if pud, ok := t.perUser[uid]; !ok {
+			err = errors.New("mentioned user is not subscribed")
+			delete(mentioned, uid)
+		} else if uid == from || !(pud.modeGiven & pud.modeWant).IsReader() {
+			delete(mentioned, uid)
+		}
+	}
+	return mentioned, err
+}
+
+// countMentions increments the counters of unread mentions of the given subscribers.
+func (t *Topic) countMentions(mentioned map[types.Uid]bool) {
+	for uid := range mentioned {
+		pud := t.perUser[uid]
+		pud.mentionCount++
+		if err := store.Subs.Update(t.name, uid,
+			map[string]interface{}{"MentionCount": pud.mentionCount}, false); err != nil {
+			log.Printf("topic[%s]: failed to update counter of mentions: %v", t.name, err)
+			continue
+		}
+		t.perUser[uid] = pud
+	}
+}
+
+// fullName returns the formatted name from the vCard in the public field, if any.
+func fullName(public interface{}) string {
+	if vcard, ok := public.(map[string]interface{}); ok {
+		if fn, ok := vcard["fn"].(string); ok {
+			return strings.TrimSpace(fn)
+		}
+	}
+	return ""
+}
+
+// startPushWorkers starts the goroutines which send push notifications queued by topics.
+func startPushWorkers() {
+	pushQueue = make(chan *push.Receipt, pushQueueSize)
+	for i := 0; i < pushWorkers; i++ {
+		go func() {
+			for rcpt := range pushQueue {
+				sendPush(rcpt)
+			}
+		}()
+	}
+}
+
+// queuePush passes the receipt to the push workers without blocking. The receipt is dropped if
+// the workers are busy.
+func queuePush(rcpt *push.Receipt) {
+	select {
+	case pushQueue <- rcpt:
+	default:
+		log.Println("push: queue is full, notification dropped", rcpt.Payload.Topic)
+	}
+}
+
+// loadPushPrefs returns preferences of the users. Preferences are loaded from the database only if
+// they are not cached. Users who are not found have no preferences.
+func loadPushPrefs(uids []types.Uid, now time.Time) map[types.Uid]*pushPrefs {
+	prefs := make(map[types.Uid]*pushPrefs, len(uids))
+	var missing []types.Uid
+	pushPrefsCache.Lock()
+	for _, uid := range uids {
+		if p := pushPrefsCache.users[uid]; p != nil && p.expires.After(now) {
+			prefs[uid] = p
+		} else {
+			missing = append(missing, uid)
+		}
+	}
+	pushPrefsCache.Unlock()
+	if len(missing) == 0 {
+		return prefs
+	}
+
+	users, err := store.Users.GetAll(missing...)
+	if err != nil {
+		// Better to disturb the user than to lose the notification.
+		log.Println("push: failed to load quiet hours", err)
+		return prefs
+	}
+	loaded := make(map[types.Uid]*pushPrefs, len(missing))
+	for _, uid := range missing {
+		loaded[uid] = &pushPrefs{expires: now.Add(pushPrefsLifetime)}
+	}
+	for i := range users {
+		p := loaded[users[i].Uid()]
+		if p == nil {
+			continue
+		}
+		p.name = fullName(users[i].Public)
+		if users[i].QuietHours != "" {
+			if p.quiet, err = types.ParseQuietHours(users[i].QuietHours); err != nil {
+				log.Println("push: invalid quiet hours of user", users[i].Id, err)
+			}
+		}
+	}
+
+	pushPrefsCache.Lock()
+	if len(pushPrefsCache.users) > pushPrefsCacheSize {
+		for uid, p := range pushPrefsCache.users {
+			if !p.expires.After(now) {
+				delete(pushPrefsCache.users, uid)
+			}
+		}
+	}
+	for uid, p := range loaded {
+		pushPrefsCache.users[uid] = p
+		prefs[uid] = p
+	}
+	pushPrefsCache.Unlock()
+	return prefs
+}
+
+// forgetPushPrefs removes cached preferences of the user after the user has changed them.
+func forgetPushPrefs(uid types.Uid) {
+	pushPrefsCache.Lock()
+	delete(pushPrefsCache.users, uid)
+	pushPrefsCache.Unlock()
+}
+
+// sendPush removes recipients who are within their quiet hours, adds the name of the sender for
+// the notification text and passes the receipt to push handlers.
+// It accesses the database and should not be called from the topic's goroutine.
+func sendPush(rcpt *push.Receipt) {
+	if len(rcpt.To) == 0 {
+		return
+	}
+
+	uids := make([]types.Uid, len(rcpt.To), len(rcpt.To)+1)
+	for i := range rcpt.To {
+		uids[i] = rcpt.To[i].User
+	}
+	from := types.ParseUserId(rcpt.Payload.From)
+	if !from.IsZero() {
+		uids = append(uids, from)
+	}
+
+	now := time.Now()
+	prefs := loadPushPrefs(uids, now)
+	if p := prefs[from]; p != nil {
+		rcpt.SenderName = p.name
+	}
+	quiet := make(map[types.Uid]bool)
+	for _, r := range rcpt.To {
+		if p := prefs[r.User]; p != nil && p.quiet != nil && p.quiet.Contains(now) {
+			quiet[r.User] = true
+		}
+	}
+
+	if len(quiet) > 0 {
+		to := rcpt.To[:0]
+		for _, r := range rcpt.To {
+			if !quiet[r.User] {
+				to = append(to, r)
+			}
+		}
+		rcpt.To = to
+		if len(to) == 0 {
+			return
+		}
+	}
+
+	push.Push(rcpt)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nanfengpo/chat/server/db/memory"
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+func TestLoadPushPrefs(t *testing.T) {
+	if err := memory.OpenTestStore(); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	user := &types.User{QuietHours: "22:00-07:00 Europe/Berlin", Public: map[string]interface{}{"fn": "Alice"}}
+	if _, err := store.Users.Create(user, nil); err != nil {
+		t.Fatal(err)
+	}
+	uid, missing := user.Uid(), types.Uid(12345)
+	defer forgetPushPrefs(uid)
+	defer forgetPushPrefs(missing)
+
+	now := time.Now()
+	prefs := loadPushPrefs([]types.Uid{uid, missing}, now)
+	if p := prefs[uid]; p == nil || p.name != "Alice" || p.quiet == nil || p.quiet.String() != user.QuietHours {
+		t.Fatal("unexpected preferences", prefs[uid])
+	}
+	if p := prefs[missing]; p == nil || p.quiet != nil {
+		t.Error("missing user must have no preferences", p)
+	}
+
+	// Cached preferences are used until they expire or are forgotten.
+	store.Users.Update(uid, map[string]interface{}{"QuietHours": ""})
+	if prefs = loadPushPrefs([]types.Uid{uid}, now); prefs[uid].quiet == nil {
+		t.Error("preferences must be cached")
+	}
+	if prefs = loadPushPrefs([]types.Uid{uid}, now.Add(pushPrefsLifetime)); prefs[uid].quiet != nil {
+		t.Error("expired preferences must be reloaded")
+	}
+	store.Users.Update(uid, map[string]interface{}{"QuietHours": user.QuietHours})
+	forgetPushPrefs(uid)
+	if prefs = loadPushPrefs([]types.Uid{uid}, now); prefs[uid].quiet == nil {
+		t.Error("forgotten preferences must be reloaded")
+	}
+}
@@ -29,12 +29,92 @@ func pbServCtrlSerialize(ctrl *MsgServerCtrl) *pbx.ServerMsg_Ctrl {
 
 func pbServDataSerialize(data *MsgServerData) *pbx.ServerMsg_Data {
 	return &pbx.ServerMsg_Data{Data: &pbx.ServerData{
-		Topic:      data.Topic,
-		FromUserId: data.From,
-		DeletedAt:  timeToInt64(data.DeletedAt),
-		SeqId:      int32(data.SeqId),
-		Head:       interfaceMapToByteMap(data.Head),
-		Content:    interfaceToBytes(data.Content)}}
+		Topic:       data.Topic,
+		FromUserId:  data.From,
+		DeletedAt:   timeToInt64(data.DeletedAt),
+		SeqId:       int32(data.SeqId),
+		Head:        interfaceMapToByteMap(data.Head),
+		Content:     interfaceToBytes(data.Content),
+		ReplyTo:     int32(data.ReplyTo),
+		ReplyCount:  int32(data.ReplyCount),
+		LastReplyAt: timeToInt64(data.LastReplyAt)}}
+}
+
+func pbServDataDeserialize(data *pbx.ServerData) *MsgServerData {
+	return &MsgServerData{
+		Topic:       data.GetTopic(),
+		From:        data.GetFromUserId(),
+		DeletedAt:   int64ToTime(data.GetDeletedAt()),
+		SeqId:       int(data.GetSeqId()),
+		Head:        byteMapToInterfaceMap(data.GetHead()),
+		Content:     data.GetContent(),
+		ReplyTo:     int(data.GetReplyTo()),
+		ReplyCount:  int(data.GetReplyCount()),
+		LastReplyAt: int64ToTime(data.GetLastReplyAt()),
+	}
+}
+
+func pbServDataSliceSerialize(msgs []MsgServerData) []*pbx.ServerData {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	out := make([]*pbx.ServerData, len(msgs))
+	for i := range msgs {
+		out[i] = pbServDataSerialize(&msgs[i]).Data
+	}
+	return out
+}
+
+func pbServDataSliceDeserialize(msgs []*pbx.ServerData) []MsgServerData {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	out := make([]MsgServerData, len(msgs))
+	for i, data := range msgs {
+		out[i] = *pbServDataDeserialize(data)
+	}
+	return out
+}
+
+func pbSessionInfoSliceSerialize(sessions []MsgSessionInfo) []*pbx.SessionInfo {
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	out := make([]*pbx.SessionInfo, len(sessions))
+	for i := range sessions {
+		in := &sessions[i]
+		out[i] = &pbx.SessionInfo{
+			Id:         in.Id,
+			Current:    in.Current,
+			DeviceId:   in.DeviceID,
+			Lang:       in.Lang,
+			UserAgent:  in.UserAgent,
+			RemoteAddr: in.RemoteAddr,
+			LastSeen:   timeToInt64(in.LastSeen)}
+	}
+	return out
+}
+
+func pbSessionInfoSliceDeserialize(sessions []*pbx.SessionInfo) []MsgSessionInfo {
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	out := make([]MsgSessionInfo, len(sessions))
+	for i, in := range sessions {
+		out[i] = MsgSessionInfo{
+			Id:         in.GetId(),
+			Current:    in.GetCurrent(),
+			DeviceID:   in.GetDeviceId(),
+			Lang:       in.GetLang(),
+			UserAgent:  in.GetUserAgent(),
+			RemoteAddr: in.GetRemoteAddr(),
+			LastSeen:   int64ToTime(in.GetLastSeen())}
+	}
+	return out
 }
 
 func pbServPresSerialize(pres *MsgServerPres) *pbx.ServerMsg_Pres {
@@ -84,16 +164,19 @@ func pbServInfoSerialize(info *MsgServerInfo) *pbx.ServerMsg_Info {
 		FromUserId: info.From,
 		What:       pbInfoNoteWhatSerialize(info.What),
 		SeqId:      int32(info.SeqId),
+		React:      info.Reaction,
 	}}
 }
 
 func pbServMetaSerialize(meta *MsgServerMeta) *pbx.ServerMsg_Meta {
 	return &pbx.ServerMsg_Meta{Meta: &pbx.ServerMeta{
-		Id:    meta.Id,
-		Topic: meta.Topic,
-		Desc:  pbTopicDescSerialize(meta.Desc),
-		Sub:   pbTopicSubSliceSerialize(meta.Sub),
-		Del:   pbDelValuesSerialize(meta.Del),
+		Id:     meta.Id,
+		Topic:  meta.Topic,
+		Desc:   pbTopicDescSerialize(meta.Desc),
+		Sub:    pbTopicSubSliceSerialize(meta.Sub),
+		Del:    pbDelValuesSerialize(meta.Del),
+		Search: pbServDataSliceSerialize(meta.Search),
+		Sess:   pbSessionInfoSliceSerialize(meta.Sess),
 	}}
 }
 
@@ -128,14 +211,7 @@ func pbServDeserialize(pkt *pbx.ServerMsg) *ServerComMessage {
 			Params: byteMapToInterfaceMap(ctrl.GetParams()),
 		}
 	} else if data := pkt.GetData(); data != nil {
-		msg.Data = &MsgServerData{
-			Topic:     data.GetTopic(),
-			From:      data.GetFromUserId(),
-			DeletedAt: int64ToTime(data.GetDeletedAt()),
-			SeqId:     int(data.GetSeqId()),
-			Head:      byteMapToInterfaceMap(data.GetHead()),
-			Content:   data.GetContent(),
-		}
+		msg.Data = pbServDataDeserialize(data)
 	} else if pres := pkt.GetPres(); pres != nil {
 		var what string
 		switch pres.GetWhat() {
@@ -176,18 +252,21 @@ func pbServDeserialize(pkt *pbx.ServerMsg) *ServerComMessage {
 		}
 	} else if info := pkt.GetInfo(); info != nil {
 		msg.Info = &MsgServerInfo{
-			Topic: info.GetTopic(),
-			From:  info.GetFromUserId(),
-			What:  pbInfoNoteWhatDeserialize(info.GetWhat()),
-			SeqId: int(info.GetSeqId()),
+			Topic:    info.GetTopic(),
+			From:     info.GetFromUserId(),
+			What:     pbInfoNoteWhatDeserialize(info.GetWhat()),
+			SeqId:    int(info.GetSeqId()),
+			Reaction: info.GetReact(),
 		}
 	} else if meta := pkt.GetMeta(); meta != nil {
 		msg.Meta = &MsgServerMeta{
-			Id:    meta.GetId(),
-			Topic: meta.GetTopic(),
-			Desc:  pbTopicDescDeserialize(meta.GetDesc()),
-			Sub:   pbTopicSubSliceDeserialize(meta.GetSub()),
-			Del:   pbDelValuesDeserialize(meta.GetDel()),
+			Id:     meta.GetId(),
+			Topic:  meta.GetTopic(),
+			Desc:   pbTopicDescDeserialize(meta.GetDesc()),
+			Sub:    pbTopicSubSliceDeserialize(meta.GetSub()),
+			Del:    pbDelValuesDeserialize(meta.GetDel()),
+			Search: pbServDataSliceDeserialize(meta.GetSearch()),
+			Sess:   pbSessionInfoSliceDeserialize(meta.GetSess()),
 		}
 	}
 	return &msg
@@ -238,7 +317,8 @@ func pbCliSerialize(msg *ClientComMessage) *pbx.ClientMsg {
 			Topic:   msg.Pub.Topic,
 			NoEcho:  msg.Pub.NoEcho,
 			Head:    interfaceMapToByteMap(msg.Pub.Head),
-			Content: interfaceToBytes(msg.Pub.Content)}}
+			Content: interfaceToBytes(msg.Pub.Content),
+			ReplyTo: int32(msg.Pub.ReplyTo)}}
 	case msg.Get != nil:
 		pkt.Message = &pbx.ClientMsg_Get{Get: &pbx.ClientGet{
 			Id:    msg.Get.Id,
@@ -258,6 +338,8 @@ func pbCliSerialize(msg *ClientComMessage) *pbx.ClientMsg {
 			what = pbx.ClientDel_TOPIC
 		case "sub":
 			what = pbx.ClientDel_SUB
+		case "sess":
+			what = pbx.ClientDel_SESS
 		}
 		pkt.Message = &pbx.ClientMsg_Del{Del: &pbx.ClientDel{
 			Id:     msg.Del.Id,
@@ -265,12 +347,14 @@ func pbCliSerialize(msg *ClientComMessage) *pbx.ClientMsg {
 			What:   what,
 			DelSeq: pbDelQuerySerialize(msg.Del.DelSeq),
 			UserId: msg.Del.User,
-			Hard:   msg.Del.Hard}}
+			Hard:   msg.Del.Hard,
+			Sess:   msg.Del.Sess}}
 	case msg.Note != nil:
 		pkt.Message = &pbx.ClientMsg_Note{Note: &pbx.ClientNote{
 			Topic: msg.Note.Topic,
 			What:  pbInfoNoteWhatSerialize(msg.Note.What),
-			SeqId: int32(msg.Note.SeqId)}}
+			SeqId: int32(msg.Note.SeqId),
+			React: msg.Note.Reaction}}
 	}
 
 	if pkt.Message == nil {
@@ -329,6 +413,7 @@ func pbCliDeserialize(pkt *pbx.ClientMsg) *ClientComMessage {
 			NoEcho:  pub.GetNoEcho(),
 			Head:    byteMapToInterfaceMap(pub.GetHead()),
 			Content: bytesToInterface(pub.GetContent()),
+			ReplyTo: int(pub.GetReplyTo()),
 		}
 	} else if get := pkt.GetGet(); get != nil {
 		msg.Get = &MsgClientGet{
@@ -349,6 +434,7 @@ func pbCliDeserialize(pkt *pbx.ClientMsg) *ClientComMessage {
 			DelSeq: pbDelQueryDeserialize(del.GetDelSeq()),
 			User:   del.GetUserId(),
 			Hard:   del.GetHard(),
+			Sess:   del.GetSess(),
 		}
 		switch del.GetWhat() {
 		case pbx.ClientDel_MSG:
@@ -357,11 +443,14 @@ func pbCliDeserialize(pkt *pbx.ClientMsg) *ClientComMessage {
 			msg.Del.What = "topic"
 		case pbx.ClientDel_SUB:
 			msg.Del.What = "sub"
+		case pbx.ClientDel_SESS:
+			msg.Del.What = "sess"
 		}
 	} else if note := pkt.GetNote(); note != nil {
 		msg.Note = &MsgClientNote{
-			Topic: note.GetTopic(),
-			SeqId: int(note.GetSeqId()),
+			Topic:    note.GetTopic(),
+			SeqId:    int(note.GetSeqId()),
+			Reaction: note.GetReact(),
 		}
 		switch note.GetWhat() {
 		case pbx.InfoNote_READ:
@@ -370,6 +459,10 @@ func pbCliDeserialize(pkt *pbx.ClientMsg) *ClientComMessage {
 			msg.Note.What = "recv"
 		case pbx.InfoNote_KP:
 			msg.Note.What = "kp"
+		case pbx.InfoNote_REACT:
+			msg.Note.What = "react"
+		case pbx.InfoNote_UNREACT:
+			msg.Note.What = "unreact"
 		}
 	}
 	return &msg
@@ -463,7 +556,16 @@ func pbGetQuerySerialize(in *MsgGetQuery) *pbx.GetQuery {
 		out.Data = &pbx.GetOpts{
 			BeforeId: int32(in.Data.BeforeId),
 			SinceId:  int32(in.Data.SinceId),
-			Limit:    int32(in.Data.Limit)}
+			Limit:    int32(in.Data.Limit),
+			Thread:   int32(in.Data.Thread)}
+	}
+	if in.Search != nil {
+		out.Search = &pbx.GetOpts{
+			Topic:    in.Search.Topic,
+			BeforeId: int32(in.Search.BeforeId),
+			SinceId:  int32(in.Search.SinceId),
+			Limit:    int32(in.Search.Limit),
+			Query:    in.Search.Query}
 	}
 	return out
 }
@@ -491,6 +593,16 @@ func pbGetQueryDeserialize(in *pbx.GetQuery) *MsgGetQuery {
 				BeforeId: int(data.GetBeforeId()),
 				SinceId:  int(data.GetSinceId()),
 				Limit:    int(data.GetLimit()),
+				Thread:   int(data.GetThread()),
+			}
+		}
+		if search := in.GetSearch(); search != nil {
+			msg.Search = &MsgGetOpts{
+				Topic:    search.GetTopic(),
+				BeforeId: int(search.GetBeforeId()),
+				SinceId:  int(search.GetSinceId()),
+				Limit:    int(search.GetLimit()),
+				Query:    search.GetQuery(),
 			}
 		}
 	}
@@ -537,6 +649,7 @@ func pbSetQuerySerialize(in *MsgSetQuery) *pbx.SetQuery {
 			Mode:   in.Sub.Mode,
 		}
 	}
+	out.Notify = pbNotifyPrefsSerialize(in.Notify)
 	return out
 }
 
@@ -553,11 +666,55 @@ func pbSetQueryDeserialize(in *pbx.SetQuery) *MsgSetQuery {
 				Mode: sub.GetMode(),
 			}
 		}
+		if notify := in.GetNotify(); notify != nil {
+			msg.Notify = pbNotifyPrefsDeserialize(notify)
+		}
 	}
 
 	return &msg
 }
 
+func pbNotifyPrefsSerialize(in *MsgNotifyPrefs) *pbx.NotifyPrefs {
+	if in == nil {
+		return nil
+	}
+
+	out := &pbx.NotifyPrefs{
+		Mute: timeToInt64(in.MuteUntil),
+	}
+	if in.Mentions != nil {
+		out.Mentions = *in.Mentions
+	}
+	if in.Quiet != nil {
+		out.Quiet = &pbx.QuietHours{
+			From: in.Quiet.From,
+			To:   in.Quiet.To,
+			Tz:   in.Quiet.TimeZone,
+		}
+	}
+	return out
+}
+
+// Protobuf cannot tell unset bool from false: if quiet hours are given, the rest is ignored (that's 'me'),
+// otherwise the mentions-only mode is always assigned.
+func pbNotifyPrefsDeserialize(in *pbx.NotifyPrefs) *MsgNotifyPrefs {
+	if quiet := in.GetQuiet(); quiet != nil {
+		return &MsgNotifyPrefs{
+			Quiet: &MsgQuietHours{
+				From:     quiet.GetFrom(),
+				To:       quiet.GetTo(),
+				TimeZone: quiet.GetTz(),
+			},
+		}
+	}
+
+	mentions := in.GetMentions()
+	return &MsgNotifyPrefs{
+		MuteUntil: int64ToTime(in.GetMute()),
+		Mentions:  &mentions,
+	}
+}
+
 func pbInfoNoteWhatSerialize(what string) pbx.InfoNote {
 	var out pbx.InfoNote
 	switch what {
@@ -567,6 +724,10 @@ func pbInfoNoteWhatSerialize(what string) pbx.InfoNote {
 		out = pbx.InfoNote_READ
 	case "recv":
 		out = pbx.InfoNote_RECV
+	case "react":
+		out = pbx.InfoNote_REACT
+	case "unreact":
+		out = pbx.InfoNote_UNREACT
 	default:
 		log.Fatal("unknown info-note.what", what)
 	}
@@ -582,6 +743,10 @@ func pbInfoNoteWhatDeserialize(what pbx.InfoNote) string {
 		out = "read"
 	case pbx.InfoNote_RECV:
 		out = "recv"
+	case pbx.InfoNote_REACT:
+		out = "react"
+	case pbx.InfoNote_UNREACT:
+		out = "unreact"
 	default:
 		log.Fatal("unknown info-note.what", what)
 	}
@@ -647,6 +812,7 @@ func pbTopicDescSerialize(desc *MsgTopicDesc) *pbx.TopicDesc {
 		DelId:     int32(desc.DelId),
 		Public:    interfaceToBytes(desc.Public),
 		Private:   interfaceToBytes(desc.Private),
+		Notify:    pbNotifyPrefsSerialize(desc.Notify),
 	}
 }
 
@@ -666,9 +832,23 @@ func pbTopicDescDeserialize(desc *pbx.TopicDesc) *MsgTopicDesc {
 		DelId:      int(desc.DelId),
 		Public:     bytesToInterface(desc.Public),
 		Private:    bytesToInterface(desc.Private),
+		Notify:     pbTopicNotifyDeserialize(desc.GetNotify()),
 	}
 }
 
+// pbTopicNotifyDeserialize converts preferences reported in topic description, where the
+// default values are omitted.
+func pbTopicNotifyDeserialize(in *pbx.NotifyPrefs) *MsgNotifyPrefs {
+	if in == nil {
+		return nil
+	}
+	out := pbNotifyPrefsDeserialize(in)
+	if out.Mentions != nil && !*out.Mentions {
+		out.Mentions = nil
+	}
+	return out
+}
+
 func pbTopicSerialize(topic *Topic) *pbx.TopicDesc {
 	if topic == nil {
 		return nil
@@ -705,6 +885,7 @@ func pbTopicSubSerialize(sub *MsgTopicSub) *pbx.TopicSub {
 		Acs:       pbAccessModeSerialize(&sub.Acs),
 		ReadId:    int32(sub.ReadSeqId),
 		RecvId:    int32(sub.RecvSeqId),
+		Mentions:  int32(sub.Mentions),
 		Public:    interfaceToBytes(sub.Public),
 		Private:   interfaceToBytes(sub.Private),
 		UserId:    sub.User,
@@ -733,6 +914,7 @@ func pbTopicSubSliceDeserialize(subs []*pbx.TopicSub) []MsgTopicSub {
 			Online:    subs[i].GetOnline(),
 			ReadSeqId: int(subs[i].GetReadId()),
 			RecvSeqId: int(subs[i].GetRecvId()),
+			Mentions:  int(subs[i].GetMentions()),
 			Public:    bytesToInterface(subs[i].GetPublic()),
 			Private:   bytesToInterface(subs[i].GetPrivate()),
 			User:      subs[i].GetUserId(),
@@ -0,0 +1,383 @@
+// Package apns implements push notifications to iOS devices through the Apple Push Notification
+// service. The handler uses token-based authentication with a .p8 signing key over HTTP/2.
+package apns
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nanfengpo/chat/server/push"
+	"github.com/nanfengpo/chat/server/store"
+	t "github.com/nanfengpo/chat/server/store/types"
+	"golang.org/x/net/http2"
+)
+
+var handler Handler
+
+const (
+	// Size of the input channel buffer.
+	defaultBuffer = 32
+
+	// APNs endpoints.
+	productionEndpoint = "https://api.push.apple.com"
+	sandboxEndpoint    = "https://api.sandbox.push.apple.com"
+
+	// APNs rejects provider tokens older than one hour and throttles tokens refreshed
+	// more often than every 20 minutes.
+	tokenLifetime = 50 * time.Minute
+
+	// Time to wait for APNs to respond.
+	requestTimeout = 10 * time.Second
+)
+
+// Handler represents the push handler; implements push.PushHandler interface.
+type Handler struct {
+	input  chan *push.Receipt
+	stop   chan bool
+	client *http.Client
+
+	endpoint  string
+	platforms map[string]bool
+
+	keyID  string
+	teamID string
+	key    *ecdsa.PrivateKey
+}
+
+// Cached provider token.
+var providerCache struct {
+	sync.Mutex
+	token    string
+	issuedAt time.Time
+}
+
+type configType struct {
+	Enabled bool `json:"enabled"`
+	Buffer  int  `json:"buffer"`
+	// Path to the .p8 file with the signing key.
+	KeyFile string `json:"key_file"`
+	// ID of the signing key.
+	KeyID string `json:"key_id"`
+	// ID of the Apple developer team.
+	TeamID string `json:"team_id"`
+	// Bundle ID of the app.
+	Topic string `json:"topic"`
+	// Use production endpoint instead of the sandbox.
+	Production bool `json:"production"`
+	// Alternative endpoint, for testing.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Platforms of devices to send to. Default ["ios"]. Only APNs device tokens are sent to,
+	// FCM registration tokens of the same platforms are left to the fcm handler.
+	Platforms []string `json:"platforms,omitempty"`
+	// Notification sound.
+	Sound string `json:"sound,omitempty"`
+	// Time in seconds before notification is discarded if undelivered (by Apple).
+	TimeToLive uint `json:"time_to_live,omitempty"`
+}
+
+// aps is the dictionary of the standard notification fields.
+type aps struct {
+	Alert          *alert `json:"alert,omitempty"`
+	Sound          string `json:"sound,omitempty"`
+	MutableContent int    `json:"mutable-content,omitempty"`
+	ThreadID       string `json:"thread-id,omitempty"`
+	// "time-sensitive" notifications break through Focus modes.
+	InterruptionLevel string `json:"interruption-level,omitempty"`
+}
+
+type alert struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+// notification is the JSON payload sent to APNs.
+type notification struct {
+	Aps       aps       `json:"aps"`
+	Topic     string    `json:"topic"`
+	From      string    `json:"xfrom"`
+	Timestamp time.Time `json:"ts"`
+	SeqId     int       `json:"seq"`
+}
+
+// response is the body of the APNs response to a failed request.
+type response struct {
+	Reason string `json:"reason"`
+}
+
+// Init initializes the push handler
+func (Handler) Init(jsonconf string) error {
+
+	var config configType
+	if err := json.Unmarshal([]byte(jsonconf), &config); err != nil {
+		return errors.New("failed to parse config: " + err.Error())
+	}
+
+	if !config.Enabled {
+		return nil
+	}
+
+	if config.KeyID == "" || config.TeamID == "" || config.Topic == "" {
+		return errors.New("apns: key_id, team_id and topic must be set")
+	}
+
+	pemBytes, err := ioutil.ReadFile(config.KeyFile)
+	if err != nil {
+		return errors.New("apns: failed to read signing key: " + err.Error())
+	}
+	if handler.key, err = parseKey(pemBytes); err != nil {
+		return err
+	}
+	handler.keyID = config.KeyID
+	handler.teamID = config.TeamID
+
+	switch {
+	case config.Endpoint != "":
+		handler.endpoint = config.Endpoint
+	case config.Production:
+		handler.endpoint = productionEndpoint
+	default:
+		handler.endpoint = sandboxEndpoint
+	}
+
+	if len(config.Platforms) == 0 {
+		config.Platforms = []string{"ios"}
+	}
+	handler.platforms = make(map[string]bool, len(config.Platforms))
+	for _, p := range config.Platforms {
+		handler.platforms[p] = true
+	}
+
+	if handler.client == nil {
+		// APNs requires HTTP/2.
+		handler.client = &http.Client{Transport: &http2.Transport{}, Timeout: requestTimeout}
+	}
+
+	if config.Buffer <= 0 {
+		config.Buffer = defaultBuffer
+	}
+
+	handler.input = make(chan *push.Receipt, config.Buffer)
+	handler.stop = make(chan bool, 1)
+
+	go func() {
+		for {
+			select {
+			case rcpt := <-handler.input:
+				go sendNotification(rcpt, &config)
+			case <-handler.stop:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// parseKey parses the PEM-encoded PKCS#8 ECDSA key, the contents of the .p8 file.
+func parseKey(pemBytes []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("apns: signing key is not PEM-encoded")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("apns: failed to parse signing key: " + err.Error())
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("apns: signing key must be ECDSA")
+	}
+	return ecKey, nil
+}
+
+// providerToken returns a cached JWT signed with ES256, refreshing it if it's too old.
+func providerToken() (string, error) {
+	providerCache.Lock()
+	defer providerCache.Unlock()
+
+	now := time.Now()
+	if providerCache.token != "" && now.Sub(providerCache.issuedAt) < tokenLifetime {
+		return providerCache.token, nil
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": handler.keyID})
+	claims, _ := json.Marshal(map[string]interface{}{"iss": handler.teamID, "iat": now.Unix()})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, handler.key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	// JWS signature is R and S as fixed-size big-endian integers.
+	size := (handler.key.Curve.Params().BitSize + 7) / 8
+	sig := make([]byte, 2*size)
+	r.FillBytes(sig[:size])
+	s.FillBytes(sig[size:])
+
+	providerCache.token = unsigned + "." + base64.RawURLEncoding.EncodeToString(sig)
+	providerCache.issuedAt = now
+	return providerCache.token, nil
+}
+
+// resetToken forces generation of a new provider token on the next request.
+func resetToken() {
+	providerCache.Lock()
+	providerCache.token = ""
+	providerCache.Unlock()
+}
+
+func sendNotification(rcpt *push.Receipt, config *configType) {
+	// List of UIDs for querying the database
+	uids := make([]t.Uid, len(rcpt.To))
+	skipDevices := make(map[string]bool)
+	highPriority := make(map[t.Uid]bool)
+	for i, to := range rcpt.To {
+		uids[i] = to.User
+		highPriority[to.User] = to.HighPriority
+
+		// Some devices were online and received the message. Skip them.
+		for _, deviceID := range to.Devices {
+			skipDevices[deviceID] = true
+		}
+	}
+
+	devices, count, err := store.Devices.GetAll(uids...)
+	if err != nil || count == 0 {
+		return
+	}
+
+	// Notifications are rendered in the language of the device. Users mentioned in the message
+	// get a time-sensitive notification.
+	payloads := make(map[string][]byte)
+	payload := func(lang string, urgent bool) ([]byte, error) {
+		key := lang
+		if urgent {
+			key += "!"
+		}
+		if data := payloads[key]; data != nil {
+			return data, nil
+		}
+		title, body := push.Render(rcpt, lang)
+		ntf := notification{
+			Aps: aps{
+				Alert:          &alert{Title: title, Body: body},
+				Sound:          config.Sound,
+				MutableContent: 1,
+				ThreadID:       rcpt.Payload.Topic,
+			},
+			Topic:     rcpt.Payload.Topic,
+			From:      rcpt.Payload.From,
+			Timestamp: rcpt.Payload.Timestamp,
+			SeqId:     rcpt.Payload.SeqId,
+		}
+		if urgent {
+			ntf.Aps.InterruptionLevel = "time-sensitive"
+		}
+		data, err := json.Marshal(&ntf)
+		payloads[key] = data
+		return data, err
+	}
+
+	var expiration string
+	if config.TimeToLive > 0 {
+		expiration = strconv.FormatInt(time.Now().Add(time.Duration(config.TimeToLive)*time.Second).Unix(), 10)
+	}
+
+	for uid, devList := range devices {
+		for i := range devList {
+			d := &devList[i]
+			// Other device IDs of iOS devices are FCM registration tokens, they are handled by the fcm handler.
+			if skipDevices[d.DeviceId] || !handler.platforms[d.Platform] || !push.IsApnsToken(d.DeviceId) {
+				continue
+			}
+			body, err := payload(d.Lang, highPriority[uid])
+			if err != nil {
+				log.Println("apns: failed to serialize notification", err)
+				return
+			}
+			if unregistered, err := sendToDevice(d.DeviceId, config.Topic, expiration, body); err != nil {
+				log.Println("apns: push failed", err)
+			} else if unregistered {
+				store.Devices.Delete(uid, d.DeviceId)
+			}
+		}
+	}
+}
+
+// sendToDevice sends one notification. Returns true if the device token is no longer valid.
+func sendToDevice(deviceID, topic, expiration string, payload []byte) (bool, error) {
+	token, err := providerToken()
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, handler.endpoint+"/3/device/"+deviceID, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("authorization", "bearer "+token)
+	req.Header.Set("apns-topic", topic)
+	req.Header.Set("apns-push-type", "alert")
+	// These are IM messages, they are high priority.
+	req.Header.Set("apns-priority", "10")
+	if expiration != "" {
+		req.Header.Set("apns-expiration", expiration)
+	}
+
+	resp, err := handler.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return false, nil
+	}
+
+	var result response
+	json.NewDecoder(resp.Body).Decode(&result)
+
+	switch {
+	case resp.StatusCode == http.StatusGone,
+		resp.StatusCode == http.StatusBadRequest && (result.Reason == "BadDeviceToken" ||
+			result.Reason == "DeviceTokenNotForTopic"):
+		return true, nil
+	case resp.StatusCode == http.StatusForbidden && result.Reason == "ExpiredProviderToken":
+		resetToken()
+	}
+	return false, errors.New("apns: " + strconv.Itoa(resp.StatusCode) + " " + result.Reason)
+}
+
+// IsReady checks if the push handler has been initialized.
+func (Handler) IsReady() bool {
+	return handler.input != nil
+}
+
+// Push return a channel that the server will use to send messages to.
+// If the adapter blocks, the message will be dropped.
+func (Handler) Push() chan<- *push.Receipt {
+	return handler.input
+}
+
+// Stop shuts down the handler
+func (Handler) Stop() {
+	handler.stop <- true
+}
+
+func init() {
+	push.Register("apns", &handler)
+}
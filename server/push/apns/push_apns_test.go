@@ -0,0 +1,181 @@
+package apns
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nanfengpo/chat/server/db/memory"
+	"github.com/nanfengpo/chat/server/push"
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+// mockAPNs is a local HTTP/2 endpoint which behaves like APNs: it checks the provider token and
+// rejects device tokens starting with "dead" as unregistered.
+type mockAPNs struct {
+	*httptest.Server
+	key *ecdsa.PublicKey
+
+	lock     sync.Mutex
+	received map[string]notification
+}
+
+func newMockAPNs(key *ecdsa.PublicKey) *mockAPNs {
+	m := &mockAPNs{key: key, received: make(map[string]notification)}
+	m.Server = httptest.NewUnstartedServer(http.HandlerFunc(m.serve))
+	m.EnableHTTP2 = true
+	m.StartTLS()
+	return m
+}
+
+func (m *mockAPNs) serve(wr http.ResponseWriter, req *http.Request) {
+	reply := func(status int, reason string) {
+		wr.WriteHeader(status)
+		if reason != "" {
+			json.NewEncoder(wr).Encode(&response{Reason: reason})
+		}
+	}
+
+	if req.ProtoMajor != 2 {
+		reply(http.StatusBadRequest, "BadProtocol")
+		return
+	}
+	if req.Method != http.MethodPost || !strings.HasPrefix(req.URL.Path, "/3/device/") {
+		reply(http.StatusNotFound, "BadPath")
+		return
+	}
+	if !m.validToken(strings.TrimPrefix(req.Header.Get("authorization"), "bearer ")) {
+		reply(http.StatusForbidden, "InvalidProviderToken")
+		return
+	}
+	if req.Header.Get("apns-topic") == "" {
+		reply(http.StatusBadRequest, "MissingTopic")
+		return
+	}
+
+	deviceID := strings.TrimPrefix(req.URL.Path, "/3/device/")
+	if strings.HasPrefix(deviceID, "dead") {
+		reply(http.StatusGone, "Unregistered")
+		return
+	}
+
+	var ntf notification
+	if err := json.NewDecoder(req.Body).Decode(&ntf); err != nil {
+		reply(http.StatusBadRequest, "BadPayload")
+		return
+	}
+	m.lock.Lock()
+	m.received[deviceID] = ntf
+	m.lock.Unlock()
+	reply(http.StatusOK, "")
+}
+
+func (m *mockAPNs) validToken(token string) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(sig) != 64 {
+		return false
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	return ecdsa.Verify(m.key, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]))
+}
+
+func TestSendNotification(t *testing.T) {
+	if err := memory.OpenTestStore(); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	dir, err := ioutil.TempDir("", "apns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "AuthKey.p8")
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mock := newMockAPNs(&key.PublicKey)
+	defer mock.Close()
+
+	handler.client = mock.Client()
+	conf, _ := json.Marshal(map[string]interface{}{"enabled": true, "key_file": keyFile, "key_id": "ABC123DEFG",
+		"team_id": "DEF123GHIJ", "topic": "co.tinode.app", "endpoint": mock.URL})
+	if err := handler.Init(string(conf)); err != nil {
+		t.Fatal(err)
+	}
+	defer handler.Stop()
+
+	var uids []types.Uid
+	for i := 0; i < 2; i++ {
+		user, err := store.Users.Create(&types.User{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uids = append(uids, user.Uid())
+	}
+	alice, bob := uids[0], uids[1]
+	// APNs device tokens are hex strings. The mock treats tokens which start with "dead" as unregistered.
+	alicePhone, deadBobPhone, bobTablet := strings.Repeat("a1", 32), "dead"+strings.Repeat("0", 60), strings.Repeat("b2", 32)
+	for uid, devs := range map[types.Uid][]types.DeviceDef{
+		alice: {{DeviceId: alicePhone, Platform: "ios"}, {DeviceId: "alice-web", Platform: "web"},
+			{DeviceId: "alice-fcm:APA91bHun4MxP5egoKMwt2KZFBaFUH", Platform: "ios"}},
+		bob: {{DeviceId: deadBobPhone, Platform: "ios"}, {DeviceId: bobTablet, Platform: "ios"},
+			{DeviceId: "dead-bob-fcm:APA91bHun4MxP5egoKMwt2KZFBaFUH", Platform: "ios"}},
+	} {
+		for i := range devs {
+			if err := store.Devices.Update(uid, "", &devs[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	sendNotification(&push.Receipt{
+		To:      []push.Recipient{{User: alice, HighPriority: true}, {User: bob, Delivered: 1, Devices: []string{bobTablet}}},
+		Payload: push.Payload{Topic: "grpAbc", From: alice.UserId(), SeqId: 7, Content: "hello"},
+	}, &configType{Topic: "co.tinode.app"})
+
+	if len(mock.received) != 1 {
+		t.Fatal("expected one notification, got", mock.received)
+	}
+	ntf, ok := mock.received[alicePhone]
+	if !ok || ntf.Aps.Alert == nil || ntf.Aps.Alert.Body != "hello" || ntf.SeqId != 7 || ntf.Topic != "grpAbc" ||
+		ntf.Aps.InterruptionLevel != "time-sensitive" {
+		t.Error("wrong notification", mock.received)
+	}
+
+	// FCM tokens are not touched.
+	devices, _, _ := store.Devices.GetAll(bob)
+	if len(devices[bob]) != 2 {
+		t.Error("only the unregistered APNs device must be deleted", devices[bob])
+	}
+	for _, d := range devices[bob] {
+		if d.DeviceId == deadBobPhone {
+			t.Error("unregistered device must be deleted", devices[bob])
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package push
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Conversion of message content to plain text suitable for a notification. See docs/drafty.md
+// for the description of the Drafty format.
+
+// PlainText converts message content to plain text. Strings are returned unchanged except for
+// whitespace. Drafty formatting is dropped, images and attachments are replaced with the labels
+// of the given language. Content of other types produces an empty string.
+func PlainText(content interface{}, lang *Language) string {
+	var text string
+	switch content := content.(type) {
+	case string:
+		text = content
+	case map[string]interface{}:
+		text = draftyToText(content, lang)
+	}
+	// Collapse line breaks and repeated spaces.
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// span is a part of Drafty text replaced with the label of an entity.
+type span struct {
+	at, end int
+	label   string
+}
+
+func draftyToText(drafty map[string]interface{}, lang *Language) string {
+	txt, _ := drafty["txt"].(string)
+	text := []rune(txt)
+	fmts, _ := drafty["fmt"].([]interface{})
+	ents, _ := drafty["ent"].([]interface{})
+
+	var spans []span
+	var appended []string
+	for _, f := range fmts {
+		style, ok := f.(map[string]interface{})
+		if !ok || style["tp"] != nil {
+			// Inline styles don't change the text.
+			continue
+		}
+		key := intValue(style["key"])
+		if key < 0 || key >= len(ents) {
+			continue
+		}
+		label := entityLabel(ents[key], lang)
+		if label == "" {
+			// Links and mentions are already in the text.
+			continue
+		}
+
+		at := intValue(style["at"])
+		if at < 0 || at > len(text) {
+			// Attachments are shown after the text.
+			appended = append(appended, label)
+			continue
+		}
+		end := at + intValue(style["len"])
+		if end < at || end > len(text) {
+			end = len(text)
+		}
+		spans = append(spans, span{at: at, end: end, label: label})
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].at < spans[j].at })
+
+	var out []string
+	pos := 0
+	for _, s := range spans {
+		if s.at < pos {
+			// Overlapping entities.
+			continue
+		}
+		out = append(out, string(text[pos:s.at]), " "+s.label+" ")
+		pos = s.end
+	}
+	out = append(out, string(text[pos:]))
+	out = append(out, appended...)
+
+	return strings.Join(out, " ")
+}
+
+// entityLabel returns the summary of an image or an attachment. Other entities produce empty string.
+func entityLabel(ent interface{}, lang *Language) string {
+	entity, ok := ent.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	data, _ := entity["data"].(map[string]interface{})
+	name, _ := data["name"].(string)
+
+	var label string
+	switch entity["tp"] {
+	case "IM":
+		label = lang.Image
+	case "EX":
+		label = lang.Attachment
+	default:
+		return ""
+	}
+	if name = strings.TrimSpace(name); name != "" {
+		label += " " + name
+	}
+	return label
+}
+
+// intValue converts a JSON number to int. Missing and invalid values are 0.
+func intValue(val interface{}) int {
+	switch val := val.(type) {
+	case float64:
+		return int(val)
+	case int:
+		return val
+	case json.Number:
+		i, _ := val.Int64()
+		return int(i)
+	}
+	return 0
+}
+
+// Truncate shortens the text to at most limit characters including the trailing ellipsis. The
+// text is cut at a word boundary unless it means losing more than a quarter of the limit.
+func Truncate(text string, limit int) string {
+	runes := []rune(text)
+	if limit <= 0 || len(runes) <= limit {
+		return text
+	}
+	cut := limit - 1
+	for i := cut; i > cut*3/4; i-- {
+		if unicode.IsSpace(runes[i]) {
+			cut = i
+			break
+		}
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace) + "…"
+}
@@ -3,6 +3,7 @@ package fcm
 import (
 	"encoding/json"
 	"errors"
+	"strings"
 
 	"github.com/nanfengpo/chat/server/push"
 	"github.com/nanfengpo/chat/server/store"
@@ -85,78 +86,74 @@ func sendNotification(rcpt *push.Receipt, config *configType) {
 		return
 	}
 
-	sendTo := make([]string, count)
-	count = 0
-	for _, devList := range devices {
+	// Devices are grouped by language: the notification text is rendered once per language.
+	sendTo := make(map[string][]string)
+	// Inverse index for removing failed devices.
+	devIds := make(map[string]t.Uid)
+	for uid, devList := range devices {
 		for i := range devList {
 			d := &devList[i]
+			// Web Push subscriptions are JSON objects, they are handled by the webpush handler.
+			// APNs device tokens are handled by the apns handler.
+			if strings.HasPrefix(d.DeviceId, "{") || push.IsApnsToken(d.DeviceId) {
+				continue
+			}
 			if _, ok := skipDevices[d.DeviceId]; !ok {
-				sendTo[count] = d.DeviceId
-				count++
+				sendTo[d.Lang] = append(sendTo[d.Lang], d.DeviceId)
+				devIds[d.DeviceId] = uid
 			}
 		}
 	}
 
-	msg := &fcm.HttpMessage{
-		To:               "",
-		RegistrationIds:  sendTo,
-		CollapseKey:      config.CollapseKey, // Optionally collapse several notification messages (i.e. "message sent")
-		Priority:         fcm.PriorityHigh,   // These are IM messages, they are high priority
-		ContentAvailable: true,               // to wake up the iOS app
-		TimeToLive:       &config.TimeToLive,
-		DryRun:           false,
-		// FIXME(gene): the real plugin must understand the structure of data to
-		// ensure it does not exceed 4KB. Messages on "me" are structured and must be converted to text first.
-		Data: rcpt.Payload,
-		Notification: &fcm.Notification{
-			Title:        "X sent a message",
-			Body:         "X sent a message",
-			Sound:        "default",
-			ClickAction:  "",
-			BodyLocKey:   "",
-			BodyLocArgs:  "",
-			TitleLocKey:  "",
-			TitleLocArgs: "",
-
-			// Android only
-			Icon:  config.Icon,
-			Tag:   "", // use some tag for coalesing notifications
-			Color: config.IconColor,
-
-			// iOS only
-			Badge: "",
-		},
-	}
-
-	resp, err := handler.client.SendHttp(msg)
-	if err != nil {
-		return
-	}
+	for lang, regIds := range sendTo {
+		title, body := push.Render(rcpt, lang)
+		msg := &fcm.HttpMessage{
+			To:               "",
+			RegistrationIds:  regIds,
+			CollapseKey:      config.CollapseKey, // Optionally collapse several notification messages (i.e. "message sent")
+			Priority:         fcm.PriorityHigh,   // These are IM messages, they are high priority
+			ContentAvailable: true,               // to wake up the iOS app
+			TimeToLive:       &config.TimeToLive,
+			DryRun:           false,
+			// FIXME(gene): the real plugin must understand the structure of data to
+			// ensure it does not exceed 4KB. Messages on "me" are structured and must be converted to text first.
+			Data: rcpt.Payload,
+			Notification: &fcm.Notification{
+				Title:        title,
+				Body:         body,
+				Sound:        "default",
+				ClickAction:  "",
+				BodyLocKey:   "",
+				BodyLocArgs:  "",
+				TitleLocKey:  "",
+				TitleLocArgs: "",
+
+				// Android only
+				Icon:  config.Icon,
+				Tag:   "", // use some tag for coalesing notifications
+				Color: config.IconColor,
+
+				// iOS only
+				Badge: "",
+			},
+		}
 
-	if resp.Fail > 0 {
-		// Generate an inverse index to speed up processing
-		devIds := make(map[string]t.Uid)
-		for uid, devList := range devices {
-			for i := range devList {
-				devIds[devList[i].DeviceId] = uid
-			}
+		resp, err := handler.client.SendHttp(msg)
+		if err != nil || resp.Fail == 0 {
+			continue
 		}
 
-		count = 0
 		for i := range resp.Results {
 			switch resp.Results[i].Error {
 			case fcm.ErrorInvalidRegistration,
 				fcm.ErrorNotRegistered,
 				fcm.ErrorMismatchSenderId:
-				if uid, ok := devIds[sendTo[count]]; ok {
-					store.Devices.Delete(uid, sendTo[count])
-					// log.Printf("FCM push: %s; token removed: %s", fail.Error, sendTo[i])
+				if uid, ok := devIds[regIds[i]]; ok {
+					store.Devices.Delete(uid, regIds[i])
 				}
 			}
-			count++
 		}
 	}
-
 }
 
 // IsReady checks if the push handler has been initialized.
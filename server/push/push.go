@@ -3,8 +3,10 @@ package push
 // Interfaces for push notifications
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"expvar"
 	"time"
 
 	t "github.com/nanfengpo/chat/server/store/types"
@@ -18,6 +20,8 @@ type Recipient struct {
 	Delivered int `json:"delivered"`
 	// List of user's devices that the packet was delivered to (if known). Len(Devices) >= Delivered
 	Devices []string `json:"devices,omitempty"`
+	// The message mentions the user and should be delivered with high priority
+	HighPriority bool `json:"high,omitempty"`
 }
 
 // Receipt is the push payload with a list of recipients.
@@ -26,6 +30,9 @@ type Receipt struct {
 	To []Recipient `json:"to"`
 	// Actual content to be delivered to the client
 	Payload Payload `json:"payload"`
+	// Display names of the sender and of the group topic for the notification text, if known
+	SenderName string `json:"sender_name,omitempty"`
+	TopicName  string `json:"topic_name,omitempty"`
 }
 
 // Payload is content of the push.
@@ -55,6 +62,13 @@ type Handler interface {
 	Stop()
 }
 
+// DropReporter may be implemented by handlers which want to know about receipts dropped because
+// the handler's channel was full.
+type DropReporter interface {
+	// Dropped is called with the receipt which was not delivered to the handler. Must not block.
+	Dropped(rcpt *Receipt)
+}
+
 type configType struct {
 	Name   string          `json:"name"`
 	Config json.RawMessage `json:"config"`
@@ -62,6 +76,20 @@ type configType struct {
 
 var handlers map[string]Handler
 
+// Count of receipts dropped by each handler because the handler was busy.
+var dropped = expvar.NewMap("PushDropped")
+
+// IsApnsToken checks if the device ID is an APNs device token: a hex string of at least 32 bytes.
+// Such devices are served by the apns handler, other handlers must skip them. FCM registration tokens
+// and Web Push subscriptions always contain other characters.
+func IsApnsToken(deviceID string) bool {
+	if len(deviceID) < 64 {
+		return false
+	}
+	_, err := hex.DecodeString(deviceID)
+	return err == nil
+}
+
 // Register a push handler
 func Register(name string, hnd Handler) {
 	if handlers == nil {
@@ -102,7 +130,7 @@ func Push(msg *Receipt) {
 		return
 	}
 
-	for _, hnd := range handlers {
+	for name, hnd := range handlers {
 		if !hnd.IsReady() {
 			continue
 		}
@@ -111,6 +139,10 @@ func Push(msg *Receipt) {
 		select {
 		case hnd.Push() <- msg:
 		default:
+			dropped.Add(name, 1)
+			if dr, ok := hnd.(DropReporter); ok {
+				dr.Dropped(msg)
+			}
 		}
 	}
 }
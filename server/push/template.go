@@ -0,0 +1,219 @@
+package push
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"text/template"
+
+	t "github.com/nanfengpo/chat/server/store/types"
+)
+
+// Localized templates of notification title and body.
+
+const (
+	// Default maximum length of the notification title in characters.
+	defaultMaxTitleLength = 64
+	// Default maximum length of the notification body in characters.
+	defaultMaxBodyLength = 128
+	// Language used when the device language has no templates.
+	defaultLang = "en"
+)
+
+// Language is a set of templates and labels for notifications in one language. Templates use
+// the syntax of text/template with fields {{.Sender}}, {{.Topic}} and {{.Text}}: the names of
+// the sender and the group topic and the plain text of the message.
+type Language struct {
+	// Title and body of notifications from p2p topics.
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	// Title and body of notifications from group topics.
+	GroupTitle string `json:"group_title"`
+	GroupBody  string `json:"group_body"`
+	// Text used when the message has no text, like a form.
+	NewMessage string `json:"new_message"`
+	// Labels which replace images and attachments in the text.
+	Image      string `json:"image"`
+	Attachment string `json:"attachment"`
+
+	title, body, groupTitle, groupBody *template.Template
+}
+
+// templateData is the value passed to the templates.
+type templateData struct {
+	Sender string
+	Topic  string
+	Text   string
+}
+
+type templatesConfig struct {
+	// Language to use if the device language is unknown or has no templates.
+	DefaultLang string `json:"default_lang"`
+	// Maximum length of the title and body in characters.
+	MaxTitleLength int `json:"max_title_length"`
+	MaxBodyLength  int `json:"max_body_length"`
+	// Templates by language code, like "en" or "pt-br".
+	Languages map[string]*Language `json:"languages"`
+}
+
+// Built-in templates, used if no templates are configured.
+var english = Language{
+	Title:      `{{or .Sender "New message"}}`,
+	Body:       `{{.Text}}`,
+	GroupTitle: `{{or .Topic "New message"}}`,
+	GroupBody:  `{{if .Sender}}{{.Sender}}: {{end}}{{.Text}}`,
+	NewMessage: "New message",
+	Image:      "[image]",
+	Attachment: "[file]",
+}
+
+var templates struct {
+	defaultLang    string
+	maxTitleLength int
+	maxBodyLength  int
+	languages      map[string]*Language
+}
+
+func init() {
+	if err := InitTemplates(""); err != nil {
+		panic(err)
+	}
+}
+
+// InitTemplates parses configuration of notification templates. Missing values of a language are
+// taken from the default language.
+func InitTemplates(jsconfig string) error {
+	var config templatesConfig
+	if jsconfig != "" {
+		if err := json.Unmarshal([]byte(jsconfig), &config); err != nil {
+			return errors.New("failed to parse templates config: " + err.Error())
+		}
+	}
+
+	if config.MaxTitleLength <= 0 {
+		config.MaxTitleLength = defaultMaxTitleLength
+	}
+	if config.MaxBodyLength <= 0 {
+		config.MaxBodyLength = defaultMaxBodyLength
+	}
+	if config.DefaultLang == "" {
+		config.DefaultLang = defaultLang
+	}
+	config.DefaultLang = normalizeLang(config.DefaultLang)
+
+	languages := make(map[string]*Language, len(config.Languages)+1)
+	for code, lang := range config.Languages {
+		languages[normalizeLang(code)] = lang
+	}
+	if config.DefaultLang == defaultLang && languages[defaultLang] == nil {
+		languages[defaultLang] = &Language{}
+	}
+
+	// Compile the default language first: other languages fall back to it.
+	fallback := languages[config.DefaultLang]
+	if fallback == nil {
+		return errors.New("no templates for the default language '" + config.DefaultLang + "'")
+	}
+	if err := fallback.compile(config.DefaultLang, &english); err != nil {
+		return err
+	}
+	for code, lang := range languages {
+		if lang == fallback {
+			continue
+		}
+		if err := lang.compile(code, fallback); err != nil {
+			return err
+		}
+	}
+
+	templates.defaultLang = config.DefaultLang
+	templates.maxTitleLength = config.MaxTitleLength
+	templates.maxBodyLength = config.MaxBodyLength
+	templates.languages = languages
+	return nil
+}
+
+// compile parses the templates and fills missing values from the fallback language.
+func (lang *Language) compile(code string, fallback *Language) error {
+	fill := func(val *string, def string) {
+		if *val == "" {
+			*val = def
+		}
+	}
+	fill(&lang.Title, fallback.Title)
+	fill(&lang.Body, fallback.Body)
+	fill(&lang.GroupTitle, fallback.GroupTitle)
+	fill(&lang.GroupBody, fallback.GroupBody)
+	fill(&lang.NewMessage, fallback.NewMessage)
+	fill(&lang.Image, fallback.Image)
+	fill(&lang.Attachment, fallback.Attachment)
+
+	var err error
+	parse := func(name, text string) *template.Template {
+		if err != nil {
+			return nil
+		}
+		var tmpl *template.Template
+		if tmpl, err = template.New(code + "." + name).Parse(text); err != nil {
+			err = errors.New("invalid template '" + name + "' for language '" + code + "': " + err.Error())
+		}
+		return tmpl
+	}
+	lang.title = parse("title", lang.Title)
+	lang.body = parse("body", lang.Body)
+	lang.groupTitle = parse("group_title", lang.GroupTitle)
+	lang.groupBody = parse("group_body", lang.GroupBody)
+	return err
+}
+
+// normalizeLang converts language codes like "pt_BR" to the form "pt-br".
+func normalizeLang(code string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(code), "_", "-", -1))
+}
+
+// FindLanguage returns templates for the given language code, like "en-US". If there are no templates
+// for the code, the base language "en" is tried, then the default language.
+func FindLanguage(code string) *Language {
+	code = normalizeLang(code)
+	if lang := templates.languages[code]; lang != nil {
+		return lang
+	}
+	if i := strings.IndexByte(code, '-'); i > 0 {
+		if lang := templates.languages[code[:i]]; lang != nil {
+			return lang
+		}
+	}
+	return templates.languages[templates.defaultLang]
+}
+
+// Render generates the title and body of the notification in the given language.
+func Render(rcpt *Receipt, langCode string) (title, body string) {
+	lang := FindLanguage(langCode)
+
+	text := PlainText(rcpt.Payload.Content, lang)
+	if text == "" {
+		text = lang.NewMessage
+	}
+	data := &templateData{
+		Sender: rcpt.SenderName,
+		Topic:  rcpt.TopicName,
+		Text:   Truncate(text, templates.maxBodyLength),
+	}
+
+	titleTmpl, bodyTmpl := lang.title, lang.body
+	if t.GetTopicCat(rcpt.Payload.Topic) == t.TopicCatGrp {
+		titleTmpl, bodyTmpl = lang.groupTitle, lang.groupBody
+	}
+
+	return Truncate(execute(titleTmpl, data), templates.maxTitleLength),
+		Truncate(execute(bodyTmpl, data), templates.maxBodyLength)
+}
+
+func execute(tmpl *template.Template, data *templateData) string {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return data.Text
+	}
+	return strings.TrimSpace(buf.String())
+}
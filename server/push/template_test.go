@@ -0,0 +1,98 @@
+package push
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func drafty(src string) interface{} {
+	var content interface{}
+	if err := json.Unmarshal([]byte(src), &content); err != nil {
+		panic(err)
+	}
+	return content
+}
+
+func TestPlainText(t *testing.T) {
+	lang := &Language{Image: "[image]", Attachment: "[file]"}
+	for _, tc := range []struct {
+		content interface{}
+		want    string
+	}{
+		{"Hello,\n  world", "Hello, world"},
+		{nil, ""},
+		{42.0, ""},
+		{drafty(`{"txt":"this is bold","fmt":[{"tp":"ST","at":8,"len":4}]}`), "this is bold"},
+		// Inline image replaces its placeholder.
+		{drafty(`{"txt":"look at  this","fmt":[{"at":8,"len":1}],"ent":[{"tp":"IM","data":{"mime":"image/png"}}]}`),
+			"look at [image] this"},
+		// Attachments are appended, links and mentions are kept as text.
+		{drafty(`{"txt":"@alice see example.com","fmt":[{"at":0,"len":6,"key":1},{"at":11,"len":11,"key":2},
+			{"at":-1,"len":0,"key":0}],"ent":[{"tp":"EX","data":{"name":"report.pdf"}},{"tp":"MN","data":{"val":"usrAbc"}},
+			{"tp":"LN","data":{"url":"https://example.com"}}]}`), "@alice see example.com [file] report.pdf"},
+		// Invalid references are ignored.
+		{drafty(`{"txt":"hi","fmt":[{"at":0,"len":2,"key":5},{"at":1,"len":100,"key":0}],"ent":[{"tp":"IM"}]}`), "h [image]"},
+	} {
+		if got := PlainText(tc.content, lang); got != tc.want {
+			t.Errorf("PlainText(%v): expected '%s', got '%s'", tc.content, tc.want, got)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	for _, tc := range []struct {
+		text  string
+		limit int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"exactly ten", 11, "exactly ten"},
+		{"the quick brown fox", 12, "the quick…"},
+		{"abcdefghijklmnop", 8, "abcdefg…"},
+		{"привет мир и все", 10, "привет ми…"},
+	} {
+		if got := Truncate(tc.text, tc.limit); got != tc.want {
+			t.Errorf("Truncate('%s', %d): expected '%s', got '%s'", tc.text, tc.limit, tc.want, got)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	defer InitTemplates("")
+
+	if err := InitTemplates(`{"default_lang":"en","max_body_length":20,"languages":{
+		"en":{"new_message":"New message"},
+		"pt_BR":{"title":"{{.Sender}} diz","new_message":"Nova mensagem","image":"[imagem]"}}}`); err != nil {
+		t.Fatal(err)
+	}
+
+	rcpt := &Receipt{SenderName: "Alice", TopicName: "Friends",
+		Payload: Payload{Topic: "usrAbCdEfGhIjK", Content: "Hello there, how are you doing today?"}}
+	if title, body := Render(rcpt, "en-US"); title != "Alice" || body != "Hello there, how…" {
+		t.Error("en: got", title, "|", body)
+	}
+	if title, body := Render(rcpt, "pt-br"); title != "Alice diz" || body != "Hello there, how…" {
+		t.Error("pt-br: got", title, "|", body)
+	}
+
+	rcpt.Payload.Topic = "grpAbCdEfGhIjK"
+	rcpt.Payload.Content = drafty(`{"fmt":[{"at":-1,"key":0}],"ent":[{"tp":"IM"}]}`)
+	if title, body := Render(rcpt, "pt-PT"); title != "Friends" || body != "Alice: [image]" {
+		t.Error("unknown language: got", title, "|", body)
+	}
+	if title, body := Render(rcpt, "pt_BR"); title != "Friends" || body != "Alice: [imagem]" {
+		t.Error("group: got", title, "|", body)
+	}
+
+	rcpt.Payload.Content = map[string]interface{}{"fm": true}
+	if _, body := Render(rcpt, "pt-BR"); body != "Alice: Nova mensagem" {
+		t.Error("empty text: got", body)
+	}
+
+	if err := InitTemplates(`{"default_lang":"de"}`); err == nil {
+		t.Error("default language without templates must fail")
+	}
+	if err := InitTemplates(`{"languages":{"en":{"body":"{{.Text"}}}`); err == nil {
+		t.Error("invalid template must fail")
+	}
+}
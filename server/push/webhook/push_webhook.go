@@ -0,0 +1,417 @@
+// Package webhook implements push notifications as HTTP POST requests to arbitrary URLs. Each receipt
+// is sent as JSON signed with HMAC-SHA256. Failed requests are retried with exponential backoff. The
+// requests are saved to disk until delivered and survive restarts.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nanfengpo/chat/server/push"
+	t "github.com/nanfengpo/chat/server/store/types"
+)
+
+var handler Handler
+
+const (
+	// Size of the input channel buffer.
+	defaultBuffer = 32
+
+	// Default number of retries of a failed request.
+	defaultMaxRetries = 5
+
+	// Default delay before the first retry, in seconds. Doubles with every retry.
+	defaultBackoff = 2
+
+	// Maximum delay between retries.
+	maxBackoff = time.Hour
+
+	// How often to check for due retries.
+	retryInterval = time.Second
+
+	// Time to wait for the endpoint to respond.
+	requestTimeout = 10 * time.Second
+
+	// Header with the HMAC-SHA256 signature of the request body.
+	signatureHeader = "X-Tinode-Signature"
+)
+
+// Handler represents the push handler; implements push.PushHandler interface.
+type Handler struct {
+	input  chan *push.Receipt
+	stop   chan bool
+	client *http.Client
+
+	endpoints  map[string]*endpoint
+	maxRetries int
+	backoff    time.Duration
+	queueDir   string
+}
+
+// endpoint is a configured destination of the webhook.
+type endpoint struct {
+	url    string
+	secret []byte
+	// Categories of topics to send receipts for. All categories if nil.
+	categories map[t.TopicCat]bool
+}
+
+type endpointConfig struct {
+	// URL to POST receipts to.
+	URL string `json:"url"`
+	// Key to sign the request body with.
+	Secret string `json:"secret"`
+	// Send only receipts for topics of these categories: "me", "fnd", "p2p", "grp". All if empty.
+	Categories []string `json:"categories,omitempty"`
+}
+
+type configType struct {
+	Enabled   bool             `json:"enabled"`
+	Buffer    int              `json:"buffer"`
+	Endpoints []endpointConfig `json:"endpoints"`
+	// Number of retries of a failed request.
+	MaxRetries int `json:"max_retries,omitempty"`
+	// Delay before the first retry in seconds.
+	Backoff int `json:"backoff,omitempty"`
+	// Directory to keep the requests in until delivered. Requests are not persisted if empty.
+	QueueDir string `json:"queue_dir,omitempty"`
+}
+
+// job is a request which is being sent or waits to be retried. Saved to the queue directory as JSON.
+type job struct {
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+	Attempts int             `json:"attempts"`
+	NextAt   time.Time       `json:"next_at"`
+
+	// Name of the file in the queue directory.
+	name string
+}
+
+// Pending retries.
+var queue struct {
+	sync.Mutex
+	jobs map[string]*job
+	// Counter for generating unique file names.
+	seq int64
+}
+
+// Count of receipts dropped because the input channel was full.
+var droppedCount int64
+
+var categoryNames = map[string]t.TopicCat{
+	"me":  t.TopicCatMe,
+	"fnd": t.TopicCatFnd,
+	"p2p": t.TopicCatP2P,
+	"grp": t.TopicCatGrp,
+}
+
+// Init initializes the push handler
+func (Handler) Init(jsonconf string) error {
+
+	var config configType
+	if err := json.Unmarshal([]byte(jsonconf), &config); err != nil {
+		return errors.New("failed to parse config: " + err.Error())
+	}
+
+	if !config.Enabled {
+		return nil
+	}
+
+	if len(config.Endpoints) == 0 {
+		return errors.New("webhook: no endpoints configured")
+	}
+	handler.endpoints = make(map[string]*endpoint, len(config.Endpoints))
+	for _, ec := range config.Endpoints {
+		if ec.URL == "" || ec.Secret == "" {
+			return errors.New("webhook: endpoint url and secret must be set")
+		}
+		ep := &endpoint{url: ec.URL, secret: []byte(ec.Secret)}
+		if len(ec.Categories) > 0 {
+			ep.categories = make(map[t.TopicCat]bool)
+			for _, name := range ec.Categories {
+				cat, ok := categoryNames[name]
+				if !ok {
+					return errors.New("webhook: unknown topic category '" + name + "'")
+				}
+				ep.categories[cat] = true
+			}
+		}
+		handler.endpoints[ec.URL] = ep
+	}
+
+	handler.maxRetries = config.MaxRetries
+	if handler.maxRetries <= 0 {
+		handler.maxRetries = defaultMaxRetries
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = defaultBackoff
+	}
+	handler.backoff = time.Duration(config.Backoff) * time.Second
+
+	queue.jobs = make(map[string]*job)
+	if config.QueueDir != "" {
+		if err := os.MkdirAll(config.QueueDir, 0700); err != nil {
+			return errors.New("webhook: failed to create queue directory: " + err.Error())
+		}
+		handler.queueDir = config.QueueDir
+		if err := loadQueue(); err != nil {
+			return err
+		}
+	}
+
+	if handler.client == nil {
+		handler.client = &http.Client{Timeout: requestTimeout}
+	}
+
+	if config.Buffer <= 0 {
+		config.Buffer = defaultBuffer
+	}
+
+	handler.input = make(chan *push.Receipt, config.Buffer)
+	handler.stop = make(chan bool, 1)
+
+	go func() {
+		ticker := time.NewTicker(retryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case rcpt := <-handler.input:
+				go sendNotification(rcpt)
+			case now := <-ticker.C:
+				for _, j := range dueJobs(now) {
+					go attempt(j)
+				}
+				if count := atomic.SwapInt64(&droppedCount, 0); count > 0 {
+					log.Println("webhook: receipts dropped because the handler is busy:", count)
+				}
+			case <-handler.stop:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// loadQueue reads the pending retries saved before the restart.
+func loadQueue() error {
+	files, err := ioutil.ReadDir(handler.queueDir)
+	if err != nil {
+		return errors.New("webhook: failed to read queue directory: " + err.Error())
+	}
+
+	queue.Lock()
+	defer queue.Unlock()
+
+	for _, fi := range files {
+		if fi.IsDir() {
+			continue
+		}
+		path := filepath.Join(handler.queueDir, fi.Name())
+		if strings.HasSuffix(fi.Name(), ".json.tmp") {
+			// Left by a crash while saving. The previous version of the record, if any, is intact.
+			os.Remove(path)
+			continue
+		}
+		if !strings.HasSuffix(fi.Name(), ".json") {
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.New("webhook: failed to read queued request: " + err.Error())
+		}
+		j := &job{name: fi.Name()}
+		if err = json.Unmarshal(data, j); err != nil || handler.endpoints[j.URL] == nil {
+			// Corrupted or the endpoint is no longer configured.
+			log.Println("webhook: discarding queued request", fi.Name())
+			os.Remove(path)
+			continue
+		}
+		queue.jobs[j.name] = j
+	}
+	return nil
+}
+
+// dueJobs removes from the queue and returns the jobs which should be retried by now.
+func dueJobs(now time.Time) []*job {
+	queue.Lock()
+	defer queue.Unlock()
+
+	var due []*job
+	for name, j := range queue.jobs {
+		if !j.NextAt.After(now) {
+			due = append(due, j)
+			delete(queue.jobs, name)
+		}
+	}
+	return due
+}
+
+// saveJob adds the job to the queue and writes it to disk.
+func saveJob(j *job) {
+	queue.Lock()
+	defer queue.Unlock()
+
+	writeJob(j)
+	queue.jobs[j.name] = j
+}
+
+// persistJob writes the job to disk without queueing it, so the request is not lost if the server
+// stops before it completes.
+func persistJob(j *job) {
+	queue.Lock()
+	defer queue.Unlock()
+
+	writeJob(j)
+}
+
+// writeJob names the job if needed and writes it to the queue directory. The queue must be locked.
+func writeJob(j *job) {
+	if j.name == "" {
+		queue.seq++
+		j.name = strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + strconv.FormatInt(queue.seq, 10) + ".json"
+	}
+
+	if handler.queueDir == "" {
+		return
+	}
+	data, _ := json.Marshal(j)
+	// Write to a temporary file first so a crash does not leave a partial record.
+	path := filepath.Join(handler.queueDir, j.name)
+	if err := ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		log.Println("webhook: failed to save request for retry", err)
+		return
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		log.Println("webhook: failed to save request for retry", err)
+	}
+}
+
+// removeJob deletes the job from disk. The job is already removed from the queue.
+func removeJob(j *job) {
+	if j.name == "" || handler.queueDir == "" {
+		return
+	}
+	if err := os.Remove(filepath.Join(handler.queueDir, j.name)); err != nil && !os.IsNotExist(err) {
+		log.Println("webhook: failed to remove queued request", err)
+	}
+}
+
+func sendNotification(rcpt *push.Receipt) {
+	body, err := json.Marshal(rcpt)
+	if err != nil {
+		log.Println("webhook: failed to serialize receipt", err)
+		return
+	}
+
+	cat := t.GetTopicCat(rcpt.Payload.Topic)
+	for _, ep := range handler.endpoints {
+		if ep.categories != nil && !ep.categories[cat] {
+			continue
+		}
+		j := &job{URL: ep.url, Body: body}
+		persistJob(j)
+		attempt(j)
+	}
+}
+
+// attempt sends the request and schedules a retry if it fails.
+func attempt(j *job) {
+	ep := handler.endpoints[j.URL]
+	if ep == nil {
+		removeJob(j)
+		return
+	}
+
+	retry, err := post(ep, j.Body)
+	if err == nil {
+		removeJob(j)
+		return
+	}
+
+	j.Attempts++
+	if !retry || j.Attempts > handler.maxRetries {
+		log.Println("webhook: giving up on", j.URL, "after", j.Attempts, "attempts:", err)
+		removeJob(j)
+		return
+	}
+
+	delay := handler.backoff << uint(j.Attempts-1)
+	if delay > maxBackoff || delay <= 0 {
+		delay = maxBackoff
+	}
+	j.NextAt = time.Now().Add(delay)
+	saveJob(j)
+}
+
+// post sends signed body to the endpoint. Returns true if the request failed and should be retried.
+func post(ep *endpoint, body []byte) (bool, error) {
+	mac := hmac.New(sha256.New, ep.secret)
+	mac.Write(body)
+
+	req, err := http.NewRequest(http.MethodPost, ep.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(signatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := handler.client.Do(req)
+	if err != nil {
+		// Network errors are temporary.
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode >= 500:
+		return true, errors.New(resp.Status)
+	}
+	return false, errors.New(resp.Status)
+}
+
+// IsReady checks if the push handler has been initialized.
+func (Handler) IsReady() bool {
+	return handler.input != nil
+}
+
+// Push return a channel that the server will use to send messages to.
+// If the adapter blocks, the message will be dropped.
+func (Handler) Push() chan<- *push.Receipt {
+	return handler.input
+}
+
+// Dropped counts receipts which were not accepted because the channel was full. The count is
+// reported to the log periodically.
+func (Handler) Dropped(rcpt *push.Receipt) {
+	atomic.AddInt64(&droppedCount, 1)
+}
+
+// Stop shuts down the handler
+func (Handler) Stop() {
+	handler.stop <- true
+}
+
+func init() {
+	push.Register("webhook", &handler)
+}
@@ -0,0 +1,117 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nanfengpo/chat/server/push"
+)
+
+func TestRetryQueue(t *testing.T) {
+	const secret = "webhook-secret"
+
+	dir, err := ioutil.TempDir("", "webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var lock sync.Mutex
+	var failures int
+	var delivered []string
+	// Number of requests saved to disk when each request was received.
+	var saved []int
+	mock := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		if req.Header.Get(signatureHeader) != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			wr.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		files, _ := ioutil.ReadDir(dir)
+		saved = append(saved, len(files))
+		if failures > 0 {
+			failures--
+			wr.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		delivered = append(delivered, string(body))
+		wr.WriteHeader(http.StatusNoContent)
+	}))
+	defer mock.Close()
+
+	if err := handler.Init(`{"enabled":true,"max_retries":2,"backoff":60,"queue_dir":"` + dir + `",
+		"endpoints":[{"url":"` + mock.URL + `","secret":"` + secret + `","categories":["grp"]}]}`); err != nil {
+		t.Fatal(err)
+	}
+	handler.Stop()
+
+	// Receipts for topics of other categories are not sent.
+	sendNotification(&push.Receipt{Payload: push.Payload{Topic: "p2pAbCdEfGhIjKlMnOpQrStUw", SeqId: 1}})
+	if len(delivered) != 0 {
+		t.Fatal("p2p receipt must be filtered out", delivered)
+	}
+
+	failures = 2
+	sendNotification(&push.Receipt{Payload: push.Payload{Topic: "grpAbCdEfGhIjK", SeqId: 2}})
+	if len(saved) != 1 || saved[0] != 1 {
+		t.Fatal("request must be saved before it is sent", saved)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 || len(queue.jobs) != 1 {
+		t.Fatal("failed request must be queued", files)
+	}
+	if due := dueJobs(time.Now()); len(due) != 0 {
+		t.Fatal("retry is not due yet", due)
+	}
+
+	// Restart: the queue is read from disk, partially written records are deleted.
+	if err := ioutil.WriteFile(dir+"/1-1.json.tmp", []byte(`{"url":`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	queue.jobs = make(map[string]*job)
+	if err := loadQueue(); err != nil || len(queue.jobs) != 1 {
+		t.Fatal("queue must survive restart", err, queue.jobs)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatal("temporary file must be deleted", files)
+	}
+
+	// The second failure reschedules the request, the third attempt succeeds.
+	for i := 0; i < 2; i++ {
+		due := dueJobs(time.Now().Add(maxBackoff))
+		if len(due) != 1 {
+			t.Fatal("expected one retry, got", due)
+		}
+		attempt(due[0])
+	}
+	if len(delivered) != 1 {
+		t.Fatal("receipt not delivered", delivered)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 || len(queue.jobs) != 0 {
+		t.Error("delivered request must be removed from the queue", files)
+	}
+
+	// Requests are dropped after max_retries.
+	failures = 10
+	sendNotification(&push.Receipt{Payload: push.Payload{Topic: "grpAbCdEfGhIjK", SeqId: 3}})
+	for i := 0; i < 2; i++ {
+		for _, j := range dueJobs(time.Now().Add(maxBackoff)) {
+			attempt(j)
+		}
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 || len(queue.jobs) != 0 || failures != 7 {
+		t.Error("request must be dropped after 3 attempts", files, failures)
+	}
+}
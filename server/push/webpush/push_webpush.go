@@ -0,0 +1,453 @@
+// Package webpush implements push notifications to web browsers using the Web Push protocol
+// (RFC 8030) with VAPID authentication (RFC 8292) and message encryption (RFC 8291).
+package webpush
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nanfengpo/chat/server/push"
+	"github.com/nanfengpo/chat/server/store"
+	t "github.com/nanfengpo/chat/server/store/types"
+	"golang.org/x/crypto/hkdf"
+)
+
+var handler Handler
+
+const (
+	// Size of the input channel buffer.
+	defaultBuffer = 32
+
+	// Default time in seconds for the push service to keep the undelivered message.
+	defaultTimeToLive = 3600
+
+	// Lifetime of the VAPID token. Must not exceed 24 hours.
+	vapidTokenLifetime = 12 * time.Hour
+
+	// Time to wait for the push service to respond.
+	requestTimeout = 10 * time.Second
+
+	// Record size of the encrypted content. The whole message is sent as a single record.
+	recordSize = 4096
+)
+
+// Handler represents the push handler; implements push.PushHandler interface.
+type Handler struct {
+	input  chan *push.Receipt
+	stop   chan bool
+	client *http.Client
+
+	platforms map[string]bool
+
+	// VAPID key pair and the contact URI of the application server.
+	key       *ecdsa.PrivateKey
+	publicKey []byte
+	subject   string
+}
+
+type configType struct {
+	Enabled bool `json:"enabled"`
+	Buffer  int  `json:"buffer"`
+	// VAPID private key as base64url-encoded 32 byte P-256 scalar.
+	PrivateKey string `json:"vapid_private_key"`
+	// Contact of the server operator, "mailto:" or "https:" URI.
+	Subject string `json:"vapid_subject"`
+	// Platforms of devices to send to. Default ["web"].
+	Platforms []string `json:"platforms,omitempty"`
+	// Time in seconds before notification is discarded if undelivered (by the push service).
+	TimeToLive uint `json:"time_to_live,omitempty"`
+}
+
+// Subscription is the browser's push subscription, the JSON returned by PushSubscription.toJSON().
+// The client sends it as the device ID.
+type Subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		// User agent public key, base64url-encoded uncompressed P-256 point.
+		P256dh string `json:"p256dh"`
+		// Authentication secret, base64url-encoded 16 bytes.
+		Auth string `json:"auth"`
+	} `json:"keys"`
+}
+
+// notification is the content of the encrypted message. The service worker receives it in the push event.
+type notification struct {
+	Topic     string    `json:"topic"`
+	From      string    `json:"xfrom"`
+	Timestamp time.Time `json:"ts"`
+	SeqId     int       `json:"seq"`
+	Title     string    `json:"title,omitempty"`
+	Body      string    `json:"body,omitempty"`
+}
+
+// Init initializes the push handler
+func (Handler) Init(jsonconf string) error {
+
+	var config configType
+	if err := json.Unmarshal([]byte(jsonconf), &config); err != nil {
+		return errors.New("failed to parse config: " + err.Error())
+	}
+
+	if !config.Enabled {
+		return nil
+	}
+
+	if config.Subject == "" {
+		return errors.New("webpush: vapid_subject must be set")
+	}
+	handler.subject = config.Subject
+
+	var err error
+	if handler.key, handler.publicKey, err = parseKey(config.PrivateKey); err != nil {
+		return err
+	}
+
+	if len(config.Platforms) == 0 {
+		config.Platforms = []string{"web"}
+	}
+	handler.platforms = make(map[string]bool, len(config.Platforms))
+	for _, p := range config.Platforms {
+		handler.platforms[p] = true
+	}
+
+	if config.TimeToLive == 0 {
+		config.TimeToLive = defaultTimeToLive
+	}
+
+	if handler.client == nil {
+		handler.client = newClient()
+	}
+
+	if config.Buffer <= 0 {
+		config.Buffer = defaultBuffer
+	}
+
+	handler.input = make(chan *push.Receipt, config.Buffer)
+	handler.stop = make(chan bool, 1)
+
+	go func() {
+		for {
+			select {
+			case rcpt := <-handler.input:
+				go sendNotification(rcpt, &config)
+			case <-handler.stop:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// parseKey creates VAPID key pair from the private key. Returns the key and the public key as
+// an uncompressed point.
+func parseKey(privateKey string) (*ecdsa.PrivateKey, []byte, error) {
+	d, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(privateKey, "="))
+	if err != nil {
+		return nil, nil, errors.New("webpush: invalid vapid_private_key: " + err.Error())
+	}
+	ecdhKey, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, nil, errors.New("webpush: invalid vapid_private_key: " + err.Error())
+	}
+	pub := ecdhKey.PublicKey().Bytes()
+	x, y := elliptic.Unmarshal(elliptic.P256(), pub)
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y},
+		D:         new(big.Int).SetBytes(d),
+	}
+	return key, pub, nil
+}
+
+// newClient creates the client for sending to push services. Endpoints come from clients, so
+// the client connects only to public addresses: the server must not be used to reach internal
+// services. The address is checked when connecting, after the host is resolved.
+func newClient() *http.Client {
+	dialer := &net.Dialer{Timeout: requestTimeout, Control: checkPublicAddr}
+	return &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: requestTimeout,
+			ForceAttemptHTTP2:   true,
+		},
+		// Push services don't redirect.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Carrier-grade NAT addresses (RFC 6598) are not public either.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// checkPublicAddr rejects connections to loopback, private, link-local and other non-public addresses.
+func checkPublicAddr(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip) {
+		return errors.New("webpush: endpoint address " + host + " is not public")
+	}
+	return nil
+}
+
+// ParseSubscription parses the device ID as a push subscription. Returns nil if the device ID is
+// not a subscription or the endpoint is not an https:// URL.
+func ParseSubscription(deviceID string) *Subscription {
+	if !strings.HasPrefix(deviceID, "{") {
+		return nil
+	}
+	var sub Subscription
+	if err := json.Unmarshal([]byte(deviceID), &sub); err != nil ||
+		sub.Endpoint == "" || sub.Keys.P256dh == "" || sub.Keys.Auth == "" {
+		return nil
+	}
+	if u, err := url.Parse(sub.Endpoint); err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return nil
+	}
+	return &sub
+}
+
+// vapidAuthorization creates the value of the Authorization header for the given push service
+// endpoint (RFC 8292).
+func vapidAuthorization(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	header, _ := json.Marshal(map[string]string{"typ": "JWT", "alg": "ES256"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(vapidTokenLifetime).Unix(),
+		"sub": handler.subject,
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, handler.key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	// JWS signature is R and S as fixed-size big-endian integers.
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	return "vapid t=" + unsigned + "." + base64.RawURLEncoding.EncodeToString(sig) +
+		", k=" + base64.RawURLEncoding.EncodeToString(handler.publicKey), nil
+}
+
+// encrypt encrypts the message for the subscription using "aes128gcm" content encoding (RFC 8291, RFC 8188).
+// The asKey is the ephemeral key of the application server, the salt is 16 random bytes.
+func encrypt(sub *Subscription, message []byte, asKey *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	uaPublicBytes, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(sub.Keys.P256dh, "="))
+	if err != nil {
+		return nil, err
+	}
+	authSecret, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(sub.Keys.Auth, "="))
+	if err != nil {
+		return nil, err
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, err
+	}
+	ecdhSecret, err := asKey.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	asPublicBytes := asKey.PublicKey().Bytes()
+
+	// IKM = HKDF(auth_secret, ecdh_secret, "WebPush: info" || 0x00 || ua_public || as_public, 32)
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPublicBytes...), asPublicBytes...)
+	ikm := make([]byte, 32)
+	if _, err = io.ReadFull(hkdf.New(sha256.New, ecdhSecret, authSecret, keyInfo), ikm); err != nil {
+		return nil, err
+	}
+
+	cek := make([]byte, 16)
+	if _, err = io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: aes128gcm\x00")), cek); err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 12)
+	if _, err = io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: nonce\x00")), nonce); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// Header: salt || record size || key ID length || key ID (as_public).
+	var out bytes.Buffer
+	out.Write(salt)
+	binary.Write(&out, binary.BigEndian, uint32(recordSize))
+	out.WriteByte(byte(len(asPublicBytes)))
+	out.Write(asPublicBytes)
+
+	// A single record: the message followed by the delimiter of the last record.
+	plaintext := append(append([]byte{}, message...), 0x02)
+	if len(plaintext)+gcm.Overhead() > recordSize {
+		return nil, errors.New("webpush: message too long")
+	}
+	out.Write(gcm.Seal(nil, nonce, plaintext, nil))
+
+	return out.Bytes(), nil
+}
+
+func sendNotification(rcpt *push.Receipt, config *configType) {
+	// List of UIDs for querying the database
+	uids := make([]t.Uid, len(rcpt.To))
+	skipDevices := make(map[string]bool)
+	for i, to := range rcpt.To {
+		uids[i] = to.User
+
+		// Some devices were online and received the message. Skip them.
+		for _, deviceID := range to.Devices {
+			skipDevices[deviceID] = true
+		}
+	}
+
+	devices, count, err := store.Devices.GetAll(uids...)
+	if err != nil || count == 0 {
+		return
+	}
+
+	// Notifications are rendered in the language of the browser.
+	messages := make(map[string][]byte)
+	message := func(lang string) ([]byte, error) {
+		if msg := messages[lang]; msg != nil {
+			return msg, nil
+		}
+		title, body := push.Render(rcpt, lang)
+		msg, err := json.Marshal(&notification{
+			Topic:     rcpt.Payload.Topic,
+			From:      rcpt.Payload.From,
+			Timestamp: rcpt.Payload.Timestamp,
+			SeqId:     rcpt.Payload.SeqId,
+			Title:     title,
+			Body:      body,
+		})
+		messages[lang] = msg
+		return msg, err
+	}
+
+	for uid, devList := range devices {
+		for i := range devList {
+			d := &devList[i]
+			if skipDevices[d.DeviceId] || !handler.platforms[d.Platform] {
+				continue
+			}
+			sub := ParseSubscription(d.DeviceId)
+			if sub == nil {
+				continue
+			}
+			msg, err := message(d.Lang)
+			if err != nil {
+				log.Println("webpush: failed to serialize notification", err)
+				return
+			}
+			if expired, err := sendToSubscription(sub, msg, config.TimeToLive); err != nil {
+				log.Println("webpush: push failed", err)
+			} else if expired {
+				store.Devices.Delete(uid, d.DeviceId)
+			}
+		}
+	}
+}
+
+// sendToSubscription sends one notification. Returns true if the subscription is no longer valid.
+func sendToSubscription(sub *Subscription, message []byte, ttl uint) (bool, error) {
+	asKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return false, err
+	}
+	salt := make([]byte, 16)
+	if _, err = rand.Read(salt); err != nil {
+		return false, err
+	}
+	body, err := encrypt(sub, message, asKey, salt)
+	if err != nil {
+		return false, err
+	}
+	authorization, err := vapidAuthorization(sub.Endpoint)
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.FormatUint(uint64(ttl), 10))
+	// These are IM messages, they are high priority.
+	req.Header.Set("Urgency", "high")
+
+	resp, err := handler.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusGone:
+		return true, nil
+	case resp.StatusCode >= 300:
+		return false, errors.New("webpush: " + resp.Status)
+	}
+	return false, nil
+}
+
+// IsReady checks if the push handler has been initialized.
+func (Handler) IsReady() bool {
+	return handler.input != nil
+}
+
+// Push return a channel that the server will use to send messages to.
+// If the adapter blocks, the message will be dropped.
+func (Handler) Push() chan<- *push.Receipt {
+	return handler.input
+}
+
+// Stop shuts down the handler
+func (Handler) Stop() {
+	handler.stop <- true
+}
+
+func init() {
+	push.Register("webpush", &handler)
+}
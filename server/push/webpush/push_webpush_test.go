@@ -0,0 +1,158 @@
+package webpush
+
+import (
+	"crypto/ecdh"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nanfengpo/chat/server/db/memory"
+	"github.com/nanfengpo/chat/server/push"
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+func b64(s string) []byte {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Example from RFC 8291, Appendix A.
+func TestEncrypt(t *testing.T) {
+	asKey, err := ecdh.P256().NewPrivateKey(b64("yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sub Subscription
+	sub.Keys.P256dh = "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"
+	sub.Keys.Auth = "BTBZMqHH6r4Tts7J_aSIgg"
+
+	got, err := encrypt(&sub, []byte("When I grow up, I want to be a watermelon"), asKey,
+		b64("DGv6ra1nlYgDCS1FRnbzlw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+	if enc := base64.RawURLEncoding.EncodeToString(got); enc != want {
+		t.Error("wrong ciphertext\n got", enc, "\nwant", want)
+	}
+}
+
+func TestSendNotification(t *testing.T) {
+	if err := memory.OpenTestStore(); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	// Mock push service: subscriptions under /gone/ are expired.
+	var lock sync.Mutex
+	received := make(map[string][]byte)
+	mock := httptest.NewTLSServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.Header.Get("Authorization"), "vapid t=") ||
+			req.Header.Get("Content-Encoding") != "aes128gcm" || req.Header.Get("TTL") == "" {
+			wr.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if strings.HasPrefix(req.URL.Path, "/gone/") {
+			wr.WriteHeader(http.StatusGone)
+			return
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		lock.Lock()
+		received[req.URL.Path] = body
+		lock.Unlock()
+		wr.WriteHeader(http.StatusCreated)
+	}))
+	defer mock.Close()
+
+	handler.client = mock.Client()
+	if err := handler.Init(`{"enabled":true,"vapid_private_key":"q1dXpw3UpT5VOmu_cf_v6ih07Aems3njxI-JWgLcM94",
+		"vapid_subject":"mailto:admin@example.com"}`); err != nil {
+		t.Fatal(err)
+	}
+	defer handler.Stop()
+
+	user, err := store.Users.Create(&types.User{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid := user.Uid()
+	subscription := func(path string) string {
+		sub, _ := json.Marshal(map[string]interface{}{"endpoint": mock.URL + path,
+			"keys": map[string]string{"p256dh": "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4",
+				"auth": "BTBZMqHH6r4Tts7J_aSIgg"}})
+		return string(sub)
+	}
+	for _, dev := range []types.DeviceDef{
+		{DeviceId: subscription("/live/1"), Platform: "web"},
+		{DeviceId: subscription("/gone/2"), Platform: "web"},
+		{DeviceId: "fcm-token", Platform: "android"},
+	} {
+		if err := store.Devices.Update(uid, "", &dev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sendNotification(&push.Receipt{
+		To:      []push.Recipient{{User: uid}},
+		Payload: push.Payload{Topic: "grpAbc", SeqId: 3, Content: "hello"},
+	}, &configType{TimeToLive: 60})
+
+	if len(received) != 1 || received["/live/1"] == nil {
+		t.Fatal("expected one notification, got", received)
+	}
+
+	devices, _, _ := store.Devices.GetAll(uid)
+	if len(devices[uid]) != 2 {
+		t.Error("expired subscription must be deleted", devices[uid])
+	}
+	for _, dev := range devices[uid] {
+		if strings.Contains(dev.DeviceId, "/gone/") {
+			t.Error("expired subscription not deleted")
+		}
+	}
+}
+
+func TestEndpointRestrictions(t *testing.T) {
+	keys := `"keys":{"p256dh":"BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4","auth":"BTBZMqHH6r4Tts7J_aSIgg"}`
+	for endpoint, valid := range map[string]bool{
+		"https://fcm.googleapis.com/fcm/send/abc": true,
+		"http://fcm.googleapis.com/fcm/send/abc":  false,
+		"file:///etc/passwd":                      false,
+		"https:///path":                           false,
+	} {
+		if sub := ParseSubscription(`{"endpoint":"` + endpoint + `",` + keys + `}`); (sub != nil) != valid {
+			t.Error("endpoint", endpoint, "expected valid", valid)
+		}
+	}
+
+	for addr, public := range map[string]bool{
+		"203.0.113.10:443": true, "[2001:db8::1]:443": true,
+		"127.0.0.1:443": false, "10.1.2.3:443": false, "192.168.0.1:443": false, "172.16.5.4:443": false,
+		"169.254.169.254:80": false, "100.64.0.1:443": false, "0.0.0.0:443": false,
+		"[::1]:443": false, "[fe80::1]:443": false, "[fd00::1]:443": false, "[::ffff:127.0.0.1]:443": false,
+	} {
+		if err := checkPublicAddr("tcp", addr, nil); (err == nil) != public {
+			t.Error("address", addr, "expected public", public, err)
+		}
+	}
+
+	// The client refuses to connect to a local push service.
+	mock := httptest.NewTLSServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		t.Error("request to a local address was sent")
+	}))
+	defer mock.Close()
+	resp, err := newClient().Post(mock.URL, "application/octet-stream", nil)
+	if err == nil {
+		resp.Body.Close()
+		t.Error("connection to a local address allowed")
+	}
+}
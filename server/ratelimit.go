@@ -0,0 +1,308 @@
+/******************************************************************************
+ *
+ *  Description :
+ *
+ *  Rate limiting of client messages with token buckets.
+ *
+ *****************************************************************************/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// How often usage is reported to other cluster nodes.
+const rateLimitSyncPeriod = time.Second
+
+// bucketConfig is a limit of one kind of messages.
+type bucketConfig struct {
+	// Number of messages allowed per second on average.
+	Rate float64 `json:"rate"`
+	// Number of messages allowed at once.
+	Burst int `json:"burst"`
+}
+
+type rateLimitConfig struct {
+	// Limits per user, by message type: "pub", "sub", "leave", "hi", "login", "get", "set", "del",
+	// "acc", "note". Limits of sessions which are not authenticated are per session.
+	Messages map[string]*bucketConfig `json:"messages"`
+	// Limits per IP address of "acc" and "login" attempts.
+	Address map[string]*bucketConfig `json:"address"`
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimiter keeps token buckets of users and IP addresses. In a cluster each bucket has an
+// owner node determined by the ring hash. Other nodes consume tokens locally and report the usage to
+// the owner once in rateLimitSyncPeriod. The owner responds with the buckets which are exhausted
+// cluster-wide.
+type rateLimiter struct {
+	lock sync.Mutex
+
+	// Limits by kind of the limit, i.e. "pub" or "ip:login".
+	limits map[string]bucketConfig
+	// Buckets by kind and subject, i.e. "pub usrAbCd" or "ip:login 203.0.113.45".
+	buckets map[string]*tokenBucket
+	// Buckets exhausted at the owner node: time when they can be used again.
+	blocked map[string]time.Time
+	// Tokens consumed locally since the last report to the owner node.
+	usage map[string]int
+}
+
+func newRateLimiter(jsconfig json.RawMessage) (*rateLimiter, error) {
+	var config rateLimitConfig
+	if err := json.Unmarshal(jsconfig, &config); err != nil {
+		return nil, errors.New("failed to parse config: " + err.Error())
+	}
+
+	rl := &rateLimiter{
+		limits:  make(map[string]bucketConfig),
+		buckets: make(map[string]*tokenBucket),
+		blocked: make(map[string]time.Time),
+		usage:   make(map[string]int),
+	}
+	add := func(kind string, conf *bucketConfig) error {
+		if conf == nil || conf.Rate <= 0 || conf.Burst < 1 {
+			return errors.New("invalid limit of '" + kind + "'")
+		}
+		rl.limits[kind] = *conf
+		return nil
+	}
+	for what, conf := range config.Messages {
+		if err := add(what, conf); err != nil {
+			return nil, err
+		}
+	}
+	for what, conf := range config.Address {
+		if what != "acc" && what != "login" {
+			return nil, errors.New("address limits apply to 'acc' and 'login' only")
+		}
+		if err := add("ip:"+what, conf); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(rl.limits) == 0 {
+		return nil, nil
+	}
+	return rl, nil
+}
+
+// refill adds tokens accumulated since the last update.
+func (b *tokenBucket) refill(conf bucketConfig, now time.Time) {
+	b.tokens = math.Min(float64(conf.Burst), b.tokens+now.Sub(b.updated).Seconds()*conf.Rate)
+	b.updated = now
+}
+
+// bucket finds or creates a full bucket.
+func (rl *rateLimiter) bucket(key string, conf bucketConfig, now time.Time) *tokenBucket {
+	b := rl.buckets[key]
+	if b == nil {
+		b = &tokenBucket{tokens: float64(conf.Burst), updated: now}
+		rl.buckets[key] = b
+	} else {
+		b.refill(conf, now)
+	}
+	return b
+}
+
+// allow consumes a token from the bucket of the subject. If the bucket is empty, returns false and
+// the time to wait before trying again.
+func (rl *rateLimiter) allow(kind, subject string) (bool, time.Duration) {
+	conf, ok := rl.limits[kind]
+	if !ok {
+		return true, 0
+	}
+	key := kind + " " + subject
+	now := time.Now()
+
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	if until, ok := rl.blocked[key]; ok {
+		if now.Before(until) {
+			return false, until.Sub(now)
+		}
+		delete(rl.blocked, key)
+	}
+
+	b := rl.bucket(key, conf, now)
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / conf.Rate * float64(time.Second))
+	}
+	b.tokens--
+
+	if globals.cluster != nil {
+		rl.usage[key]++
+	}
+	return true, 0
+}
+
+// report applies usage reported by another node to the buckets owned by this node. Returns buckets
+// which are exhausted with the time to wait.
+func (rl *rateLimiter) report(usage map[string]int) map[string]time.Duration {
+	now := time.Now()
+	blocked := make(map[string]time.Duration)
+
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	for key, count := range usage {
+		conf, ok := rl.limits[rateLimitKind(key)]
+		if !ok {
+			continue
+		}
+		b := rl.bucket(key, conf, now)
+		// Don't let a burst from many nodes block the subject for too long.
+		b.tokens = math.Max(-float64(conf.Burst), b.tokens-float64(count))
+		if b.tokens < 1 {
+			blocked[key] = time.Duration((1 - b.tokens) / conf.Rate * float64(time.Second))
+		}
+	}
+	return blocked
+}
+
+// rateLimitKind extracts the kind of the limit from the bucket key.
+func rateLimitKind(key string) string {
+	for i := 0; i < len(key); i++ {
+		if key[i] == ' ' {
+			return key[:i]
+		}
+	}
+	return key
+}
+
+// gc removes buckets which are full again.
+func (rl *rateLimiter) gc(now time.Time) {
+	for key, b := range rl.buckets {
+		b.refill(rl.limits[rateLimitKind(key)], now)
+		if b.tokens >= float64(rl.limits[rateLimitKind(key)].Burst) {
+			delete(rl.buckets, key)
+		}
+	}
+	for key, until := range rl.blocked {
+		if !now.Before(until) {
+			delete(rl.blocked, key)
+		}
+	}
+}
+
+// run periodically reports local usage to owner nodes and removes unused buckets.
+func (rl *rateLimiter) run() {
+	ticker := time.NewTicker(rateLimitSyncPeriod)
+	for range ticker.C {
+		rl.lock.Lock()
+		usage := rl.usage
+		rl.usage = make(map[string]int)
+		rl.gc(time.Now())
+		rl.lock.Unlock()
+
+		if c := globals.cluster; c != nil {
+			rl.sync(c, usage)
+		}
+	}
+}
+
+// sync sends usage to owner nodes of the buckets.
+func (rl *rateLimiter) sync(c *Cluster, usage map[string]int) {
+	byNode := make(map[string]map[string]int)
+	for key, count := range usage {
+		owner := c.ring.Get(key)
+		if owner == c.thisNodeName {
+			// Local bucket is authoritative.
+			continue
+		}
+		if byNode[owner] == nil {
+			byNode[owner] = make(map[string]int)
+		}
+		byNode[owner][key] = count
+	}
+
+	for name, nodeUsage := range byNode {
+		n := c.nodes[name]
+		if n == nil {
+			continue
+		}
+		var resp ClusterRateLimitResp
+		if err := n.call("Cluster.RateLimit",
+			&ClusterRateLimitReq{Node: c.thisNodeName, Usage: nodeUsage}, &resp); err != nil {
+			log.Println("rate limit: failed to report usage to", name, err)
+			continue
+		}
+
+		now := time.Now()
+		rl.lock.Lock()
+		for key, wait := range resp.Blocked {
+			rl.blocked[key] = now.Add(wait)
+		}
+		rl.lock.Unlock()
+	}
+}
+
+// rateLimit checks limits of the message. Returns an error response if the message must be rejected.
+func (s *Session) rateLimit(msg *ClientComMessage) *ServerComMessage {
+	rl := globals.rateLimiter
+	if rl == nil || s.proto == CLUSTER {
+		// Messages from other cluster nodes are checked at their origin.
+		return nil
+	}
+
+	what, id, topic := msg.describe()
+
+	subject := s.uid.UserId()
+	if s.uid.IsZero() {
+		subject = "sid:" + s.sid
+	}
+	ok, wait := rl.allow(what, subject)
+
+	if ok && (what == "acc" || what == "login") {
+		addr := s.remoteAddr
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+		ok, wait = rl.allow("ip:"+what, addr)
+	}
+
+	if ok {
+		return nil
+	}
+	log.Println("s.dispatch: rate limit exceeded", what, s.sid, s.remoteAddr)
+	return ErrTooManyRequests(id, topic, msg.timestamp, wait)
+}
+
+// describe returns message type, ID and topic of the client message.
+func (msg *ClientComMessage) describe() (what, id, topic string) {
+	switch {
+	case msg.Pub != nil:
+		return "pub", msg.Pub.Id, msg.Pub.Topic
+	case msg.Sub != nil:
+		return "sub", msg.Sub.Id, msg.Sub.Topic
+	case msg.Leave != nil:
+		return "leave", msg.Leave.Id, msg.Leave.Topic
+	case msg.Hi != nil:
+		return "hi", msg.Hi.Id, ""
+	case msg.Login != nil:
+		return "login", msg.Login.Id, ""
+	case msg.Get != nil:
+		return "get", msg.Get.Id, msg.Get.Topic
+	case msg.Set != nil:
+		return "set", msg.Set.Id, msg.Set.Topic
+	case msg.Del != nil:
+		return "del", msg.Del.Id, msg.Del.Topic
+	case msg.Acc != nil:
+		return "acc", msg.Acc.Id, ""
+	case msg.Note != nil:
+		return "note", "", msg.Note.Topic
+	}
+	return "", "", ""
+}
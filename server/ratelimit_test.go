@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+func newTestRateLimiter(t *testing.T, config string) *rateLimiter {
+	rl, err := newRateLimiter(json.RawMessage(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rl == nil {
+		t.Fatal("rate limiter not created")
+	}
+	return rl
+}
+
+func TestRateLimitConfig(t *testing.T) {
+	for _, config := range []string{
+		`{"messages":{"pub":{"rate":0,"burst":5}}}`,
+		`{"messages":{"pub":{"rate":1,"burst":0}}}`,
+		`{"address":{"pub":{"rate":1,"burst":5}}}`,
+		`{"messages":{"pub":null}}`,
+	} {
+		if _, err := newRateLimiter(json.RawMessage(config)); err == nil {
+			t.Error("invalid config accepted", config)
+		}
+	}
+	if rl, err := newRateLimiter(json.RawMessage(`{}`)); rl != nil || err != nil {
+		t.Error("empty config must disable rate limiting", rl, err)
+	}
+}
+
+func TestRateLimitBurst(t *testing.T) {
+	rl := newTestRateLimiter(t, `{"messages":{"pub":{"rate":0.5,"burst":3}}}`)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := rl.allow("pub", "usrAlice"); !ok {
+			t.Fatal("message within burst rejected", i)
+		}
+	}
+	ok, wait := rl.allow("pub", "usrAlice")
+	if ok {
+		t.Fatal("message over burst allowed")
+	}
+	// One token is accumulated in 2 seconds.
+	if wait <= time.Second || wait > 2*time.Second {
+		t.Error("unexpected wait", wait)
+	}
+
+	// Other subjects and kinds of messages are not affected.
+	if ok, _ := rl.allow("pub", "usrBob"); !ok {
+		t.Error("message of another user rejected")
+	}
+	if ok, _ := rl.allow("sub", "usrAlice"); !ok {
+		t.Error("message without a limit rejected")
+	}
+}
+
+func TestRateLimitRefill(t *testing.T) {
+	conf := bucketConfig{Rate: 2, Burst: 4}
+	now := time.Now()
+	b := &tokenBucket{tokens: 0, updated: now}
+
+	b.refill(conf, now.Add(time.Second))
+	if b.tokens != 2 {
+		t.Error("expected 2 tokens after 1 second, got", b.tokens)
+	}
+	b.refill(conf, now.Add(time.Minute))
+	if b.tokens != 4 {
+		t.Error("bucket must not exceed the burst, got", b.tokens)
+	}
+
+	// An exhausted bucket is usable again once refilled.
+	rl := newTestRateLimiter(t, `{"messages":{"pub":{"rate":2,"burst":1}}}`)
+	rl.allow("pub", "usrAlice")
+	if ok, _ := rl.allow("pub", "usrAlice"); ok {
+		t.Fatal("empty bucket allowed a message")
+	}
+	rl.buckets["pub usrAlice"].updated = time.Now().Add(-time.Second)
+	if ok, _ := rl.allow("pub", "usrAlice"); !ok {
+		t.Error("refilled bucket rejected a message")
+	}
+
+	// Full buckets are removed.
+	rl.buckets["pub usrAlice"].updated = time.Now().Add(-time.Second)
+	rl.gc(time.Now())
+	if len(rl.buckets) != 0 {
+		t.Error("full bucket not removed", rl.buckets)
+	}
+}
+
+func TestRateLimitReport(t *testing.T) {
+	rl := newTestRateLimiter(t, `{"messages":{"pub":{"rate":1,"burst":5}}}`)
+
+	// Usage reported by other nodes is added to the local usage.
+	if blocked := rl.report(map[string]int{"pub usrAlice": 3, "unknown usrAlice": 100}); len(blocked) != 0 {
+		t.Error("bucket blocked within the burst", blocked)
+	}
+	blocked := rl.report(map[string]int{"pub usrAlice": 100})
+	if wait := blocked["pub usrAlice"]; wait <= 5*time.Second || wait > 11*time.Second {
+		t.Error("overused bucket must be blocked for at most two bursts, got", wait)
+	}
+	if ok, _ := rl.allow("pub", "usrAlice"); ok {
+		t.Error("exhausted bucket allowed a message")
+	}
+
+	// Buckets blocked by the owner node are rejected locally.
+	rl.blocked["pub usrBob"] = time.Now().Add(time.Minute)
+	if ok, wait := rl.allow("pub", "usrBob"); ok || wait <= 59*time.Second {
+		t.Error("bucket blocked by the owner allowed a message", wait)
+	}
+}
+
+func TestSessionRateLimit(t *testing.T) {
+	defer func(rl *rateLimiter) { globals.rateLimiter = rl }(globals.rateLimiter)
+	globals.rateLimiter = newTestRateLimiter(t, `{"messages":{"pub":{"rate":1,"burst":2},
+		"login":{"rate":1,"burst":10}}, "address":{"login":{"rate":1,"burst":1}}}`)
+
+	pub := func(id string) *ClientComMessage {
+		return &ClientComMessage{Pub: &MsgClientPub{Id: id, Topic: "grpAbCd"}, timestamp: time.Now()}
+	}
+
+	// Sessions of one user share the limit.
+	uid := types.Uid(1001)
+	first := &Session{sid: "s1", uid: uid, proto: WEBSOCK, remoteAddr: "203.0.113.1:5000"}
+	second := &Session{sid: "s2", uid: uid, proto: WEBSOCK, remoteAddr: "203.0.113.2:5000"}
+	if first.rateLimit(pub("1")) != nil || second.rateLimit(pub("2")) != nil {
+		t.Fatal("messages within the limit rejected")
+	}
+	resp := second.rateLimit(pub("3"))
+	if resp == nil || resp.Ctrl == nil {
+		t.Fatal("limit shared across sessions not enforced")
+	}
+	if resp.Ctrl.Code != http.StatusTooManyRequests || resp.Ctrl.Id != "3" || resp.Ctrl.Topic != "grpAbCd" ||
+		resp.Ctrl.Params.(map[string]interface{})["retry"] != 1 {
+		t.Error("unexpected response", resp.Ctrl)
+	}
+
+	// Messages from other cluster nodes are checked at their origin.
+	if (&Session{sid: "s3", uid: uid, proto: CLUSTER}).rateLimit(pub("4")) != nil {
+		t.Error("message from a cluster node rejected")
+	}
+
+	// Sessions which are not authenticated are limited separately.
+	for _, sid := range []string{"s4", "s5"} {
+		s := &Session{sid: sid, proto: WEBSOCK, remoteAddr: "203.0.113.3:5000"}
+		if s.rateLimit(pub("5")) != nil {
+			t.Error("anonymous session limited by another session", sid)
+		}
+	}
+
+	// Logins are limited by the address too.
+	login := &ClientComMessage{Login: &MsgClientLogin{Id: "6"}, timestamp: time.Now()}
+	if (&Session{sid: "s6", proto: WEBSOCK, remoteAddr: "203.0.113.4:5000"}).rateLimit(login) != nil {
+		t.Fatal("first login rejected")
+	}
+	if (&Session{sid: "s7", proto: WEBSOCK, remoteAddr: "203.0.113.4:5001"}).rateLimit(login) == nil {
+		t.Error("login from the same address not limited")
+	}
+}
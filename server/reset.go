@@ -0,0 +1,203 @@
+/******************************************************************************
+ *
+ *  Description :
+ *
+ *  Reset of a lost secret, such as a password, with a one-time code sent to
+ *  a confirmed credential.
+ *
+ *****************************************************************************/
+
+package main
+
+import (
+	"crypto/rand"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nanfengpo/chat/server/auth"
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// Name of the pseudo authentication scheme used to request the reset and to store the code.
+	resetScheme = "reset"
+	// Time to enter the code.
+	resetCodeLifetime = 30 * time.Minute
+	// Number of wrong codes after which the code is discarded.
+	resetMaxAttempts = 5
+	// resetCodeLength = log10(resetMaxCodeValue)
+	resetCodeLength   = 6
+	resetMaxCodeValue = 1000000
+)
+
+// Hash to check the code against when there is no code, so the response takes the same time.
+var resetDummyHash = []byte("$2a$10$osb5jbYMNiSFS4PCqxlj9eAYtC2mwuNW3xXLEmijM0/LZDGRjjy8a")
+
+// resetSecret handles {login scheme="reset"}. The secret is the name of the authentication scheme
+// to reset, like "basic", the cred is the confirmed credential to send the code to. Once the code is
+// received, the client sends it back in cred.resp and the secret becomes the scheme name followed by
+// a colon and the new secret for the scheme, like "basic:alice:new-password".
+//
+// The responses do not depend on the existence of the account with the credential.
+func (s *Session) resetSecret(msg *ClientComMessage) {
+	scheme, newSecret := string(msg.Login.Secret), ""
+	if splitAt := strings.Index(scheme, ":"); splitAt >= 0 {
+		scheme, newSecret = scheme[:splitAt], scheme[splitAt+1:]
+	}
+
+	handler := store.GetAuthHandler(scheme)
+	if handler == nil {
+		s.queueOut(ErrAuthUnknownScheme(msg.Login.Id, "", msg.timestamp))
+		return
+	}
+
+	if len(msg.Login.Cred) != 1 {
+		s.queueOut(ErrMalformed(msg.Login.Id, "", msg.timestamp))
+		return
+	}
+	cred := msg.Login.Cred[0]
+	if _, ok := globals.validators[cred.Method]; !ok {
+		s.queueOut(decodeStoreError(types.ErrUnsupported, msg.Login.Id, "", msg.timestamp, nil))
+		return
+	}
+	vld := store.GetValidator(cred.Method)
+	cred.Value = vld.Normalize(cred.Value)
+	if err := vld.PreCheck(cred.Value, nil); err != nil {
+		s.queueOut(decodeStoreError(err, msg.Login.Id, "", msg.timestamp, nil))
+		return
+	}
+
+	uid, err := resetOwner(cred.Method, cred.Value, scheme)
+	if err != nil {
+		log.Println("reset: failed to look up the credential", err)
+		s.queueOut(ErrUnknown(msg.Login.Id, "", msg.timestamp))
+		return
+	}
+
+	if cred.Response == "" {
+		// Request for the code. The response is the same whether the code is sent or not. The code
+		// is sent in the background, otherwise the time of the response would tell.
+		if !uid.IsZero() {
+			go func(lang string) {
+				if err := sendResetCode(uid, cred.Method, cred.Value, scheme, lang); err != nil {
+					log.Println("reset: failed to send the code", uid.UserId(), err)
+				}
+			}(s.lang)
+		}
+		s.queueOut(NoErrAccepted(msg.Login.Id, "", msg.timestamp))
+		return
+	}
+
+	if newSecret == "" {
+		s.queueOut(ErrMalformed(msg.Login.Id, "", msg.timestamp))
+		return
+	}
+	if !checkResetCode(uid, cred.Response) {
+		s.queueOut(ErrAuthFailed(msg.Login.Id, "", msg.timestamp))
+		return
+	}
+
+	if err := handler.UpdateRecord(&auth.Rec{Uid: uid, AuthLevel: auth.LevelAuth}, []byte(newSecret)); err != nil {
+		s.queueOut(decodeStoreError(err, msg.Login.Id, "", msg.timestamp, nil))
+		return
+	}
+	// The code cannot be used again.
+	store.Users.DelAuthRecords(uid, resetScheme)
+	store.Users.ClearAuthFailures(resetScheme + ":" + uid.UserId())
+
+	// Whoever knew the old secret may have obtained tokens with it.
+	if tokenHdl := store.GetAuthHandler("token"); tokenHdl != nil {
+		if err := tokenHdl.UpdateRecord(&auth.Rec{Uid: uid}, nil); err != nil {
+			log.Println("reset: failed to revoke tokens", uid.UserId(), err)
+		}
+	}
+
+	s.queueOut(NoErr(msg.Login.Id, "", msg.timestamp))
+}
+
+// resetOwner returns ID of the active user who has confirmed the credential and has a record of the
+// authentication scheme. Returns ZeroUid if there is no such user.
+func resetOwner(method, value, scheme string) (types.Uid, error) {
+	uid, err := store.Users.GetByCred(method, value)
+	if err != nil || uid.IsZero() {
+		return types.ZeroUid, err
+	}
+	user, err := store.Users.Get(uid)
+	if err != nil || user == nil || user.DeletedAt != nil {
+		return types.ZeroUid, err
+	}
+	if _, _, _, _, err = store.Users.GetAuthRecord(uid, scheme); err == types.ErrNotFound {
+		return types.ZeroUid, nil
+	} else if err != nil {
+		return types.ZeroUid, err
+	}
+	return uid, nil
+}
+
+// sendResetCode generates a new code, saves its hash replacing the earlier one and sends the code
+// through the validator.
+func sendResetCode(uid types.Uid, method, value, scheme, lang string) error {
+	num, err := rand.Int(rand.Reader, big.NewInt(resetMaxCodeValue))
+	if err != nil {
+		return err
+	}
+	code := strconv.FormatInt(num.Int64(), 10)
+	code = strings.Repeat("0", resetCodeLength-len(code)) + code
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err = store.Users.DelAuthRecords(uid, resetScheme); err != nil {
+		return err
+	}
+	if _, err = store.Users.AddAuthRecord(uid, auth.LevelNone, resetScheme, uid.UserId(), hash,
+		types.TimeNow().Add(resetCodeLifetime)); err != nil {
+		return err
+	}
+	store.Users.ClearAuthFailures(resetScheme + ":" + uid.UserId())
+
+	return store.GetValidator(method).ResetSecret(value, scheme, lang, code)
+}
+
+// checkResetCode checks the code sent by the user. The code is discarded after too many wrong attempts.
+// The uid may be zero if there is no such user.
+func checkResetCode(uid types.Uid, code string) bool {
+	hash, found := resetDummyHash, false
+	if !uid.IsZero() {
+		_, _, secret, expires, err := store.Users.GetAuthRecord(uid, resetScheme)
+		if err == nil && expires.After(time.Now()) {
+			hash, found = secret, true
+		} else if err != nil && err != types.ErrNotFound {
+			log.Println("reset: failed to read the code", uid.UserId(), err)
+		}
+	}
+
+	// The attempt is counted before the code is compared, so concurrent attempts cannot exceed the limit.
+	key := resetScheme + ":" + uid.UserId()
+	var count int
+	var err error
+	if found {
+		count, err = store.Users.AddAuthFailure(key, time.Now().Add(-resetCodeLifetime))
+	}
+
+	match := bcrypt.CompareHashAndPassword(hash, []byte(code)) == nil
+	if !found {
+		return false
+	}
+	if err == nil && count <= resetMaxAttempts && match {
+		return true
+	}
+
+	if err != nil || count >= resetMaxAttempts {
+		// The last attempt has failed.
+		store.Users.DelAuthRecords(uid, resetScheme)
+		store.Users.ClearAuthFailures(key)
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nanfengpo/chat/server/auth"
+	"github.com/nanfengpo/chat/server/db/memory"
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCheckResetCode(t *testing.T) {
+	if err := memory.OpenTestStore(); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	uid := types.Uid(1001)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	saveCode := func() {
+		store.Users.DelAuthRecords(uid, resetScheme)
+		if _, err := store.Users.AddAuthRecord(uid, auth.LevelNone, resetScheme, uid.UserId(), hash,
+			types.TimeNow().Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		store.Users.ClearAuthFailures(resetScheme + ":" + uid.UserId())
+	}
+
+	saveCode()
+	for i := 0; i < resetMaxAttempts-1; i++ {
+		if checkResetCode(uid, "000000") {
+			t.Fatal("wrong code accepted")
+		}
+	}
+	if !checkResetCode(uid, "123456") {
+		t.Fatal("valid code rejected at the last attempt")
+	}
+	if checkResetCode(types.ZeroUid, "123456") {
+		t.Error("code accepted for a missing user")
+	}
+
+	// Concurrent attempts are all counted: the code is discarded after the last one.
+	saveCode()
+	var wg sync.WaitGroup
+	for i := 0; i < resetMaxAttempts*2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkResetCode(uid, "000000")
+		}()
+	}
+	wg.Wait()
+	if checkResetCode(uid, "123456") {
+		t.Error("code accepted after too many attempts")
+	}
+}
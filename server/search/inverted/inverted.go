@@ -0,0 +1,239 @@
+// Package inverted implements github.com/nanfengpo/chat/server/search interface as an embedded in-memory
+// inverted index: word -> topic -> message SeqIds. The index is optionally persisted to an append-only
+// file and rebuilt from it at startup. Only messages saved by the current process are indexed, so the
+// index is suitable for single-node deployments only.
+package inverted
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/nanfengpo/chat/server/search"
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+const (
+	// Maximum number of messages returned by a single search.
+	maxResults = 1024
+	// Maximum difference between SeqIds of candidates fetched from the database with a single query.
+	batchSpan = 256
+)
+
+type configType struct {
+	// Optional file to persist the index to.
+	File string `json:"file,omitempty"`
+}
+
+// Entry of the index file.
+type logEntry struct {
+	Topic string   `json:"t"`
+	SeqId int      `json:"s"`
+	Words []string `json:"w"`
+}
+
+type index struct {
+	sync.RWMutex
+
+	// word -> topic -> set of SeqIds
+	words map[string]map[string]map[int]struct{}
+
+	file *os.File
+	enc  *json.Encoder
+}
+
+func (idx *index) Init(jsconf string) error {
+	var config configType
+	if jsconf != "" {
+		if err := json.Unmarshal([]byte(jsconf), &config); err != nil {
+			return errors.New("inverted index failed to parse config: " + err.Error())
+		}
+	}
+
+	idx.words = make(map[string]map[string]map[int]struct{})
+
+	if config.File == "" {
+		return nil
+	}
+
+	file, err := os.OpenFile(config.File, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	// Rebuild the index from the file.
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry logEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// Possibly a partially written last line.
+			log.Println("inverted index: skipped malformed entry", err)
+			continue
+		}
+		idx.add(entry.Topic, entry.SeqId, entry.Words)
+	}
+	if err = scanner.Err(); err != nil {
+		file.Close()
+		return err
+	}
+
+	idx.file = file
+	idx.enc = json.NewEncoder(file)
+
+	return nil
+}
+
+// add must be called with the lock held or from Init.
+func (idx *index) add(topic string, seq int, words []string) {
+	for _, word := range words {
+		topics := idx.words[word]
+		if topics == nil {
+			topics = make(map[string]map[int]struct{})
+			idx.words[word] = topics
+		}
+		seqs := topics[topic]
+		if seqs == nil {
+			seqs = make(map[int]struct{})
+			topics[topic] = seqs
+		}
+		seqs[seq] = struct{}{}
+	}
+}
+
+// Index adds words of the message to the index. Words of the earlier versions of edited
+// messages are not removed: such false positives are filtered out at search time.
+func (idx *index) Index(msg *types.Message) error {
+	words := search.MessageWords(msg)
+	if len(words) == 0 {
+		return nil
+	}
+
+	idx.Lock()
+	defer idx.Unlock()
+
+	idx.add(msg.Topic, msg.SeqId, words)
+
+	if idx.enc != nil {
+		if err := idx.enc.Encode(&logEntry{Topic: msg.Topic, SeqId: msg.SeqId, Words: words}); err != nil {
+			log.Println("inverted index: failed to persist entry", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// candidates returns SeqIds of messages in the topic which may contain all the words, highest first.
+func (idx *index) candidates(topic string, words []string, lower, upper int) []int {
+	idx.RLock()
+	defer idx.RUnlock()
+
+	var seqs []int
+	for seq := range idx.words[words[0]][topic] {
+		if seq < lower || seq >= upper {
+			continue
+		}
+		found := true
+		for _, word := range words[1:] {
+			if _, ok := idx.words[word][topic][seq]; !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(seqs)))
+	return seqs
+}
+
+// Search finds messages in the index then fetches them from the database. Deleted messages are
+// not returned by the database and thus skipped.
+func (idx *index) Search(topics []string, forUser types.Uid, query string,
+	opts *types.QueryOpt) ([]types.Message, error) {
+
+	words := search.Words(query)
+	if len(topics) == 0 || len(words) == 0 {
+		return nil, nil
+	}
+
+	var limit = maxResults
+	var lower = 0
+	var upper = 1 << 31
+
+	if opts != nil {
+		if opts.Since > 0 {
+			lower = opts.Since
+		}
+		if opts.Before > 0 {
+			upper = opts.Before
+		}
+		if opts.Limit > 0 && opts.Limit < limit {
+			limit = opts.Limit
+		}
+	}
+
+	var msgs []types.Message
+	for _, topic := range topics {
+		// Each topic contributes at most 'limit' of its newest matching messages.
+		found, err := fetch(topic, forUser, idx.candidates(topic, words, lower, upper), words, limit)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, found...)
+	}
+
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].CreatedAt.After(msgs[j].CreatedAt)
+	})
+	if len(msgs) > limit {
+		msgs = msgs[:limit]
+	}
+
+	return msgs, nil
+}
+
+// fetch loads candidate messages from the database and keeps those which contain all the words.
+// Candidates close to each other are loaded with a single query. Candidates must be sorted highest first.
+func fetch(topic string, forUser types.Uid, seqs []int, words []string, limit int) ([]types.Message, error) {
+	var msgs []types.Message
+	for len(seqs) > 0 && len(msgs) < limit {
+		n := 1
+		for n < len(seqs) && seqs[0]-seqs[n] < batchSpan {
+			n++
+		}
+		batch := make(map[int]bool, n)
+		for _, seq := range seqs[:n] {
+			batch[seq] = true
+		}
+
+		// The range has at most batchSpan messages, none of them are cut off by the limit.
+		found, err := store.Messages.GetAll(topic, forUser,
+			&types.QueryOpt{Since: seqs[n-1], Before: seqs[0] + 1, Limit: batchSpan})
+		if err != nil {
+			return nil, err
+		}
+		for i := range found {
+			if !batch[found[i].SeqId] || !search.Contains(&found[i], words) {
+				continue
+			}
+			msgs = append(msgs, found[i])
+			if len(msgs) == limit {
+				break
+			}
+		}
+		seqs = seqs[n:]
+	}
+	return msgs, nil
+}
+
+func init() {
+	store.RegisterSearchIndex("inverted", &index{})
+}
@@ -0,0 +1,79 @@
+// Package search defines an interface which must be implemented by full-text message indexes
+// and helpers for extracting searchable words from messages.
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+// MinWordLength is the shortest word (in runes) which is indexed and searched for.
+const MinWordLength = 2
+
+// Indexer is an interface which must be implemented by full-text search indexes.
+type Indexer interface {
+	// Init initializes the index.
+	Init(jsconf string) error
+
+	// Index adds a newly saved or an edited message to the index.
+	Index(msg *types.Message) error
+
+	// Search returns messages from the given topics which contain all the words of the query.
+	// Messages which are hard-deleted or soft-deleted for forUser must be skipped.
+	// The opts.Since and opts.Before limit SeqIds of messages, they are set only when searching
+	// a single topic. The opts.Limit limits the total number of results. Messages are returned
+	// newest first.
+	Search(topics []string, forUser types.Uid, query string, opts *types.QueryOpt) ([]types.Message, error)
+}
+
+// ContentText returns searchable text of message content. The content is either a plain string
+// or a Drafty document with the text in the 'txt' field.
+func ContentText(content interface{}) string {
+	switch val := content.(type) {
+	case string:
+		return val
+	case map[string]interface{}:
+		if txt, ok := val["txt"].(string); ok {
+			return txt
+		}
+	}
+	return ""
+}
+
+// Words splits text into a list of unique lowercase words. Words shorter than
+// MinWordLength are dropped.
+func Words(text string) []string {
+	var words []string
+	seen := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if len([]rune(word)) < MinWordLength || seen[word] {
+			continue
+		}
+		seen[word] = true
+		words = append(words, word)
+	}
+	return words
+}
+
+// MessageWords returns the list of unique words in the message content.
+func MessageWords(msg *types.Message) []string {
+	return Words(ContentText(msg.Content))
+}
+
+// Contains checks if all the words are present in the message.
+func Contains(msg *types.Message, words []string) bool {
+	have := make(map[string]bool)
+	for _, word := range MessageWords(msg) {
+		have[word] = true
+	}
+	for _, word := range words {
+		if !have[word] {
+			return false
+		}
+	}
+	return true
+}
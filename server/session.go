@@ -11,6 +11,8 @@ package main
 
 import (
 	"container/list"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -186,6 +188,40 @@ func (s *Session) queueOutBytes(data []byte) bool {
 	return true
 }
 
+// terminate disconnects the session after sending it the message. Sessions proxied from other
+// cluster nodes are disconnected at their origin.
+func (s *Session) terminate(msg *ServerComMessage) {
+	if s.proto == CLUSTER {
+		data, _ := json.Marshal(msg)
+		go func() {
+			var unused bool
+			if err := s.clnode.call("Cluster.Proxy",
+				&ClusterResp{Msg: data, FromSID: s.sid, Terminate: true}, &unused); err != nil {
+				log.Println("s.terminate: failed to reach origin node", s.sid, err)
+			}
+		}()
+		return
+	}
+
+	s.terminateBytes(s.serialize(msg))
+}
+
+// terminateBytes requests the session to shut down after sending the already serialized message.
+func (s *Session) terminateBytes(data interface{}) {
+	select {
+	case s.stop <- data:
+	default:
+		// Shutdown already requested.
+	}
+}
+
+// publicID returns the ID of the session which is safe to show to the user. Session IDs of
+// long polling sessions act as credentials and must not be revealed.
+func (s *Session) publicID() string {
+	sum := sha256.Sum256([]byte(s.sid))
+	return base64.RawURLEncoding.EncodeToString(sum[:9])
+}
+
 func (s *Session) cleanUp() int {
 	count := globals.sessionStore.Delete(s)
 	globals.cluster.sessionGone(s)
@@ -240,6 +276,11 @@ func (s *Session) dispatch(msg *ClientComMessage) {
 
 	msg.timestamp = time.Now().UTC().Round(time.Millisecond)
 
+	if resp = s.rateLimit(msg); resp != nil {
+		s.queueOut(resp)
+		return
+	}
+
 	switch {
 	case msg.Pub != nil:
 		s.publish(msg)
@@ -375,12 +416,18 @@ func (s *Session) publish(msg *ClientComMessage) {
 		return
 	}
 
+	if msg.Pub.ReplyTo < 0 {
+		s.queueOut(ErrMalformed(msg.Pub.Id, msg.Pub.Topic, msg.timestamp))
+		return
+	}
+
 	data := &ServerComMessage{Data: &MsgServerData{
 		Topic:     msg.Pub.Topic,
 		From:      msg.from,
 		Timestamp: msg.timestamp,
 		Head:      msg.Pub.Head,
-		Content:   msg.Pub.Content},
+		Content:   msg.Pub.Content,
+		ReplyTo:   msg.Pub.ReplyTo},
 		rcptto: expanded, sessFrom: s, id: msg.Pub.Id, timestamp: msg.timestamp}
 	if msg.Pub.NoEcho {
 		data.skipSid = s.sid
@@ -428,7 +475,7 @@ func (s *Session) hello(msg *ClientComMessage) {
 		if !s.uid.IsZero() {
 			if err := store.Devices.Update(s.uid, s.deviceID, &types.DeviceDef{
 				DeviceId: msg.Hi.DeviceID,
-				Platform: "",
+				Platform: devicePlatform(msg.Hi.UserAgent, msg.Hi.DeviceID),
 				LastSeen: msg.timestamp,
 				Lang:     msg.Hi.Lang,
 			}); err != nil {
@@ -625,10 +672,19 @@ func (s *Session) acc(msg *ClientComMessage) {
 	} else if !s.uid.IsZero() {
 		var params map[string]interface{}
 		if authhdl != nil {
-			// Request to update auth of an existing account. Only basic auth is currently supported
-			// TODO(gene): support adding new auth schemes
+			// Request to add or update auth of an existing account.
 			// TODO(gene): support the case when msg.Acc.User is not equal to the current user
-			if err := authhdl.UpdateRecord(&auth.Rec{Uid: s.uid}, msg.Acc.Secret); err != nil {
+			_, _, _, _, err := store.Users.GetAuthRecord(s.uid, msg.Acc.Scheme)
+			if err == types.ErrNotFound {
+				// The user does not have a record of this scheme yet.
+				var rec *auth.Rec
+				if rec, err = authhdl.AddRecord(&auth.Rec{Uid: s.uid}, msg.Acc.Secret); err == nil {
+					params = rec.Params
+				}
+			} else if err == nil {
+				err = authhdl.UpdateRecord(&auth.Rec{Uid: s.uid}, msg.Acc.Secret)
+			}
+			if err != nil {
 				log.Println("auth: failed to update secret", err)
 				s.queueOut(decodeStoreError(err, msg.Acc.Id, "", msg.timestamp, nil))
 				return
@@ -679,6 +735,11 @@ func (s *Session) login(msg *ClientComMessage) {
 		return
 	}
 
+	if msg.Login.Scheme == resetScheme {
+		s.resetSecret(msg)
+		return
+	}
+
 	handler := store.GetAuthHandler(msg.Login.Scheme)
 	if handler == nil {
 		log.Println("Unknown authentication scheme", msg.Login.Scheme)
@@ -686,12 +747,21 @@ func (s *Session) login(msg *ClientComMessage) {
 		return
 	}
 
-	rec, challenge, err := handler.Authenticate(msg.Login.Secret)
+	rec, challenge, err := authenticate(handler, msg.Login.Secret, s.remoteAddr)
 	if err != nil {
 		s.queueOut(decodeStoreError(err, msg.Login.Id, "", msg.timestamp, nil))
 		return
 	}
 
+	if challenge == nil {
+		challenge, err = secondFactorChallenge(rec)
+		if err != nil {
+			log.Println("auth: failed to issue second factor challenge", err)
+			s.queueOut(decodeStoreError(err, msg.Login.Id, "", msg.timestamp, nil))
+			return
+		}
+	}
+
 	if challenge != nil {
 		// Multi-stage authentication. Issue challenge to the client.
 		s.queueOut(InfoChallenge(msg.Login.Id, msg.timestamp, challenge))
@@ -750,7 +820,7 @@ func (s *Session) onLogin(msgID string, timestamp time.Time, rec *auth.Rec, miss
 		if s.deviceID != "" {
 			if err := store.Devices.Update(rec.Uid, "", &types.DeviceDef{
 				DeviceId: s.deviceID,
-				Platform: "",
+				Platform: devicePlatform(s.userAgent, s.deviceID),
 				LastSeen: timestamp,
 				Lang:     s.lang,
 			}); err != nil {
@@ -761,13 +831,41 @@ func (s *Session) onLogin(msgID string, timestamp time.Time, rec *auth.Rec, miss
 
 	// GenSecret fails only if tokenLifetime is < 0. It can't be < 0 here,
 	// otherwise login would have failed earlier.
-	rec.Features = features
+	// Tokens issued after the second step of authentication don't require it again.
+	rec.Features = features | (rec.Features & auth.TwoFactor)
+	// JWT is issued only if the 'jwt' scheme is configured with a signing key.
+	if jwt, _, err := store.GetAuthHandler("jwt").GenSecret(rec); err == nil {
+		params["jwt"] = string(jwt)
+	}
 	params["token"], params["expires"], _ = store.GetAuthHandler("token").GenSecret(rec)
 
 	reply.Ctrl.Params = params
 	return reply
 }
 
+// secondFactorChallenge checks if the user must pass the second step of authentication and
+// generates the challenge to present to the client.
+func secondFactorChallenge(rec *auth.Rec) ([]byte, error) {
+	if rec.Features&auth.TwoFactor != 0 {
+		return nil, nil
+	}
+
+	_, authLvl, _, _, err := store.Users.GetAuthRecord(rec.Uid, "totp")
+	if err == types.ErrNotFound || (err == nil && authLvl == auth.LevelNone) {
+		// The second factor is not enabled or not confirmed yet.
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	challenge, _, err := store.GetAuthHandler("totp").GenSecret(rec)
+	if err == types.ErrUnsupported {
+		// The second factor is disabled in the config.
+		return nil, nil
+	}
+	return challenge, err
+}
+
 // Get a list of all validated credentials.
 func (s *Session) getValidatedGred(uid types.Uid, authLvl auth.Level, creds []MsgAccCred) ([]string, error) {
 
@@ -838,7 +936,7 @@ func (s *Session) get(msg *ClientComMessage) {
 		if err := globals.cluster.routeToTopic(msg, expanded, s); err != nil {
 			s.queueOut(ErrClusterNodeUnreachable(msg.Get.Id, msg.Get.Topic, msg.timestamp))
 		}
-	} else if meta.what&(constMsgMetaData|constMsgMetaSub|constMsgMetaDel) != 0 {
+	} else if meta.what&(constMsgMetaData|constMsgMetaSub|constMsgMetaDel|constMsgMetaSearch|constMsgMetaSess) != 0 {
 		log.Println("s.get: subscribe first to get=", msg.Get.What)
 		s.queueOut(ErrPermissionDenied(msg.Get.Id, msg.Get.Topic, msg.timestamp))
 	} else {
@@ -875,6 +973,9 @@ func (s *Session) set(msg *ClientComMessage) {
 		if msg.Set.Tags != nil {
 			meta.what |= constMsgMetaTags
 		}
+		if msg.Set.Notify != nil {
+			meta.what |= constMsgMetaNotify
+		}
 		if meta.what == 0 {
 			s.queueOut(ErrMalformed(msg.Set.Id, msg.Set.Topic, msg.timestamp))
 			log.Println("s.set: nil Set action")
@@ -964,6 +1065,10 @@ func (s *Session) note(msg *ClientComMessage) {
 		if msg.Note.SeqId <= 0 {
 			return
 		}
+	case "react", "unreact":
+		if msg.Note.SeqId <= 0 || msg.Note.Reaction == "" || len(msg.Note.Reaction) > maxReactionLength {
+			return
+		}
 	default:
 		return
 	}
@@ -971,10 +1076,11 @@ func (s *Session) note(msg *ClientComMessage) {
 	if sub := s.getSub(expanded); sub != nil {
 		// Pings can be sent to subscribed topics only
 		sub.broadcast <- &ServerComMessage{Info: &MsgServerInfo{
-			Topic: msg.Note.Topic,
-			From:  s.uid.UserId(),
-			What:  msg.Note.What,
-			SeqId: msg.Note.SeqId,
+			Topic:    msg.Note.Topic,
+			From:     s.uid.UserId(),
+			What:     msg.Note.What,
+			SeqId:    msg.Note.SeqId,
+			Reaction: msg.Note.Reaction,
 		}, rcptto: expanded, timestamp: msg.timestamp, skipSid: s.sid}
 	} else if globals.cluster.isRemoteTopic(expanded) {
 		// The topic is handled by a remote node. Forward message to it.
@@ -18,6 +18,7 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/nanfengpo/chat/pbx"
 	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
 )
 
 // SessionStore holds live sessions. Long polling sessions are stored in a linked list with
@@ -113,6 +114,20 @@ func (ss *SessionStore) Get(sid string) *Session {
 	return nil
 }
 
+// FindByUser returns live sessions of the given user, including sessions proxied from other cluster nodes.
+func (ss *SessionStore) FindByUser(uid types.Uid) []*Session {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	var found []*Session
+	for _, sess := range ss.sessCache {
+		if sess.uid == uid {
+			found = append(found, sess)
+		}
+	}
+	return found
+}
+
 // Delete removes session from store.
 func (ss *SessionStore) Delete(s *Session) int {
 	ss.lock.Lock()
@@ -10,12 +10,14 @@ import (
 	"github.com/nanfengpo/chat/server/auth"
 	"github.com/nanfengpo/chat/server/db"
 	"github.com/nanfengpo/chat/server/media"
+	"github.com/nanfengpo/chat/server/search"
 	"github.com/nanfengpo/chat/server/store/types"
 	"github.com/nanfengpo/chat/server/validate"
 )
 
 var adp adapter.Adapter
 var mediaHandler media.Handler
+var searchIndex search.Indexer
 
 // Unique ID generator
 var uGen types.UidGenerator
@@ -41,13 +43,8 @@ func openAdapter(workerId int, jsonconf string) error {
 		return errors.New("store: connection is already opened")
 	}
 
-	// Initialise snowflake
-	if workerId < 0 || workerId > 1023 {
-		return errors.New("store: invalid worker ID")
-	}
-
-	if err := uGen.Init(uint(workerId), config.UidKey); err != nil {
-		return errors.New("store: failed to init snowflake: " + err.Error())
+	if err := InitUidGenerator(workerId, config.UidKey); err != nil {
+		return err
 	}
 
 	var adapterConfig string
@@ -108,6 +105,18 @@ func InitDb(jsonconf string, reset bool) error {
 	return adp.CreateDb(reset)
 }
 
+// UpgradeDb upgrades an existing database to the version expected by the adapter without losing data.
+// If dryRun is true, the database is not changed. Returns descriptions of the applied or planned steps.
+// If the connection is not open yet, the config string is used to open it first.
+func UpgradeDb(jsonconf string, dryRun bool) ([]string, error) {
+	if !IsOpen() {
+		if err := openAdapter(1, jsonconf); err != nil {
+			return nil, err
+		}
+	}
+	return adp.UpgradeDb(dryRun)
+}
+
 // RegisterAdapter makes a persistence adapter available.
 // If Register is called twice or if the adapter is nil, it panics.
 func RegisterAdapter(name string, a adapter.Adapter) {
@@ -122,6 +131,20 @@ func RegisterAdapter(name string, a adapter.Adapter) {
 	adp = a
 }
 
+// InitUidGenerator initializes the generator of unique IDs. It's called when the store is opened. Call it
+// directly only when the adapter is used without the store, e.g. in adapter tests.
+func InitUidGenerator(workerId int, key []byte) error {
+	// Initialise snowflake
+	if workerId < 0 || workerId > 1023 {
+		return errors.New("store: invalid worker ID")
+	}
+
+	if err := uGen.Init(uint(workerId), key); err != nil {
+		return errors.New("store: failed to init snowflake: " + err.Error())
+	}
+	return nil
+}
+
 // GetUid generates a unique ID suitable for use as a primary key.
 func GetUid() types.Uid {
 	return uGen.Get()
@@ -229,7 +252,31 @@ func (UsersObjMapper) UpdateAuthRecord(uid types.Uid, authLvl auth.Level, scheme
 
 // DelAuthRecords deletes user's all auth records of the given scheme.
 func (UsersObjMapper) DelAuthRecords(uid types.Uid, scheme string) error {
-	return adp.AuthDelRecord(uid, scheme)
+	// Records are deleted by the unique value which is not known to the caller.
+	unique, _, _, _, err := adp.AuthGetRecord(uid, scheme)
+	if err == types.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return adp.AuthDelRecord(uid, unique)
+}
+
+// GetAuthFailures returns the count of failed authentication attempts for the given key and the
+// time of the last failure.
+func (UsersObjMapper) GetAuthFailures(key string) (int, time.Time, error) {
+	return adp.AuthFailGet(key)
+}
+
+// AddAuthFailure records a failed authentication attempt for the given key and returns the updated
+// count. Failures which happened before resetBefore are forgotten.
+func (UsersObjMapper) AddAuthFailure(key string, resetBefore time.Time) (int, error) {
+	return adp.AuthFailAdd(key, resetBefore)
+}
+
+// ClearAuthFailures forgets failed authentication attempts for the given key.
+func (UsersObjMapper) ClearAuthFailures(key string) error {
+	return adp.AuthFailDel(key)
 }
 
 // Get returns a user object for the given user id
@@ -249,7 +296,7 @@ func (UsersObjMapper) Delete(id types.Uid, soft bool) error {
 		// TODO: Maybe delete topics where the user is the owner and all subscriptions to those topics,
 		// and messages
 		adp.AuthDelAllRecords(id)
-		adp.CredDel(id, "")
+		adp.CredDel(id, "", "")
 	}
 
 	adp.UserDelete(id, soft)
@@ -313,6 +360,12 @@ func (UsersObjMapper) FailCred(id types.Uid, method string) error {
 	return adp.CredFail(id, method)
 }
 
+// DelCred deletes user's credential of the given method and value. All credentials of the method
+// are deleted if the value is empty.
+func (UsersObjMapper) DelCred(id types.Uid, method, value string) error {
+	return adp.CredDel(id, method, value)
+}
+
 // GetCred gets a list of confirmed credentials.
 func (UsersObjMapper) GetCred(id types.Uid, method string) (*types.Credential, error) {
 	var creds []*types.Credential
@@ -327,6 +380,12 @@ func (UsersObjMapper) GetCred(id types.Uid, method string) (*types.Credential, e
 
 }
 
+// GetByCred returns ID of the user who has confirmed the given credential, or ZeroUid if the credential
+// is not confirmed by anyone.
+func (UsersObjMapper) GetByCred(method, value string) (types.Uid, error) {
+	return adp.CredGetOwner(method, value)
+}
+
 // GetAllCred retrieves all confimed credential for the given user.
 func (UsersObjMapper) GetAllCred(id types.Uid) ([]*types.Credential, error) {
 	return adp.CredGet(id, "")
@@ -478,6 +537,49 @@ func (MessagesObjMapper) Save(msg *types.Message) error {
 	}
 
 	// Check if the message has attachments. If so, link earlier uploaded files to message.
+	attachments := msgAttachments(msg)
+
+	err = adp.MessageSave(msg)
+	if err != nil {
+		return err
+	}
+
+	if searchIndex != nil {
+		// The message is already saved. Failure to index it is not reported to the sender.
+		searchIndex.Index(msg)
+	}
+
+	if len(attachments) > 0 {
+		return adp.MessageAttachments(msg.Uid(), attachments)
+	}
+	return nil
+}
+
+// Edit replaces Head and Content of an existing message identified by msg.Topic and msg.SeqId.
+// The previous version of the message is kept as a revision.
+func (MessagesObjMapper) Edit(msg *types.Message) error {
+	msg.UpdatedAt = types.TimeNow()
+
+	attachments := msgAttachments(msg)
+
+	err := adp.MessageEdit(msg)
+	if err != nil {
+		return err
+	}
+
+	if searchIndex != nil {
+		searchIndex.Index(msg)
+	}
+
+	if len(attachments) > 0 {
+		return adp.MessageAttachments(msg.Uid(), attachments)
+	}
+	return nil
+}
+
+// msgAttachments converts attachment URLs in message header to file IDs. The header
+// is removed if it contains no valid attachments.
+func msgAttachments(msg *types.Message) []string {
 	var attachments []string
 	if header, ok := msg.Head["attachments"]; ok {
 		// The header is typed as []interface{}, convert to []string
@@ -496,16 +598,17 @@ func (MessagesObjMapper) Save(msg *types.Message) error {
 			delete(msg.Head, "attachments")
 		}
 	}
+	return attachments
+}
 
-	err = adp.MessageSave(msg)
-	if err != nil {
-		return err
-	}
+// AddReaction records user's reaction to a message.
+func (MessagesObjMapper) AddReaction(topic string, seqID int, user types.Uid, reaction string) error {
+	return adp.MessageReactionAdd(topic, seqID, user, reaction)
+}
 
-	if len(attachments) > 0 {
-		return adp.MessageAttachments(msg.Uid(), attachments)
-	}
-	return nil
+// DeleteReaction removes user's reaction to a message.
+func (MessagesObjMapper) DeleteReaction(topic string, seqID int, user types.Uid, reaction string) error {
+	return adp.MessageReactionDelete(topic, seqID, user, reaction)
 }
 
 // DeleteList deletes multiple messages defined by a list of ranges.
@@ -548,6 +651,16 @@ func (MessagesObjMapper) GetAll(topic string, forUser types.Uid, opt *types.Quer
 	return adp.MessageGetAll(topic, forUser, opt)
 }
 
+// Search returns messages from the given topics which contain all the words of the query.
+func (MessagesObjMapper) Search(topics []string, forUser types.Uid, query string,
+	opt *types.QueryOpt) ([]types.Message, error) {
+
+	if searchIndex == nil {
+		return nil, types.ErrUnsupported
+	}
+	return searchIndex.Search(topics, forUser, query, opt)
+}
+
 // GetDeleted returns the ranges of deleted messages and the largest DelId reported in the list.
 func (MessagesObjMapper) GetDeleted(topic string, forUser types.Uid, opt *types.QueryOpt) ([]types.Range, int, error) {
 	dmsgs, err := adp.MessageGetDeleted(topic, forUser, opt)
@@ -684,6 +797,54 @@ func UseMediaHandler(name, config string) error {
 	return mediaHandler.Init(config)
 }
 
+// Registered full-text search indexes.
+var searchIndexes map[string]search.Indexer
+
+// RegisterSearchIndex saves reference to a full-text search index.
+func RegisterSearchIndex(name string, idx search.Indexer) {
+	if searchIndexes == nil {
+		searchIndexes = make(map[string]search.Indexer)
+	}
+
+	if idx == nil {
+		panic("RegisterSearchIndex: index is nil")
+	}
+	if _, dup := searchIndexes[name]; dup {
+		panic("RegisterSearchIndex: called twice for index " + name)
+	}
+	searchIndexes[name] = idx
+}
+
+// UseSearchIndex sets specified full-text search index as default.
+func UseSearchIndex(name, config string) error {
+	searchIndex = searchIndexes[name]
+	if searchIndex == nil {
+		panic("UseSearchIndex: unknown index '" + name + "'")
+	}
+	return searchIndex.Init(config)
+}
+
+// dbIndex is a full-text search index which uses the database adapter for storing and searching words.
+type dbIndex struct{}
+
+func (dbIndex) Init(jsconf string) error {
+	return nil
+}
+
+func (dbIndex) Index(msg *types.Message) error {
+	return adp.MessageIndex(msg.Topic, msg.SeqId, search.MessageWords(msg))
+}
+
+func (dbIndex) Search(topics []string, forUser types.Uid, query string,
+	opt *types.QueryOpt) ([]types.Message, error) {
+
+	return adp.MessageSearch(topics, forUser, search.Words(query), opt)
+}
+
+func init() {
+	RegisterSearchIndex("db", dbIndex{})
+}
+
 // FileMapper is a struct to map methods used for file handling.
 type FileMapper struct{}
 
@@ -705,6 +866,12 @@ func (FileMapper) FinishUpload(fid string, success bool, size int64) (*types.Fil
 	return adp.FileFinishUpload(fid, status, size)
 }
 
+// UpdateUpload records progress of a partial upload: the number of bytes received so far.
+// The upload remains in the started state.
+func (FileMapper) UpdateUpload(fid string, size int64) (*types.FileDef, error) {
+	return adp.FileFinishUpload(fid, types.UploadStarted, size)
+}
+
 // Get fetches a file record for a unique file id.
 func (FileMapper) Get(fid string) (*types.FileDef, error) {
 	return adp.FileGet(fid)
@@ -716,8 +883,15 @@ func (FileMapper) DeleteUnused(olderThan time.Time, limit int) error {
 	if err != nil {
 		return err
 	}
-	if len(toDel) > 0 {
-		return GetMediaHandler().Delete(toDel)
+	// Partial uploads have no location: their data is not stored by the media handler yet.
+	var locations []string
+	for _, loc := range toDel {
+		if loc != "" {
+			locations = append(locations, loc)
+		}
+	}
+	if len(locations) > 0 {
+		return GetMediaHandler().Delete(locations)
 	}
 	return nil
 }
@@ -41,6 +41,8 @@ const (
 	ErrNotFound = StoreError("not found")
 	// ErrPermissionDenied means the operation is not permitted
 	ErrPermissionDenied = StoreError("denied")
+	// ErrLocked means there were too many failed attempts, the caller must wait before trying again
+	ErrLocked = StoreError("locked")
 )
 
 // Uid is a database-specific record id, suitable to be used as a primary key.
@@ -329,6 +331,87 @@ type User struct {
 
 	// Info on known devices, used for push notifications
 	Devices map[string]*DeviceDef
+
+	// Daily period when push notifications are not sent, like "22:00-07:00 Europe/Berlin".
+	// See ParseQuietHours.
+	QuietHours string
+}
+
+// QuietHours is a daily period of time when the user does not want to receive push notifications.
+type QuietHours struct {
+	// Start and end of the period in minutes since midnight. The period may span midnight.
+	From int
+	To   int
+	// Time zone of the user.
+	Location *time.Location
+}
+
+// ParseQuietHours parses quiet hours in the form "HH:MM-HH:MM Time/Zone", like "22:00-07:00 Europe/Berlin".
+// Returns nil if the string is empty. The time zone is optional, UTC by default.
+func ParseQuietHours(s string) (*QuietHours, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	period, zone := s, ""
+	if sp := strings.IndexByte(s, ' '); sp > 0 {
+		period, zone = s[:sp], strings.TrimSpace(s[sp+1:])
+	}
+	parts := strings.Split(period, "-")
+	if len(parts) != 2 {
+		return nil, ErrMalformed
+	}
+
+	var q QuietHours
+	var err error
+	if q.From, err = parseClock(parts[0]); err != nil {
+		return nil, err
+	}
+	if q.To, err = parseClock(parts[1]); err != nil {
+		return nil, err
+	}
+	if q.From == q.To {
+		return nil, ErrMalformed
+	}
+	if q.Location, err = time.LoadLocation(zone); err != nil {
+		return nil, ErrMalformed
+	}
+	return &q, nil
+}
+
+// parseClock converts "HH:MM" to minutes since midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, ErrMalformed
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// String formats quiet hours as "HH:MM-HH:MM Time/Zone".
+func (q *QuietHours) String() string {
+	if q == nil {
+		return ""
+	}
+	clock := func(m int) string {
+		return time.Date(0, 1, 1, m/60, m%60, 0, 0, time.UTC).Format("15:04")
+	}
+	return clock(q.From) + "-" + clock(q.To) + " " + q.Location.String()
+}
+
+// Contains checks if the given time falls within quiet hours in the user's time zone.
+func (q *QuietHours) Contains(when time.Time) bool {
+	if q == nil {
+		return false
+	}
+	local := when.In(q.Location)
+	m := local.Hour()*60 + local.Minute()
+	if q.From < q.To {
+		return m >= q.From && m < q.To
+	}
+	// The period spans midnight.
+	return m >= q.From || m < q.To
 }
 
 // AccessMode is a definition of access mode bits.
@@ -421,7 +504,8 @@ func (m *AccessMode) UnmarshalText(b []byte) error {
 	}
 
 	if m0 != ModeUnset {
-		*m = m0
+		// ModeUnset is only a marker that nothing was parsed, it's not a part of the value.
+		*m = m0 &^ ModeUnset
 	}
 	return nil
 }
@@ -456,10 +540,13 @@ func (m *AccessMode) UnmarshalJSON(b []byte) error {
 }
 
 // Scan is an implementation of sql.Scanner interface. It expects the
-// value to be a byte slice representation of an ASCII string.
+// value to be a byte slice or a string representation of an ASCII string.
 func (m *AccessMode) Scan(val interface{}) error {
-	if bb, ok := val.([]byte); ok {
-		return m.UnmarshalText(bb)
+	switch v := val.(type) {
+	case []byte:
+		return m.UnmarshalText(v)
+	case string:
+		return m.UnmarshalText([]byte(v))
 	}
 	return errors.New("scan failed: data is not a byte slice")
 }
@@ -608,6 +695,8 @@ type Subscription struct {
 	RecvSeqId int
 	// Last SeqID reported read by the user
 	ReadSeqId int
+	// Count of unread messages which mention the user
+	MentionCount int
 
 	// Access mode requested by this user
 	ModeWant AccessMode
@@ -616,6 +705,11 @@ type Subscription struct {
 	// User's private data associated with the subscription to topic
 	Private interface{}
 
+	// Push notifications are not sent until this time
+	MuteUntil *time.Time
+	// Push notifications are sent only for messages which mention the user
+	MentionsOnly bool
+
 	// Deserialized ephemeral values
 
 	// Deserialized public value from topic or user (depends on context)
@@ -646,6 +740,14 @@ func (s *Subscription) GetPublic() interface{} {
 	return s.public
 }
 
+// MutedUntil returns the time when the subscription is unmuted or zero time if it's not muted.
+func (s *Subscription) MutedUntil() time.Time {
+	if s.MuteUntil == nil {
+		return time.Time{}
+	}
+	return *s.MuteUntil
+}
+
 // SetWith sets other user for P2P subscriptions.
 func (s *Subscription) SetWith(with string) {
 	s.with = with
@@ -843,6 +945,14 @@ type Message struct {
 	From    string
 	Head    MessageHeaders `json:"Head,omitempty"`
 	Content interface{}
+	// Counts of reactions to the message: reaction -> count. Not stored directly.
+	Reactions map[string]int `json:"Reactions,omitempty"`
+	// SeqId of the thread root if the message is a reply, 0 otherwise
+	ReplyTo int `json:"ReplyTo,omitempty"`
+	// Number of replies to this message
+	ReplyCount int `json:"ReplyCount,omitempty"`
+	// Timestamp of the latest reply to this message
+	LastReplyAt *time.Time `json:"LastReplyAt,omitempty"`
 }
 
 // Range is a range of message SeqIDs. Low end is inclusive (closed), high end is exclusive (open): [Low, Hi).
@@ -922,6 +1032,8 @@ type QueryOpt struct {
 	// ID-based query parameters: Messages
 	Since  int
 	Before int
+	// Return only replies to the message with this SeqId
+	Thread int
 	// Common parameter
 	Limit int
 }
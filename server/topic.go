@@ -11,6 +11,7 @@ package main
 import (
 	"errors"
 	"log"
+	"net"
 	"sort"
 	"sync/atomic"
 	"time"
@@ -54,6 +55,9 @@ type Topic struct {
 	// Last published userAgent ('me' topic only)
 	userAgent string
 
+	// Quiet hours of push notifications ('me' topic only)
+	quietHours *types.QuietHours
+
 	// User ID of the topic owner/creator. Could be zero.
 	owner types.Uid
 
@@ -110,6 +114,8 @@ type perUserData struct {
 	// Last t.lastId reported by user through {pres} as received or read
 	recvID int
 	readID int
+	// Count of unread messages which mention the user
+	mentionCount int
 	// ID of the latest Delete operation
 	delID int
 
@@ -118,6 +124,10 @@ type perUserData struct {
 	modeWant  types.AccessMode
 	modeGiven types.AccessMode
 
+	// Preferences of push notifications
+	muteUntil    time.Time
+	mentionsOnly bool
+
 	// P2P only:
 	public    interface{}
 	topicName string
@@ -306,37 +316,64 @@ func (t *Topic) run(hub *Hub) {
 					}
 				}
 
-				if err := store.Messages.Save(&types.Message{
-					ObjHeader: types.ObjHeader{CreatedAt: msg.Data.Timestamp},
-					SeqId:     t.lastID + 1,
-					Topic:     t.name,
-					From:      from.String(),
-					Head:      msg.Data.Head,
-					Content:   msg.Data.Content}); err != nil {
+				if _, ok := msg.Data.Head["replace"]; ok && msg.sessFrom != nil {
+					// Request to edit an existing message. Edits are broadcast but not pushed.
+					if err := t.editMessage(msg, from); err != nil {
+						log.Printf("topic[%s]: failed to edit message: %v", t.name, err)
+						continue
+					}
+				} else {
+					if msg.Data.ReplyTo != 0 && msg.sessFrom != nil {
+						// Reply to another message: attach it to the root of the thread.
+						if err := t.threadRoot(msg, from); err != nil {
+							log.Printf("topic[%s]: failed to reply to message: %v", t.name, err)
+							continue
+						}
+					}
 
-					log.Printf("topic[%s]: failed to save message: %v", t.name, err)
-					msg.sessFrom.queueOut(ErrUnknown(msg.id, t.original(msg.sessFrom.uid), msg.timestamp))
+					// Mentions of users who are not subscribed are rejected. Internally generated
+					// messages are not checked: such mentions are just ignored.
+					mentioned, err := t.mentionedSubscribers(msg.Data, from)
+					if err != nil && msg.sessFrom != nil {
+						msg.sessFrom.queueOut(ErrMalformed(msg.id, t.original(msg.sessFrom.uid), msg.timestamp))
+						continue
+					}
 
-					continue
-				}
+					if err := store.Messages.Save(&types.Message{
+						ObjHeader: types.ObjHeader{CreatedAt: msg.Data.Timestamp},
+						SeqId:     t.lastID + 1,
+						Topic:     t.name,
+						From:      from.String(),
+						Head:      msg.Data.Head,
+						Content:   msg.Data.Content,
+						ReplyTo:   msg.Data.ReplyTo}); err != nil {
 
-				t.lastID++
-				msg.Data.SeqId = t.lastID
+						log.Printf("topic[%s]: failed to save message: %v", t.name, err)
+						msg.sessFrom.queueOut(ErrUnknown(msg.id, t.original(msg.sessFrom.uid), msg.timestamp))
 
-				if msg.id != "" {
-					reply := NoErrAccepted(msg.id, t.original(msg.sessFrom.uid), msg.timestamp)
-					reply.Ctrl.Params = map[string]int{"seq": t.lastID}
-					msg.sessFrom.queueOut(reply)
-				}
+						continue
+					}
+
+					t.lastID++
+					msg.Data.SeqId = t.lastID
+
+					if msg.id != "" {
+						reply := NoErrAccepted(msg.id, t.original(msg.sessFrom.uid), msg.timestamp)
+						reply.Ctrl.Params = map[string]int{"seq": t.lastID}
+						msg.sessFrom.queueOut(reply)
+					}
+
+					t.countMentions(mentioned)
 
-				pushRcpt = t.makePushReceipt(msg.Data)
+					pushRcpt = t.makePushReceipt(msg.Data, mentioned)
 
-				// Message sent: notify offline 'R' subscrbers on 'me'
-				t.presSubsOffline("msg", &presParams{seqID: t.lastID},
-					&presFilters{filterIn: types.ModeRead}, "", true)
+					// Message sent: notify offline 'R' subscrbers on 'me'
+					t.presSubsOffline("msg", &presParams{seqID: t.lastID},
+						&presFilters{filterIn: types.ModeRead}, "", true)
 
-				// Tell the plugins that a message was accepted for delivery
-				pluginMessage(msg.Data, plgActCreate)
+					// Tell the plugins that a message was accepted for delivery
+					pluginMessage(msg.Data, plgActCreate)
+				}
 
 			} else if msg.Pres != nil {
 
@@ -396,11 +433,17 @@ func (t *Topic) run(hub *Hub) {
 						recv = pud.recvID
 					}
 
-					if err := store.Subs.Update(t.name, uid,
-						map[string]interface{}{
-							"RecvSeqId": pud.recvID,
-							"ReadSeqId": pud.readID},
-						false); err != nil {
+					update := map[string]interface{}{
+						"RecvSeqId": pud.recvID,
+						"ReadSeqId": pud.readID}
+					// The counter of mentions is not tracked per message: it's cleared when
+					// all messages are read.
+					if pud.mentionCount > 0 && pud.readID >= t.lastID {
+						pud.mentionCount = 0
+						update["MentionCount"] = 0
+					}
+
+					if err := store.Subs.Update(t.name, uid, update, false); err != nil {
 
 						log.Printf("topic[%s]: failed to update SeqRead/Recv counter: %v", t.name, err)
 						continue
@@ -411,6 +454,27 @@ func (t *Topic) run(hub *Hub) {
 
 					t.perUser[uid] = pud
 				}
+
+				if msg.Info.What == "react" || msg.Info.What == "unreact" {
+					// Reacting requires both 'R' and 'W' permissions.
+					if !(pud.modeGiven & pud.modeWant).IsReader() || !(pud.modeGiven & pud.modeWant).IsWriter() {
+						continue
+					}
+
+					var err error
+					if msg.Info.What == "react" {
+						err = store.Messages.AddReaction(t.name, msg.Info.SeqId, uid, msg.Info.Reaction)
+					} else {
+						err = store.Messages.DeleteReaction(t.name, msg.Info.SeqId, uid, msg.Info.Reaction)
+					}
+					if err != nil {
+						// Duplicate or missing reactions and reactions to deleted messages are silently dropped.
+						if err != types.ErrDuplicate && err != types.ErrNotFound {
+							log.Printf("topic[%s]: failed to update reaction: %v", t.name, err)
+						}
+						continue
+					}
+				}
 			}
 
 			// Broadcast the message. Only {data}, {pres}, {info} are broadcastable.
@@ -483,7 +547,8 @@ func (t *Topic) run(hub *Hub) {
 				}
 
 				if pushRcpt != nil {
-					push.Push(pushRcpt.rcpt)
+					// Quiet hours are checked outside of the topic's goroutine.
+					queuePush(pushRcpt.rcpt)
 				}
 
 			} else {
@@ -518,6 +583,16 @@ func (t *Topic) run(hub *Hub) {
 						log.Printf("topic[%s] meta.Get.Del failed: %v", t.name, err)
 					}
 				}
+				if meta.what&constMsgMetaSearch != 0 {
+					if err := t.replyGetSearch(meta.sess, meta.pkt.Get.Id, meta.pkt.Get.Search); err != nil {
+						log.Printf("topic[%s] meta.Get.Search failed: %v", t.name, err)
+					}
+				}
+				if meta.what&constMsgMetaSess != 0 {
+					if err := t.replyGetSess(meta.sess, meta.pkt.Get.Id); err != nil {
+						log.Printf("topic[%s] meta.Get.Sess failed: %v", t.name, err)
+					}
+				}
 
 			case meta.pkt.Set != nil:
 				// Set request
@@ -539,6 +614,11 @@ func (t *Topic) run(hub *Hub) {
 						log.Printf("topic[%s] meta.Set.Tags failed: %v", t.name, err)
 					}
 				}
+				if meta.what&constMsgMetaNotify != 0 {
+					if err := t.replySetNotify(meta.sess, meta.pkt.Set); err != nil {
+						log.Printf("topic[%s] meta.Set.Notify failed: %v", t.name, err)
+					}
+				}
 
 			case meta.pkt.Del != nil:
 				// Del request
@@ -550,6 +630,8 @@ func (t *Topic) run(hub *Hub) {
 					err = t.replyDelSub(hub, meta.sess, meta.pkt.Del)
 				case constMsgDelTopic:
 					err = t.replyDelTopic(hub, meta.sess, meta.pkt.Del)
+				case constMsgDelSess:
+					err = t.replyDelSess(meta.sess, meta.pkt.Del)
 				}
 
 				if err != nil {
@@ -1246,6 +1328,12 @@ func (t *Topic) replyGetDesc(sess *Session, id, tempName string, opts *MsgGetOpt
 			desc.Private = pud.private
 		}
 
+		if t.cat == types.TopicCatMe {
+			desc.Notify = quietHoursPrefs(t.quietHours)
+		} else {
+			desc.Notify = subscriptionPrefs(&pud, now)
+		}
+
 		// Don't report message IDs to users without Read access.
 		if (pud.modeGiven & pud.modeWant).IsReader() {
 			desc.SeqId = t.lastID
@@ -1405,6 +1493,10 @@ func (t *Topic) replySetDesc(sess *Session, set *MsgClientSet) error {
 		}
 		if public, ok := core["Public"]; ok {
 			t.public = public
+			if t.cat == types.TopicCatMe {
+				// The name of the sender in push notifications has changed.
+				forgetPushPrefs(sess.uid)
+			}
 		}
 	} else if t.cat == types.TopicCatFnd {
 		// Assign per-session fnd.Public.
@@ -1609,6 +1701,9 @@ func (t *Topic) replyGetSub(sess *Session, id string, req *MsgGetOpts) error {
 				if isReader && !banned {
 					mts.ReadSeqId = sub.ReadSeqId
 					mts.RecvSeqId = sub.RecvSeqId
+					if uid == sess.uid {
+						mts.Mentions = sub.MentionCount
+					}
 				}
 
 				if t.cat != types.TopicCatFnd {
@@ -1714,12 +1809,16 @@ func (t *Topic) replyGetData(sess *Session, id string, req *MsgGetOpts) error {
 			for i := count - 1; i >= 0; i-- {
 				mm := messages[i]
 				sess.queueOut(&ServerComMessage{Data: &MsgServerData{
-					Topic:     t.original(sess.uid),
-					Head:      mm.Head,
-					SeqId:     mm.SeqId,
-					From:      types.ParseUid(mm.From).UserId(),
-					Timestamp: mm.CreatedAt,
-					Content:   mm.Content}})
+					Topic:       t.original(sess.uid),
+					Head:        mm.Head,
+					SeqId:       mm.SeqId,
+					From:        types.ParseUid(mm.From).UserId(),
+					Timestamp:   mm.CreatedAt,
+					Content:     mm.Content,
+					Reactions:   mm.Reactions,
+					ReplyTo:     mm.ReplyTo,
+					ReplyCount:  mm.ReplyCount,
+					LastReplyAt: mm.LastReplyAt}})
 			}
 		}
 	}
@@ -1727,7 +1826,7 @@ func (t *Topic) replyGetData(sess *Session, id string, req *MsgGetOpts) error {
 	// Request for all available data returned no results while the client expects results
 	// because t.lastID > 0. Generate an empty data message to indicate that all messages
 	// have been deleted.
-	if count == 0 && t.lastID > 0 && (req == nil || (req.BeforeId == 0 && req.SinceId == 0)) {
+	if count == 0 && t.lastID > 0 && (req == nil || (req.BeforeId == 0 && req.SinceId == 0 && req.Thread == 0)) {
 		sess.queueOut(&ServerComMessage{Data: &MsgServerData{
 			Topic:     t.original(sess.uid),
 			SeqId:     t.lastID,
@@ -1827,6 +1926,80 @@ func (t *Topic) replySetTags(sess *Session, set *MsgClientSet) error {
 	return err
 }
 
+// replySetNotify updates preferences of push notifications: quiet hours through 'me',
+// mute and mentions-only mode through a subscription to p2p or group topic.
+func (t *Topic) replySetNotify(sess *Session, set *MsgClientSet) error {
+	now := types.TimeNow()
+	prefs := set.Notify
+
+	if t.cat == types.TopicCatFnd {
+		sess.queueOut(ErrOperationNotAllowed(set.Id, t.original(sess.uid), now))
+		return errors.New("notification preferences are not supported by fnd")
+	}
+
+	if t.cat == types.TopicCatMe {
+		if prefs.Quiet == nil || prefs.MuteUntil != nil || prefs.Mentions != nil {
+			sess.queueOut(ErrMalformed(set.Id, set.Topic, now))
+			return errors.New("only quiet hours can be assigned through 'me'")
+		}
+
+		var quiet *types.QuietHours
+		if prefs.Quiet.From != "" || prefs.Quiet.To != "" {
+			var err error
+			quiet, err = types.ParseQuietHours(prefs.Quiet.From + "-" + prefs.Quiet.To + " " + prefs.Quiet.TimeZone)
+			if err != nil {
+				sess.queueOut(ErrMalformed(set.Id, set.Topic, now))
+				return err
+			}
+		}
+
+		var value string
+		if quiet != nil {
+			value = quiet.String()
+		}
+		if err := store.Users.Update(sess.uid, map[string]interface{}{"QuietHours": value}); err != nil {
+			sess.queueOut(ErrUnknown(set.Id, set.Topic, now))
+			return err
+		}
+		t.quietHours = quiet
+		forgetPushPrefs(sess.uid)
+
+		sess.queueOut(NoErr(set.Id, set.Topic, now))
+		return nil
+	}
+
+	pud, ok := t.perUser[sess.uid]
+	if !ok || prefs.Quiet != nil || (prefs.MuteUntil == nil && prefs.Mentions == nil) {
+		sess.queueOut(ErrMalformed(set.Id, set.Topic, now))
+		return errors.New("invalid notification preferences")
+	}
+
+	update := map[string]interface{}{}
+	if prefs.MuteUntil != nil {
+		if prefs.MuteUntil.After(now) {
+			pud.muteUntil = prefs.MuteUntil.UTC().Round(time.Millisecond)
+			update["MuteUntil"] = &pud.muteUntil
+		} else {
+			// Time in the past unmutes the topic.
+			pud.muteUntil = time.Time{}
+			update["MuteUntil"] = (*time.Time)(nil)
+		}
+	}
+	if prefs.Mentions != nil {
+		pud.mentionsOnly = *prefs.Mentions
+		update["MentionsOnly"] = pud.mentionsOnly
+	}
+
+	if err := store.Subs.Update(t.name, sess.uid, update, true); err != nil {
+		sess.queueOut(ErrUnknown(set.Id, set.Topic, now))
+		return err
+	}
+	t.perUser[sess.uid] = pud
+
+	sess.queueOut(NoErr(set.Id, set.Topic, now))
+	return nil
+}
+
 // replyGetDel is a response to a get[what=del] request: load a list of deleted message ids, send them to
 // a session as {meta}
 // response goes to a single session rather than all sessions in a topic
@@ -1865,6 +2038,135 @@ func (t *Topic) replyGetDel(sess *Session, id string, req *MsgGetOpts) error {
 	return nil
 }
 
+// replyGetSearch is a response to a get[what=search] request on 'fnd' topic: find messages matching
+// the full-text query in all topics where the user has the R permission, send them to the session as {meta}.
+func (t *Topic) replyGetSearch(sess *Session, id string, req *MsgGetOpts) error {
+	now := types.TimeNow()
+
+	if t.cat != types.TopicCatFnd {
+		sess.queueOut(ErrOperationNotAllowed(id, t.original(sess.uid), now))
+		return errors.New("search is supported in 'fnd' topic only")
+	}
+
+	if req == nil || req.Query == "" || req.IfModifiedSince != nil || req.User != "" || req.Thread != 0 {
+		sess.queueOut(ErrMalformed(id, t.original(sess.uid), now))
+		return errors.New("invalid MsgGetOpts query")
+	}
+
+	// SeqIds of messages in different topics are unrelated, thus paging by IDs is possible only
+	// within a single topic.
+	if req.Topic == "" && (req.SinceId != 0 || req.BeforeId != 0) {
+		sess.queueOut(ErrMalformed(id, t.original(sess.uid), now))
+		return errors.New("search by message IDs requires a topic")
+	}
+
+	// Search could be limited to a single topic. P2P topic could be given as user ID 'usrAbCd'.
+	var opts *types.QueryOpt
+	if req.Topic != "" {
+		topic := req.Topic
+		if uid2 := types.ParseUserId(topic); !uid2.IsZero() {
+			topic = uid2.P2PName(sess.uid)
+		}
+		opts = &types.QueryOpt{Topic: topic}
+	}
+
+	subs, err := store.Users.GetTopics(sess.uid, opts)
+	if err != nil {
+		sess.queueOut(decodeStoreError(err, id, t.original(sess.uid), now, nil))
+		return err
+	}
+
+	// Topics with the R permission, mapped to topic names as seen by the user.
+	names := make(map[string]string, len(subs))
+	var topics []string
+	for i := range subs {
+		sub := &subs[i]
+		if !(sub.ModeGiven & sub.ModeWant).IsReader() {
+			continue
+		}
+		name := sub.GetWith()
+		if name == "" {
+			name = sub.Topic
+		}
+		names[sub.Topic] = name
+		topics = append(topics, sub.Topic)
+	}
+
+	var found []types.Message
+	if len(topics) > 0 {
+		found, err = store.Messages.Search(topics, sess.uid, req.Query, &types.QueryOpt{
+			Since:  req.SinceId,
+			Before: req.BeforeId,
+			Limit:  req.Limit})
+		if err != nil {
+			sess.queueOut(decodeStoreError(err, id, t.original(sess.uid), now, nil))
+			return err
+		}
+	}
+
+	if len(found) > 0 {
+		meta := &MsgServerMeta{Id: id, Topic: t.original(sess.uid), Timestamp: &now}
+		for i := range found {
+			mm := &found[i]
+			meta.Search = append(meta.Search, MsgServerData{
+				Topic:     names[mm.Topic],
+				Head:      mm.Head,
+				SeqId:     mm.SeqId,
+				From:      types.ParseUid(mm.From).UserId(),
+				Timestamp: mm.CreatedAt,
+				Content:   mm.Content,
+				ReplyTo:   mm.ReplyTo})
+		}
+		sess.queueOut(&ServerComMessage{Meta: meta})
+		return nil
+	}
+
+	reply := NoErr(id, t.original(sess.uid), now)
+	reply.Ctrl.Params = map[string]string{"what": "search"}
+	sess.queueOut(reply)
+
+	return nil
+}
+
+// replyGetSess is a response to a get[what=sess] request: list live sessions of the user. Sessions at
+// other cluster nodes are listed if they are attached to the 'me' topic.
+func (t *Topic) replyGetSess(sess *Session, id string) error {
+	now := types.TimeNow()
+
+	if t.cat != types.TopicCatMe {
+		sess.queueOut(ErrOperationNotAllowed(id, t.original(sess.uid), now))
+		return errors.New("sessions are available in 'me' topic only")
+	}
+
+	var list []MsgSessionInfo
+	for _, s := range globals.sessionStore.FindByUser(sess.uid) {
+		info := MsgSessionInfo{
+			Id:         s.publicID(),
+			Current:    s.sid == sess.sid,
+			DeviceID:   s.deviceID,
+			Lang:       s.lang,
+			UserAgent:  s.userAgent,
+			RemoteAddr: s.remoteAddr,
+		}
+		if host, _, err := net.SplitHostPort(s.remoteAddr); err == nil {
+			info.RemoteAddr = host
+		}
+		if !s.lastAction.IsZero() {
+			lastAction := s.lastAction
+			info.LastSeen = &lastAction
+		}
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Id < list[j].Id
+	})
+
+	sess.queueOut(&ServerComMessage{
+		Meta: &MsgServerMeta{Id: id, Topic: t.original(sess.uid), Timestamp: &now, Sess: list}})
+
+	return nil
+}
+
 // replyDelMsg deletes (soft or hard) messages in response to del.msg packet.
 func (t *Topic) replyDelMsg(sess *Session, del *MsgClientDel) error {
 	now := types.TimeNow()
@@ -1971,6 +2273,109 @@ func (t *Topic) replyDelMsg(sess *Session, del *MsgClientDel) error {
 	return nil
 }
 
+// editMessage replaces content of the message referenced by {pub head.replace=SeqId} and prepares
+// the {data} packet for broadcasting. Only the original author or a user with 'D' permission may edit.
+func (t *Topic) editMessage(msg *ServerComMessage, from types.Uid) error {
+	sess := msg.sessFrom
+	now := msg.timestamp
+
+	var seq int
+	switch val := msg.Data.Head["replace"].(type) {
+	case float64:
+		seq = int(val)
+	case int:
+		seq = val
+	}
+	if seq <= 0 || seq > t.lastID {
+		sess.queueOut(ErrMalformed(msg.id, t.original(sess.uid), now))
+		return errors.New("edit: invalid message ID")
+	}
+
+	// Fetch the message to check its author. Messages deleted for the current user cannot be edited.
+	msgs, err := store.Messages.GetAll(t.name, from, &types.QueryOpt{Since: seq, Before: seq + 1, Limit: 1})
+	if err != nil {
+		sess.queueOut(ErrUnknown(msg.id, t.original(sess.uid), now))
+		return err
+	}
+	if len(msgs) == 0 {
+		sess.queueOut(ErrNotFound(msg.id, t.original(sess.uid), now))
+		return errors.New("edit: message not found")
+	}
+	orig := &msgs[0]
+
+	pud := t.perUser[from]
+	if orig.From != from.String() && !(pud.modeGiven & pud.modeWant).IsDeleter() {
+		sess.queueOut(ErrPermissionDenied(msg.id, t.original(sess.uid), now))
+		return errors.New("edit: permission denied")
+	}
+
+	// The 'replace' header is not stored, the stored message is marked as 'edited' instead.
+	head := make(map[string]interface{}, len(msg.Data.Head))
+	for key, val := range msg.Data.Head {
+		if key != "replace" {
+			head[key] = val
+		}
+	}
+	head["edited"] = true
+
+	if err := store.Messages.Edit(&types.Message{
+		SeqId:   seq,
+		Topic:   t.name,
+		Head:    head,
+		Content: msg.Data.Content}); err != nil {
+
+		sess.queueOut(decodeStoreError(err, msg.id, t.original(sess.uid), now, nil))
+		return err
+	}
+
+	if msg.id != "" {
+		reply := NoErrAccepted(msg.id, t.original(sess.uid), now)
+		reply.Ctrl.Params = map[string]int{"seq": seq}
+		sess.queueOut(reply)
+	}
+
+	// Subscribers receive the updated message under its original ID and author.
+	// The 'replace' header tells clients to replace the copy they already have.
+	head["replace"] = seq
+	msg.Data.Head = head
+	msg.Data.SeqId = seq
+	msg.Data.From = types.ParseUid(orig.From).UserId()
+	msg.Data.Timestamp = orig.CreatedAt
+	msg.Data.ReplyTo = orig.ReplyTo
+
+	return nil
+}
+
+// threadRoot validates msg.Data.ReplyTo and replaces it with the ID of the thread root.
+// Threads are one level deep: a reply to a reply is attached to the original message.
+func (t *Topic) threadRoot(msg *ServerComMessage, from types.Uid) error {
+	sess := msg.sessFrom
+	now := msg.timestamp
+
+	seq := msg.Data.ReplyTo
+	if seq <= 0 || seq > t.lastID {
+		sess.queueOut(ErrMalformed(msg.id, t.original(sess.uid), now))
+		return errors.New("reply: invalid message ID")
+	}
+
+	// Messages deleted for the current user cannot be replied to.
+	msgs, err := store.Messages.GetAll(t.name, from, &types.QueryOpt{Since: seq, Before: seq + 1, Limit: 1})
+	if err != nil {
+		sess.queueOut(ErrUnknown(msg.id, t.original(sess.uid), now))
+		return err
+	}
+	if len(msgs) == 0 {
+		sess.queueOut(ErrNotFound(msg.id, t.original(sess.uid), now))
+		return errors.New("reply: message not found")
+	}
+
+	if msgs[0].ReplyTo > 0 {
+		msg.Data.ReplyTo = msgs[0].ReplyTo
+	}
+
+	return nil
+}
+
 // Shut down the topic in response to {del what="topic"} request
 // See detailed description at hub.topicUnreg()
 // 1. Checks if the requester is the owner. If so:
@@ -2058,6 +2463,57 @@ func (t *Topic) replyDelSub(h *Hub, sess *Session, del *MsgClientDel) error {
 	return nil
 }
 
+// replyDelSess terminates the requested session or all other sessions of the user and revokes all
+// user's tokens. The requester receives a new token.
+func (t *Topic) replyDelSess(sess *Session, del *MsgClientDel) error {
+	now := types.TimeNow()
+
+	if t.cat != types.TopicCatMe {
+		sess.queueOut(ErrOperationNotAllowed(del.Id, t.original(sess.uid), now))
+		return errors.New("del.sess: sessions can be terminated in 'me' topic only")
+	}
+
+	var targets []*Session
+	for _, s := range globals.sessionStore.FindByUser(sess.uid) {
+		if s.sid == sess.sid {
+			if del.Sess == s.publicID() {
+				sess.queueOut(ErrOperationNotAllowed(del.Id, t.original(sess.uid), now))
+				return errors.New("del.sess: cannot terminate current session")
+			}
+			continue
+		}
+		if del.Sess == "" || del.Sess == s.publicID() {
+			targets = append(targets, s)
+		}
+	}
+
+	if del.Sess != "" && len(targets) == 0 {
+		sess.queueOut(ErrNotFound(del.Id, t.original(sess.uid), now))
+		return errors.New("del.sess: session not found")
+	}
+
+	// Stolen devices may hold tokens even if they are not connected now.
+	tokenHdl := store.GetAuthHandler("token")
+	if err := tokenHdl.UpdateRecord(&auth.Rec{Uid: sess.uid}, nil); err != nil {
+		sess.queueOut(decodeStoreError(err, del.Id, t.original(sess.uid), now, nil))
+		return err
+	}
+
+	for _, s := range targets {
+		s.terminate(NoErrEvicted("", "", now))
+	}
+
+	reply := NoErr(del.Id, t.original(sess.uid), now)
+	// Tokens issued after revocation require the second step of authentication again.
+	rec := &auth.Rec{Uid: sess.uid, AuthLevel: sess.authLvl, Features: auth.Validated}
+	if token, expires, err := tokenHdl.GenSecret(rec); err == nil {
+		reply.Ctrl.Params = map[string]interface{}{"token": token, "expires": expires}
+	}
+	sess.queueOut(reply)
+
+	return nil
+}
+
 func (t *Topic) replyLeaveUnsub(h *Hub, sess *Session, id string) error {
 	now := types.TimeNow()
 
@@ -2160,7 +2616,8 @@ func (t *Topic) evictUser(uid types.Uid, unsub bool, skip string) {
 }
 
 // Prepares a payload to be delivered to a mobile device as a push notification.
-func (t *Topic) makePushReceipt(data *MsgServerData) *pushReceipt {
+// Notifications to the mentioned users are sent with high priority.
+func (t *Topic) makePushReceipt(data *MsgServerData, mentioned map[types.Uid]bool) *pushReceipt {
 	idx := make(map[types.Uid]int, len(t.perUser))
 	receipt := push.Receipt{
 		To: make([]push.Recipient, len(t.perUser)),
@@ -2171,15 +2628,22 @@ func (t *Topic) makePushReceipt(data *MsgServerData) *pushReceipt {
 			SeqId:     data.SeqId,
 			Content:   data.Content}}
 
+	if t.cat == types.TopicCatGrp {
+		receipt.TopicName = fullName(t.public)
+	}
+
+	now := types.TimeNow()
 	i := 0
-	for uid := range t.perUser {
-		if (t.perUser[uid].modeWant & t.perUser[uid].modeGiven).IsPresencer() {
-			// Only send to those users who have notifications enabled
+	for uid, pud := range t.perUser {
+		// Only send to those users who have notifications enabled and did not mute the topic.
+		if (pud.modeWant & pud.modeGiven).IsPresencer() && wantsPush(&pud, mentioned[uid], now) {
 			receipt.To[i].User = uid
+			receipt.To[i].HighPriority = mentioned[uid]
 			idx[uid] = i
 			i++
 		}
 	}
+	receipt.To = receipt.To[:i]
 
 	return &pushReceipt{rcpt: &receipt, uidMap: idx}
 }
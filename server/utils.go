@@ -4,6 +4,7 @@ package main
 
 import (
 	"errors"
+	"net"
 	"regexp"
 	"sort"
 	"strconv"
@@ -13,6 +14,7 @@ import (
 	"unicode/utf8"
 
 	"github.com/nanfengpo/chat/server/auth"
+	"github.com/nanfengpo/chat/server/store"
 	"github.com/nanfengpo/chat/server/store/types"
 )
 
@@ -169,7 +171,7 @@ func restrictedTagsEqual(oldTags, newTags []string, namespaces map[string]bool)
 	return true
 }
 
-// Process credentials for correctness: remove duplicates and unknown methods.
+// Process credentials for correctness: remove duplicates and unknown methods, convert values to canonical form.
 // If valueRequired is true, keep only those where Value is non-empty.
 func normalizeCredentials(creds []MsgAccCred, valueRequired bool) []MsgAccCred {
 	if len(creds) == 0 {
@@ -180,6 +182,9 @@ func normalizeCredentials(creds []MsgAccCred, valueRequired bool) []MsgAccCred {
 	for i := range creds {
 		c := &creds[i]
 		if _, ok := globals.validators[c.Method]; ok && (!valueRequired || c.Value != "") {
+			if c.Value != "" {
+				c.Value = store.GetValidator(c.Method).Normalize(c.Value)
+			}
 			index[c.Method] = c
 		}
 	}
@@ -230,6 +235,7 @@ func msgOpts2storeOpts(req *MsgGetOpts) *types.QueryOpt {
 			Limit:           req.Limit,
 			Since:           req.SinceId,
 			Before:          req.BeforeId,
+			Thread:          req.Thread,
 		}
 	}
 	return opts
@@ -276,6 +282,8 @@ func decodeStoreError(err error, id, topic string, timestamp time.Time, params m
 			errmsg = InfoValidateCredentials(id, timestamp)
 		case types.ErrNotFound:
 			errmsg = ErrNotFound(id, topic, timestamp)
+		case types.ErrLocked:
+			errmsg = ErrTooManyRequests(id, topic, timestamp, 0)
 		default:
 			errmsg = ErrUnknown(id, topic, timestamp)
 		}
@@ -285,6 +293,18 @@ func decodeStoreError(err error, id, topic string, timestamp time.Time, params m
 	return errmsg
 }
 
+// authenticate calls the auth handler passing the remote address of the client to the handlers
+// which use it.
+func authenticate(handler auth.AuthHandler, secret []byte, remoteAddr string) (*auth.Rec, []byte, error) {
+	if ah, ok := handler.(auth.AddrAuthenticator); ok {
+		if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+			remoteAddr = host
+		}
+		return ah.AuthenticateAddr(secret, remoteAddr)
+	}
+	return handler.Authenticate(secret)
+}
+
 // Helper function to select access mode for the given auth level
 func selectAccessMode(authLvl auth.Level, anonMode, authMode, rootMode types.AccessMode) types.AccessMode {
 	switch authLvl {
@@ -499,3 +519,22 @@ func truncateStringIfTooLong(s string) string {
 		return s[:1024] + "..."
 	}
 }
+
+// Guess the platform of the client device from the user agent and the device ID for routing of push
+// notifications: "ios", "android" or "web". Returns an empty string if the platform is not recognized.
+func devicePlatform(ua, deviceID string) string {
+	ua = strings.ToLower(ua)
+	switch {
+	case strings.HasPrefix(deviceID, "{"):
+		// Web Push subscription.
+		return "web"
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ios"):
+		return "ios"
+	case strings.Contains(ua, "android"):
+		return "android"
+	case strings.Contains(ua, "mozilla"), strings.Contains(ua, "chrome"), strings.Contains(ua, "safari"),
+		strings.Contains(ua, "firefox"), strings.Contains(ua, "web"):
+		return "web"
+	}
+	return ""
+}
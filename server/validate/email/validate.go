@@ -23,6 +23,8 @@ import (
 type validator struct {
 	TemplateFile   string `json:"msg_body_templ"`
 	Subject        string `json:"msg_subject"`
+	ResetTemplFile string `json:"reset_body_templ"`
+	ResetSubject   string `json:"reset_subject"`
 	SendFrom       string `json:"sender"`
 	SenderPassword string `json:"sender_password"`
 	DebugResponse  string `json:"debug_response"`
@@ -30,6 +32,7 @@ type validator struct {
 	SMTPAddr       string `json:"smtp_server"`
 	SMTPPort       string `json:"smtp_port"`
 	htmlTempl      *ht.Template
+	resetTempl     *ht.Template
 	auth           smtp.Auth
 }
 
@@ -37,6 +40,11 @@ const (
 	maxRetries  = 4
 	defaultPort = "25"
 
+	defaultResetSubject = "Reset password"
+	defaultResetTempl   = `<html><body><p>Someone requested to reset the {{.Scheme}} password of your account.</p>
+<p>Enter the following code to set a new password:</p><blockquote>{{.Code}}</blockquote>
+<p>If you did not make the request just ignore this message.</p></body></html>`
+
 	// Technically email could be up to 255 bytes long but practically 128 is enough.
 	maxEmailLength = 128
 
@@ -68,6 +76,24 @@ func (v *validator) Init(jsonconf string) error {
 		return err
 	}
 
+	if v.ResetTemplFile != "" {
+		if !filepath.IsAbs(v.ResetTemplFile) {
+			basepath, err := os.Executable()
+			if err == nil {
+				v.ResetTemplFile = filepath.Join(filepath.Dir(basepath), v.ResetTemplFile)
+			}
+		}
+		v.resetTempl, err = ht.ParseFiles(v.ResetTemplFile)
+	} else {
+		v.resetTempl, err = ht.New("reset").Parse(defaultResetTempl)
+	}
+	if err != nil {
+		return err
+	}
+	if v.ResetSubject == "" {
+		v.ResetSubject = defaultResetSubject
+	}
+
 	// Initialize random number generator.
 	rand.Seed(time.Now().UnixNano())
 
@@ -81,6 +107,11 @@ func (v *validator) Init(jsonconf string) error {
 	return nil
 }
 
+// Normalize removes leading and trailing whitespace.
+func (v *validator) Normalize(cred string) string {
+	return strings.TrimSpace(cred)
+}
+
 // PreCheck validates the credential and parameters without sending an email.
 func (v *validator) PreCheck(cred string, params interface{}) error {
 	if len(cred) > maxEmailLength {
@@ -155,6 +186,19 @@ func (v *validator) Check(user t.Uid, resp string) error {
 	return t.ErrFailed
 }
 
+// ResetSecret sends an email with the code to reset the secret of the authentication scheme.
+func (v *validator) ResetSecret(email, scheme, lang, code string) error {
+	body := new(bytes.Buffer)
+	if err := v.resetTempl.Execute(body, map[string]interface{}{"Code": code, "Scheme": scheme}); err != nil {
+		return err
+	}
+
+	// Send email without blocking. Email sending may take long time.
+	go v.send(email, v.ResetSubject, body.String())
+
+	return nil
+}
+
 // Delete deletes user's records.
 func (v *validator) Delete(user t.Uid) error {
 	return nil
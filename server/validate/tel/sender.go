@@ -0,0 +1,159 @@
+package tel
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// Sender delivers text messages to phones.
+type Sender interface {
+	// Init initializes the sender.
+	Init(jsonconf string) error
+	// Send sends the text to the phone number in E.164 format.
+	Send(to, text string) error
+}
+
+var senders = make(map[string]Sender)
+
+// RegisterSender makes an SMS sender available by the provided name.
+// If RegisterSender is called twice with the same name or if the sender is nil, it panics.
+func RegisterSender(name string, snd Sender) {
+	if snd == nil {
+		panic("RegisterSender: sender is nil")
+	}
+	if _, dup := senders[name]; dup {
+		panic("RegisterSender: called twice for sender " + name)
+	}
+	senders[name] = snd
+}
+
+// httpSender posts messages to an HTTP SMS gateway.
+type httpSender struct {
+	// Gateway URL.
+	URL string `json:"url"`
+	// Optional value of the Authorization header, like "Bearer ...".
+	Authorization string `json:"authorization"`
+	// Optional sender ID or phone number.
+	From string `json:"from"`
+	// Names of request fields. Defaults: "to", "text", "from".
+	ToField   string `json:"to_field"`
+	TextField string `json:"text_field"`
+	FromField string `json:"from_field"`
+	// Send a JSON object instead of a form.
+	JSON bool `json:"json"`
+	// Request timeout in seconds.
+	Timeout int `json:"timeout"`
+
+	client *http.Client
+}
+
+func (s *httpSender) Init(jsonconf string) error {
+	if err := json.Unmarshal([]byte(jsonconf), s); err != nil {
+		return err
+	}
+	if u, err := url.Parse(s.URL); err != nil || u.Host == "" {
+		return errors.New("tel: invalid gateway url")
+	}
+	if s.ToField == "" {
+		s.ToField = "to"
+	}
+	if s.TextField == "" {
+		s.TextField = "text"
+	}
+	if s.FromField == "" {
+		s.FromField = "from"
+	}
+	if s.Timeout == 0 {
+		s.Timeout = 10
+	}
+	s.client = &http.Client{Timeout: time.Duration(s.Timeout) * time.Second}
+	return nil
+}
+
+func (s *httpSender) Send(to, text string) error {
+	fields := map[string]string{s.ToField: to, s.TextField: text}
+	if s.From != "" {
+		fields[s.FromField] = s.From
+	}
+
+	var body []byte
+	var contentType string
+	if s.JSON {
+		body, _ = json.Marshal(fields)
+		contentType = "application/json"
+	} else {
+		form := url.Values{}
+		for k, v := range fields {
+			form.Set(k, v)
+		}
+		body = []byte(form.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.Authorization != "" {
+		req.Header.Set("Authorization", s.Authorization)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New("tel: gateway responded with " + resp.Status)
+	}
+	return nil
+}
+
+// fileSender appends messages to a file instead of sending them. Useful for testing.
+type fileSender struct {
+	// Path to the file. Messages are written to STDOUT if the path is empty or "-".
+	Path string `json:"path"`
+
+	lock sync.Mutex
+	out  io.Writer
+}
+
+func (s *fileSender) Init(jsonconf string) error {
+	if err := json.Unmarshal([]byte(jsonconf), s); err != nil {
+		return err
+	}
+	if s.Path == "" || s.Path == "-" {
+		s.out = os.Stdout
+		return nil
+	}
+	file, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	s.out = file
+	return nil
+}
+
+func (s *fileSender) Send(to, text string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, err := io.WriteString(s.out, time.Now().UTC().Format(time.RFC3339)+" "+to+": "+text+"\n")
+	return err
+}
+
+func init() {
+	RegisterSender("http", &httpSender{})
+	RegisterSender("file", &fileSender{})
+}
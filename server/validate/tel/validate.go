@@ -1,42 +1,299 @@
+// Package tel implements a validator of phone numbers. The user confirms the number by responding with
+// a one-time code sent in an SMS.
 package tel
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
 	"github.com/nanfengpo/chat/server/store"
 	t "github.com/nanfengpo/chat/server/store/types"
 )
 
-// Empty placeholder struct.
-type validator struct{}
+// Validator configuration.
+type validator struct {
+	TemplateFile  string `json:"template"`
+	ResetTemplate string `json:"reset_template"`
+	DebugResponse string `json:"debug_response"`
+	MaxRetries    int    `json:"max_retries"`
+	// Country calling code to use for numbers in national format, like "1" for the USA.
+	DefaultCountryCode string `json:"default_country_code"`
+	// Name of the SMS sender to use.
+	Sender string `json:"sender"`
+	// Configurations of senders.
+	Senders map[string]json.RawMessage `json:"senders"`
 
-// Init is a noop.
-func (validator) Init(jsonconf string) error {
-	return nil
+	textTempl  *template.Template
+	resetTempl *template.Template
+	sender     Sender
 }
 
-// PreCheck validates the credential and parameters without sending an SMS or maing the call.
-func (validator) PreCheck(cred string, params interface{}) error {
-	// TODO: Check phone format. Format phone for E.164
-	// TODO: Check phone uniqueness
+const (
+	maxRetries = 4
+
+	defaultTemplate      = "Confirmation code: {{.Code}}"
+	defaultResetTemplate = "Password reset code: {{.Code}}"
+	defaultSender        = "file"
+
+	// codeLength = log10(maxCodeValue)
+	codeLength   = 6
+	maxCodeValue = 1000000
+)
+
+// E.164: '+', country code, subscriber number, 15 digits max.
+var e164Regexp = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// Characters commonly used to format phone numbers.
+var phoneFormatting = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "", "\t", "")
+
+// Init: initialize validator.
+func (v *validator) Init(jsonconf string) error {
+	var err error
+	if err = json.Unmarshal([]byte(jsonconf), v); err != nil {
+		return err
+	}
+
+	if v.TemplateFile != "" {
+		// If a relative path is provided, try to resolve it relative to the exec file location,
+		// not whatever directory the user is in.
+		if !filepath.IsAbs(v.TemplateFile) {
+			basepath, err := os.Executable()
+			if err == nil {
+				v.TemplateFile = filepath.Join(filepath.Dir(basepath), v.TemplateFile)
+			}
+		}
+		v.textTempl, err = template.ParseFiles(v.TemplateFile)
+	} else {
+		v.textTempl, err = template.New("sms").Parse(defaultTemplate)
+	}
+	if err != nil {
+		return err
+	}
+
+	if v.ResetTemplate != "" {
+		if !filepath.IsAbs(v.ResetTemplate) {
+			basepath, err := os.Executable()
+			if err == nil {
+				v.ResetTemplate = filepath.Join(filepath.Dir(basepath), v.ResetTemplate)
+			}
+		}
+		v.resetTempl, err = template.ParseFiles(v.ResetTemplate)
+	} else {
+		v.resetTempl, err = template.New("reset").Parse(defaultResetTemplate)
+	}
+	if err != nil {
+		return err
+	}
+
+	if v.MaxRetries == 0 {
+		v.MaxRetries = maxRetries
+	}
+	if v.DefaultCountryCode != "" && !regexp.MustCompile(`^[1-9][0-9]{0,2}$`).MatchString(v.DefaultCountryCode) {
+		return errors.New("tel: invalid default_country_code")
+	}
+
+	if v.Sender == "" {
+		v.Sender = defaultSender
+	}
+	v.sender = senders[v.Sender]
+	if v.sender == nil {
+		return errors.New("tel: unknown sender '" + v.Sender + "'")
+	}
+	conf := v.Senders[v.Sender]
+	if conf == nil {
+		conf = json.RawMessage("{}")
+	}
+	return v.sender.Init(string(conf))
+}
+
+// Normalize converts the phone number to E.164 format: formatting characters are removed,
+// international prefix 00 is replaced with '+', numbers in national format get the default
+// country code. The result is not guaranteed to be valid.
+func (v *validator) Normalize(cred string) string {
+	phone := phoneFormatting.Replace(strings.TrimSpace(cred))
+	if strings.HasPrefix(phone, "+") {
+		return phone
+	}
+	if strings.HasPrefix(phone, "00") {
+		return "+" + phone[2:]
+	}
+	if v.DefaultCountryCode != "" && phone != "" {
+		// Drop trunk prefix of the national format.
+		return "+" + v.DefaultCountryCode + strings.TrimPrefix(phone, "0")
+	}
+	return phone
+}
+
+// PreCheck validates the credential and parameters without sending an SMS or making the call.
+// The number must be normalized.
+func (v *validator) PreCheck(cred string, params interface{}) error {
+	if !e164Regexp.MatchString(cred) {
+		return t.ErrMalformed
+	}
+	// Uniqueness is enforced when the credential is saved and confirmed.
 	return nil
 }
 
-// Send a request for confirmation to the user: makes a record in DB  and nothing else.
-func (validator) Request(user t.Uid, cred, lang string, params interface{}, resp string) error {
-	// TODO: actually send a validation SMS or make a call to the provided `cred` here.
+// Request sends an SMS with the confirmation code to the user and saves the code.
+func (v *validator) Request(user t.Uid, phone, lang string, params interface{}, resp string) error {
+	// Phone validator cannot accept an immmediate response.
+	if resp != "" {
+		return t.ErrFailed
+	}
+
+	if err := v.PreCheck(phone, params); err != nil {
+		return err
+	}
+
+	confirmed, pending, err := credentials(user)
+	if err != nil {
+		return err
+	}
+	if pending != nil {
+		// Replace the unconfirmed number. The confirmed one is kept until the new number is confirmed.
+		if err = store.Users.DelCred(user, "tel", pending.Value); err != nil {
+			return err
+		}
+	}
+	if confirmed != nil && confirmed.Value == phone {
+		// Already confirmed.
+		return nil
+	}
+
+	resp, err = generateCode()
+	if err != nil {
+		return err
+	}
+
+	body := new(bytes.Buffer)
+	if err = v.textTempl.Execute(body, map[string]interface{}{"Code": resp}); err != nil {
+		return err
+	}
+
+	// Save the code first: CredAdd fails if the number is already confirmed by another user.
+	if err = store.Users.SaveCred(&t.Credential{
+		User:   user.String(),
+		Method: "tel",
+		Value:  phone,
+		Resp:   resp,
+	}); err != nil {
+		return err
+	}
+
+	// Send SMS without blocking. Gateways may be slow.
+	go func() {
+		if err := v.sender.Send(phone, body.String()); err != nil {
+			log.Println("tel: failed to send SMS to", phone, err)
+		}
+	}()
+
 	return nil
 }
 
-// Find if user exists in the database, and if so return OK. Any response is accepted.
-func (validator) Check(user t.Uid, resp string) error {
-	// TODO: check response against a database.
+// Check checks the code sent to the user.
+func (v *validator) Check(user t.Uid, resp string) error {
+	confirmed, cred, err := credentials(user)
+	if err != nil {
+		return err
+	}
+
+	if cred == nil {
+		cred = confirmed
+	}
+	if cred == nil {
+		// Request to validate non-existent credential.
+		return t.ErrNotFound
+	}
+
+	if cred.Retries > v.MaxRetries {
+		return t.ErrPolicy
+	}
+	if resp == "" {
+		return t.ErrFailed
+	}
+
+	// Comparing with dummy response too.
+	if cred.Resp == resp || (v.DebugResponse != "" && v.DebugResponse == resp) {
+		if cred.Done {
+			return nil
+		}
+		// Valid response, save confirmation. Fails if another user has confirmed the number meanwhile.
+		if err = store.Users.ConfirmCred(user, "tel"); err != nil {
+			return err
+		}
+		// The new number replaces the previously confirmed one.
+		if confirmed != nil {
+			return store.Users.DelCred(user, "tel", confirmed.Value)
+		}
+		return nil
+	}
+
+	// Invalid response, increment fail counter.
+	store.Users.FailCred(user, "tel")
+
+	return t.ErrFailed
+}
+
+// ResetSecret sends an SMS with the code to reset the secret of the authentication scheme.
+func (v *validator) ResetSecret(phone, scheme, lang, code string) error {
+	body := new(bytes.Buffer)
+	if err := v.resetTempl.Execute(body, map[string]interface{}{"Code": code, "Scheme": scheme}); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := v.sender.Send(phone, body.String()); err != nil {
+			log.Println("tel: failed to send SMS to", phone, err)
+		}
+	}()
+
 	return nil
 }
 
 // Delete deletes user's records.
-func (validator) Delete(user t.Uid) error {
-	return nil
+func (v *validator) Delete(user t.Uid) error {
+	return store.Users.DelCred(user, "tel", "")
+}
+
+// credentials returns user's confirmed and pending phone numbers, if any.
+func credentials(user t.Uid) (confirmed, pending *t.Credential, err error) {
+	creds, err := store.Users.GetAllCred(user)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, cred := range creds {
+		if cred.Method != "tel" {
+			continue
+		}
+		if cred.Done {
+			confirmed = cred
+		} else {
+			pending = cred
+		}
+	}
+	return confirmed, pending, nil
+}
+
+// generateCode generates a random numeric string between 000000 and 999999.
+func generateCode() (string, error) {
+	num, err := rand.Int(rand.Reader, big.NewInt(maxCodeValue))
+	if err != nil {
+		return "", err
+	}
+	code := strconv.FormatInt(num.Int64(), 10)
+	return strings.Repeat("0", codeLength-len(code)) + code, nil
 }
 
 func init() {
-	store.RegisterValidator("tel", validator{})
+	store.RegisterValidator("tel", &validator{})
 }
@@ -0,0 +1,160 @@
+package tel
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/nanfengpo/chat/server/db/memory"
+	"github.com/nanfengpo/chat/server/store"
+	"github.com/nanfengpo/chat/server/store/types"
+)
+
+func TestNormalize(t *testing.T) {
+	v := &validator{DefaultCountryCode: "44"}
+	cases := map[string]string{
+		"+1 (650) 555-0100": "+16505550100",
+		"0049 30 1234567":   "+49301234567",
+		"020 7946 0018":     "+442079460018",
+		" +7.495.123.45.67": "+74951234567",
+	}
+	for in, want := range cases {
+		got := v.Normalize(in)
+		if got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+		if err := v.PreCheck(got, nil); err != nil {
+			t.Errorf("PreCheck(%q): %v", got, err)
+		}
+	}
+
+	for _, bad := range []string{"", "12345", "+0123456789", "+1234567890123456", "+1-800-FLOWERS", "16505550100"} {
+		if err := v.PreCheck(bad, nil); err == nil {
+			t.Errorf("PreCheck(%q) must fail", bad)
+		}
+	}
+
+	// Without the default country code national numbers are left unchanged and rejected.
+	v = &validator{}
+	if got := v.Normalize("020 7946 0018"); got != "02079460018" || v.PreCheck(got, nil) == nil {
+		t.Error("national number without country code must be rejected, got", got)
+	}
+}
+
+func TestGenerateCode(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		code, err := generateCode()
+		if err != nil || len(code) != codeLength || strings.Trim(code, "0123456789") != "" {
+			t.Fatal("invalid code", code, err)
+		}
+	}
+}
+
+func TestHTTPSender(t *testing.T) {
+	var got http.Header
+	var form map[string][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(wrt http.ResponseWriter, req *http.Request) {
+		got = req.Header
+		req.ParseForm()
+		form = req.PostForm
+		if req.PostForm.Get("dst") == "+15550000000" {
+			http.Error(wrt, "unreachable", http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	s := &httpSender{}
+	if err := s.Init(`{"url":"` + srv.URL + `","authorization":"Bearer xyz","from":"Chat","to_field":"dst"}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send("+16505550100", "Confirmation code: 012345"); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("Authorization") != "Bearer xyz" || form["dst"][0] != "+16505550100" ||
+		form["text"][0] != "Confirmation code: 012345" || form["from"][0] != "Chat" {
+		t.Error("unexpected request", got, form)
+	}
+	if err := s.Send("+15550000000", "x"); err == nil {
+		t.Error("gateway error must be reported")
+	}
+}
+
+func TestFileSender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "sms.log")
+	s := &fileSender{}
+	if err = s.Init(`{"path":"` + path + `"}`); err != nil {
+		t.Fatal(err)
+	}
+	s.Send("+16505550100", "Confirmation code: 012345")
+
+	data, _ := ioutil.ReadFile(path)
+	if !strings.HasSuffix(string(data), " +16505550100: Confirmation code: 012345\n") {
+		t.Error("unexpected file content", string(data))
+	}
+}
+
+type nopSender struct{}
+
+func (nopSender) Init(string) error          { return nil }
+func (nopSender) Send(to, text string) error { return nil }
+
+func TestReplaceNumber(t *testing.T) {
+	if err := memory.OpenTestStore(); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	v := &validator{
+		DebugResponse: "123456",
+		MaxRetries:    3,
+		textTempl:     template.Must(template.New("text").Parse("{{.Code}}")),
+		sender:        nopSender{},
+	}
+	uid := types.Uid(1001)
+	confirmed := func() string {
+		creds, _ := store.Users.GetAllCred(uid)
+		for _, cred := range creds {
+			if cred.Done {
+				return cred.Value
+			}
+		}
+		return ""
+	}
+
+	if err := v.Request(uid, "+16505550100", "", nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Check(uid, "123456"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The old number stays confirmed until the new one is.
+	if err := v.Request(uid, "+16505550101", "", nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Check(uid, "000000"); err != types.ErrFailed {
+		t.Fatal("wrong code: expected ErrFailed, got", err)
+	}
+	if got := confirmed(); got != "+16505550100" {
+		t.Fatal("old number must remain confirmed, got", got)
+	}
+
+	if err := v.Check(uid, "123456"); err != nil {
+		t.Fatal(err)
+	}
+	creds, _ := store.Users.GetAllCred(uid)
+	if len(creds) != 1 || creds[0].Value != "+16505550101" || !creds[0].Done {
+		t.Error("new number must replace the old one, got", creds)
+	}
+}
@@ -10,6 +10,10 @@ type Validator interface {
 	// Init initializes the validator.
 	Init(jsonconf string) error
 
+	// Normalize converts the credential to its canonical form, e.g. a phone number to E.164.
+	// The credential is normalized before any other calls.
+	Normalize(cred string) string
+
 	// PreCheck pre-validates the credential without sending an actual request for validation:
 	// check uniqueness (if appropriate), format, etc
 	PreCheck(cred string, params interface{}) error
@@ -25,6 +29,14 @@ type Validator interface {
 	// Check checks validity of user response.
 	Check(user t.Uid, resp string) error
 
+	// ResetSecret sends a one-time code for resetting the secret of the authentication scheme, such as
+	// a password, to the confirmed credential.
+	// 	cred: confirmed credential of the user, such as email or phone.
+	// 	scheme: authentication scheme being reset, like "basic".
+	// 	lang: user's human language as repored in the session.
+	// 	code: the code to send.
+	ResetSecret(cred, scheme, lang, code string) error
+
 	// Delete deletes user's records.
 	Delete(user t.Uid) error
 }
@@ -11,7 +11,10 @@ import (
 	"time"
 
 	jcr "github.com/DisposaBoy/JsonConfigReader"
+	"github.com/nanfengpo/chat/server/auth/basic"
+	_ "github.com/nanfengpo/chat/server/db/bolt"
 	_ "github.com/nanfengpo/chat/server/db/mysql"
+	_ "github.com/nanfengpo/chat/server/db/postgres"
 	_ "github.com/nanfengpo/chat/server/db/rethinkdb"
 	"github.com/nanfengpo/chat/server/store"
 )
@@ -149,9 +152,50 @@ func getPassword(n int) string {
 	return string(b)
 }
 
+// Upgrade the existing database to the current version or print the steps of the upgrade.
+func upgradeDb(dbSource string, dryRun bool) {
+	defer store.Close()
+
+	steps, err := store.UpgradeDb(dbSource, dryRun)
+	for _, step := range steps {
+		if dryRun {
+			log.Println("Planned:", step)
+		} else {
+			log.Println("Applied:", step)
+		}
+	}
+	if err != nil {
+		log.Fatal("Failed to upgrade DB: ", err)
+	}
+
+	if len(steps) == 0 {
+		log.Println("DB is up to date, nothing to upgrade")
+	} else if dryRun {
+		log.Println("Dry run, DB is NOT changed")
+	} else {
+		log.Println("Successfully upgraded", store.GetAdapterName())
+	}
+}
+
+// Clear failed login attempts of a login or of an IP address.
+func unlock(dbSource, subject string) {
+	if err := store.Open(1, dbSource); err != nil {
+		log.Fatal("Failed to open DB: ", err)
+	}
+	defer store.Close()
+
+	if err := basic.Unlock(subject); err != nil {
+		log.Fatal("Failed to unlock: ", err)
+	}
+	log.Println("Unlocked", subject)
+}
+
 func main() {
 	var reset = flag.Bool("reset", false, "first delete the database if one exists")
+	var upgrade = flag.Bool("upgrade", false, "upgrade the existing database to the current version keeping the data")
+	var dryRun = flag.Bool("dry-run", false, "with -upgrade print the steps of the upgrade without changing the database")
 	var datafile = flag.String("data", "", "name of file with sample data")
+	var unlockSubject = flag.String("unlock", "", "clear failed login attempts of a login or of 'ip:ADDRESS'")
 	var conffile = flag.String("config", "./nanfengpo.conf", "config of the database connection")
 	flag.Parse()
 
@@ -177,5 +221,18 @@ func main() {
 		log.Fatal("Failed to parse config file:", err)
 	}
 
+	if *upgrade {
+		if *reset || *datafile != "" {
+			log.Fatal("-upgrade cannot be combined with -reset or -data")
+		}
+		upgradeDb(string(config.StoreConfig), *dryRun)
+		return
+	}
+
+	if *unlockSubject != "" {
+		unlock(string(config.StoreConfig), *unlockSubject)
+		return
+	}
+
 	genDb(*reset, string(config.StoreConfig), &data)
 }